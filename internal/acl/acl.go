@@ -0,0 +1,366 @@
+package acl
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"go-proxy-server/internal/config"
+	"go-proxy-server/internal/security"
+)
+
+// Rule scopes
+const (
+	ScopeGroup = "group"
+	ScopeUser  = "user"
+)
+
+// Commands that can be restricted by AllowedCommands
+const (
+	CommandConnect = "CONNECT" // SOCKS5 CONNECT, HTTP CONNECT tunnels and plain HTTP forwarding
+	CommandBind    = "BIND"
+	CommandUDP     = "UDP"
+)
+
+// ErrDenied is returned (wrapped) when an access rule rejects a request
+var ErrDenied = errors.New("access denied")
+
+// Rule is the API representation of an access rule
+// Empty lists place no restriction; a nil BypassSSRF inherits the group setting
+type Rule struct {
+	Scope            string   `json:"scope"`
+	Subject          string   `json:"subject"`
+	AllowedDomains   []string `json:"allowedDomains"`
+	DeniedDomains    []string `json:"deniedDomains"`
+	AllowedCIDRs     []string `json:"allowedCIDRs"`
+	DeniedCIDRs      []string `json:"deniedCIDRs"`
+	AllowedPorts     []string `json:"allowedPorts"`
+	DeniedPorts      []string `json:"deniedPorts"`
+	AllowedListeners []string `json:"allowedListeners"`
+	AllowedCommands  []string `json:"allowedCommands"`
+	BypassSSRF       *bool    `json:"bypassSSRF"`
+}
+
+// Validate checks the scope, subject and all list entries of the rule
+func (r Rule) Validate() error {
+	if r.Scope != ScopeGroup && r.Scope != ScopeUser {
+		return fmt.Errorf("scope must be %q or %q", ScopeGroup, ScopeUser)
+	}
+	if strings.TrimSpace(r.Subject) == "" {
+		return fmt.Errorf("subject is required")
+	}
+	_, err := compile(r)
+	return err
+}
+
+// portRange is an inclusive range of destination ports
+type portRange struct {
+	from, to int
+}
+
+// Policy is the compiled, effective access policy of a user
+// A nil Policy allows everything and does not bypass SSRF protection
+type Policy struct {
+	allowedDomains   []string
+	deniedDomains    []string
+	allowedNets      []*net.IPNet
+	deniedNets       []*net.IPNet
+	allowedPorts     []portRange
+	deniedPorts      []portRange
+	allowedListeners map[string]bool
+	allowedCommands  map[string]bool
+	bypassSSRF       bool
+}
+
+// merge returns the group rule with every field set in the user rule overridden
+func merge(group, user Rule) Rule {
+	merged := group
+	if len(user.AllowedDomains) > 0 {
+		merged.AllowedDomains = user.AllowedDomains
+	}
+	if len(user.DeniedDomains) > 0 {
+		merged.DeniedDomains = user.DeniedDomains
+	}
+	if len(user.AllowedCIDRs) > 0 {
+		merged.AllowedCIDRs = user.AllowedCIDRs
+	}
+	if len(user.DeniedCIDRs) > 0 {
+		merged.DeniedCIDRs = user.DeniedCIDRs
+	}
+	if len(user.AllowedPorts) > 0 {
+		merged.AllowedPorts = user.AllowedPorts
+	}
+	if len(user.DeniedPorts) > 0 {
+		merged.DeniedPorts = user.DeniedPorts
+	}
+	if len(user.AllowedListeners) > 0 {
+		merged.AllowedListeners = user.AllowedListeners
+	}
+	if len(user.AllowedCommands) > 0 {
+		merged.AllowedCommands = user.AllowedCommands
+	}
+	if user.BypassSSRF != nil {
+		merged.BypassSSRF = user.BypassSSRF
+	}
+	return merged
+}
+
+// compile parses a rule into a policy
+func compile(r Rule) (*Policy, error) {
+	p := &Policy{}
+
+	var err error
+	if p.allowedDomains, err = parseDomains(r.AllowedDomains); err != nil {
+		return nil, err
+	}
+	if p.deniedDomains, err = parseDomains(r.DeniedDomains); err != nil {
+		return nil, err
+	}
+	if p.allowedNets, err = parseCIDRs(r.AllowedCIDRs); err != nil {
+		return nil, err
+	}
+	if p.deniedNets, err = parseCIDRs(r.DeniedCIDRs); err != nil {
+		return nil, err
+	}
+	if p.allowedPorts, err = parsePorts(r.AllowedPorts); err != nil {
+		return nil, err
+	}
+	if p.deniedPorts, err = parsePorts(r.DeniedPorts); err != nil {
+		return nil, err
+	}
+
+	if len(r.AllowedListeners) > 0 {
+		p.allowedListeners = make(map[string]bool, len(r.AllowedListeners))
+		for _, listener := range r.AllowedListeners {
+			listener = strings.ToLower(strings.TrimSpace(listener))
+			// Rules may name listeners that are created later, so only the name format is checked
+			if err := config.ValidateListenerName(listener); err != nil {
+				return nil, err
+			}
+			p.allowedListeners[listener] = true
+		}
+	}
+	if len(r.AllowedCommands) > 0 {
+		p.allowedCommands = make(map[string]bool, len(r.AllowedCommands))
+		for _, command := range r.AllowedCommands {
+			command = strings.ToUpper(strings.TrimSpace(command))
+			if command != CommandConnect && command != CommandBind && command != CommandUDP {
+				return nil, fmt.Errorf("unknown command %q", command)
+			}
+			p.allowedCommands[command] = true
+		}
+	}
+	if r.BypassSSRF != nil {
+		p.bypassSSRF = *r.BypassSSRF
+	}
+	return p, nil
+}
+
+// parseDomains normalizes domain patterns ("example.com" also matches its subdomains)
+func parseDomains(values []string) ([]string, error) {
+	domains := make([]string, 0, len(values))
+	for _, value := range values {
+		domain := strings.ToLower(strings.TrimSpace(value))
+		domain = strings.TrimPrefix(domain, "*.")
+		domain = strings.TrimSuffix(domain, ".")
+		if domain == "" {
+			continue
+		}
+		if strings.ContainsAny(domain, " /:") {
+			return nil, fmt.Errorf("invalid domain %q", value)
+		}
+		domains = append(domains, domain)
+	}
+	return domains, nil
+}
+
+// parseCIDRs parses networks; a plain IP address is treated as a single-host network
+func parseCIDRs(values []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(values))
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		if !strings.Contains(value, "/") {
+			ip := net.ParseIP(value)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid CIDR %q", value)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q", value)
+		}
+		nets = append(nets, network)
+	}
+	return nets, nil
+}
+
+// parsePorts parses ports and inclusive ranges such as "443" or "8000-9000"
+func parsePorts(values []string) ([]portRange, error) {
+	ranges := make([]portRange, 0, len(values))
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		fromStr, toStr, isRange := strings.Cut(value, "-")
+		if !isRange {
+			toStr = fromStr
+		}
+		from, err1 := strconv.Atoi(strings.TrimSpace(fromStr))
+		to, err2 := strconv.Atoi(strings.TrimSpace(toStr))
+		if err1 != nil || err2 != nil || from < 1 || to > 65535 || from > to {
+			return nil, fmt.Errorf("invalid port or port range %q", value)
+		}
+		ranges = append(ranges, portRange{from: from, to: to})
+	}
+	return ranges, nil
+}
+
+// matchDomain reports whether host equals or is a subdomain of any pattern
+func matchDomain(host string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if pattern == "*" || host == pattern || strings.HasSuffix(host, "."+pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchNet reports whether ip is in any network
+func matchNet(ip net.IP, nets []*net.IPNet) bool {
+	for _, network := range nets {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchPort reports whether port is in any range
+func matchPort(port int, ranges []portRange) bool {
+	for _, r := range ranges {
+		if port >= r.from && port <= r.to {
+			return true
+		}
+	}
+	return false
+}
+
+// BypassSSRF reports whether the policy allows access to private addresses
+func (p *Policy) BypassSSRF() bool {
+	return p != nil && p.bypassSSRF
+}
+
+// CheckListener checks whether the listener may be used
+func (p *Policy) CheckListener(listener string) error {
+	if p == nil || p.allowedListeners == nil || p.allowedListeners[listener] {
+		return nil
+	}
+	return fmt.Errorf("%w: listener %s not allowed", ErrDenied, listener)
+}
+
+// CheckCommand checks whether the command may be used
+func (p *Policy) CheckCommand(command string) error {
+	if p == nil || p.allowedCommands == nil || p.allowedCommands[command] {
+		return nil
+	}
+	return fmt.Errorf("%w: command %s not allowed", ErrDenied, command)
+}
+
+// CheckDestination checks a "host:port" destination against the destination rules
+// Hostnames are resolved when network rules must be applied to them
+func (p *Policy) CheckDestination(hostPort string) error {
+	if p == nil {
+		return nil
+	}
+
+	host, portStr, err := net.SplitHostPort(hostPort)
+	if err != nil {
+		return fmt.Errorf("%w: invalid destination", ErrDenied)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return fmt.Errorf("%w: invalid destination port", ErrDenied)
+	}
+
+	// Ports
+	if matchPort(port, p.deniedPorts) {
+		return fmt.Errorf("%w: port %d denied", ErrDenied, port)
+	}
+	if len(p.allowedPorts) > 0 && !matchPort(port, p.allowedPorts) {
+		return fmt.Errorf("%w: port %d not allowed", ErrDenied, port)
+	}
+
+	restrictAllow := len(p.allowedDomains) > 0 || len(p.allowedNets) > 0
+
+	// IP literal destinations are matched against networks only
+	if ip := net.ParseIP(host); ip != nil {
+		if matchNet(ip, p.deniedNets) {
+			return fmt.Errorf("%w: destination network denied", ErrDenied)
+		}
+		if restrictAllow && !matchNet(ip, p.allowedNets) {
+			return fmt.Errorf("%w: destination not allowed", ErrDenied)
+		}
+		return nil
+	}
+
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if matchDomain(host, p.deniedDomains) {
+		return fmt.Errorf("%w: destination domain denied", ErrDenied)
+	}
+
+	allowedByDomain := matchDomain(host, p.allowedDomains)
+	needNetCheck := len(p.deniedNets) > 0 || (restrictAllow && !allowedByDomain && len(p.allowedNets) > 0)
+	if needNetCheck {
+		ips, err := security.ResolveHost(host)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrDenied, err)
+		}
+		for _, ip := range ips {
+			if matchNet(ip, p.deniedNets) {
+				return fmt.Errorf("%w: destination network denied", ErrDenied)
+			}
+		}
+		if restrictAllow && !allowedByDomain {
+			for _, ip := range ips {
+				if !matchNet(ip, p.allowedNets) {
+					return fmt.Errorf("%w: destination not allowed", ErrDenied)
+				}
+			}
+			allowedByDomain = len(ips) > 0
+		}
+	}
+
+	if restrictAllow && !allowedByDomain {
+		return fmt.Errorf("%w: destination not allowed", ErrDenied)
+	}
+	return nil
+}
+
+// CheckConnectedIP checks the address actually connected to against the network rules
+// This closes the gap where a hostname resolves differently at dial time
+func (p *Policy) CheckConnectedIP(ip net.IP) error {
+	if p == nil {
+		return nil
+	}
+	if matchNet(ip, p.deniedNets) {
+		return fmt.Errorf("%w: destination network denied", ErrDenied)
+	}
+	// Networks are the only allow path when no domains are allowed
+	if len(p.allowedDomains) == 0 && len(p.allowedNets) > 0 && !matchNet(ip, p.allowedNets) {
+		return fmt.Errorf("%w: destination not allowed", ErrDenied)
+	}
+	return nil
+}
@@ -0,0 +1,301 @@
+package acl
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	"gorm.io/gorm"
+
+	"go-proxy-server/internal/logger"
+	"go-proxy-server/internal/models"
+)
+
+// Group is the API representation of a user group
+type Group struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Members     []string `json:"members"`
+}
+
+// snapshot holds the compiled policies, replaced atomically on reload
+type snapshot struct {
+	groupRules map[string]Rule
+	userRules  map[string]Rule
+	groups     map[string]*Policy    // Group rule only, by group name
+	users      map[string]userPolicy // User rule merged with the user's stored group, by username
+}
+
+// userPolicy is a user's compiled policy and the group it was merged with
+type userPolicy struct {
+	group  string
+	policy *Policy
+}
+
+var current atomic.Pointer[snapshot]
+
+func init() {
+	current.Store(&snapshot{
+		groupRules: make(map[string]Rule),
+		userRules:  make(map[string]Rule),
+		groups:     make(map[string]*Policy),
+		users:      make(map[string]userPolicy),
+	})
+}
+
+// PolicyFor returns the effective policy of a user in the given group (nil = unrestricted)
+// The group comes from the authentication backend, so externally authenticated users
+// receive their mapped group's rules; a user rule overrides the group rule field by field
+func PolicyFor(username, group string) *Policy {
+	snap := current.Load()
+	if up, ok := snap.users[username]; ok && up.group == group {
+		return up.policy
+	}
+	if userRule, ok := snap.userRules[username]; ok {
+		// External user, or authenticated into a different group than stored locally
+		return compileOrDeny("user "+username, merge(snap.groupRules[group], userRule))
+	}
+	return snap.groups[group]
+}
+
+// compileOrDeny compiles a rule, failing closed when it is invalid
+func compileOrDeny(subject string, rule Rule) *Policy {
+	policy, err := compile(rule)
+	if err != nil {
+		// Rules are validated on save, so this only happens with hand-edited data
+		// Fail closed instead of leaving the subject unrestricted
+		logger.Error("Invalid access rule for %s: %v", subject, err)
+		return &Policy{allowedListeners: map[string]bool{}}
+	}
+	return policy
+}
+
+// splitList splits a comma-separated list stored in the database
+func splitList(value string) []string {
+	if value == "" {
+		return nil
+	}
+	parts := strings.Split(value, ",")
+	result := make([]string, 0, len(parts))
+	for _, part := range parts {
+		if part = strings.TrimSpace(part); part != "" {
+			result = append(result, part)
+		}
+	}
+	return result
+}
+
+// joinList joins a list for storage in the database
+func joinList(values []string) string {
+	trimmed := make([]string, 0, len(values))
+	for _, value := range values {
+		if value = strings.TrimSpace(value); value != "" {
+			trimmed = append(trimmed, value)
+		}
+	}
+	return strings.Join(trimmed, ",")
+}
+
+// ruleFromModel converts a database row to a Rule
+func ruleFromModel(m models.AccessRule) Rule {
+	return Rule{
+		Scope:            m.Scope,
+		Subject:          m.Subject,
+		AllowedDomains:   splitList(m.AllowedDomains),
+		DeniedDomains:    splitList(m.DeniedDomains),
+		AllowedCIDRs:     splitList(m.AllowedCIDRs),
+		DeniedCIDRs:      splitList(m.DeniedCIDRs),
+		AllowedPorts:     splitList(m.AllowedPorts),
+		DeniedPorts:      splitList(m.DeniedPorts),
+		AllowedListeners: splitList(m.AllowedListeners),
+		AllowedCommands:  splitList(m.AllowedCommands),
+		BypassSSRF:       m.BypassSSRF,
+	}
+}
+
+// LoadFromDB loads groups, memberships and access rules and rebuilds the effective policies
+func LoadFromDB(db *gorm.DB) error {
+	var rows []models.AccessRule
+	if err := db.Find(&rows).Error; err != nil {
+		return fmt.Errorf("failed to load access rules: %w", err)
+	}
+	var users []models.User
+	if err := db.Select("username", "group_name").Find(&users).Error; err != nil {
+		return fmt.Errorf("failed to load user groups: %w", err)
+	}
+
+	groupRules := make(map[string]Rule)
+	userRules := make(map[string]Rule)
+	for _, row := range rows {
+		switch row.Scope {
+		case ScopeGroup:
+			groupRules[row.Subject] = ruleFromModel(row)
+		case ScopeUser:
+			userRules[row.Subject] = ruleFromModel(row)
+		}
+	}
+
+	snap := &snapshot{
+		groupRules: groupRules,
+		userRules:  userRules,
+		groups:     make(map[string]*Policy, len(groupRules)),
+		users:      make(map[string]userPolicy, len(userRules)),
+	}
+	for name, rule := range groupRules {
+		snap.groups[name] = compileOrDeny("group "+name, rule)
+	}
+	for _, user := range users {
+		if userRule, ok := userRules[user.Username]; ok {
+			snap.users[user.Username] = userPolicy{
+				group:  user.GroupName,
+				policy: compileOrDeny("user "+user.Username, merge(groupRules[user.GroupName], userRule)),
+			}
+		}
+	}
+	current.Store(snap)
+	return nil
+}
+
+// ListRules returns all stored access rules
+func ListRules(db *gorm.DB) ([]Rule, error) {
+	var rows []models.AccessRule
+	if err := db.Order("scope, subject").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	rules := make([]Rule, 0, len(rows))
+	for _, row := range rows {
+		rules = append(rules, ruleFromModel(row))
+	}
+	return rules, nil
+}
+
+// SetRule creates or replaces the access rule of a group or user
+func SetRule(db *gorm.DB, rule Rule) error {
+	if err := SaveRule(db, rule); err != nil {
+		return err
+	}
+	return LoadFromDB(db)
+}
+
+// SaveRule creates or replaces the access rule of a group or user without rebuilding the policies,
+// so several rules can be saved in one transaction; the caller reloads them with LoadFromDB
+func SaveRule(db *gorm.DB, rule Rule) error {
+	if err := rule.Validate(); err != nil {
+		return err
+	}
+
+	var existing models.AccessRule
+	err := db.Where("scope = ? AND subject = ?", rule.Scope, rule.Subject).First(&existing).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		existing = models.AccessRule{Scope: rule.Scope, Subject: rule.Subject}
+	} else if err != nil {
+		return err
+	}
+
+	existing.AllowedDomains = joinList(rule.AllowedDomains)
+	existing.DeniedDomains = joinList(rule.DeniedDomains)
+	existing.AllowedCIDRs = joinList(rule.AllowedCIDRs)
+	existing.DeniedCIDRs = joinList(rule.DeniedCIDRs)
+	existing.AllowedPorts = joinList(rule.AllowedPorts)
+	existing.DeniedPorts = joinList(rule.DeniedPorts)
+	existing.AllowedListeners = joinList(rule.AllowedListeners)
+	existing.AllowedCommands = joinList(rule.AllowedCommands)
+	existing.BypassSSRF = rule.BypassSSRF
+	return db.Save(&existing).Error
+}
+
+// DeleteRule removes the access rule of a group or user
+func DeleteRule(db *gorm.DB, scope, subject string) error {
+	if err := db.Unscoped().Where("scope = ? AND subject = ?", scope, subject).Delete(&models.AccessRule{}).Error; err != nil {
+		return err
+	}
+	return LoadFromDB(db)
+}
+
+// ListGroups returns all groups with their members
+func ListGroups(db *gorm.DB) ([]Group, error) {
+	var rows []models.UserGroup
+	if err := db.Order("name").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	var users []models.User
+	if err := db.Select("username", "group_name").Where("group_name <> ?", "").Order("username").Find(&users).Error; err != nil {
+		return nil, err
+	}
+
+	members := make(map[string][]string)
+	for _, user := range users {
+		members[user.GroupName] = append(members[user.GroupName], user.Username)
+	}
+
+	groups := make([]Group, 0, len(rows))
+	for _, row := range rows {
+		group := Group{Name: row.Name, Description: row.Description, Members: members[row.Name]}
+		if group.Members == nil {
+			group.Members = []string{}
+		}
+		groups = append(groups, group)
+	}
+	return groups, nil
+}
+
+// SaveGroup creates a group or updates its description
+func SaveGroup(db *gorm.DB, name, description string) error {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return fmt.Errorf("group name is required")
+	}
+
+	var existing models.UserGroup
+	err := db.Where("name = ?", name).First(&existing).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		existing = models.UserGroup{Name: name}
+	} else if err != nil {
+		return err
+	}
+	existing.Description = description
+	return db.Save(&existing).Error
+}
+
+// DeleteGroup removes a group, its access rule, its schedule assignment and all memberships
+func DeleteGroup(db *gorm.DB, name string) error {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("name = ?", name).Delete(&models.UserGroup{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("scope = ? AND subject = ?", ScopeGroup, name).Delete(&models.AccessRule{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("scope = ? AND subject = ?", ScopeGroup, name).Delete(&models.ScheduleAssignment{}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.User{}).Where("group_name = ?", name).Update("group_name", "").Error
+	})
+	if err != nil {
+		return err
+	}
+	return LoadFromDB(db)
+}
+
+// SetUserGroup assigns a user to a group (empty group removes the membership)
+func SetUserGroup(db *gorm.DB, username, group string) error {
+	if group != "" {
+		var count int64
+		if err := db.Model(&models.UserGroup{}).Where("name = ?", group).Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			return fmt.Errorf("group '%s' does not exist", group)
+		}
+	}
+
+	result := db.Model(&models.User{}).Where("username = ?", username).Update("group_name", group)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("user '%s' does not exist", username)
+	}
+	return LoadFromDB(db)
+}
@@ -0,0 +1,161 @@
+package admin
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"go-proxy-server/internal/auth"
+	"go-proxy-server/internal/models"
+)
+
+// ErrInvalidCredentials is returned for a wrong username or password
+var ErrInvalidCredentials = errors.New("invalid username or password")
+
+// Admin is the API representation of an admin account
+type Admin struct {
+	Username     string    `json:"username"`
+	Role         Role      `json:"role"`
+	TOTPEnabled  bool      `json:"totpEnabled"`
+	TOTPRequired bool      `json:"totpRequired"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+// usernamePattern restricts admin names to characters that are safe in logs and URLs
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9._@-]{1,64}$`)
+
+// validatePassword checks the admin password policy (stricter than for proxy users)
+func validatePassword(password string) error {
+	if len(password) < 10 {
+		return fmt.Errorf("password must be at least 10 characters long")
+	}
+	if len(password) > 128 {
+		return fmt.Errorf("password must not exceed 128 characters")
+	}
+	if !strings.ContainsAny(password, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ") {
+		return fmt.Errorf("password must contain at least one letter")
+	}
+	if !strings.ContainsAny(password, "0123456789") {
+		return fmt.Errorf("password must contain at least one digit")
+	}
+	return nil
+}
+
+// Count returns the number of admin accounts
+func Count(db *gorm.DB) (int64, error) {
+	var count int64
+	err := db.Model(&models.AdminUser{}).Count(&count).Error
+	return count, err
+}
+
+// List returns all admin accounts
+func List(db *gorm.DB) ([]Admin, error) {
+	var rows []models.AdminUser
+	if err := db.Order("username").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	admins := make([]Admin, 0, len(rows))
+	for _, row := range rows {
+		admins = append(admins, Admin{
+			Username:     row.Username,
+			Role:         roleOf(row),
+			TOTPEnabled:  row.TOTPEnabled,
+			TOTPRequired: row.TOTPRequired,
+			CreatedAt:    row.CreatedAt,
+		})
+	}
+	return admins, nil
+}
+
+// Create adds an admin account with a role
+func Create(db *gorm.DB, username, password string, role Role) error {
+	if !usernamePattern.MatchString(username) {
+		return fmt.Errorf("username must be 1-64 letters, digits or . _ @ -")
+	}
+	if _, ok := roleRanks[role]; !ok {
+		return fmt.Errorf("invalid role: %s", role)
+	}
+	if err := validatePassword(password); err != nil {
+		return err
+	}
+	hash, err := auth.HashPassword([]byte(password))
+	if err != nil {
+		return err
+	}
+
+	err = db.Create(&models.AdminUser{Username: username, Password: hash, Role: string(role)}).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return fmt.Errorf("admin '%s' already exists", username)
+		}
+		return err
+	}
+	return nil
+}
+
+// SetPassword changes an admin's password and ends all of the admin's sessions
+func SetPassword(db *gorm.DB, username, password string) error {
+	if err := validatePassword(password); err != nil {
+		return err
+	}
+	hash, err := auth.HashPassword([]byte(password))
+	if err != nil {
+		return err
+	}
+	result := db.Model(&models.AdminUser{}).Where("username = ?", username).Update("password", hash)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("admin '%s' does not exist", username)
+	}
+	return db.Unscoped().Where("username = ?", username).Delete(&models.AdminSession{}).Error
+}
+
+// Delete removes an admin account with its sessions, tokens and two-factor data
+// The last account with the admin role cannot be deleted, so the interface cannot be locked
+func Delete(db *gorm.DB, username string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		others, err := countOtherAdmins(tx, username)
+		if err != nil {
+			return err
+		}
+		result := tx.Unscoped().Where("username = ?", username).Delete(&models.AdminUser{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return fmt.Errorf("admin '%s' does not exist", username)
+		}
+		if others == 0 {
+			return fmt.Errorf("the last account with the admin role cannot be deleted")
+		}
+		for _, model := range []interface{}{&models.AdminSession{}, &models.AdminToken{}, &models.AdminRecoveryCode{}, &models.AdminTrustedDevice{}} {
+			if err := tx.Unscoped().Where("username = ?", username).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Verify checks an admin's password
+func Verify(db *gorm.DB, username, password string) error {
+	var user models.AdminUser
+	err := db.Where("username = ?", username).First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		// Spend the same time as for existing accounts
+		auth.VerifyPasswordHash(nil, []byte(password))
+		return ErrInvalidCredentials
+	} else if err != nil {
+		return err
+	}
+	if !auth.VerifyPasswordHash(user.Password, []byte(password)) {
+		return ErrInvalidCredentials
+	}
+	return nil
+}
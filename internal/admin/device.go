@@ -0,0 +1,108 @@
+package admin
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+
+	"go-proxy-server/internal/models"
+)
+
+// DeviceTrustDuration is how long a remembered browser may skip the TOTP code
+const DeviceTrustDuration = 30 * 24 * time.Hour
+
+// Maximum stored length of a device's user agent
+const maxUserAgentLength = 256
+
+// TrustedDevice is the API representation of a remembered browser
+type TrustedDevice struct {
+	ID         uint      `json:"id"`
+	ClientIP   string    `json:"clientIP"`
+	UserAgent  string    `json:"userAgent"`
+	CreatedAt  time.Time `json:"createdAt"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+	LastUsedAt time.Time `json:"lastUsedAt"`
+}
+
+// RememberDevice trusts a browser of an admin and returns the cookie value
+func RememberDevice(db *gorm.DB, username, clientIP, userAgent string) (string, error) {
+	token, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
+	}
+	now := time.Now()
+	row := models.AdminTrustedDevice{
+		Username:   username,
+		TokenHash:  hashToken(token),
+		ClientIP:   clientIP,
+		UserAgent:  userAgent,
+		ExpiresAt:  now.Add(DeviceTrustDuration),
+		LastUsedAt: now,
+	}
+	if err := db.Create(&row).Error; err != nil {
+		return "", err
+	}
+
+	// Drop devices that expired meanwhile
+	db.Unscoped().Where("expires_at < ?", now).Delete(&models.AdminTrustedDevice{})
+	return token, nil
+}
+
+// DeviceTrusted reports whether a remember-device cookie value belongs to the admin and is still valid
+func DeviceTrusted(db *gorm.DB, username, token string) bool {
+	if token == "" {
+		return false
+	}
+	var row models.AdminTrustedDevice
+	err := db.Where("token_hash = ? AND username = ?", hashToken(token), username).First(&row).Error
+	if err != nil {
+		return false
+	}
+	now := time.Now()
+	if now.After(row.ExpiresAt) {
+		db.Unscoped().Delete(&row)
+		return false
+	}
+	db.Model(&row).Update("last_used_at", now)
+	return true
+}
+
+// ListTrustedDevices returns the remembered browsers of an admin
+func ListTrustedDevices(db *gorm.DB, username string) ([]TrustedDevice, error) {
+	var rows []models.AdminTrustedDevice
+	if err := db.Where("username = ? AND expires_at > ?", username, time.Now()).Order("id").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	devices := make([]TrustedDevice, 0, len(rows))
+	for _, row := range rows {
+		devices = append(devices, TrustedDevice{
+			ID:         row.ID,
+			ClientIP:   row.ClientIP,
+			UserAgent:  row.UserAgent,
+			CreatedAt:  row.CreatedAt,
+			ExpiresAt:  row.ExpiresAt,
+			LastUsedAt: row.LastUsedAt,
+		})
+	}
+	return devices, nil
+}
+
+// ForgetDevice revokes a remembered browser of an admin (id 0 = all browsers)
+func ForgetDevice(db *gorm.DB, username string, id uint) error {
+	query := db.Unscoped().Where("username = ?", username)
+	if id != 0 {
+		query = query.Where("id = ?", id)
+	}
+	result := query.Delete(&models.AdminTrustedDevice{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if id != 0 && result.RowsAffected == 0 {
+		return fmt.Errorf("device %d does not exist", id)
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package admin
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+
+	"go-proxy-server/internal/models"
+)
+
+// Role grants an admin a set of permissions in the web management interface
+// Each role includes the permissions of the roles before it
+type Role string
+
+const (
+	// RoleViewer may read status, metrics and configuration
+	RoleViewer Role = "viewer"
+	// RoleOperator may additionally manage proxy users, access rules and proxy listeners
+	RoleOperator Role = "operator"
+	// RoleAdmin may additionally change system settings, authentication backends and admin accounts
+	RoleAdmin Role = "admin"
+)
+
+// roleRanks orders the roles by their permissions
+var roleRanks = map[Role]int{
+	RoleViewer:   1,
+	RoleOperator: 2,
+	RoleAdmin:    3,
+}
+
+// ParseRole validates a role name; an empty name is the admin role
+func ParseRole(name string) (Role, error) {
+	if name == "" {
+		return RoleAdmin, nil
+	}
+	role := Role(name)
+	if _, ok := roleRanks[role]; !ok {
+		return "", fmt.Errorf("role must be \"viewer\", \"operator\" or \"admin\"")
+	}
+	return role, nil
+}
+
+// Allows reports whether the role includes the permissions of the required role
+func (r Role) Allows(required Role) bool {
+	return roleRanks[r] >= roleRanks[required]
+}
+
+// roleOf returns the role stored for an admin (rows created before roles existed are admins)
+func roleOf(user models.AdminUser) Role {
+	if _, ok := roleRanks[Role(user.Role)]; !ok {
+		return RoleAdmin
+	}
+	return Role(user.Role)
+}
+
+// GetRole returns the role of an admin
+func GetRole(db *gorm.DB, username string) (Role, error) {
+	user, err := findAdmin(db, username)
+	if err != nil {
+		return "", err
+	}
+	return roleOf(*user), nil
+}
+
+// countOtherAdmins counts the accounts with the admin role other than username
+func countOtherAdmins(tx *gorm.DB, username string) (int64, error) {
+	var count int64
+	err := tx.Model(&models.AdminUser{}).
+		Where("username <> ? AND (role = ? OR role = '' OR role IS NULL)", username, RoleAdmin).
+		Count(&count).Error
+	return count, err
+}
+
+// SetRole changes the role of an admin
+// The last account with the admin role cannot be demoted, so admin accounts stay manageable
+func SetRole(db *gorm.DB, username string, role Role) error {
+	if _, ok := roleRanks[role]; !ok {
+		return fmt.Errorf("invalid role: %s", role)
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		user, err := findAdmin(tx, username)
+		if err != nil {
+			return err
+		}
+		if roleOf(*user) == RoleAdmin && role != RoleAdmin {
+			others, err := countOtherAdmins(tx, username)
+			if err != nil {
+				return err
+			}
+			if others == 0 {
+				return fmt.Errorf("the last account with the admin role cannot be demoted")
+			}
+		}
+		return tx.Model(user).Update("role", string(role)).Error
+	})
+}
@@ -0,0 +1,109 @@
+package admin
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+
+	"go-proxy-server/internal/models"
+)
+
+// Session lifetimes
+const (
+	// SessionIdleTimeout ends sessions without requests for this long
+	SessionIdleTimeout = 2 * time.Hour
+	// SessionMaxAge ends sessions this long after login regardless of activity
+	SessionMaxAge = 24 * time.Hour
+	// lastSeenResolution limits how often LastSeenAt is written
+	lastSeenResolution = time.Minute
+)
+
+// ErrSessionExpired is returned for unknown, expired or idle sessions
+var ErrSessionExpired = errors.New("session expired")
+
+// Session describes a logged-in admin
+type Session struct {
+	Username  string    `json:"username"`
+	CSRFToken string    `json:"csrfToken"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// randomToken returns a URL-safe random token with 32 bytes of entropy
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken returns the stored form of a session or API token
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateSession starts a session for an admin and returns the cookie value
+func CreateSession(db *gorm.DB, username, clientIP string) (string, *Session, error) {
+	token, err := randomToken()
+	if err != nil {
+		return "", nil, err
+	}
+	csrf, err := randomToken()
+	if err != nil {
+		return "", nil, err
+	}
+
+	now := time.Now()
+	row := models.AdminSession{
+		TokenHash:  hashToken(token),
+		Username:   username,
+		CSRFToken:  csrf,
+		ClientIP:   clientIP,
+		ExpiresAt:  now.Add(SessionMaxAge),
+		LastSeenAt: now,
+	}
+	if err := db.Create(&row).Error; err != nil {
+		return "", nil, err
+	}
+
+	// Drop sessions that ended meanwhile
+	db.Unscoped().Where("expires_at < ? OR last_seen_at < ?", now, now.Add(-SessionIdleTimeout)).Delete(&models.AdminSession{})
+
+	return token, &Session{Username: username, CSRFToken: csrf, ExpiresAt: row.ExpiresAt}, nil
+}
+
+// LookupSession returns the session of a cookie value and records the activity
+func LookupSession(db *gorm.DB, token string) (*Session, error) {
+	if token == "" {
+		return nil, ErrSessionExpired
+	}
+	var row models.AdminSession
+	err := db.Where("token_hash = ?", hashToken(token)).First(&row).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrSessionExpired
+	} else if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if now.After(row.ExpiresAt) || now.Sub(row.LastSeenAt) > SessionIdleTimeout {
+		db.Unscoped().Delete(&row)
+		return nil, ErrSessionExpired
+	}
+	if now.Sub(row.LastSeenAt) > lastSeenResolution {
+		db.Model(&row).Update("last_seen_at", now)
+	}
+	return &Session{Username: row.Username, CSRFToken: row.CSRFToken, ExpiresAt: row.ExpiresAt}, nil
+}
+
+// DeleteSession ends the session of a cookie value
+func DeleteSession(db *gorm.DB, token string) error {
+	return db.Unscoped().Where("token_hash = ?", hashToken(token)).Delete(&models.AdminSession{}).Error
+}
@@ -0,0 +1,121 @@
+package admin
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"go-proxy-server/internal/models"
+)
+
+// TokenPrefix marks API tokens so they are recognisable in configuration files and secret scanners
+const TokenPrefix = "gps_"
+
+// ErrInvalidToken is returned for unknown or expired API tokens
+var ErrInvalidToken = errors.New("invalid API token")
+
+// Token is the API representation of an API token (never includes the secret)
+type Token struct {
+	ID         uint       `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	ExpiresAt  *time.Time `json:"expiresAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+}
+
+// tokenFromModel converts a database row to a Token
+func tokenFromModel(row models.AdminToken) Token {
+	return Token{
+		ID:         row.ID,
+		Name:       row.Name,
+		Prefix:     row.Prefix,
+		CreatedAt:  row.CreatedAt,
+		ExpiresAt:  row.ExpiresAt,
+		LastUsedAt: row.LastUsedAt,
+	}
+}
+
+// CreateToken issues an API token for an admin (ttl 0 = never expires)
+// The returned secret is shown once; only its hash is stored
+func CreateToken(db *gorm.DB, username, name string, ttl time.Duration) (string, *Token, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > 64 {
+		return "", nil, fmt.Errorf("token name must be 1-64 characters")
+	}
+	if ttl < 0 {
+		return "", nil, fmt.Errorf("token lifetime must not be negative")
+	}
+	random, err := randomToken()
+	if err != nil {
+		return "", nil, err
+	}
+	secret := TokenPrefix + random
+
+	row := models.AdminToken{
+		Username:  username,
+		Name:      name,
+		TokenHash: hashToken(secret),
+		Prefix:    secret[:len(TokenPrefix)+6],
+	}
+	if ttl > 0 {
+		expires := time.Now().Add(ttl)
+		row.ExpiresAt = &expires
+	}
+	if err := db.Create(&row).Error; err != nil {
+		return "", nil, err
+	}
+	token := tokenFromModel(row)
+	return secret, &token, nil
+}
+
+// ListTokens returns the API tokens of an admin
+func ListTokens(db *gorm.DB, username string) ([]Token, error) {
+	var rows []models.AdminToken
+	if err := db.Where("username = ?", username).Order("id").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	tokens := make([]Token, 0, len(rows))
+	for _, row := range rows {
+		tokens = append(tokens, tokenFromModel(row))
+	}
+	return tokens, nil
+}
+
+// DeleteToken revokes an API token of an admin
+func DeleteToken(db *gorm.DB, username string, id uint) error {
+	result := db.Unscoped().Where("id = ? AND username = ?", id, username).Delete(&models.AdminToken{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("token %d does not exist", id)
+	}
+	return nil
+}
+
+// LookupToken returns the admin owning an API token and records its use
+func LookupToken(db *gorm.DB, secret string) (string, error) {
+	if !strings.HasPrefix(secret, TokenPrefix) {
+		return "", ErrInvalidToken
+	}
+	var row models.AdminToken
+	err := db.Where("token_hash = ?", hashToken(secret)).First(&row).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", ErrInvalidToken
+	} else if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	if row.ExpiresAt != nil && now.After(*row.ExpiresAt) {
+		return "", ErrInvalidToken
+	}
+	if row.LastUsedAt == nil || now.Sub(*row.LastUsedAt) > lastSeenResolution {
+		db.Model(&row).Update("last_used_at", now)
+	}
+	return row.Username, nil
+}
@@ -0,0 +1,305 @@
+package admin
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"go-proxy-server/internal/models"
+)
+
+// TOTP parameters (RFC 6238 defaults understood by all authenticator apps)
+const (
+	TOTPIssuer  = "go-proxy-server"
+	totpPeriod  = 30
+	totpDigits  = 6
+	totpSkew    = 1 // Accepted time steps before and after the current one
+	secretBytes = 20
+
+	// RecoveryCodeCount is the number of recovery codes issued at a time
+	RecoveryCodeCount = 10
+)
+
+// ErrInvalidCode is returned for a wrong, reused or expired TOTP or recovery code
+var ErrInvalidCode = errors.New("invalid verification code")
+
+// base32NoPadding is the secret encoding used in provisioning URIs
+var base32NoPadding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// TOTPStatus describes the two-factor authentication state of an admin
+type TOTPStatus struct {
+	Enabled                bool            `json:"enabled"`
+	Required               bool            `json:"required"`
+	RecoveryCodesRemaining int64           `json:"recoveryCodesRemaining"`
+	TrustedDevices         []TrustedDevice `json:"trustedDevices"`
+}
+
+// totpCode computes the code of a time step (HOTP of RFC 4226 with the step as counter)
+func totpCode(secret []byte, step int64) string {
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(step))
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000)
+}
+
+// matchTOTP returns the time step a code is valid for, or -1
+func matchTOTP(secret, code string, now time.Time) int64 {
+	key, err := base32NoPadding.DecodeString(strings.ToUpper(secret))
+	if err != nil || len(code) != totpDigits {
+		return -1
+	}
+	current := now.Unix() / totpPeriod
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if subtle.ConstantTimeCompare([]byte(totpCode(key, step)), []byte(code)) == 1 {
+			return step
+		}
+	}
+	return -1
+}
+
+// normalizeCode strips the separators users type into codes
+func normalizeCode(code string) string {
+	return strings.ToLower(strings.NewReplacer(" ", "", "-", "").Replace(strings.TrimSpace(code)))
+}
+
+// findAdmin loads an admin account
+func findAdmin(db *gorm.DB, username string) (*models.AdminUser, error) {
+	var user models.AdminUser
+	err := db.Where("username = ?", username).First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("admin '%s' does not exist", username)
+	}
+	return &user, err
+}
+
+// GetTOTPStatus returns the two-factor authentication state of an admin
+func GetTOTPStatus(db *gorm.DB, username string) (*TOTPStatus, error) {
+	user, err := findAdmin(db, username)
+	if err != nil {
+		return nil, err
+	}
+	status := &TOTPStatus{Enabled: user.TOTPEnabled, Required: user.TOTPRequired}
+	if err := db.Model(&models.AdminRecoveryCode{}).Where("username = ?", username).Count(&status.RecoveryCodesRemaining).Error; err != nil {
+		return nil, err
+	}
+	if status.TrustedDevices, err = ListTrustedDevices(db, username); err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+// TOTPEnabled reports whether an admin has to enter a TOTP code at login
+func TOTPEnabled(db *gorm.DB, username string) (bool, error) {
+	user, err := findAdmin(db, username)
+	if err != nil {
+		return false, err
+	}
+	return user.TOTPEnabled, nil
+}
+
+// EnrollmentRequired reports whether an admin must enrol TOTP before using the interface
+func EnrollmentRequired(db *gorm.DB, username string) (bool, error) {
+	user, err := findAdmin(db, username)
+	if err != nil {
+		return false, err
+	}
+	return user.TOTPRequired && !user.TOTPEnabled, nil
+}
+
+// BeginTOTPEnrollment generates a secret for an admin and returns it with the
+// otpauth:// provisioning URI shown as QR code; it takes effect once confirmed
+func BeginTOTPEnrollment(db *gorm.DB, username string) (string, string, error) {
+	user, err := findAdmin(db, username)
+	if err != nil {
+		return "", "", err
+	}
+	if user.TOTPEnabled {
+		return "", "", fmt.Errorf("two-factor authentication is already enabled")
+	}
+
+	key := make([]byte, secretBytes)
+	if _, err := rand.Read(key); err != nil {
+		return "", "", fmt.Errorf("failed to generate secret: %w", err)
+	}
+	secret := base32NoPadding.EncodeToString(key)
+	if err := db.Model(user).Update("totp_pending_secret", secret).Error; err != nil {
+		return "", "", err
+	}
+
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", TOTPIssuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", fmt.Sprint(totpDigits))
+	query.Set("period", fmt.Sprint(totpPeriod))
+	uri := url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + TOTPIssuer + ":" + username,
+		RawQuery: query.Encode(),
+	}
+	return secret, uri.String(), nil
+}
+
+// ActivateTOTP confirms the enrolment with a code from the authenticator and
+// returns the recovery codes, which are shown once
+func ActivateTOTP(db *gorm.DB, username, code string) ([]string, error) {
+	user, err := findAdmin(db, username)
+	if err != nil {
+		return nil, err
+	}
+	if user.TOTPEnabled {
+		return nil, fmt.Errorf("two-factor authentication is already enabled")
+	}
+	if user.TOTPPendingSecret == "" {
+		return nil, fmt.Errorf("no enrolment in progress")
+	}
+	step := matchTOTP(user.TOTPPendingSecret, normalizeCode(code), time.Now())
+	if step < 0 {
+		return nil, ErrInvalidCode
+	}
+
+	var codes []string
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(user).Updates(map[string]interface{}{
+			"totp_secret":         user.TOTPPendingSecret,
+			"totp_pending_secret": "",
+			"totp_enabled":        true,
+			"totp_last_step":      step,
+		}).Error; err != nil {
+			return err
+		}
+		codes, err = replaceRecoveryCodes(tx, username)
+		return err
+	})
+	return codes, err
+}
+
+// DisableTOTP removes an admin's authenticator, recovery codes and trusted devices
+// Used by admins turning 2FA off and to reset an admin who lost the authenticator
+func DisableTOTP(db *gorm.DB, username string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.AdminUser{}).Where("username = ?", username).Updates(map[string]interface{}{
+			"totp_secret":         "",
+			"totp_pending_secret": "",
+			"totp_enabled":        false,
+			"totp_last_step":      0,
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return fmt.Errorf("admin '%s' does not exist", username)
+		}
+		if err := tx.Unscoped().Where("username = ?", username).Delete(&models.AdminRecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Where("username = ?", username).Delete(&models.AdminTrustedDevice{}).Error
+	})
+}
+
+// SetTOTPRequired sets whether an admin must use two-factor authentication
+func SetTOTPRequired(db *gorm.DB, username string, required bool) error {
+	result := db.Model(&models.AdminUser{}).Where("username = ?", username).Update("totp_required", required)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("admin '%s' does not exist", username)
+	}
+	return nil
+}
+
+// VerifyTOTP checks a TOTP code of an admin; every code is accepted only once
+func VerifyTOTP(db *gorm.DB, username, code string) error {
+	user, err := findAdmin(db, username)
+	if err != nil {
+		return err
+	}
+	if !user.TOTPEnabled {
+		return ErrInvalidCode
+	}
+	step := matchTOTP(user.TOTPSecret, normalizeCode(code), time.Now())
+	if step < 0 || step <= user.TOTPLastStep {
+		return ErrInvalidCode
+	}
+	// Conditional update so concurrent logins cannot use the same code
+	result := db.Model(&models.AdminUser{}).
+		Where("username = ? AND totp_last_step < ?", username, step).
+		Update("totp_last_step", step)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvalidCode
+	}
+	return nil
+}
+
+// UseRecoveryCode consumes one of an admin's recovery codes
+func UseRecoveryCode(db *gorm.DB, username, code string) error {
+	code = normalizeCode(code)
+	if code == "" {
+		return ErrInvalidCode
+	}
+	result := db.Unscoped().Where("username = ? AND code_hash = ?", username, hashToken(code)).Delete(&models.AdminRecoveryCode{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvalidCode
+	}
+	return nil
+}
+
+// RegenerateRecoveryCodes replaces an admin's recovery codes
+func RegenerateRecoveryCodes(db *gorm.DB, username string) ([]string, error) {
+	enabled, err := TOTPEnabled(db, username)
+	if err != nil {
+		return nil, err
+	}
+	if !enabled {
+		return nil, fmt.Errorf("two-factor authentication is not enabled")
+	}
+	var codes []string
+	err = db.Transaction(func(tx *gorm.DB) error {
+		codes, err = replaceRecoveryCodes(tx, username)
+		return err
+	})
+	return codes, err
+}
+
+// replaceRecoveryCodes stores a new set of recovery codes formatted as xxxxx-xxxxx
+func replaceRecoveryCodes(tx *gorm.DB, username string) ([]string, error) {
+	if err := tx.Unscoped().Where("username = ?", username).Delete(&models.AdminRecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+	codes := make([]string, 0, RecoveryCodeCount)
+	for i := 0; i < RecoveryCodeCount; i++ {
+		raw := make([]byte, 7)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, fmt.Errorf("failed to generate recovery code: %w", err)
+		}
+		code := strings.ToLower(base32NoPadding.EncodeToString(raw))[:10]
+		if err := tx.Create(&models.AdminRecoveryCode{Username: username, CodeHash: hashToken(code)}).Error; err != nil {
+			return nil, err
+		}
+		codes = append(codes, code[:5]+"-"+code[5:])
+	}
+	return codes, nil
+}
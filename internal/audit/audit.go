@@ -0,0 +1,210 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+
+	"go-proxy-server/internal/models"
+)
+
+// Page size limits of Query
+const (
+	DefaultPageSize = 50
+	MaxPageSize     = 500
+)
+
+// Change is a changed field of an audited object, addressed by its dotted JSON path
+type Change struct {
+	Field  string      `json:"field"`
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// Entry is the API representation of an audit log entry
+type Entry struct {
+	ID        uint      `json:"id"`
+	Timestamp time.Time `json:"timestamp"`
+	Actor     string    `json:"actor"`
+	SourceIP  string    `json:"sourceIP"`
+	Method    string    `json:"method"`
+	Endpoint  string    `json:"endpoint"`
+	Status    int       `json:"status"`
+	Changes   []Change  `json:"changes"`
+}
+
+// Filter selects audit log entries; empty fields match everything
+type Filter struct {
+	Actor    string
+	SourceIP string
+	Endpoint string
+	Since    time.Time
+	Until    time.Time
+	Page     int // 1-based
+	PageSize int
+}
+
+// Result is a page of audit log entries
+type Result struct {
+	Entries  []Entry `json:"entries"`
+	Total    int64   `json:"total"`
+	Page     int     `json:"page"`
+	PageSize int     `json:"pageSize"`
+}
+
+// Record appends an entry to the audit log
+func Record(db *gorm.DB, entry Entry) error {
+	if entry.Changes == nil {
+		entry.Changes = []Change{}
+	}
+	changes, err := json.Marshal(entry.Changes)
+	if err != nil {
+		return fmt.Errorf("failed to encode changes: %w", err)
+	}
+	if entry.Timestamp.IsZero() {
+		entry.Timestamp = time.Now()
+	}
+	return db.Create(&models.AuditLog{
+		Timestamp: entry.Timestamp,
+		Actor:     entry.Actor,
+		SourceIP:  entry.SourceIP,
+		Method:    entry.Method,
+		Endpoint:  entry.Endpoint,
+		Status:    entry.Status,
+		Changes:   string(changes),
+	}).Error
+}
+
+// Query returns a page of audit log entries matching a filter, newest first
+func Query(db *gorm.DB, filter Filter) (*Result, error) {
+	if filter.Page < 1 {
+		filter.Page = 1
+	}
+	if filter.PageSize < 1 {
+		filter.PageSize = DefaultPageSize
+	}
+	if filter.PageSize > MaxPageSize {
+		filter.PageSize = MaxPageSize
+	}
+
+	query := db.Model(&models.AuditLog{})
+	if filter.Actor != "" {
+		query = query.Where("actor = ?", filter.Actor)
+	}
+	if filter.SourceIP != "" {
+		query = query.Where("source_ip = ?", filter.SourceIP)
+	}
+	if filter.Endpoint != "" {
+		query = query.Where("endpoint = ?", filter.Endpoint)
+	}
+	if !filter.Since.IsZero() {
+		query = query.Where("timestamp >= ?", filter.Since)
+	}
+	if !filter.Until.IsZero() {
+		query = query.Where("timestamp <= ?", filter.Until)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, err
+	}
+	var rows []models.AuditLog
+	err := query.Order("timestamp DESC, id DESC").
+		Offset((filter.Page - 1) * filter.PageSize).
+		Limit(filter.PageSize).
+		Find(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]Entry, 0, len(rows))
+	for _, row := range rows {
+		entry := Entry{
+			ID:        row.ID,
+			Timestamp: row.Timestamp,
+			Actor:     row.Actor,
+			SourceIP:  row.SourceIP,
+			Method:    row.Method,
+			Endpoint:  row.Endpoint,
+			Status:    row.Status,
+			Changes:   []Change{},
+		}
+		if row.Changes != "" {
+			json.Unmarshal([]byte(row.Changes), &entry.Changes)
+		}
+		entries = append(entries, entry)
+	}
+	return &Result{Entries: entries, Total: total, Page: filter.Page, PageSize: filter.PageSize}, nil
+}
+
+// Diff compares the JSON representations of an object before and after a change
+// Objects are compared field by field; arrays and scalar values are compared as a whole
+func Diff(before, after interface{}) ([]Change, error) {
+	beforeFields, err := flatten(before)
+	if err != nil {
+		return nil, err
+	}
+	afterFields, err := flatten(after)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := make(map[string]bool, len(beforeFields)+len(afterFields))
+	for field := range beforeFields {
+		fields[field] = true
+	}
+	for field := range afterFields {
+		fields[field] = true
+	}
+	names := make([]string, 0, len(fields))
+	for field := range fields {
+		names = append(names, field)
+	}
+	sort.Strings(names)
+
+	changes := make([]Change, 0)
+	for _, field := range names {
+		oldValue, newValue := beforeFields[field], afterFields[field]
+		if !reflect.DeepEqual(oldValue, newValue) {
+			changes = append(changes, Change{Field: field, Before: oldValue, After: newValue})
+		}
+	}
+	return changes, nil
+}
+
+// flatten maps the dotted JSON path of every non-object value of v to the value
+func flatten(v interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var decoded interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return nil, err
+	}
+	fields := make(map[string]interface{})
+	flattenInto(fields, "", decoded)
+	return fields, nil
+}
+
+// flattenInto adds the values below prefix to fields
+func flattenInto(fields map[string]interface{}, prefix string, v interface{}) {
+	object, ok := v.(map[string]interface{})
+	if !ok {
+		if v != nil {
+			fields[prefix] = v
+		}
+		return
+	}
+	for key, value := range object {
+		path := key
+		if prefix != "" {
+			path = prefix + "." + key
+		}
+		flattenInto(fields, path, value)
+	}
+}
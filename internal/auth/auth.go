@@ -48,6 +48,20 @@ func HashPassword(password []byte) ([]byte, error) {
 	return hashPasswordWithSalt(password, salt), nil
 }
 
+// IsPasswordHash reports whether a value has the format created by HashPassword
+func IsPasswordHash(value string) bool {
+	parts := strings.Split(value, "$")
+	if len(parts) != 4 || parts[0] != "" || parts[1] != "sha256" {
+		return false
+	}
+	salt, err := hex.DecodeString(parts[2])
+	if err != nil || len(salt) == 0 {
+		return false
+	}
+	hash, err := hex.DecodeString(parts[3])
+	return err == nil && len(hash) == sha256.Size
+}
+
 // VerifyCredentials verifies username and password against stored credentials
 // Uses constant-time comparison to prevent timing attacks
 func VerifyCredentials(username string, password []byte) error {
@@ -71,6 +85,16 @@ func VerifyCredentials(username string, password []byte) error {
 	return nil
 }
 
+// VerifyPasswordHash verifies a password against a hash created by HashPassword
+// A nil hash is compared against a dummy hash so unknown accounts take the same time
+func VerifyPasswordHash(storedHash, password []byte) bool {
+	if storedHash == nil {
+		verifyHash(dummyHash, password)
+		return false
+	}
+	return verifyHash(storedHash, password)
+}
+
 // verifyHash verifies password against stored hash
 // Returns true if password matches, false otherwise
 // Uses constant-time comparison to prevent timing attacks
@@ -0,0 +1,192 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"go-proxy-server/internal/config"
+	"go-proxy-server/internal/constants"
+	"go-proxy-server/internal/logger"
+)
+
+// Authentication errors; backends wrap them so the chain can decide whether to fall back
+var (
+	// ErrInvalidCredentials means the backend knows the user but rejected the password
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	// ErrUnknownUser means the backend does not know the user
+	ErrUnknownUser = errors.New("unknown user")
+	// ErrBackendUnavailable means the backend could not be reached or failed
+	ErrBackendUnavailable = errors.New("authentication backend unavailable")
+)
+
+// Result describes an authenticated user
+type Result struct {
+	Username string // Name the user is accounted under
+	Group    string // Proxy user group (empty = none)
+	Backend  string // Name of the backend that authenticated the user
+
+	// Session attributes granted by the backend (zero = no restriction from the backend)
+	SessionTimeout time.Duration // Maximum session duration
+	UploadRate     int64         // Upload bandwidth in bytes per second
+	DownloadRate   int64         // Download bandwidth in bytes per second
+	EgressIP       string        // Local address outbound connections are bound to
+
+	// RADIUS accounting state carried from the Access-Accept
+	radius          *RADIUSAuthenticator
+	radiusClass     [][]byte
+	interimInterval time.Duration
+}
+
+// Request describes a login attempt
+type Request struct {
+	Username    string
+	Password    []byte
+	ClientIP    string // Address of the proxy client
+	Listener    string // Name of the listener that accepted the connection
+	Destination string // Requested host:port (empty when not known yet, e.g. SOCKS5)
+}
+
+// Authenticator verifies a username and password
+type Authenticator interface {
+	// Name returns the backend name used in configuration and logs
+	Name() string
+	// Authenticate returns the result on success or an error wrapping one of the errors above
+	Authenticate(req *Request) (*Result, error)
+}
+
+// localAuthenticator verifies users stored in the database
+type localAuthenticator struct{}
+
+// Name returns the backend name
+func (localAuthenticator) Name() string {
+	return config.AuthBackendLocal
+}
+
+// Authenticate verifies the password against the local credentials map
+func (localAuthenticator) Authenticate(req *Request) (*Result, error) {
+	username := req.Username
+	if err := VerifyCredentials(username, req.Password); err != nil {
+		if _, ok := getCredentials()[username]; !ok {
+			return nil, ErrUnknownUser
+		}
+		return nil, ErrInvalidCredentials
+	}
+	return &Result{Username: username, Group: getLocalGroup(username), Backend: config.AuthBackendLocal}, nil
+}
+
+// Chain tries authenticators in order according to the fallback policy
+type Chain struct {
+	backends []Authenticator
+	fallback string
+}
+
+// NewChain creates an authenticator chain
+func NewChain(fallback string, backends ...Authenticator) *Chain {
+	return &Chain{backends: backends, fallback: fallback}
+}
+
+// Name returns the backend name
+func (c *Chain) Name() string {
+	return "chain"
+}
+
+// Authenticate tries each backend until one accepts the user or the fallback policy stops the chain
+func (c *Chain) Authenticate(req *Request) (*Result, error) {
+	err := ErrUnknownUser
+	for _, backend := range c.backends {
+		var result *Result
+		result, err = backend.Authenticate(req)
+		if err == nil {
+			return result, nil
+		}
+		if errors.Is(err, ErrBackendUnavailable) {
+			logger.Warn("Authentication backend %s unavailable: %v", backend.Name(), err)
+			continue
+		}
+		if errors.Is(err, ErrUnknownUser) {
+			continue
+		}
+		// Rejected password: only continue when configured to
+		if c.fallback != config.AuthFallbackAny {
+			return nil, err
+		}
+	}
+	return nil, err
+}
+
+// Active authenticator chain, replaced atomically when the configuration changes
+var activeChain atomic.Pointer[Chain]
+
+func init() {
+	activeChain.Store(NewChain(config.AuthFallbackUnavailable, localAuthenticator{}))
+}
+
+// ConfigureBackends builds the authenticator chain from the authentication configuration
+func ConfigureBackends(cfg config.AuthConfig) error {
+	backends := make([]Authenticator, 0, len(cfg.Backends))
+	for _, name := range cfg.Backends {
+		switch name {
+		case config.AuthBackendLocal:
+			backends = append(backends, localAuthenticator{})
+		case config.AuthBackendLDAP:
+			backends = append(backends, NewLDAPAuthenticator(cfg.LDAP))
+		case config.AuthBackendRADIUS:
+			backends = append(backends, NewRADIUSAuthenticator(cfg.RADIUS))
+		case config.AuthBackendWebhook:
+			backends = append(backends, NewWebhookAuthenticator(cfg.Webhook))
+		default:
+			return fmt.Errorf("unknown authentication backend %q", name)
+		}
+	}
+	if len(backends) == 0 {
+		return fmt.Errorf("at least one authentication backend is required")
+	}
+	activeChain.Store(NewChain(cfg.Fallback, backends...))
+	return nil
+}
+
+// UsesDestination reports whether a configured backend may decide by the requested destination,
+// in which case a client changing destinations must be authenticated again
+func UsesDestination() bool {
+	for _, backend := range activeChain.Load().backends {
+		if _, ok := backend.(*WebhookAuthenticator); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Set once the goroutine sweeping expired cache entries runs
+var authCacheCleanupStarted atomic.Bool
+
+// startAuthCacheCleanup starts the sweep of expired cache entries when a backend first caches a login
+func startAuthCacheCleanup() {
+	if authCacheCleanupStarted.CompareAndSwap(false, true) {
+		go cleanupAuthCaches()
+	}
+}
+
+// cleanupAuthCaches periodically removes expired entries from the caches of the active backends
+// A single goroutine serves every backend, since the chain is rebuilt whenever the configuration changes
+func cleanupAuthCaches() {
+	ticker := time.NewTicker(constants.AuthCacheCleanupInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		for _, backend := range activeChain.Load().backends {
+			switch backend := backend.(type) {
+			case *LDAPAuthenticator:
+				backend.cache.CleanExpired()
+			case *WebhookAuthenticator:
+				backend.cache.CleanExpired()
+			}
+		}
+	}
+}
+
+// Authenticate verifies proxy credentials with the configured backends
+func Authenticate(req *Request) (*Result, error) {
+	return activeChain.Load().Authenticate(req)
+}
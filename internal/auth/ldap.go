@@ -0,0 +1,279 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+
+	"go-proxy-server/internal/cache"
+	"go-proxy-server/internal/config"
+	"go-proxy-server/internal/constants"
+)
+
+// ldapConn is the subset of *ldap.Conn used by the LDAP backend
+// It allows an in-process LDAP stand-in to replace real servers
+type ldapConn interface {
+	Bind(username, password string) error
+	Search(request *ldap.SearchRequest) (*ldap.SearchResult, error)
+	StartTLS(config *tls.Config) error
+	Close() error
+}
+
+// ldapDialFunc opens a connection to an LDAP server URL
+type ldapDialFunc func(serverURL string, cfg config.LDAPConfig) (ldapConn, error)
+
+// ldapCacheEntry is a cached successful login
+type ldapCacheEntry struct {
+	passwordHash [sha256.Size]byte
+	result       Result
+}
+
+// LDAPAuthenticator authenticates users against LDAP / Active Directory servers
+type LDAPAuthenticator struct {
+	cfg  config.LDAPConfig
+	dial ldapDialFunc
+
+	// Successful logins cached by username; passwords are stored as salted hashes
+	// and the LRU bounds the memory they take
+	cache     *cache.ShardedLRU
+	cacheSalt []byte
+}
+
+// NewLDAPAuthenticator creates an LDAP backend connecting to the configured servers
+func NewLDAPAuthenticator(cfg config.LDAPConfig) *LDAPAuthenticator {
+	return newLDAPAuthenticator(cfg, dialLDAP)
+}
+
+// newLDAPAuthenticator creates an LDAP backend with a custom dialer
+func newLDAPAuthenticator(cfg config.LDAPConfig, dial ldapDialFunc) *LDAPAuthenticator {
+	salt := make([]byte, 32)
+	rand.Read(salt)
+	return &LDAPAuthenticator{
+		cfg:       cfg,
+		dial:      dial,
+		cache:     cache.NewShardedLRU(constants.LDAPCacheMaxSize, 16),
+		cacheSalt: salt,
+	}
+}
+
+// dialLDAP connects to an LDAP server, upgrading with StartTLS when configured
+func dialLDAP(serverURL string, cfg config.LDAPConfig) (ldapConn, error) {
+	timeout := time.Duration(cfg.Timeout) * time.Second
+	u, err := url.Parse(serverURL)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig := &tls.Config{
+		ServerName:         u.Hostname(),
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+		MinVersion:         tls.VersionTLS12,
+	}
+
+	conn, err := ldap.DialURL(serverURL,
+		ldap.DialWithDialer(&net.Dialer{Timeout: timeout}),
+		ldap.DialWithTLSConfig(tlsConfig))
+	if err != nil {
+		return nil, err
+	}
+	conn.SetTimeout(timeout)
+
+	if cfg.StartTLS && u.Scheme == "ldap" {
+		if err := conn.StartTLS(tlsConfig); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("StartTLS failed: %w", err)
+		}
+	}
+	return conn, nil
+}
+
+// Name returns the backend name
+func (a *LDAPAuthenticator) Name() string {
+	return config.AuthBackendLDAP
+}
+
+// Authenticate verifies the user against the first reachable server
+func (a *LDAPAuthenticator) Authenticate(req *Request) (*Result, error) {
+	username, password := req.Username, req.Password
+	// An empty password would be an unauthenticated bind, which most servers accept
+	if len(password) == 0 || username == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	hash := a.hashPassword(password)
+	if result, ok := a.cached(username, hash); ok {
+		return result, nil
+	}
+
+	var lastErr error
+	for _, server := range a.cfg.Servers {
+		result, err := a.authenticateWith(server, username, string(password))
+		if err == nil {
+			a.store(username, hash, result)
+			return result, nil
+		}
+		if !errors.Is(err, ErrBackendUnavailable) {
+			// The server answered: its decision is final
+			return nil, err
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// authenticateWith authenticates against a single server
+func (a *LDAPAuthenticator) authenticateWith(server, username, password string) (*Result, error) {
+	conn, err := a.dial(server, a.cfg)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrBackendUnavailable, server, err)
+	}
+	defer conn.Close()
+
+	var userDN string
+	if a.cfg.UserDNTemplate != "" {
+		// Simple bind: the DN is derived from the username
+		userDN = fmt.Sprintf(a.cfg.UserDNTemplate, ldap.EscapeDN(username))
+	} else {
+		// Search-then-bind: find the user's DN with the service account
+		if a.cfg.BindDN != "" {
+			if err := conn.Bind(a.cfg.BindDN, a.cfg.BindPassword); err != nil {
+				return nil, fmt.Errorf("%w: service account bind failed: %v", ErrBackendUnavailable, err)
+			}
+		}
+		entry, err := a.searchUser(conn, username)
+		if err != nil {
+			return nil, err
+		}
+		userDN = entry.DN
+	}
+
+	if err := conn.Bind(userDN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, fmt.Errorf("%w: %v", ErrBackendUnavailable, err)
+	}
+
+	groups, err := a.userGroups(conn, username, userDN)
+	if err != nil {
+		return nil, err
+	}
+	group := a.mapGroup(groups)
+	if group == "" && a.cfg.RequireGroup {
+		return nil, fmt.Errorf("%w: user is not in a mapped group", ErrInvalidCredentials)
+	}
+
+	return &Result{Username: username, Group: group, Backend: config.AuthBackendLDAP}, nil
+}
+
+// searchUser finds exactly one entry for the username below BaseDN
+func (a *LDAPAuthenticator) searchUser(conn ldapConn, username string) (*ldap.Entry, error) {
+	request := ldap.NewSearchRequest(
+		a.cfg.BaseDN,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, a.cfg.Timeout, false,
+		fmt.Sprintf(a.cfg.UserFilter, ldap.EscapeFilter(username)),
+		[]string{"dn"},
+		nil,
+	)
+	result, err := conn.Search(request)
+	if err != nil {
+		return nil, fmt.Errorf("%w: user search failed: %v", ErrBackendUnavailable, err)
+	}
+	switch len(result.Entries) {
+	case 0:
+		return nil, ErrUnknownUser
+	case 1:
+		return result.Entries[0], nil
+	default:
+		return nil, fmt.Errorf("%w: username matches multiple entries", ErrInvalidCredentials)
+	}
+}
+
+// userGroups reads the group attribute of the bound user's entry
+func (a *LDAPAuthenticator) userGroups(conn ldapConn, username, userDN string) ([]string, error) {
+	if len(a.cfg.GroupMappings) == 0 || a.cfg.GroupAttribute == "" {
+		return nil, nil
+	}
+
+	// Active Directory UPN templates ("%s@domain") are not DNs, so look the entry up instead
+	base, scope, filter := userDN, ldap.ScopeBaseObject, "(objectClass=*)"
+	if !strings.Contains(userDN, "=") {
+		if a.cfg.BaseDN == "" || a.cfg.UserFilter == "" {
+			return nil, nil
+		}
+		base, scope = a.cfg.BaseDN, ldap.ScopeWholeSubtree
+		filter = fmt.Sprintf(a.cfg.UserFilter, ldap.EscapeFilter(username))
+	}
+
+	request := ldap.NewSearchRequest(
+		base, scope, ldap.NeverDerefAliases, 1, a.cfg.Timeout, false,
+		filter, []string{a.cfg.GroupAttribute}, nil,
+	)
+	result, err := conn.Search(request)
+	if err != nil {
+		return nil, fmt.Errorf("%w: group lookup failed: %v", ErrBackendUnavailable, err)
+	}
+	if len(result.Entries) == 0 {
+		return nil, nil
+	}
+	return result.Entries[0].GetAttributeValues(a.cfg.GroupAttribute), nil
+}
+
+// mapGroup returns the proxy group of the first mapping matching one of the LDAP groups
+func (a *LDAPAuthenticator) mapGroup(groups []string) string {
+	for _, mapping := range a.cfg.GroupMappings {
+		for _, group := range groups {
+			if strings.EqualFold(group, mapping.LDAPGroup) {
+				return mapping.ProxyGroup
+			}
+		}
+	}
+	return ""
+}
+
+// hashPassword hashes a password with the per-process cache salt
+func (a *LDAPAuthenticator) hashPassword(password []byte) [sha256.Size]byte {
+	h := sha256.New()
+	h.Write(a.cacheSalt)
+	h.Write(password)
+	var sum [sha256.Size]byte
+	copy(sum[:], h.Sum(nil))
+	return sum
+}
+
+// cached returns a cached login if the password matches and the entry has not expired
+func (a *LDAPAuthenticator) cached(username string, hash [sha256.Size]byte) (*Result, bool) {
+	if a.cfg.CacheTTL <= 0 {
+		return nil, false
+	}
+	cached, ok := a.cache.Get(username)
+	if !ok {
+		return nil, false
+	}
+	entry := cached.Value.(ldapCacheEntry)
+	if subtle.ConstantTimeCompare(entry.passwordHash[:], hash[:]) != 1 {
+		return nil, false
+	}
+	result := entry.result
+	return &result, true
+}
+
+// store caches a successful login; expired logins are swept periodically
+func (a *LDAPAuthenticator) store(username string, hash [sha256.Size]byte, result *Result) {
+	if a.cfg.CacheTTL <= 0 {
+		return
+	}
+	startAuthCacheCleanup()
+	a.cache.Put(username, cache.Entry{
+		Value:     ldapCacheEntry{passwordHash: hash, result: *result},
+		ExpiresAt: time.Now().Add(time.Duration(a.cfg.CacheTTL) * time.Second),
+	})
+}
@@ -0,0 +1,235 @@
+package auth
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+
+	"go-proxy-server/internal/config"
+)
+
+// fakeLDAPEntry is a user in the in-process directory
+type fakeLDAPEntry struct {
+	dn       string
+	password string
+	groups   []string
+}
+
+// fakeLDAPDirectory is an in-process LDAP stand-in
+type fakeLDAPDirectory struct {
+	serviceDN, servicePassword string
+	userFilter                 string // Filter template the users are found with
+	users                      map[string]fakeLDAPEntry
+	dials                      int
+}
+
+func newFakeLDAPDirectory() *fakeLDAPDirectory {
+	return &fakeLDAPDirectory{
+		serviceDN:       "cn=proxy,dc=example,dc=com",
+		servicePassword: "service-secret",
+		userFilter:      "(uid=%s)",
+		users: map[string]fakeLDAPEntry{
+			"alice": {dn: "uid=alice,ou=people,dc=example,dc=com", password: "alice-pass", groups: []string{"cn=staff,dc=example,dc=com"}},
+			"bob":   {dn: "uid=bob,ou=people,dc=example,dc=com", password: "bob-pass"},
+		},
+	}
+}
+
+// fakeLDAPConn is a connection to a fakeLDAPDirectory
+type fakeLDAPConn struct {
+	dir *fakeLDAPDirectory
+}
+
+func (c *fakeLDAPConn) Bind(username, password string) error {
+	if username == c.dir.serviceDN && password == c.dir.servicePassword {
+		return nil
+	}
+	for _, entry := range c.dir.users {
+		if entry.dn == username && entry.password == password {
+			return nil
+		}
+	}
+	return ldap.NewError(ldap.LDAPResultInvalidCredentials, errors.New("invalid credentials"))
+}
+
+func (c *fakeLDAPConn) Search(request *ldap.SearchRequest) (*ldap.SearchResult, error) {
+	result := &ldap.SearchResult{}
+	for name, entry := range c.dir.users {
+		match := request.Scope == ldap.ScopeBaseObject && request.BaseDN == entry.dn ||
+			request.Scope == ldap.ScopeWholeSubtree && request.Filter == fmt.Sprintf(c.dir.userFilter, ldap.EscapeFilter(name))
+		if match {
+			result.Entries = append(result.Entries, ldap.NewEntry(entry.dn, map[string][]string{"memberOf": entry.groups}))
+		}
+	}
+	return result, nil
+}
+
+func (c *fakeLDAPConn) StartTLS(*tls.Config) error { return nil }
+
+func (c *fakeLDAPConn) Close() error { return nil }
+
+// fakeLDAPDialer connects to the directories by server URL; servers without one are down
+func fakeLDAPDialer(servers map[string]*fakeLDAPDirectory) ldapDialFunc {
+	return func(serverURL string, cfg config.LDAPConfig) (ldapConn, error) {
+		dir, ok := servers[serverURL]
+		if !ok {
+			return nil, errors.New("connection refused")
+		}
+		dir.dials++
+		return &fakeLDAPConn{dir: dir}, nil
+	}
+}
+
+func TestLDAPAuthenticate(t *testing.T) {
+	mappings := []config.LDAPGroupMapping{{LDAPGroup: "CN=Staff,DC=example,DC=com", ProxyGroup: "staff"}}
+	simpleBind := config.LDAPConfig{
+		Servers:        []string{"ldap://dc1"},
+		UserDNTemplate: "uid=%s,ou=people,dc=example,dc=com",
+		GroupAttribute: "memberOf",
+		GroupMappings:  mappings,
+	}
+	searchThenBind := config.LDAPConfig{
+		Servers:        []string{"ldap://dc1"},
+		BindDN:         "cn=proxy,dc=example,dc=com",
+		BindPassword:   "service-secret",
+		BaseDN:         "dc=example,dc=com",
+		UserFilter:     "(uid=%s)",
+		GroupAttribute: "memberOf",
+		GroupMappings:  mappings,
+	}
+	requireGroup := simpleBind
+	requireGroup.RequireGroup = true
+	wrongService := searchThenBind
+	wrongService.BindPassword = "wrong"
+
+	tests := []struct {
+		name      string
+		cfg       config.LDAPConfig
+		username  string
+		password  string
+		wantErr   error
+		wantGroup string
+	}{
+		{name: "simple bind", cfg: simpleBind, username: "alice", password: "alice-pass", wantGroup: "staff"},
+		{name: "simple bind without group", cfg: simpleBind, username: "bob", password: "bob-pass"},
+		{name: "simple bind wrong password", cfg: simpleBind, username: "alice", password: "wrong", wantErr: ErrInvalidCredentials},
+		{name: "simple bind empty password", cfg: simpleBind, username: "alice", password: "", wantErr: ErrInvalidCredentials},
+		{name: "require group", cfg: requireGroup, username: "bob", password: "bob-pass", wantErr: ErrInvalidCredentials},
+		{name: "search then bind", cfg: searchThenBind, username: "alice", password: "alice-pass", wantGroup: "staff"},
+		{name: "search then bind wrong password", cfg: searchThenBind, username: "alice", password: "wrong", wantErr: ErrInvalidCredentials},
+		{name: "search then bind unknown user", cfg: searchThenBind, username: "carol", password: "carol-pass", wantErr: ErrUnknownUser},
+		{name: "service account rejected", cfg: wrongService, username: "alice", password: "alice-pass", wantErr: ErrBackendUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			servers := map[string]*fakeLDAPDirectory{"ldap://dc1": newFakeLDAPDirectory()}
+			a := newLDAPAuthenticator(tt.cfg, fakeLDAPDialer(servers))
+			result, err := a.Authenticate(&Request{Username: tt.username, Password: []byte(tt.password)})
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Authenticate() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Authenticate() error = %v", err)
+			}
+			if result.Username != tt.username || result.Group != tt.wantGroup || result.Backend != config.AuthBackendLDAP {
+				t.Fatalf("Authenticate() = %+v, want user %q in group %q", result, tt.username, tt.wantGroup)
+			}
+		})
+	}
+}
+
+func TestLDAPFailover(t *testing.T) {
+	second := newFakeLDAPDirectory()
+	cfg := config.LDAPConfig{
+		Servers:        []string{"ldap://down", "ldap://dc2"},
+		UserDNTemplate: "uid=%s,ou=people,dc=example,dc=com",
+	}
+	a := newLDAPAuthenticator(cfg, fakeLDAPDialer(map[string]*fakeLDAPDirectory{"ldap://dc2": second}))
+
+	if _, err := a.Authenticate(&Request{Username: "alice", Password: []byte("alice-pass")}); err != nil {
+		t.Fatalf("Authenticate() error = %v, want success on the second server", err)
+	}
+	if second.dials != 1 {
+		t.Fatalf("second server dialed %d times, want 1", second.dials)
+	}
+
+	// A rejection by a reachable server is final and does not fall back
+	first := newFakeLDAPDirectory()
+	cfg.Servers = []string{"ldap://dc1", "ldap://dc2"}
+	second.dials = 0
+	a = newLDAPAuthenticator(cfg, fakeLDAPDialer(map[string]*fakeLDAPDirectory{"ldap://dc1": first, "ldap://dc2": second}))
+	if _, err := a.Authenticate(&Request{Username: "alice", Password: []byte("wrong")}); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("Authenticate() error = %v, want %v", err, ErrInvalidCredentials)
+	}
+	if second.dials != 0 {
+		t.Fatalf("second server dialed after the first rejected the password")
+	}
+
+	// Every server down
+	a = newLDAPAuthenticator(cfg, fakeLDAPDialer(nil))
+	if _, err := a.Authenticate(&Request{Username: "alice", Password: []byte("alice-pass")}); !errors.Is(err, ErrBackendUnavailable) {
+		t.Fatalf("Authenticate() error = %v, want %v", err, ErrBackendUnavailable)
+	}
+}
+
+func TestLDAPCache(t *testing.T) {
+	dir := newFakeLDAPDirectory()
+	cfg := config.LDAPConfig{
+		Servers:        []string{"ldap://dc1"},
+		UserDNTemplate: "uid=%s,ou=people,dc=example,dc=com",
+		CacheTTL:       60,
+	}
+	a := newLDAPAuthenticator(cfg, fakeLDAPDialer(map[string]*fakeLDAPDirectory{"ldap://dc1": dir}))
+	login := func(password string) error {
+		_, err := a.Authenticate(&Request{Username: "alice", Password: []byte(password)})
+		return err
+	}
+
+	if err := login("alice-pass"); err != nil {
+		t.Fatalf("first login: %v", err)
+	}
+	if err := login("alice-pass"); err != nil {
+		t.Fatalf("cached login: %v", err)
+	}
+	if dir.dials != 1 {
+		t.Fatalf("server dialed %d times, want 1 with the cached login", dir.dials)
+	}
+
+	// A different password is never answered from the cache
+	if err := login("wrong"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("wrong password: error = %v, want %v", err, ErrInvalidCredentials)
+	}
+	if dir.dials != 2 {
+		t.Fatalf("server dialed %d times, want 2 after a different password", dir.dials)
+	}
+
+	// Without a TTL nothing is cached
+	cfg.CacheTTL = 0
+	dir.dials = 0
+	a = newLDAPAuthenticator(cfg, fakeLDAPDialer(map[string]*fakeLDAPDirectory{"ldap://dc1": dir}))
+	login("alice-pass")
+	login("alice-pass")
+	if dir.dials != 2 {
+		t.Fatalf("server dialed %d times without a cache, want 2", dir.dials)
+	}
+
+	// Expired entries are not used
+	cfg.CacheTTL = 60
+	dir.dials = 0
+	a = newLDAPAuthenticator(cfg, fakeLDAPDialer(map[string]*fakeLDAPDirectory{"ldap://dc1": dir}))
+	login("alice-pass")
+	entry, _ := a.cache.Get("alice")
+	entry.ExpiresAt = time.Now().Add(-time.Second)
+	a.cache.Put("alice", entry)
+	login("alice-pass")
+	if dir.dials != 2 {
+		t.Fatalf("server dialed %d times after the entry expired, want 2", dir.dials)
+	}
+}
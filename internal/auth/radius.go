@@ -0,0 +1,334 @@
+package auth
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"layeh.com/radius"
+	"layeh.com/radius/rfc2865"
+	"layeh.com/radius/rfc2866"
+	"layeh.com/radius/rfc2869"
+	"layeh.com/radius/vendors/mikrotik"
+	"layeh.com/radius/vendors/wispr"
+
+	"go-proxy-server/internal/config"
+	"go-proxy-server/internal/logger"
+)
+
+// Minimum interval between Interim-Update records (RFC 2869 section 5.16)
+const minInterimInterval = 60 * time.Second
+
+// radiusExchangeFunc sends a packet to a RADIUS server and waits for the response
+// It allows an in-process RADIUS stand-in to replace real servers
+type radiusExchangeFunc func(ctx context.Context, packet *radius.Packet, addr string) (*radius.Packet, error)
+
+// RADIUSAuthenticator authenticates users against RADIUS servers and reports
+// their proxy sessions to RADIUS accounting
+type RADIUSAuthenticator struct {
+	cfg      config.RADIUSConfig
+	exchange radiusExchangeFunc
+}
+
+// NewRADIUSAuthenticator creates a RADIUS backend using the configured servers
+func NewRADIUSAuthenticator(cfg config.RADIUSConfig) *RADIUSAuthenticator {
+	client := &radius.Client{MaxPacketErrors: 10}
+	if cfg.Retries > 0 {
+		// Spread the retransmissions evenly over the per-server timeout
+		client.Retry = time.Duration(cfg.Timeout) * time.Second / time.Duration(cfg.Retries+1)
+	}
+	return newRADIUSAuthenticator(cfg, client.Exchange)
+}
+
+// newRADIUSAuthenticator creates a RADIUS backend with a custom exchange function
+func newRADIUSAuthenticator(cfg config.RADIUSConfig, exchange radiusExchangeFunc) *RADIUSAuthenticator {
+	return &RADIUSAuthenticator{cfg: cfg, exchange: exchange}
+}
+
+// Name returns the backend name
+func (a *RADIUSAuthenticator) Name() string {
+	return config.AuthBackendRADIUS
+}
+
+// Authenticate sends an Access-Request and maps the response to a result
+// RADIUS does not distinguish unknown users from wrong passwords, so rejections are ErrInvalidCredentials
+func (a *RADIUSAuthenticator) Authenticate(req *Request) (*Result, error) {
+	username, password := req.Username, req.Password
+	if len(password) == 0 || username == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	packet := radius.New(radius.CodeAccessRequest, []byte(a.cfg.Secret))
+	if err := rfc2865.UserName_SetString(packet, username); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCredentials, err)
+	}
+	if a.cfg.Method == config.RADIUSMethodCHAP {
+		if err := setCHAPPassword(packet, password); err != nil {
+			return nil, err
+		}
+	} else if err := rfc2865.UserPassword_Set(packet, password); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCredentials, err)
+	}
+	a.setNASAttributes(packet)
+
+	response, err := a.send(packet, a.cfg.Servers)
+	if err != nil {
+		return nil, err
+	}
+	switch response.Code {
+	case radius.CodeAccessAccept:
+		return a.resultFrom(username, response), nil
+	case radius.CodeAccessReject:
+		return nil, ErrInvalidCredentials
+	default:
+		// Access-Challenge needs user interaction that proxy protocols cannot carry
+		return nil, fmt.Errorf("%w: unexpected %v response", ErrInvalidCredentials, response.Code)
+	}
+}
+
+// send delivers a packet to the first server that answers within the timeout
+func (a *RADIUSAuthenticator) send(packet *radius.Packet, servers []string) (*radius.Packet, error) {
+	lastErr := fmt.Errorf("%w: no servers configured", ErrBackendUnavailable)
+	for _, server := range servers {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(a.cfg.Timeout)*time.Second)
+		response, err := a.exchange(ctx, packet, server)
+		cancel()
+		if err == nil {
+			return response, nil
+		}
+		lastErr = fmt.Errorf("%w: %s: %v", ErrBackendUnavailable, server, err)
+	}
+	return nil, lastErr
+}
+
+// setNASAttributes identifies the proxy to the RADIUS server
+func (a *RADIUSAuthenticator) setNASAttributes(packet *radius.Packet) {
+	if a.cfg.NASIdentifier != "" {
+		rfc2865.NASIdentifier_SetString(packet, a.cfg.NASIdentifier)
+	}
+}
+
+// setCHAPPassword adds a CHAP response computed over a random challenge (RFC 2865 section 5.3)
+func setCHAPPassword(packet *radius.Packet, password []byte) error {
+	challenge := make([]byte, 17)
+	if _, err := rand.Read(challenge); err != nil {
+		return fmt.Errorf("%w: %v", ErrBackendUnavailable, err)
+	}
+	ident, challenge := challenge[0], challenge[1:]
+
+	h := md5.New()
+	h.Write([]byte{ident})
+	h.Write(password)
+	h.Write(challenge)
+	if err := rfc2865.CHAPPassword_Set(packet, append([]byte{ident}, h.Sum(nil)...)); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidCredentials, err)
+	}
+	return rfc2865.CHAPChallenge_Set(packet, challenge)
+}
+
+// resultFrom reads the session attributes of an Access-Accept
+func (a *RADIUSAuthenticator) resultFrom(username string, response *radius.Packet) *Result {
+	result := &Result{
+		Username: username,
+		Backend:  config.AuthBackendRADIUS,
+		radius:   a,
+	}
+	if classes, err := rfc2865.Class_Gets(response); err == nil {
+		result.radiusClass = classes
+	}
+	if timeout, err := rfc2865.SessionTimeout_Lookup(response); err == nil && timeout > 0 {
+		result.SessionTimeout = time.Duration(timeout) * time.Second
+	}
+	if interval, err := rfc2869.AcctInterimInterval_Lookup(response); err == nil && interval > 0 {
+		result.interimInterval = time.Duration(interval) * time.Second
+	}
+	result.UploadRate, result.DownloadRate = bandwidthAttributes(response)
+	return result
+}
+
+// bandwidthAttributes returns the upload and download rates in bytes per second granted by
+// WISPr-Bandwidth-Max-Up/Down (bits per second) or, failing that, Mikrotik-Rate-Limit ("rx/tx")
+func bandwidthAttributes(response *radius.Packet) (upload, download int64) {
+	if up, err := wispr.WISPrBandwidthMaxUp_Lookup(response); err == nil {
+		upload = int64(up) / 8
+	}
+	if down, err := wispr.WISPrBandwidthMaxDown_Lookup(response); err == nil {
+		download = int64(down) / 8
+	}
+	if upload > 0 || download > 0 {
+		return upload, download
+	}
+
+	limit, err := mikrotik.MikrotikRateLimit_LookupString(response)
+	if err != nil {
+		return 0, 0
+	}
+	// The first field is "rx-rate[/tx-rate]" seen from the NAS: rx is the client's upload
+	fields := strings.Fields(limit)
+	if len(fields) == 0 {
+		return 0, 0
+	}
+	rates := strings.SplitN(fields[0], "/", 2)
+	upload = parseBitRate(rates[0]) / 8
+	download = upload
+	if len(rates) == 2 {
+		download = parseBitRate(rates[1]) / 8
+	}
+	return upload, download
+}
+
+// parseBitRate parses a rate in bits per second with an optional k, M or G suffix
+func parseBitRate(value string) int64 {
+	multiplier := int64(1)
+	switch {
+	case strings.HasSuffix(value, "k"), strings.HasSuffix(value, "K"):
+		multiplier = 1000
+	case strings.HasSuffix(value, "M"):
+		multiplier = 1000 * 1000
+	case strings.HasSuffix(value, "G"):
+		multiplier = 1000 * 1000 * 1000
+	}
+	if multiplier > 1 {
+		value = value[:len(value)-1]
+	}
+	rate, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || rate < 0 {
+		return 0
+	}
+	return rate * multiplier
+}
+
+// StopCause tells RADIUS accounting why a session ended
+type StopCause int
+
+const (
+	// StopUserRequest means the client closed the session
+	StopUserRequest StopCause = iota
+	// StopSessionTimeout means the Session-Timeout granted in the Access-Accept was reached
+	StopSessionTimeout
+)
+
+// AccountingSession reports one proxy session to RADIUS accounting
+// Records are sent from a background goroutine so the data path never waits for the server
+type AccountingSession struct {
+	auth     *RADIUSAuthenticator
+	id       string
+	username string
+	clientIP string
+	class    [][]byte
+	started  time.Time
+	counters func() (in, out int64)
+
+	stop     chan StopCause
+	stopOnce sync.Once
+}
+
+// StartAccounting sends Accounting-Start for a proxy session of the authenticated user
+// counters returns the bytes received from and sent to the client since the session started
+// Returns nil when the user was not authenticated by RADIUS or accounting is disabled
+func (r *Result) StartAccounting(clientIP string, counters func() (in, out int64)) *AccountingSession {
+	if r == nil || r.radius == nil || !r.radius.cfg.Accounting {
+		return nil
+	}
+
+	id := make([]byte, 8)
+	rand.Read(id)
+	s := &AccountingSession{
+		auth:     r.radius,
+		id:       hex.EncodeToString(id),
+		username: r.Username,
+		clientIP: clientIP,
+		class:    r.radiusClass,
+		started:  time.Now(),
+		counters: counters,
+		stop:     make(chan StopCause, 1),
+	}
+
+	// An interval from the server takes precedence over the configured one
+	interval := time.Duration(r.radius.cfg.InterimInterval) * time.Second
+	if r.interimInterval > 0 {
+		interval = r.interimInterval
+		if interval < minInterimInterval {
+			interval = minInterimInterval
+		}
+	}
+	go s.run(interval)
+	return s
+}
+
+// Stop sends Accounting-Stop with the final counters (safe to call on nil and more than once)
+func (s *AccountingSession) Stop(cause StopCause) {
+	if s == nil {
+		return
+	}
+	s.stopOnce.Do(func() {
+		s.stop <- cause
+	})
+}
+
+// run sends Start, periodic Interim-Update and Stop records in order
+func (s *AccountingSession) run(interval time.Duration) {
+	s.send(rfc2866.AcctStatusType_Value_Start, StopUserRequest)
+
+	var tick <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case <-tick:
+			s.send(rfc2866.AcctStatusType_Value_InterimUpdate, StopUserRequest)
+		case cause := <-s.stop:
+			s.send(rfc2866.AcctStatusType_Value_Stop, cause)
+			return
+		}
+	}
+}
+
+// send builds and delivers one Accounting-Request
+func (s *AccountingSession) send(status rfc2866.AcctStatusType, cause StopCause) {
+	packet := radius.New(radius.CodeAccountingRequest, []byte(s.auth.cfg.Secret))
+	rfc2865.UserName_SetString(packet, s.username)
+	rfc2865.CallingStationID_SetString(packet, s.clientIP)
+	s.auth.setNASAttributes(packet)
+	rfc2866.AcctStatusType_Set(packet, status)
+	rfc2866.AcctSessionID_SetString(packet, s.id)
+	rfc2866.AcctAuthentic_Set(packet, rfc2866.AcctAuthentic_Value_RADIUS)
+	// Class must be echoed unmodified (RFC 2865 section 5.25)
+	for _, class := range s.class {
+		rfc2865.Class_Add(packet, class)
+	}
+
+	if status != rfc2866.AcctStatusType_Value_Start {
+		in, out := s.counters()
+		rfc2866.AcctInputOctets_Set(packet, rfc2866.AcctInputOctets(uint32(in)))
+		rfc2869.AcctInputGigawords_Set(packet, rfc2869.AcctInputGigawords(uint32(in>>32)))
+		rfc2866.AcctOutputOctets_Set(packet, rfc2866.AcctOutputOctets(uint32(out)))
+		rfc2869.AcctOutputGigawords_Set(packet, rfc2869.AcctOutputGigawords(uint32(out>>32)))
+		rfc2866.AcctSessionTime_Set(packet, rfc2866.AcctSessionTime(time.Since(s.started)/time.Second))
+	}
+	if status == rfc2866.AcctStatusType_Value_Stop {
+		terminateCause := rfc2866.AcctTerminateCause_Value_UserRequest
+		if cause == StopSessionTimeout {
+			terminateCause = rfc2866.AcctTerminateCause_Value_SessionTimeout
+		}
+		rfc2866.AcctTerminateCause_Set(packet, terminateCause)
+	}
+
+	response, err := s.auth.send(packet, s.auth.cfg.AccountingServers)
+	if err != nil {
+		logger.Warn("RADIUS accounting %v for user %s failed: %v", status, s.username, err)
+		return
+	}
+	if response.Code != radius.CodeAccountingResponse {
+		logger.Warn("RADIUS accounting %v for user %s got unexpected %v", status, s.username, response.Code)
+	}
+}
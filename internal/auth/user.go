@@ -1,22 +1,27 @@
 package auth
 
 import (
+	"errors"
 	"fmt"
-	"strings"
 	"sync"
 	"sync/atomic"
 
 	"gorm.io/gorm"
 
+	"go-proxy-server/internal/acl"
+	"go-proxy-server/internal/config"
 	"go-proxy-server/internal/logger"
 	"go-proxy-server/internal/models"
+	"go-proxy-server/internal/quota"
+	"go-proxy-server/internal/schedule"
 )
 
 type Credentials map[string][]byte
 
 // credentialsMap wraps credentials for atomic storage
 type credentialsMap struct {
-	data Credentials
+	data   Credentials
+	groups map[string]string // Username -> group name of local users
 }
 
 var (
@@ -28,7 +33,7 @@ var (
 
 func init() {
 	// Initialize atomic values with empty maps wrapped in structs
-	credentialsAtomic.Store(&credentialsMap{data: make(Credentials)})
+	credentialsAtomic.Store(&credentialsMap{data: make(Credentials), groups: make(map[string]string)})
 }
 
 // LoadCredentialsFromDB loads user credentials from database
@@ -42,6 +47,7 @@ func LoadCredentialsFromDB(db *gorm.DB) error {
 	}
 
 	tempCred := make(Credentials)
+	tempGroups := make(map[string]string)
 
 	for _, user := range users {
 		// Username should be globally unique due to database constraint
@@ -50,11 +56,14 @@ func LoadCredentialsFromDB(db *gorm.DB) error {
 			return fmt.Errorf("data corruption: duplicate username '%s' found in database", user.Username)
 		}
 		tempCred[user.Username] = user.Password
+		if user.GroupName != "" {
+			tempGroups[user.Username] = user.GroupName
+		}
 	}
 
 	// Atomic store - no read lock needed, lock-free reads continue to work
 	credWriteLock.Lock()
-	credentialsAtomic.Store(&credentialsMap{data: tempCred})
+	credentialsAtomic.Store(&credentialsMap{data: tempCred, groups: tempGroups})
 	credWriteLock.Unlock()
 
 	return nil
@@ -83,8 +92,7 @@ func AddUser(db *gorm.DB, ip, username, password string) error {
 	err = db.Create(&user).Error
 	if err != nil {
 		// Check if error is due to unique constraint violation
-		if strings.Contains(err.Error(), "UNIQUE constraint failed") ||
-			strings.Contains(err.Error(), "duplicate key") {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
 			return fmt.Errorf("Username '%s' already exists", username)
 		}
 		return err
@@ -101,6 +109,37 @@ func AddUser(db *gorm.DB, ip, username, password string) error {
 	return nil
 }
 
+// UpdateUser changes the IP and/or password of an existing user (nil leaves a field unchanged)
+func UpdateUser(db *gorm.DB, username string, ip, password *string) error {
+	updates := make(map[string]interface{})
+	if ip != nil {
+		updates["ip"] = *ip
+	}
+	if password != nil {
+		if err := validatePasswordStrength(*password); err != nil {
+			return err
+		}
+		hashedPassword, err := HashPassword([]byte(*password))
+		if err != nil {
+			return err
+		}
+		updates["password"] = hashedPassword
+	}
+
+	result := db.Model(&models.User{}).Where("username = ?", username).Updates(updates)
+	if result.Error != nil {
+		return result.Error
+	}
+	if len(updates) > 0 && result.RowsAffected == 0 {
+		return fmt.Errorf("user '%s' does not exist", username)
+	}
+
+	if password != nil {
+		return LoadCredentialsFromDB(db)
+	}
+	return nil
+}
+
 // validatePasswordStrength checks if the password meets minimum security requirements
 func validatePasswordStrength(password string) error {
 	if len(password) < 8 {
@@ -144,6 +183,33 @@ func DeleteUser(db *gorm.DB, username string) error {
 		return err
 	}
 
+	// Remove the user's traffic quota and usage counters
+	if manager := quota.GetManager(); manager != nil {
+		err = manager.Delete(username)
+	} else {
+		err = db.Unscoped().Where("username = ?", username).Delete(&models.UserQuota{}).Error
+	}
+	if err != nil {
+		logger.Error("Failed to delete traffic quota for user %s: %v", username, err)
+	}
+
+	// Remove the user's limit overrides
+	if err := db.Unscoped().Where("username = ?", username).Delete(&models.UserLimit{}).Error; err != nil {
+		logger.Error("Failed to delete limits for user %s: %v", username, err)
+	} else if err := config.LoadUserLimitsFromDB(db); err != nil {
+		logger.Error("Failed to reload user limits after deletion: %v", err)
+	}
+
+	// Remove the user's access rule override
+	if err := acl.DeleteRule(db, acl.ScopeUser, username); err != nil {
+		logger.Error("Failed to delete access rule for user %s: %v", username, err)
+	}
+
+	// Remove the user's schedule assignment
+	if err := schedule.Unassign(db, schedule.ScopeUser, username); err != nil {
+		logger.Error("Failed to delete schedule assignment for user %s: %v", username, err)
+	}
+
 	// Update the userCredentials map by re-syncing from the database
 	if err := LoadCredentialsFromDB(db); err != nil {
 		logger.Error("Failed to reload credentials after deletion: %v", err)
@@ -172,6 +238,12 @@ func ListUsers(db *gorm.DB) error {
 	return nil
 }
 
+// getLocalGroup returns the group of a local user (for internal use)
+func getLocalGroup(username string) string {
+	creds := credentialsAtomic.Load().(*credentialsMap)
+	return creds.groups[username]
+}
+
 // getCredentials returns the current credentials map (for internal use)
 func getCredentials() Credentials {
 	creds := credentialsAtomic.Load().(*credentialsMap)
@@ -0,0 +1,279 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"go-proxy-server/internal/cache"
+	"go-proxy-server/internal/config"
+	"go-proxy-server/internal/constants"
+	"go-proxy-server/internal/logger"
+)
+
+// Maximum size of a webhook response body
+const maxWebhookResponseSize = 64 * 1024
+
+// webhookRequest is the JSON body posted to the endpoint
+type webhookRequest struct {
+	Username     string `json:"username"`
+	Password     string `json:"password"`     // Plain or SHA-256 hex depending on passwordMode
+	PasswordMode string `json:"passwordMode"` // "plain" or "sha256"
+	ClientIP     string `json:"clientIP"`
+	Listener     string `json:"listener"`
+	Destination  string `json:"destination,omitempty"`
+}
+
+// webhookResponse is the JSON body expected from the endpoint
+type webhookResponse struct {
+	Allow        bool   `json:"allow"`
+	Reason       string `json:"reason"`       // Logged when the login is denied
+	Group        string `json:"group"`        // Proxy user group
+	EgressIP     string `json:"egressIP"`     // Local address outbound connections are bound to
+	UploadRate   int64  `json:"uploadRate"`   // Bytes per second (0 = no limit from the endpoint)
+	DownloadRate int64  `json:"downloadRate"` // Bytes per second (0 = no limit from the endpoint)
+	TTL          *int   `json:"ttl"`          // Seconds the decision may be cached (overrides cacheTTL/negativeCacheTTL)
+}
+
+// webhookDecision is a cached decision (nil result = denied)
+type webhookDecision struct {
+	result *Result
+}
+
+// WebhookAuthenticator delegates logins to an external HTTP endpoint
+type WebhookAuthenticator struct {
+	cfg    config.WebhookConfig
+	client *http.Client
+
+	// Decisions cached by a salted hash of the whole request; the LRU bounds the memory they take
+	cache     *cache.ShardedLRU
+	cacheSalt []byte
+
+	// Circuit breaker: after BreakerThreshold consecutive failures the endpoint
+	// is not called until openUntil
+	breakerMu sync.Mutex
+	failures  int
+	openUntil time.Time
+}
+
+// NewWebhookAuthenticator creates a webhook backend calling the configured endpoint
+func NewWebhookAuthenticator(cfg config.WebhookConfig) *WebhookAuthenticator {
+	salt := make([]byte, 32)
+	rand.Read(salt)
+	return &WebhookAuthenticator{
+		cfg: cfg,
+		client: &http.Client{
+			Timeout: time.Duration(cfg.Timeout) * time.Second,
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{
+					InsecureSkipVerify: cfg.InsecureSkipVerify,
+					MinVersion:         tls.VersionTLS12,
+				},
+				MaxIdleConnsPerHost: 10,
+				IdleConnTimeout:     90 * time.Second,
+			},
+			// Never follow redirects: the credentials must only reach the configured endpoint
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		cache:     cache.NewShardedLRU(constants.WebhookCacheMaxSize, 16),
+		cacheSalt: salt,
+	}
+}
+
+// Name returns the backend name
+func (a *WebhookAuthenticator) Name() string {
+	return config.AuthBackendWebhook
+}
+
+// Authenticate asks the endpoint whether the login is allowed
+func (a *WebhookAuthenticator) Authenticate(req *Request) (*Result, error) {
+	if len(req.Password) == 0 || req.Username == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	key := a.cacheKey(req)
+	if decision, ok := a.cached(key); ok {
+		if decision.result == nil {
+			return nil, ErrInvalidCredentials
+		}
+		result := *decision.result
+		return &result, nil
+	}
+
+	if !a.breakerAllows() {
+		return a.unavailable(req, fmt.Errorf("%w: circuit open", ErrBackendUnavailable))
+	}
+
+	response, err := a.call(req)
+	if err != nil {
+		a.recordFailure()
+		return a.unavailable(req, err)
+	}
+	a.recordSuccess()
+
+	if !response.Allow {
+		if response.Reason != "" {
+			logger.Info("Webhook denied user %s: %s", req.Username, response.Reason)
+		}
+		a.store(key, nil, a.ttl(response.TTL, a.cfg.NegativeCacheTTL))
+		return nil, ErrInvalidCredentials
+	}
+
+	result := &Result{
+		Username:     req.Username,
+		Group:        response.Group,
+		Backend:      config.AuthBackendWebhook,
+		EgressIP:     response.EgressIP,
+		UploadRate:   response.UploadRate,
+		DownloadRate: response.DownloadRate,
+	}
+	a.store(key, result, a.ttl(response.TTL, a.cfg.CacheTTL))
+	return result, nil
+}
+
+// call posts the login to the endpoint and decodes the decision
+func (a *WebhookAuthenticator) call(req *Request) (*webhookResponse, error) {
+	password := string(req.Password)
+	if a.cfg.PasswordMode == config.WebhookPasswordSHA256 {
+		sum := sha256.Sum256(req.Password)
+		password = hex.EncodeToString(sum[:])
+	}
+	body, err := json.Marshal(webhookRequest{
+		Username:     req.Username,
+		Password:     password,
+		PasswordMode: a.cfg.PasswordMode,
+		ClientIP:     req.ClientIP,
+		Listener:     req.Listener,
+		Destination:  req.Destination,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBackendUnavailable, err)
+	}
+
+	httpReq, err := http.NewRequest(http.MethodPost, a.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBackendUnavailable, err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if a.cfg.Secret != "" {
+		// Lets the endpoint verify the request came from this proxy
+		mac := hmac.New(sha256.New, []byte(a.cfg.Secret))
+		mac.Write(body)
+		httpReq.Header.Set("X-Proxy-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := a.client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBackendUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, io.LimitReader(resp.Body, maxWebhookResponseSize))
+		return nil, fmt.Errorf("%w: endpoint returned %s", ErrBackendUnavailable, resp.Status)
+	}
+	var response webhookResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxWebhookResponseSize)).Decode(&response); err != nil {
+		return nil, fmt.Errorf("%w: invalid response: %v", ErrBackendUnavailable, err)
+	}
+	if response.EgressIP != "" && net.ParseIP(response.EgressIP) == nil {
+		return nil, fmt.Errorf("%w: invalid egressIP %q", ErrBackendUnavailable, response.EgressIP)
+	}
+	if response.UploadRate < 0 || response.DownloadRate < 0 {
+		return nil, fmt.Errorf("%w: negative bandwidth", ErrBackendUnavailable)
+	}
+	return &response, nil
+}
+
+// unavailable applies the failure mode when the endpoint cannot decide
+func (a *WebhookAuthenticator) unavailable(req *Request, err error) (*Result, error) {
+	if !a.cfg.FailOpen {
+		return nil, err
+	}
+	logger.Warn("Webhook unavailable, admitting user %s (fail-open): %v", req.Username, err)
+	return &Result{Username: req.Username, Backend: config.AuthBackendWebhook}, nil
+}
+
+// breakerAllows reports whether the endpoint may be called
+func (a *WebhookAuthenticator) breakerAllows() bool {
+	a.breakerMu.Lock()
+	defer a.breakerMu.Unlock()
+	return time.Now().After(a.openUntil)
+}
+
+// recordFailure counts a failed call and opens the circuit at the threshold
+func (a *WebhookAuthenticator) recordFailure() {
+	a.breakerMu.Lock()
+	defer a.breakerMu.Unlock()
+	a.failures++
+	if a.failures >= a.cfg.BreakerThreshold {
+		a.openUntil = time.Now().Add(time.Duration(a.cfg.BreakerCooldown) * time.Second)
+		if a.failures == a.cfg.BreakerThreshold {
+			logger.Warn("Webhook endpoint failed %d times, pausing calls for %ds", a.failures, a.cfg.BreakerCooldown)
+		}
+	}
+}
+
+// recordSuccess closes the circuit
+func (a *WebhookAuthenticator) recordSuccess() {
+	a.breakerMu.Lock()
+	defer a.breakerMu.Unlock()
+	a.failures = 0
+	a.openUntil = time.Time{}
+}
+
+// ttl returns the cache lifetime of a decision
+// The response may shorten or extend it, but never beyond the longest lifetime the configuration allows
+func (a *WebhookAuthenticator) ttl(responseTTL *int, configured int) time.Duration {
+	if responseTTL != nil {
+		configured = *responseTTL
+	}
+	if configured < 0 {
+		return 0
+	}
+	if configured > config.MaxAuthCacheTTL {
+		configured = config.MaxAuthCacheTTL
+	}
+	return time.Duration(configured) * time.Second
+}
+
+// cacheKey hashes every field the endpoint may base its decision on
+func (a *WebhookAuthenticator) cacheKey(req *Request) string {
+	h := sha256.New()
+	h.Write(a.cacheSalt)
+	for _, field := range [][]byte{[]byte(req.Username), req.Password, []byte(req.ClientIP), []byte(req.Listener), []byte(req.Destination)} {
+		h.Write(field)
+		h.Write([]byte{0})
+	}
+	return string(h.Sum(nil))
+}
+
+// cached returns an unexpired cached decision
+func (a *WebhookAuthenticator) cached(key string) (webhookDecision, bool) {
+	entry, ok := a.cache.Get(key)
+	if !ok {
+		return webhookDecision{}, false
+	}
+	return entry.Value.(webhookDecision), true
+}
+
+// store caches a decision for ttl (0 = not cached); expired decisions are swept periodically
+func (a *WebhookAuthenticator) store(key string, result *Result, ttl time.Duration) {
+	if ttl <= 0 {
+		return
+	}
+	startAuthCacheCleanup()
+	a.cache.Put(key, cache.Entry{Value: webhookDecision{result: result}, ExpiresAt: time.Now().Add(ttl)})
+}
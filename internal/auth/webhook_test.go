@@ -0,0 +1,111 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go-proxy-server/internal/config"
+)
+
+// newWebhookEndpoint starts an endpoint allowing the password "secret" and counting its calls
+func newWebhookEndpoint(t *testing.T) (*httptest.Server, *atomic.Int32) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		var req webhookRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		json.NewEncoder(w).Encode(webhookResponse{Allow: req.Password == "secret", Group: "staff"})
+	}))
+	t.Cleanup(server.Close)
+	return server, &calls
+}
+
+func webhookConfig(url string) config.WebhookConfig {
+	return config.WebhookConfig{
+		URL:              url,
+		PasswordMode:     config.WebhookPasswordPlain,
+		Timeout:          5,
+		CacheTTL:         60,
+		NegativeCacheTTL: 10,
+		BreakerThreshold: 3,
+		BreakerCooldown:  30,
+	}
+}
+
+func TestWebhookCache(t *testing.T) {
+	server, calls := newWebhookEndpoint(t)
+	a := NewWebhookAuthenticator(webhookConfig(server.URL))
+	login := func(password, destination string) error {
+		_, err := a.Authenticate(&Request{Username: "alice", Password: []byte(password), ClientIP: "192.0.2.1", Destination: destination})
+		return err
+	}
+
+	tests := []struct {
+		name        string
+		password    string
+		destination string
+		wantErr     error
+		wantCalls   int32
+	}{
+		{name: "allowed", password: "secret", destination: "example.com:443", wantCalls: 1},
+		{name: "allowed from cache", password: "secret", destination: "example.com:443", wantCalls: 1},
+		{name: "new destination asks the endpoint", password: "secret", destination: "example.org:443", wantCalls: 2},
+		{name: "denied", password: "wrong", destination: "example.com:443", wantErr: ErrInvalidCredentials, wantCalls: 3},
+		{name: "denied from cache", password: "wrong", destination: "example.com:443", wantErr: ErrInvalidCredentials, wantCalls: 3},
+	}
+	for _, tt := range tests {
+		if err := login(tt.password, tt.destination); !errors.Is(err, tt.wantErr) {
+			t.Fatalf("%s: Authenticate() error = %v, want %v", tt.name, err, tt.wantErr)
+		}
+		if got := calls.Load(); got != tt.wantCalls {
+			t.Fatalf("%s: endpoint called %d times, want %d", tt.name, got, tt.wantCalls)
+		}
+	}
+}
+
+func TestWebhookTTL(t *testing.T) {
+	a := NewWebhookAuthenticator(webhookConfig("http://127.0.0.1"))
+	seconds := func(n int) *int { return &n }
+
+	tests := []struct {
+		name        string
+		responseTTL *int
+		configured  int
+		want        time.Duration
+	}{
+		{name: "configured", configured: 60, want: time.Minute},
+		{name: "response overrides", responseTTL: seconds(5), configured: 60, want: 5 * time.Second},
+		{name: "response disables", responseTTL: seconds(0), configured: 60, want: 0},
+		{name: "negative", responseTTL: seconds(-1), configured: 60, want: 0},
+		{name: "clamped to maximum", responseTTL: seconds(10 * config.MaxAuthCacheTTL), configured: 60, want: config.MaxAuthCacheTTL * time.Second},
+	}
+	for _, tt := range tests {
+		if got := a.ttl(tt.responseTTL, tt.configured); got != tt.want {
+			t.Errorf("%s: ttl() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestWebhookUnavailable(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	cfg := webhookConfig(server.URL)
+	a := NewWebhookAuthenticator(cfg)
+	if _, err := a.Authenticate(&Request{Username: "alice", Password: []byte("secret")}); !errors.Is(err, ErrBackendUnavailable) {
+		t.Fatalf("fail-closed: error = %v, want %v", err, ErrBackendUnavailable)
+	}
+
+	cfg.FailOpen = true
+	a = NewWebhookAuthenticator(cfg)
+	if result, err := a.Authenticate(&Request{Username: "alice", Password: []byte("secret")}); err != nil || result.Username != "alice" {
+		t.Fatalf("fail-open: Authenticate() = %+v, %v; want alice admitted", result, err)
+	}
+}
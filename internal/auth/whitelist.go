@@ -1,9 +1,9 @@
 package auth
 
 import (
+	"errors"
 	"fmt"
 	"net"
-	"strings"
 	"sync"
 	"sync/atomic"
 
@@ -11,6 +11,7 @@ import (
 
 	"go-proxy-server/internal/logger"
 	"go-proxy-server/internal/models"
+	"go-proxy-server/internal/schedule"
 )
 
 // whitelistMap wraps whitelist for atomic storage
@@ -76,8 +77,7 @@ func AddIPToWhitelist(db *gorm.DB, ip string) error {
 	err := db.Create(&whitelist).Error
 	if err != nil {
 		// Check if error is due to unique constraint violation
-		if strings.Contains(err.Error(), "UNIQUE constraint failed") ||
-			strings.Contains(err.Error(), "duplicate key") {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
 			return fmt.Errorf("IP already in whitelist")
 		}
 		return err
@@ -102,6 +102,11 @@ func DeleteIPFromWhitelist(db *gorm.DB, ip string) error {
 		return err
 	}
 
+	// Remove the entry's schedule assignment
+	if err := schedule.Unassign(db, schedule.ScopeWhitelist, ip); err != nil {
+		logger.Error("Failed to delete schedule assignment for %s: %v", ip, err)
+	}
+
 	// Reload whitelist from database
 	if err := LoadWhitelistFromDB(db); err != nil {
 		logger.Error("Failed to reload whitelist after deletion: %v", err)
@@ -0,0 +1,199 @@
+//go:build linux
+// +build linux
+
+package autostart
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	unitName    = "go-proxy-server.service"
+	desktopName = "go-proxy-server.desktop"
+)
+
+// unitTemplate is the systemd user unit running the web management server
+// Type=notify waits for the readiness notification; NotifyAccess=all lets a hot-upgraded process notify
+const unitTemplate = `[Unit]
+Description=Go Proxy Server
+After=network-online.target
+Wants=network-online.target
+
+[Service]
+Type=notify
+NotifyAccess=all
+ExecStart=%s web
+Restart=on-failure
+WatchdogSec=30
+
+[Install]
+WantedBy=default.target
+`
+
+// desktopTemplate is the XDG autostart entry used without a systemd user manager
+const desktopTemplate = `[Desktop Entry]
+Type=Application
+Name=Go Proxy Server
+Exec=%s web
+Terminal=false
+NoDisplay=true
+X-GNOME-Autostart-enabled=true
+`
+
+// getUnitPath returns the path of the systemd user unit
+func getUnitPath() (string, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "systemd", "user", unitName), nil
+}
+
+// getDesktopPath returns the path of the XDG autostart entry
+func getDesktopPath() (string, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "autostart", desktopName), nil
+}
+
+// hasUserManager reports whether a systemd user manager runs for the current user
+func hasUserManager() bool {
+	if _, err := exec.LookPath("systemctl"); err != nil {
+		return false
+	}
+	runtimeDir := os.Getenv("XDG_RUNTIME_DIR")
+	if runtimeDir == "" {
+		return false
+	}
+	_, err := os.Stat(filepath.Join(runtimeDir, "systemd", "private"))
+	return err == nil
+}
+
+// systemctl runs a systemctl command against the user manager
+func systemctl(args ...string) error {
+	output, err := exec.Command("systemctl", append([]string{"--user"}, args...)...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("systemctl --user %s: %v: %s", strings.Join(args, " "), err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// quoteExec quotes the executable path for ExecStart= and Exec= if it contains spaces
+func quoteExec(path string) string {
+	if strings.ContainsAny(path, " \t\"\\") {
+		return strconv.Quote(path)
+	}
+	return path
+}
+
+// IsEnabled checks if autostart is enabled by the user unit or the autostart entry
+func IsEnabled() (bool, error) {
+	unitPath, err := getUnitPath()
+	if err != nil {
+		return false, err
+	}
+	// systemctl enable links the unit into the wants directory of its install target
+	if _, err := os.Lstat(filepath.Join(filepath.Dir(unitPath), "default.target.wants", unitName)); err == nil {
+		return true, nil
+	}
+
+	desktopPath, err := getDesktopPath()
+	if err != nil {
+		return false, err
+	}
+	if _, err := os.Stat(desktopPath); err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// Enable enables autostart by installing and enabling a systemd user unit,
+// or an XDG autostart entry if no systemd user manager runs
+func Enable() error {
+	exePath, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to get executable path: %v", err)
+	}
+
+	// Resolve symlinks
+	exePath, err = filepath.EvalSymlinks(exePath)
+	if err != nil {
+		return fmt.Errorf("failed to resolve symlinks: %v", err)
+	}
+
+	if hasUserManager() {
+		unitPath, err := getUnitPath()
+		if err != nil {
+			return err
+		}
+		if err := writeFile(unitPath, fmt.Sprintf(unitTemplate, quoteExec(exePath))); err != nil {
+			return fmt.Errorf("failed to write systemd unit: %v", err)
+		}
+		if err := systemctl("daemon-reload"); err != nil {
+			return err
+		}
+		// Not started now: this process already serves the configured ports
+		return systemctl("enable", unitName)
+	}
+
+	desktopPath, err := getDesktopPath()
+	if err != nil {
+		return err
+	}
+	if err := writeFile(desktopPath, fmt.Sprintf(desktopTemplate, quoteExec(exePath))); err != nil {
+		return fmt.Errorf("failed to write autostart entry: %v", err)
+	}
+	return nil
+}
+
+// Disable disables autostart by removing the user unit and the autostart entry
+func Disable() error {
+	unitPath, err := getUnitPath()
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(unitPath); err == nil {
+		if hasUserManager() {
+			if err := systemctl("disable", unitName); err != nil {
+				return err
+			}
+		}
+		// Without a running user manager the enablement link is removed by hand
+		os.Remove(filepath.Join(filepath.Dir(unitPath), "default.target.wants", unitName))
+		if err := os.Remove(unitPath); err != nil {
+			return fmt.Errorf("failed to remove systemd unit: %v", err)
+		}
+		if hasUserManager() {
+			if err := systemctl("daemon-reload"); err != nil {
+				return err
+			}
+		}
+	}
+
+	desktopPath, err := getDesktopPath()
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(desktopPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove autostart entry: %v", err)
+	}
+	return nil
+}
+
+// writeFile writes a file, creating its directory
+func writeFile(path, content string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(content), 0644)
+}
@@ -1,21 +1,21 @@
-//go:build !windows
-// +build !windows
+//go:build !windows && !linux
+// +build !windows,!linux
 
 package autostart
 
 import "errors"
 
-// IsEnabled checks if autostart is enabled (not supported on non-Windows)
+// IsEnabled checks if autostart is enabled (not supported on this platform)
 func IsEnabled() (bool, error) {
-	return false, errors.New("autostart is only supported on Windows")
+	return false, errors.New("autostart is only supported on Windows and Linux")
 }
 
-// Enable enables autostart (not supported on non-Windows)
+// Enable enables autostart (not supported on this platform)
 func Enable() error {
-	return errors.New("autostart is only supported on Windows")
+	return errors.New("autostart is only supported on Windows and Linux")
 }
 
-// Disable disables autostart (not supported on non-Windows)
+// Disable disables autostart (not supported on this platform)
 func Disable() error {
-	return errors.New("autostart is only supported on Windows")
+	return errors.New("autostart is only supported on Windows and Linux")
 }
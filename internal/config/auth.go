@@ -0,0 +1,312 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync/atomic"
+
+	"gorm.io/gorm"
+)
+
+// System configuration key for the authentication backend configuration (JSON)
+const (
+	KeyAuthConfig = "auth_config"
+)
+
+// Authentication backend names
+const (
+	AuthBackendLocal   = "local"
+	AuthBackendLDAP    = "ldap"
+	AuthBackendRADIUS  = "radius"
+	AuthBackendWebhook = "webhook"
+)
+
+// RADIUS authentication methods
+const (
+	RADIUSMethodPAP  = "pap"
+	RADIUSMethodCHAP = "chap"
+)
+
+// Fallback policies between authentication backends
+const (
+	// AuthFallbackUnavailable tries the next backend when a backend is unreachable or does not know the user
+	AuthFallbackUnavailable = "unavailable"
+	// AuthFallbackAny also tries the next backend when a backend rejects the password
+	AuthFallbackAny = "any"
+)
+
+// MaxAuthCacheTTL is the longest time in seconds an authentication backend may cache a decision
+const MaxAuthCacheTTL = 86400
+
+// LDAPGroupMapping maps an LDAP group DN to a proxy user group
+type LDAPGroupMapping struct {
+	LDAPGroup  string `json:"ldapGroup"`
+	ProxyGroup string `json:"proxyGroup"`
+}
+
+// LDAPConfig holds the LDAP / Active Directory backend configuration
+// With UserDNTemplate set users bind directly (simple bind); otherwise the service
+// account searches BaseDN with UserFilter and the found entry is bound (search-then-bind)
+type LDAPConfig struct {
+	Servers            []string           `json:"servers"`            // Tried in order, e.g. "ldaps://dc1.example.com:636"
+	StartTLS           bool               `json:"startTLS"`           // Upgrade ldap:// connections with StartTLS
+	InsecureSkipVerify bool               `json:"insecureSkipVerify"` // Skip TLS certificate verification (testing only)
+	Timeout            int                `json:"timeout"`            // Per-server timeout in seconds
+	BindDN             string             `json:"bindDN"`             // Service account for search-then-bind
+	BindPassword       string             `json:"bindPassword"`       // Service account password
+	BindPasswordSet    bool               `json:"bindPasswordSet"`    // Reported by the API instead of the password
+	UserDNTemplate     string             `json:"userDNTemplate"`     // e.g. "uid=%s,ou=people,dc=example,dc=com" or "%s@corp.example.com"
+	BaseDN             string             `json:"baseDN"`             // Search base for users
+	UserFilter         string             `json:"userFilter"`         // e.g. "(&(objectClass=user)(sAMAccountName=%s))"
+	GroupAttribute     string             `json:"groupAttribute"`     // Attribute listing group DNs, usually "memberOf"
+	GroupMappings      []LDAPGroupMapping `json:"groupMappings"`      // First matching mapping wins
+	RequireGroup       bool               `json:"requireGroup"`       // Reject users matching no group mapping
+	CacheTTL           int                `json:"cacheTTL"`           // Seconds successful logins are cached (0 = no cache)
+}
+
+// RADIUSConfig holds the RADIUS authentication and accounting configuration
+type RADIUSConfig struct {
+	Servers           []string `json:"servers"`           // Authentication servers tried in order, e.g. "radius1.example.com:1812"
+	AccountingServers []string `json:"accountingServers"` // Accounting servers tried in order, e.g. "radius1.example.com:1813"
+	Secret            string   `json:"secret"`            // Shared secret
+	SecretSet         bool     `json:"secretSet"`         // Reported by the API instead of the secret
+	Method            string   `json:"method"`            // RADIUSMethodPAP or RADIUSMethodCHAP
+	Timeout           int      `json:"timeout"`           // Per-server timeout in seconds
+	Retries           int      `json:"retries"`           // Retransmissions per server within the timeout
+	NASIdentifier     string   `json:"nasIdentifier"`     // Sent as NAS-Identifier
+	Accounting        bool     `json:"accounting"`        // Send Accounting Start/Interim-Update/Stop records
+	InterimInterval   int      `json:"interimInterval"`   // Seconds between Interim-Update records (0 = none unless the server sets Acct-Interim-Interval)
+}
+
+// How the webhook backend sends the password
+const (
+	WebhookPasswordPlain  = "plain"  // As entered, e.g. for API tokens
+	WebhookPasswordSHA256 = "sha256" // Hex-encoded SHA-256 digest
+)
+
+// WebhookConfig holds the HTTP webhook backend configuration
+type WebhookConfig struct {
+	URL                string `json:"url"`                // Endpoint receiving the login as a JSON POST
+	Secret             string `json:"secret"`             // Key signing request bodies (X-Proxy-Signature header, empty = unsigned)
+	SecretSet          bool   `json:"secretSet"`          // Reported by the API instead of the secret
+	PasswordMode       string `json:"passwordMode"`       // WebhookPasswordPlain or WebhookPasswordSHA256
+	Timeout            int    `json:"timeout"`            // Request timeout in seconds
+	InsecureSkipVerify bool   `json:"insecureSkipVerify"` // Skip TLS certificate verification (testing only)
+	CacheTTL           int    `json:"cacheTTL"`           // Seconds allowed logins are cached unless the response sets ttl (0 = no cache)
+	NegativeCacheTTL   int    `json:"negativeCacheTTL"`   // Seconds denied logins are cached (0 = no cache)
+	FailOpen           bool   `json:"failOpen"`           // Admit users while the endpoint is unavailable
+	BreakerThreshold   int    `json:"breakerThreshold"`   // Consecutive failures that open the circuit
+	BreakerCooldown    int    `json:"breakerCooldown"`    // Seconds the circuit stays open before the endpoint is tried again
+}
+
+// AuthConfig holds the authentication backend configuration
+type AuthConfig struct {
+	Backends []string      `json:"backends"` // Backend order, e.g. ["local", "ldap"]
+	Fallback string        `json:"fallback"` // AuthFallbackUnavailable or AuthFallbackAny
+	LDAP     LDAPConfig    `json:"ldap"`
+	RADIUS   RADIUSConfig  `json:"radius"`
+	Webhook  WebhookConfig `json:"webhook"`
+}
+
+// DefaultAuthConfig returns the configuration used when none is stored: local users only
+func DefaultAuthConfig() AuthConfig {
+	return AuthConfig{
+		Backends: []string{AuthBackendLocal},
+		Fallback: AuthFallbackUnavailable,
+		LDAP: LDAPConfig{
+			Timeout:        5,
+			GroupAttribute: "memberOf",
+			CacheTTL:       300,
+		},
+		RADIUS: RADIUSConfig{
+			Method:        RADIUSMethodPAP,
+			Timeout:       5,
+			Retries:       2,
+			NASIdentifier: "go-proxy-server",
+		},
+		Webhook: WebhookConfig{
+			PasswordMode:     WebhookPasswordPlain,
+			Timeout:          5,
+			CacheTTL:         60,
+			NegativeCacheTTL: 10,
+			BreakerThreshold: 5,
+			BreakerCooldown:  30,
+		},
+	}
+}
+
+// Global authentication configuration (thread-safe with atomic operations)
+var authConfig atomic.Pointer[AuthConfig]
+
+func init() {
+	cfg := DefaultAuthConfig()
+	authConfig.Store(&cfg)
+}
+
+// Validate checks the backend order and the configuration of every enabled backend
+func (c AuthConfig) Validate() error {
+	if len(c.Backends) == 0 {
+		return fmt.Errorf("at least one authentication backend is required")
+	}
+	seen := make(map[string]bool)
+	for _, backend := range c.Backends {
+		if seen[backend] {
+			return fmt.Errorf("authentication backend %q listed twice", backend)
+		}
+		seen[backend] = true
+		switch backend {
+		case AuthBackendLocal:
+		case AuthBackendLDAP:
+			if err := c.LDAP.Validate(); err != nil {
+				return fmt.Errorf("ldap: %w", err)
+			}
+		case AuthBackendRADIUS:
+			if err := c.RADIUS.Validate(); err != nil {
+				return fmt.Errorf("radius: %w", err)
+			}
+		case AuthBackendWebhook:
+			if err := c.Webhook.Validate(); err != nil {
+				return fmt.Errorf("webhook: %w", err)
+			}
+		default:
+			return fmt.Errorf("unknown authentication backend %q", backend)
+		}
+	}
+	if c.Fallback != AuthFallbackUnavailable && c.Fallback != AuthFallbackAny {
+		return fmt.Errorf("fallback must be %q or %q", AuthFallbackUnavailable, AuthFallbackAny)
+	}
+	return nil
+}
+
+// Validate checks the LDAP configuration
+func (c LDAPConfig) Validate() error {
+	if len(c.Servers) == 0 {
+		return fmt.Errorf("at least one server is required")
+	}
+	for _, server := range c.Servers {
+		u, err := url.Parse(server)
+		if err != nil || (u.Scheme != "ldap" && u.Scheme != "ldaps") || u.Host == "" {
+			return fmt.Errorf("invalid server %q (expected ldap://host:port or ldaps://host:port)", server)
+		}
+	}
+	if c.Timeout <= 0 || c.Timeout > 60 {
+		return fmt.Errorf("timeout must be between 1 and 60 seconds")
+	}
+	if c.UserDNTemplate == "" {
+		if c.BaseDN == "" || c.UserFilter == "" {
+			return fmt.Errorf("either userDNTemplate or baseDN and userFilter are required")
+		}
+		if strings.Count(c.UserFilter, "%s") != 1 {
+			return fmt.Errorf("userFilter must contain exactly one %%s")
+		}
+	} else if strings.Count(c.UserDNTemplate, "%s") != 1 {
+		return fmt.Errorf("userDNTemplate must contain exactly one %%s")
+	}
+	if c.CacheTTL < 0 || c.CacheTTL > MaxAuthCacheTTL {
+		return fmt.Errorf("cacheTTL must be between 0 and %d seconds", MaxAuthCacheTTL)
+	}
+	for _, mapping := range c.GroupMappings {
+		if mapping.LDAPGroup == "" || mapping.ProxyGroup == "" {
+			return fmt.Errorf("group mappings need both ldapGroup and proxyGroup")
+		}
+	}
+	return nil
+}
+
+// Validate checks the RADIUS configuration
+func (c RADIUSConfig) Validate() error {
+	if len(c.Servers) == 0 {
+		return fmt.Errorf("at least one server is required")
+	}
+	for _, server := range append(append([]string{}, c.Servers...), c.AccountingServers...) {
+		if _, port, err := net.SplitHostPort(server); err != nil || port == "" {
+			return fmt.Errorf("invalid server %q (expected host:port)", server)
+		}
+	}
+	if c.Secret == "" {
+		return fmt.Errorf("shared secret is required")
+	}
+	if c.Method != RADIUSMethodPAP && c.Method != RADIUSMethodCHAP {
+		return fmt.Errorf("method must be %q or %q", RADIUSMethodPAP, RADIUSMethodCHAP)
+	}
+	if c.Timeout <= 0 || c.Timeout > 60 {
+		return fmt.Errorf("timeout must be between 1 and 60 seconds")
+	}
+	if c.Retries < 0 || c.Retries > 10 {
+		return fmt.Errorf("retries must be between 0 and 10")
+	}
+	if c.Accounting && len(c.AccountingServers) == 0 {
+		return fmt.Errorf("accounting requires at least one accounting server")
+	}
+	if c.InterimInterval != 0 && (c.InterimInterval < 60 || c.InterimInterval > 86400) {
+		return fmt.Errorf("interimInterval must be 0 or between 60 and 86400 seconds")
+	}
+	return nil
+}
+
+// Validate checks the webhook configuration
+func (c WebhookConfig) Validate() error {
+	u, err := url.Parse(c.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid url %q (expected http:// or https:// URL)", c.URL)
+	}
+	if c.PasswordMode != WebhookPasswordPlain && c.PasswordMode != WebhookPasswordSHA256 {
+		return fmt.Errorf("passwordMode must be %q or %q", WebhookPasswordPlain, WebhookPasswordSHA256)
+	}
+	if c.Timeout <= 0 || c.Timeout > 60 {
+		return fmt.Errorf("timeout must be between 1 and 60 seconds")
+	}
+	if c.CacheTTL < 0 || c.CacheTTL > MaxAuthCacheTTL || c.NegativeCacheTTL < 0 || c.NegativeCacheTTL > MaxAuthCacheTTL {
+		return fmt.Errorf("cacheTTL and negativeCacheTTL must be between 0 and %d seconds", MaxAuthCacheTTL)
+	}
+	if c.BreakerThreshold < 1 {
+		return fmt.Errorf("breakerThreshold must be at least 1")
+	}
+	if c.BreakerCooldown < 1 || c.BreakerCooldown > 3600 {
+		return fmt.Errorf("breakerCooldown must be between 1 and 3600 seconds")
+	}
+	return nil
+}
+
+// InitAuthConfig initializes the authentication configuration from database
+func InitAuthConfig(db *gorm.DB) error {
+	value, err := GetSystemConfig(db, KeyAuthConfig)
+	if err != nil {
+		return fmt.Errorf("failed to load authentication configuration: %w", err)
+	}
+	cfg := DefaultAuthConfig()
+	if value != "" {
+		if err := json.Unmarshal([]byte(value), &cfg); err != nil {
+			return fmt.Errorf("invalid authentication configuration: %w", err)
+		}
+		if err := cfg.Validate(); err != nil {
+			return fmt.Errorf("invalid authentication configuration: %w", err)
+		}
+	}
+	authConfig.Store(&cfg)
+	return nil
+}
+
+// GetAuthConfig returns the current authentication configuration
+func GetAuthConfig() AuthConfig {
+	return *authConfig.Load()
+}
+
+// UpdateAuthConfig updates the authentication configuration in database and memory
+func UpdateAuthConfig(db *gorm.DB, cfg AuthConfig) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	value, err := json.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	if err := SetSystemConfig(db, KeyAuthConfig, string(value)); err != nil {
+		return fmt.Errorf("failed to save authentication configuration: %w", err)
+	}
+	authConfig.Store(&cfg)
+	return nil
+}
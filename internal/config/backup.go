@@ -0,0 +1,112 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"sync/atomic"
+
+	"gorm.io/gorm"
+)
+
+// System configuration keys for scheduled database backups
+const (
+	KeyBackupIntervalHours = "backup_interval_hours"
+	KeyBackupRetention     = "backup_retention"
+)
+
+// Limits of the scheduled backup settings
+const (
+	MaxBackupIntervalHours = 24 * 30
+	MaxBackupRetention     = 1000
+)
+
+// BackupConfig holds the scheduled backup configuration
+// Backups are written to the backups directory of the data directory; an interval of 0 disables them
+type BackupConfig struct {
+	IntervalHours int `json:"intervalHours"` // Hours between scheduled backups (0 = disabled)
+	Retention     int `json:"retention"`     // Number of scheduled backups kept, older ones are deleted
+}
+
+// DefaultBackupConfig returns the configuration used before anything is saved: a daily backup, kept for a week
+func DefaultBackupConfig() BackupConfig {
+	return BackupConfig{IntervalHours: 24, Retention: 7}
+}
+
+var backupConfig atomic.Pointer[BackupConfig]
+
+func init() {
+	cfg := DefaultBackupConfig()
+	backupConfig.Store(&cfg)
+}
+
+// backupKeys maps configuration keys to fields of BackupConfig
+func backupKeys(cfg *BackupConfig) map[string]*int {
+	return map[string]*int{
+		KeyBackupIntervalHours: &cfg.IntervalHours,
+		KeyBackupRetention:     &cfg.Retention,
+	}
+}
+
+// Validate checks all values of the backup configuration
+func (c BackupConfig) Validate() error {
+	if c.IntervalHours < 0 || c.IntervalHours > MaxBackupIntervalHours {
+		return fmt.Errorf("backup interval must be between 0 (disabled) and %d hours", MaxBackupIntervalHours)
+	}
+	if c.Retention < 1 || c.Retention > MaxBackupRetention {
+		return fmt.Errorf("backup retention must be between 1 and %d backups", MaxBackupRetention)
+	}
+	return nil
+}
+
+// InitBackupConfig initializes the backup configuration from database
+func InitBackupConfig(db *gorm.DB) error {
+	cfg := DefaultBackupConfig()
+	for key, field := range backupKeys(&cfg) {
+		value, err := GetSystemConfig(db, key)
+		if err != nil {
+			return fmt.Errorf("failed to load %s: %w", key, err)
+		}
+		if value == "" {
+			// Not configured, keep the default
+			continue
+		}
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("invalid %s value: %w", key, err)
+		}
+		*field = parsed
+	}
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	backupConfig.Store(&cfg)
+
+	return nil
+}
+
+// GetBackupConfig returns the current backup configuration
+func GetBackupConfig() BackupConfig {
+	return *backupConfig.Load()
+}
+
+// UpdateBackupConfig updates the backup configuration in database and memory
+func UpdateBackupConfig(db *gorm.DB, cfg BackupConfig) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		for key, value := range backupKeys(&cfg) {
+			if err := SetSystemConfig(tx, key, strconv.Itoa(*value)); err != nil {
+				return fmt.Errorf("failed to save %s: %w", key, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	backupConfig.Store(&cfg)
+	return nil
+}
@@ -0,0 +1,128 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"sync/atomic"
+
+	"gorm.io/gorm"
+)
+
+// System configuration keys for bandwidth shaping (all values in bytes/sec, 0 = unlimited)
+const (
+	KeyBandwidthGlobalUpload    = "bandwidth_global_upload"
+	KeyBandwidthGlobalDownload  = "bandwidth_global_download"
+	KeyBandwidthPerIPUpload     = "bandwidth_per_ip_upload"
+	KeyBandwidthPerIPDownload   = "bandwidth_per_ip_download"
+	KeyBandwidthPerUserUpload   = "bandwidth_per_user_upload"
+	KeyBandwidthPerUserDownload = "bandwidth_per_user_download"
+	KeyBandwidthBurst           = "bandwidth_burst"
+)
+
+// MaxBandwidthRate is the upper bound accepted for any rate or burst value (10 GiB/s)
+const MaxBandwidthRate = 10 * 1024 * 1024 * 1024
+
+// BandwidthConfig holds the bandwidth shaping configuration
+// Rates are in bytes per second; 0 means unlimited
+// Burst is the token bucket size in bytes; 0 means one second worth of traffic
+type BandwidthConfig struct {
+	GlobalUpload    int64 `json:"globalUpload"`
+	GlobalDownload  int64 `json:"globalDownload"`
+	PerIPUpload     int64 `json:"perIPUpload"`
+	PerIPDownload   int64 `json:"perIPDownload"`
+	PerUserUpload   int64 `json:"perUserUpload"`
+	PerUserDownload int64 `json:"perUserDownload"`
+	Burst           int64 `json:"burst"`
+}
+
+// Global bandwidth configuration (thread-safe with atomic operations)
+var bandwidthConfig atomic.Pointer[BandwidthConfig]
+
+func init() {
+	// Default to unlimited to prevent zero-value issues
+	bandwidthConfig.Store(&BandwidthConfig{})
+}
+
+// bandwidthKeys maps configuration keys to fields of BandwidthConfig
+func bandwidthKeys(cfg *BandwidthConfig) map[string]*int64 {
+	return map[string]*int64{
+		KeyBandwidthGlobalUpload:    &cfg.GlobalUpload,
+		KeyBandwidthGlobalDownload:  &cfg.GlobalDownload,
+		KeyBandwidthPerIPUpload:     &cfg.PerIPUpload,
+		KeyBandwidthPerIPDownload:   &cfg.PerIPDownload,
+		KeyBandwidthPerUserUpload:   &cfg.PerUserUpload,
+		KeyBandwidthPerUserDownload: &cfg.PerUserDownload,
+		KeyBandwidthBurst:           &cfg.Burst,
+	}
+}
+
+// validateRate checks that a rate or burst value is within the accepted range
+func validateRate(name string, value int64) error {
+	if value < 0 || value > MaxBandwidthRate {
+		return fmt.Errorf("%s must be between 0 (unlimited) and %d bytes/sec", name, int64(MaxBandwidthRate))
+	}
+	return nil
+}
+
+// Validate checks all values of the bandwidth configuration
+func (c BandwidthConfig) Validate() error {
+	for key, value := range bandwidthKeys(&c) {
+		if err := validateRate(key, *value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// InitBandwidthConfig initializes the bandwidth configuration from database
+func InitBandwidthConfig(db *gorm.DB) error {
+	cfg := &BandwidthConfig{}
+	for key, field := range bandwidthKeys(cfg) {
+		value, err := GetSystemConfig(db, key)
+		if err != nil {
+			return fmt.Errorf("failed to load %s: %w", key, err)
+		}
+		if value == "" {
+			// Not configured, default to unlimited
+			continue
+		}
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid %s value: %w", key, err)
+		}
+		if err := validateRate(key, parsed); err != nil {
+			return err
+		}
+		*field = parsed
+	}
+	bandwidthConfig.Store(cfg)
+
+	return nil
+}
+
+// GetBandwidthConfig returns the current bandwidth configuration
+func GetBandwidthConfig() BandwidthConfig {
+	return *bandwidthConfig.Load()
+}
+
+// UpdateBandwidthConfig updates the bandwidth configuration in database and memory
+func UpdateBandwidthConfig(db *gorm.DB, cfg BandwidthConfig) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		for key, value := range bandwidthKeys(&cfg) {
+			if err := SetSystemConfig(tx, key, strconv.FormatInt(*value, 10)); err != nil {
+				return fmt.Errorf("failed to save %s: %w", key, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	bandwidthConfig.Store(&cfg)
+	return nil
+}
@@ -11,7 +11,6 @@ import (
 
 	"gorm.io/gorm"
 
-	"go-proxy-server/internal/constants"
 	"go-proxy-server/internal/models"
 )
 
@@ -22,6 +21,7 @@ type TimeoutConfig struct {
 	IdleWrite        time.Duration // Idle write timeout (no data sent)
 	MaxConnectionAge time.Duration // Maximum connection lifetime
 	CleanupTimeout   time.Duration // Timeout for graceful connection cleanup
+	Drain            time.Duration // Time open connections get to finish when a listener stops before they are force-closed
 }
 
 // DefaultTimeout provides default timeout values
@@ -30,12 +30,36 @@ type TimeoutConfig struct {
 // - IdleWrite: 120 seconds (2 minutes) for idle write operations
 // - MaxConnectionAge: 2 hours for maximum connection lifetime
 // - CleanupTimeout: 5 seconds for graceful connection cleanup
+// - Drain: 30 seconds for open connections to finish on stop and shutdown
 var DefaultTimeout = TimeoutConfig{
 	Connect:          30 * time.Second,
 	IdleRead:         300 * time.Second,
 	IdleWrite:        120 * time.Second,
 	MaxConnectionAge: 2 * time.Hour,
 	CleanupTimeout:   5 * time.Second,
+	Drain:            30 * time.Second,
+}
+
+// Validate checks that all timeouts are set and within the ranges accepted by the API
+func (t TimeoutConfig) Validate() error {
+	limits := []struct {
+		name  string
+		value time.Duration
+		max   time.Duration
+	}{
+		{"connect timeout", t.Connect, 300 * time.Second},
+		{"idle read timeout", t.IdleRead, time.Hour},
+		{"idle write timeout", t.IdleWrite, time.Hour},
+		{"max connection age", t.MaxConnectionAge, 7 * 24 * time.Hour},
+		{"cleanup timeout", t.CleanupTimeout, 300 * time.Second},
+		{"drain timeout", t.Drain, time.Hour},
+	}
+	for _, limit := range limits {
+		if limit.value < time.Second || limit.value > limit.max {
+			return fmt.Errorf("%s must be between 1 and %d seconds", limit.name, int(limit.max.Seconds()))
+		}
+	}
+	return nil
 }
 
 // Global timeout configuration with thread-safe access
@@ -59,7 +83,7 @@ func LoadTimeoutFromDB(db *gorm.DB) error {
 
 	// Try to load from database
 	var configs []models.SystemConfig
-	err := db.Where("key IN ?", []string{"timeout_connect", "timeout_idle_read", "timeout_idle_write"}).Find(&configs).Error
+	err := db.Where(keyColumn("timeout_connect", "timeout_idle_read", "timeout_idle_write", "timeout_max_connection_age", "timeout_cleanup", "timeout_drain")).Find(&configs).Error
 	if err != nil {
 		return err
 	}
@@ -76,6 +100,7 @@ func LoadTimeoutFromDB(db *gorm.DB) error {
 	idleWriteSec := parseTimeoutOrDefault(configMap["timeout_idle_write"], 120)
 	maxConnectionAgeSec := parseTimeoutOrDefault(configMap["timeout_max_connection_age"], 7200) // 2 hours
 	cleanupSec := parseTimeoutOrDefault(configMap["timeout_cleanup"], 5)
+	drainSec := parseTimeoutOrDefault(configMap["timeout_drain"], 30)
 
 	currentTimeout = TimeoutConfig{
 		Connect:          time.Duration(connectSec) * time.Second,
@@ -83,6 +108,7 @@ func LoadTimeoutFromDB(db *gorm.DB) error {
 		IdleWrite:        time.Duration(idleWriteSec) * time.Second,
 		MaxConnectionAge: time.Duration(maxConnectionAgeSec) * time.Second,
 		CleanupTimeout:   time.Duration(cleanupSec) * time.Second,
+		Drain:            time.Duration(drainSec) * time.Second,
 	}
 
 	// If not found in database, save default values
@@ -101,6 +127,7 @@ func SaveTimeoutToDB(db *gorm.DB, timeout TimeoutConfig) error {
 		{Key: "timeout_idle_write", Value: fmt.Sprintf("%d", int(timeout.IdleWrite.Seconds()))},
 		{Key: "timeout_max_connection_age", Value: fmt.Sprintf("%d", int(timeout.MaxConnectionAge.Seconds()))},
 		{Key: "timeout_cleanup", Value: fmt.Sprintf("%d", int(timeout.CleanupTimeout.Seconds()))},
+		{Key: "timeout_drain", Value: fmt.Sprintf("%d", int(timeout.Drain.Seconds()))},
 	}
 
 	// Use transaction to ensure all configs are saved atomically
@@ -108,7 +135,7 @@ func SaveTimeoutToDB(db *gorm.DB, timeout TimeoutConfig) error {
 		for _, cfg := range configs {
 			// Use GORM's Save which will update if exists or create if not
 			var existing models.SystemConfig
-			err := tx.Where("key = ?", cfg.Key).First(&existing).Error
+			err := tx.Where(keyColumn(cfg.Key)).First(&existing).Error
 			if err == gorm.ErrRecordNotFound {
 				// Create new record
 				if err := tx.Create(&cfg).Error; err != nil {
@@ -161,22 +188,6 @@ func InitTimeout(db *gorm.DB) error {
 	return LoadTimeoutFromDB(db)
 }
 
-// StartTimeoutReloader starts a background goroutine to reload timeout configuration periodically
-func StartTimeoutReloader(db *gorm.DB) {
-	go func() {
-		ticker := time.NewTicker(constants.TimeoutReloadInterval)
-		defer ticker.Stop()
-
-		for range ticker.C {
-			if err := LoadTimeoutFromDB(db); err != nil {
-				// Log error but don't stop the reloader
-				// Note: We can't use logger here to avoid circular dependency
-				// The error will be logged by the caller if needed
-			}
-		}
-	}()
-}
-
 // GetDataDir returns the user data directory for the application
 func GetDataDir() (string, error) {
 	var dataDir string
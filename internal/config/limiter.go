@@ -12,6 +12,12 @@ import (
 const (
 	KeyMaxConcurrentConnections      = "max_concurrent_connections"
 	KeyMaxConcurrentConnectionsPerIP = "max_concurrent_connections_per_ip"
+
+	// Per-user defaults and connection-rate limits (0 = unlimited)
+	KeyMaxConcurrentConnectionsPerUser = "max_concurrent_connections_per_user"
+	KeyMaxNewConnectionsPerUserSecond  = "max_new_connections_per_user_second"
+	KeyMaxNewConnectionsPerUserMinute  = "max_new_connections_per_user_minute"
+	KeyMaxNewConnectionsPerIPSecond    = "max_new_connections_per_ip_second"
 )
 
 // Default connection limits
@@ -20,22 +26,36 @@ const (
 	DefaultMaxConcurrentConnectionsPerIP = 1000
 )
 
+// MaxConnectionRate is the upper bound accepted for connection-rate limits
+const MaxConnectionRate = 1000000
+
 // LimiterConfig holds the connection limiter configuration
 type LimiterConfig struct {
 	MaxConcurrentConnections      int32
 	MaxConcurrentConnectionsPerIP int32
 }
 
+// UserLimiterConfig holds per-user connection limits and connection-rate limits
+// The per-user values are defaults that can be overridden for individual users
+type UserLimiterConfig struct {
+	MaxConcurrentConnectionsPerUser int32 `json:"maxConcurrentConnectionsPerUser"`
+	MaxNewConnectionsPerUserSecond  int32 `json:"maxNewConnectionsPerUserSecond"`
+	MaxNewConnectionsPerUserMinute  int32 `json:"maxNewConnectionsPerUserMinute"`
+	MaxNewConnectionsPerIPSecond    int32 `json:"maxNewConnectionsPerIPSecond"`
+}
+
 // Global limiter configuration (thread-safe with atomic operations)
 var (
 	globalMaxConnections      atomic.Int32
 	globalMaxConnectionsPerIP atomic.Int32
+	userLimiterConfig         atomic.Pointer[UserLimiterConfig]
 )
 
 func init() {
 	// Set default values to prevent zero-value issues
 	globalMaxConnections.Store(DefaultMaxConcurrentConnections)
 	globalMaxConnectionsPerIP.Store(DefaultMaxConcurrentConnectionsPerIP)
+	userLimiterConfig.Store(&UserLimiterConfig{})
 }
 
 // InitLimiterConfig initializes the connection limiter configuration from database
@@ -98,6 +118,82 @@ func InitLimiterConfig(db *gorm.DB) error {
 	globalMaxConnections.Store(maxConn)
 	globalMaxConnectionsPerIP.Store(maxConnPerIP)
 
+	// Load per-user and connection-rate limits (not configured means unlimited)
+	userCfg := &UserLimiterConfig{}
+	for key, field := range userLimiterKeys(userCfg) {
+		value, err := GetSystemConfig(db, key)
+		if err != nil {
+			return fmt.Errorf("failed to load %s: %w", key, err)
+		}
+		if value == "" {
+			continue
+		}
+		parsed, err := strconv.ParseInt(value, 10, 32)
+		if err != nil {
+			return fmt.Errorf("invalid %s value: %w", key, err)
+		}
+		*field = int32(parsed)
+	}
+	if err := userCfg.Validate(); err != nil {
+		return err
+	}
+	userLimiterConfig.Store(userCfg)
+
+	return nil
+}
+
+// userLimiterKeys maps configuration keys to fields of UserLimiterConfig
+func userLimiterKeys(cfg *UserLimiterConfig) map[string]*int32 {
+	return map[string]*int32{
+		KeyMaxConcurrentConnectionsPerUser: &cfg.MaxConcurrentConnectionsPerUser,
+		KeyMaxNewConnectionsPerUserSecond:  &cfg.MaxNewConnectionsPerUserSecond,
+		KeyMaxNewConnectionsPerUserMinute:  &cfg.MaxNewConnectionsPerUserMinute,
+		KeyMaxNewConnectionsPerIPSecond:    &cfg.MaxNewConnectionsPerIPSecond,
+	}
+}
+
+// validateConnectionRate checks that a connection limit is within the accepted range
+func validateConnectionRate(name string, value int32) error {
+	if value < 0 || value > MaxConnectionRate {
+		return fmt.Errorf("%s must be between 0 (unlimited) and %d", name, MaxConnectionRate)
+	}
+	return nil
+}
+
+// Validate checks all values of the user limiter configuration
+func (c UserLimiterConfig) Validate() error {
+	for key, value := range userLimiterKeys(&c) {
+		if err := validateConnectionRate(key, *value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetUserLimiterConfig returns the current per-user and connection-rate limits
+func GetUserLimiterConfig() UserLimiterConfig {
+	return *userLimiterConfig.Load()
+}
+
+// UpdateUserLimiterConfig updates per-user and connection-rate limits in database and memory
+func UpdateUserLimiterConfig(db *gorm.DB, cfg UserLimiterConfig) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		for key, value := range userLimiterKeys(&cfg) {
+			if err := SetSystemConfig(tx, key, strconv.Itoa(int(*value))); err != nil {
+				return fmt.Errorf("failed to save %s: %w", key, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	userLimiterConfig.Store(&cfg)
 	return nil
 }
 
@@ -109,16 +205,24 @@ func GetLimiterConfig() LimiterConfig {
 	}
 }
 
-// UpdateLimiterConfig updates the connection limiter configuration
-// Note: This only updates the in-memory configuration. Existing limiters need to be recreated.
-func UpdateLimiterConfig(db *gorm.DB, maxConn, maxConnPerIP int32) error {
-	// Validate values (0 means unlimited)
-	if maxConn < 0 || maxConn > 1000000 {
+// Validate checks the connection limits (0 means unlimited)
+func (c LimiterConfig) Validate() error {
+	if c.MaxConcurrentConnections < 0 || c.MaxConcurrentConnections > 1000000 {
 		return fmt.Errorf("max concurrent connections must be between 0 (unlimited) and 1000000")
 	}
-	if maxConnPerIP < 0 || maxConnPerIP > 100000 {
+	if c.MaxConcurrentConnectionsPerIP < 0 || c.MaxConcurrentConnectionsPerIP > 100000 {
 		return fmt.Errorf("max concurrent connections per IP must be between 0 (unlimited) and 100000")
 	}
+	return nil
+}
+
+// UpdateLimiterConfig updates the connection limiter configuration
+// New limits apply to the next connection attempt; existing connections are not affected
+func UpdateLimiterConfig(db *gorm.DB, maxConn, maxConnPerIP int32) error {
+	// Validate values (0 means unlimited)
+	if err := (LimiterConfig{MaxConcurrentConnections: maxConn, MaxConcurrentConnectionsPerIP: maxConnPerIP}).Validate(); err != nil {
+		return err
+	}
 
 	// Save to database
 	if err := SetSystemConfig(db, KeyMaxConcurrentConnections, strconv.Itoa(int(maxConn))); err != nil {
@@ -3,37 +3,159 @@ package config
 import (
 	"errors"
 	"fmt"
+	"net"
+	"regexp"
 
 	"gorm.io/gorm"
 
 	"go-proxy-server/internal/models"
 )
 
-// LoadProxyConfig loads proxy configuration from database by type
-func LoadProxyConfig(db *gorm.DB, proxyType string) (*models.ProxyConfig, error) {
+// Listener types
+const (
+	ListenerSOCKS5 = "socks5"
+	ListenerHTTP   = "http"
+)
+
+// Listener authentication modes
+const (
+	AuthModeDefault   = "default"   // Whitelisted IPs connect without credentials, others need a username and password
+	AuthModePassword  = "password"  // Username and password only; the whitelist is ignored
+	AuthModeWhitelist = "whitelist" // Whitelisted IPs only
+)
+
+// Listener address families
+const (
+	IPFamilyDual = "dual" // IPv4 and IPv6; the wildcard address is one dual-stack socket
+	IPFamilyIPv4 = "ipv4"
+	IPFamilyIPv6 = "ipv6" // IPv6 only; the wildcard socket does not accept IPv4 connections
+)
+
+// interfaceNamePattern accepts network interface names, which may contain spaces on Windows
+var interfaceNamePattern = regexp.MustCompile(`^[^\s:/%][^:/%\x00-\x1f]{0,63}$`)
+
+// listenerNamePattern restricts listener names to identifiers usable in URLs and access rules
+var listenerNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,31}$`)
+
+// ValidateListenerName checks the format of a listener name
+func ValidateListenerName(name string) error {
+	if !listenerNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid listener name %q (1-32 lowercase letters, digits, '-' or '_')", name)
+	}
+	return nil
+}
+
+// ValidateListenAddress checks the listen address, address family and listen-each setting of a listener
+func ValidateListenAddress(address, ipFamily string, each bool) error {
+	switch ipFamily {
+	case "", IPFamilyDual, IPFamilyIPv4, IPFamilyIPv6:
+	default:
+		return fmt.Errorf("ip family must be %q, %q or %q", IPFamilyDual, IPFamilyIPv4, IPFamilyIPv6)
+	}
+	if ip := net.ParseIP(address); ip != nil {
+		if each {
+			return fmt.Errorf("listen each requires an empty listen address or an interface name")
+		}
+		if ip.To4() != nil && ipFamily == IPFamilyIPv6 {
+			return fmt.Errorf("listen address %s is not an IPv6 address", address)
+		}
+		if ip.To4() == nil && ipFamily == IPFamilyIPv4 {
+			return fmt.Errorf("listen address %s is not an IPv4 address", address)
+		}
+	} else if address != "" && !interfaceNamePattern.MatchString(address) {
+		return fmt.Errorf("invalid listen address %q (expected an IP address or an interface name)", address)
+	}
+	return nil
+}
+
+// ValidateProxyConfig checks a listener configuration and fills in the default authentication mode and address family
+func ValidateProxyConfig(config *models.ProxyConfig) error {
+	if err := ValidateListenerName(config.Name); err != nil {
+		return err
+	}
+	if config.Type != ListenerSOCKS5 && config.Type != ListenerHTTP {
+		return fmt.Errorf("invalid proxy type: %s", config.Type)
+	}
+	if config.IPFamily == "" {
+		config.IPFamily = IPFamilyDual
+	}
+	if err := ValidateListenAddress(config.ListenAddress, config.IPFamily, config.ListenEach); err != nil {
+		return err
+	}
+	if config.Port < 0 || config.Port > 65535 {
+		return fmt.Errorf("port must be between 0 and 65535")
+	}
+	switch config.AuthMode {
+	case "":
+		config.AuthMode = AuthModeDefault
+	case AuthModeDefault, AuthModePassword, AuthModeWhitelist:
+	default:
+		return fmt.Errorf("auth mode must be %q, %q or %q", AuthModeDefault, AuthModePassword, AuthModeWhitelist)
+	}
+	if config.TLS && (config.TLSCert == "" || config.TLSKey == "") {
+		return fmt.Errorf("tls requires a certificate and a key file")
+	}
+	if err := validateRate("upload rate", config.UploadRate); err != nil {
+		return err
+	}
+	if err := validateRate("download rate", config.DownloadRate); err != nil {
+		return err
+	}
+	if config.MaxConnections < 0 || config.MaxConnectionsPerIP < 0 {
+		return fmt.Errorf("connection limits must not be negative (0 = global setting)")
+	}
+	return nil
+}
+
+// ListProxyConfigs loads all listener configurations ordered by name
+func ListProxyConfigs(db *gorm.DB) ([]models.ProxyConfig, error) {
+	var configs []models.ProxyConfig
+	if err := db.Order("name").Find(&configs).Error; err != nil {
+		return nil, err
+	}
+	for i := range configs {
+		fillProxyConfigDefaults(&configs[i])
+	}
+	return configs, nil
+}
+
+// LoadProxyConfig loads a listener configuration from database by name
+func LoadProxyConfig(db *gorm.DB, name string) (*models.ProxyConfig, error) {
 	var config models.ProxyConfig
-	err := db.Where("type = ?", proxyType).First(&config).Error
+	err := db.Where("name = ?", name).First(&config).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, nil // No config found, not an error
 		}
 		return nil, err
 	}
+	fillProxyConfigDefaults(&config)
 	return &config, nil
 }
 
-// SaveProxyConfig saves proxy configuration to database
+// fillProxyConfigDefaults sets the authentication mode and address family of rows saved before listeners had them
+func fillProxyConfigDefaults(config *models.ProxyConfig) {
+	if config.AuthMode == "" {
+		config.AuthMode = AuthModeDefault
+	}
+	if config.IPFamily == "" {
+		config.IPFamily = IPFamilyDual
+	}
+}
+
+// SaveProxyConfig creates or updates a listener configuration by name
 func SaveProxyConfig(db *gorm.DB, config *models.ProxyConfig) error {
-	if config.Type != "socks5" && config.Type != "http" {
-		return fmt.Errorf("invalid proxy type: %s", config.Type)
+	if err := ValidateProxyConfig(config); err != nil {
+		return err
 	}
 
 	// Check if config already exists
 	var existing models.ProxyConfig
-	err := db.Where("type = ?", config.Type).First(&existing).Error
+	err := db.Where("name = ?", config.Name).First(&existing).Error
 
 	if errors.Is(err, gorm.ErrRecordNotFound) {
 		// Create new config
+		config.ID = 0
 		return db.Create(config).Error
 	} else if err != nil {
 		return err
@@ -41,16 +163,17 @@ func SaveProxyConfig(db *gorm.DB, config *models.ProxyConfig) error {
 
 	// Update existing config
 	config.ID = existing.ID
+	config.CreatedAt = existing.CreatedAt
 	return db.Save(config).Error
 }
 
-// DeleteProxyConfig deletes proxy configuration from database
-func DeleteProxyConfig(db *gorm.DB, proxyType string) error {
+// DeleteProxyConfig deletes a listener configuration from database
+func DeleteProxyConfig(db *gorm.DB, name string) error {
 	// Use Unscoped to permanently delete the record (hard delete)
-	return db.Unscoped().Where("type = ?", proxyType).Delete(&models.ProxyConfig{}).Error
+	return db.Unscoped().Where("name = ?", name).Delete(&models.ProxyConfig{}).Error
 }
 
-// UpdateProxyAutoStart updates only the AutoStart field for a proxy type
-func UpdateProxyAutoStart(db *gorm.DB, proxyType string, autoStart bool) error {
-	return db.Model(&models.ProxyConfig{}).Where("type = ?", proxyType).Update("auto_start", autoStart).Error
+// UpdateProxyAutoStart updates only the AutoStart field of a listener
+func UpdateProxyAutoStart(db *gorm.DB, name string, autoStart bool) error {
+	return db.Model(&models.ProxyConfig{}).Where("name = ?", name).Update("auto_start", autoStart).Error
 }
@@ -2,8 +2,10 @@ package config
 
 import (
 	"errors"
+	"strconv"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 
 	"go-proxy-server/internal/models"
 )
@@ -11,12 +13,26 @@ import (
 // System configuration keys
 const (
 	KeyAutoStart = "autostart_enabled"
+	// Counter raised by commands that change the database, for servers they cannot signal
+	KeyConfigRevision = "config_revision"
 )
 
+// keyColumn matches system configuration keys; "key" is reserved in MySQL, so the column is quoted by the dialect
+func keyColumn(keys ...string) clause.Expression {
+	if len(keys) == 1 {
+		return clause.Eq{Column: clause.Column{Name: "key"}, Value: keys[0]}
+	}
+	values := make([]interface{}, len(keys))
+	for i, key := range keys {
+		values[i] = key
+	}
+	return clause.IN{Column: clause.Column{Name: "key"}, Values: values}
+}
+
 // GetSystemConfig gets a system configuration value
 func GetSystemConfig(db *gorm.DB, key string) (string, error) {
 	var config models.SystemConfig
-	err := db.Where("key = ?", key).First(&config).Error
+	err := db.Where(keyColumn(key)).First(&config).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return "", nil // Not found, return empty string
@@ -29,7 +45,7 @@ func GetSystemConfig(db *gorm.DB, key string) (string, error) {
 // SetSystemConfig sets a system configuration value
 func SetSystemConfig(db *gorm.DB, key, value string) error {
 	var config models.SystemConfig
-	err := db.Where("key = ?", key).First(&config).Error
+	err := db.Where(keyColumn(key)).First(&config).Error
 
 	if errors.Is(err, gorm.ErrRecordNotFound) {
 		// Create new config
@@ -49,5 +65,25 @@ func SetSystemConfig(db *gorm.DB, key, value string) error {
 
 // DeleteSystemConfig deletes a system configuration
 func DeleteSystemConfig(db *gorm.DB, key string) error {
-	return db.Unscoped().Where("key = ?", key).Delete(&models.SystemConfig{}).Error
+	return db.Unscoped().Where(keyColumn(key)).Delete(&models.SystemConfig{}).Error
+}
+
+// GetConfigRevision returns the configuration revision raised by commands that change the database
+func GetConfigRevision(db *gorm.DB) (int, error) {
+	value, err := GetSystemConfig(db, KeyConfigRevision)
+	if err != nil || value == "" {
+		return 0, err
+	}
+	return strconv.Atoi(value)
+}
+
+// BumpConfigRevision raises the configuration revision, so servers watching it reload the configuration
+func BumpConfigRevision(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		revision, err := GetConfigRevision(tx)
+		if err != nil {
+			return err
+		}
+		return SetSystemConfig(tx, KeyConfigRevision, strconv.Itoa(revision+1))
+	})
 }
@@ -0,0 +1,141 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+
+	"gorm.io/gorm"
+
+	"go-proxy-server/internal/models"
+)
+
+// UserLimits holds the limits applied to a single user
+// In an override a value of 0 means the global per-user default applies
+type UserLimits struct {
+	UploadRate              int64 `json:"uploadRate"`
+	DownloadRate            int64 `json:"downloadRate"`
+	MaxConnections          int32 `json:"maxConnections"`
+	MaxConnectionsPerSecond int32 `json:"maxConnectionsPerSecond"`
+	MaxConnectionsPerMinute int32 `json:"maxConnectionsPerMinute"`
+}
+
+// Per-user overrides: map[username]UserLimits, replaced atomically on reload
+var userLimitOverrides atomic.Pointer[map[string]UserLimits]
+
+func init() {
+	empty := make(map[string]UserLimits)
+	userLimitOverrides.Store(&empty)
+}
+
+// Validate checks all values of the user limits
+func (l UserLimits) Validate() error {
+	if err := validateRate("upload rate", l.UploadRate); err != nil {
+		return err
+	}
+	if err := validateRate("download rate", l.DownloadRate); err != nil {
+		return err
+	}
+	if err := validateConnectionRate("max connections", l.MaxConnections); err != nil {
+		return err
+	}
+	if err := validateConnectionRate("max connections per second", l.MaxConnectionsPerSecond); err != nil {
+		return err
+	}
+	return validateConnectionRate("max connections per minute", l.MaxConnectionsPerMinute)
+}
+
+// LoadUserLimitsFromDB loads per-user limit overrides from database
+func LoadUserLimitsFromDB(db *gorm.DB) error {
+	var limits []models.UserLimit
+	if err := db.Find(&limits).Error; err != nil {
+		return fmt.Errorf("failed to load user limits: %w", err)
+	}
+
+	overrides := make(map[string]UserLimits, len(limits))
+	for _, limit := range limits {
+		overrides[limit.Username] = UserLimits{
+			UploadRate:              limit.UploadRate,
+			DownloadRate:            limit.DownloadRate,
+			MaxConnections:          limit.MaxConnections,
+			MaxConnectionsPerSecond: limit.MaxConnectionsPerSecond,
+			MaxConnectionsPerMinute: limit.MaxConnectionsPerMinute,
+		}
+	}
+	userLimitOverrides.Store(&overrides)
+	return nil
+}
+
+// GetUserLimitOverride returns the stored override for a user, if any
+func GetUserLimitOverride(username string) (UserLimits, bool) {
+	override, ok := (*userLimitOverrides.Load())[username]
+	return override, ok
+}
+
+// GetUserLimits returns the effective limits for a user
+// Each value not overridden for the user falls back to the global per-user default
+func GetUserLimits(username string) UserLimits {
+	bandwidth := GetBandwidthConfig()
+	limiter := GetUserLimiterConfig()
+	effective := UserLimits{
+		UploadRate:              bandwidth.PerUserUpload,
+		DownloadRate:            bandwidth.PerUserDownload,
+		MaxConnections:          limiter.MaxConcurrentConnectionsPerUser,
+		MaxConnectionsPerSecond: limiter.MaxNewConnectionsPerUserSecond,
+		MaxConnectionsPerMinute: limiter.MaxNewConnectionsPerUserMinute,
+	}
+
+	override, ok := GetUserLimitOverride(username)
+	if !ok {
+		return effective
+	}
+	if override.UploadRate > 0 {
+		effective.UploadRate = override.UploadRate
+	}
+	if override.DownloadRate > 0 {
+		effective.DownloadRate = override.DownloadRate
+	}
+	if override.MaxConnections > 0 {
+		effective.MaxConnections = override.MaxConnections
+	}
+	if override.MaxConnectionsPerSecond > 0 {
+		effective.MaxConnectionsPerSecond = override.MaxConnectionsPerSecond
+	}
+	if override.MaxConnectionsPerMinute > 0 {
+		effective.MaxConnectionsPerMinute = override.MaxConnectionsPerMinute
+	}
+	return effective
+}
+
+// SetUserLimits saves the limit overrides of a user (all zero removes the override)
+func SetUserLimits(db *gorm.DB, username string, limits UserLimits) error {
+	if err := limits.Validate(); err != nil {
+		return err
+	}
+
+	if limits == (UserLimits{}) {
+		if err := db.Unscoped().Where("username = ?", username).Delete(&models.UserLimit{}).Error; err != nil {
+			return err
+		}
+		return LoadUserLimitsFromDB(db)
+	}
+
+	var existing models.UserLimit
+	err := db.Where("username = ?", username).First(&existing).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		existing = models.UserLimit{Username: username}
+	} else if err != nil {
+		return err
+	}
+
+	existing.UploadRate = limits.UploadRate
+	existing.DownloadRate = limits.DownloadRate
+	existing.MaxConnections = limits.MaxConnections
+	existing.MaxConnectionsPerSecond = limits.MaxConnectionsPerSecond
+	existing.MaxConnectionsPerMinute = limits.MaxConnectionsPerMinute
+	if err := db.Save(&existing).Error; err != nil {
+		return err
+	}
+
+	return LoadUserLimitsFromDB(db)
+}
@@ -0,0 +1,158 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+	"sync/atomic"
+
+	"gorm.io/gorm"
+)
+
+// System configuration key for the web management server configuration (JSON)
+const (
+	KeyWebConfig = "web_config"
+)
+
+// WebUnixPrefix marks a unix socket path in WebConfig.Listen
+const WebUnixPrefix = "unix:"
+
+// WebConfig holds the web management server configuration
+type WebConfig struct {
+	Listen     string   `json:"listen"`     // Bind address: "localhost", an IP ("0.0.0.0", "::" = all interfaces) or "unix:/path/to/socket"
+	Port       int      `json:"port"`       // TCP port (0 = random port, overridden by -port)
+	TLS        bool     `json:"tls"`        // Serve HTTPS
+	CertFile   string   `json:"certFile"`   // PEM certificate (empty with TLS = auto-generated self-signed certificate)
+	KeyFile    string   `json:"keyFile"`    // PEM private key
+	AllowedIPs []string `json:"allowedIPs"` // IPs or CIDRs allowed to reach the interface (empty = any; loopback is always allowed)
+	Hosts      []string `json:"hosts"`      // Host names the interface is reached by, besides localhost and IP addresses
+}
+
+// DefaultWebConfig returns the configuration used before anything is saved: localhost only, plain HTTP
+func DefaultWebConfig() WebConfig {
+	return WebConfig{Listen: "localhost"}
+}
+
+var webConfig atomic.Pointer[WebConfig]
+
+func init() {
+	cfg := DefaultWebConfig()
+	webConfig.Store(&cfg)
+}
+
+// IsUnixSocket reports whether the interface listens on a unix socket
+func (c WebConfig) IsUnixSocket() bool {
+	return strings.HasPrefix(c.Listen, WebUnixPrefix)
+}
+
+// SocketPath returns the unix socket path of the interface
+func (c WebConfig) SocketPath() string {
+	return strings.TrimPrefix(c.Listen, WebUnixPrefix)
+}
+
+// IsLoopbackOnly reports whether the interface can only be reached from the local machine
+func (c WebConfig) IsLoopbackOnly() bool {
+	if c.IsUnixSocket() || c.Listen == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(c.Listen)
+	return ip != nil && ip.IsLoopback()
+}
+
+// AllowedNetworks parses AllowedIPs (single IPs become /32 or /128 networks)
+func (c WebConfig) AllowedNetworks() ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(c.AllowedIPs))
+	for _, entry := range c.AllowedIPs {
+		entry = strings.TrimSpace(entry)
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid allowed IP %q", entry)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 32
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid allowed network %q", entry)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// Validate checks the web management server configuration
+func (c WebConfig) Validate() error {
+	if c.IsUnixSocket() {
+		if c.SocketPath() == "" {
+			return fmt.Errorf("unix socket path must not be empty")
+		}
+	} else if c.Listen != "localhost" && net.ParseIP(c.Listen) == nil {
+		return fmt.Errorf("invalid listen address %q (expected localhost, an IP address or unix:/path)", c.Listen)
+	}
+	if c.Port < 0 || c.Port > 65535 {
+		return fmt.Errorf("port must be between 0 and 65535")
+	}
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		return fmt.Errorf("certFile and keyFile must be set together")
+	}
+	if c.CertFile != "" && !c.TLS {
+		return fmt.Errorf("certFile and keyFile require tls to be enabled")
+	}
+	if _, err := c.AllowedNetworks(); err != nil {
+		return err
+	}
+	for _, host := range c.Hosts {
+		if host == "" || strings.ContainsAny(host, " /:") {
+			return fmt.Errorf("invalid host name %q", host)
+		}
+	}
+	return nil
+}
+
+// InitWebConfig initializes the web management server configuration from database
+func InitWebConfig(db *gorm.DB) error {
+	value, err := GetSystemConfig(db, KeyWebConfig)
+	if err != nil {
+		return fmt.Errorf("failed to load web configuration: %w", err)
+	}
+	cfg := DefaultWebConfig()
+	if value != "" {
+		if err := json.Unmarshal([]byte(value), &cfg); err != nil {
+			return fmt.Errorf("invalid web configuration: %w", err)
+		}
+		if err := cfg.Validate(); err != nil {
+			return fmt.Errorf("invalid web configuration: %w", err)
+		}
+	}
+	webConfig.Store(&cfg)
+	return nil
+}
+
+// GetWebConfig returns the current web management server configuration
+func GetWebConfig() WebConfig {
+	return *webConfig.Load()
+}
+
+// UpdateWebConfig updates the web management server configuration in database and memory
+// Changes take effect when the web server is next started
+func UpdateWebConfig(db *gorm.DB, cfg WebConfig) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	value, err := json.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	if err := SetSystemConfig(db, KeyWebConfig, string(value)); err != nil {
+		return fmt.Errorf("failed to save web configuration: %w", err)
+	}
+	webConfig.Store(&cfg)
+	return nil
+}
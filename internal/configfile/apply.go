@@ -0,0 +1,563 @@
+package configfile
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"go-proxy-server/internal/acl"
+	"go-proxy-server/internal/audit"
+	"go-proxy-server/internal/auth"
+	"go-proxy-server/internal/config"
+	"go-proxy-server/internal/models"
+	"go-proxy-server/internal/quota"
+	"go-proxy-server/internal/reload"
+	"go-proxy-server/internal/schedule"
+)
+
+// How a file is applied to a database that already holds configuration
+const (
+	// ModeFileWins makes the file authoritative: present list sections replace the stored entries
+	// (entries missing from the file are deleted) and present settings overwrite the stored ones
+	ModeFileWins = "file-wins"
+	// ModeDBWins keeps everything stored: the file only adds the entries the database does not have yet
+	ModeDBWins = "db-wins"
+)
+
+// Plan is the comparison of a file with the current configuration
+type Plan struct {
+	Mode    string         `json:"mode"`
+	Changes []audit.Change `json:"changes"` // Changed fields, addressed by section, entry and field
+	file    *Document
+	desired *Document
+	removed []string // Users deleted by the plan
+}
+
+// ValidateMode checks the name of an apply mode
+func ValidateMode(mode string) error {
+	if mode != ModeFileWins && mode != ModeDBWins {
+		return fmt.Errorf("mode must be %q or %q", ModeFileWins, ModeDBWins)
+	}
+	return nil
+}
+
+// Prepare validates a file and compares the configuration it leads to with the current one
+func Prepare(db *gorm.DB, file *Document, mode string) (*Plan, error) {
+	if err := ValidateMode(mode); err != nil {
+		return nil, err
+	}
+	current, err := Export(db)
+	if err != nil {
+		return nil, err
+	}
+	if err := validate(file); err != nil {
+		return nil, err
+	}
+
+	desired := merge(current, file, mode)
+	if err := validateReferences(desired); err != nil {
+		return nil, err
+	}
+	changes, err := audit.Diff(Snapshot(current), Snapshot(desired))
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &Plan{Mode: mode, Changes: changes, file: file, desired: desired}
+	kept := make(map[string]bool, len(desired.Users))
+	for _, user := range desired.Users {
+		kept[user.Name] = true
+	}
+	for _, user := range current.Users {
+		if !kept[user.Name] {
+			plan.removed = append(plan.removed, user.Name)
+		}
+	}
+	return plan, nil
+}
+
+// Snapshot returns a document keyed by entry names, which is what plans compare and the audit log records
+// Password hashes are replaced by fingerprints that only show whether a password changed
+func Snapshot(doc *Document) map[string]interface{} {
+	listeners := make(map[string]Listener, len(doc.Listeners))
+	for _, listener := range doc.Listeners {
+		listeners[listener.Name] = listener
+	}
+	groups := make(map[string]Group, len(doc.Groups))
+	for _, group := range doc.Groups {
+		groups[group.Name] = group
+	}
+	type user struct {
+		Password string `json:"password"`
+		IP       string `json:"ip"`
+		Group    string `json:"group"`
+	}
+	users := make(map[string]user, len(doc.Users))
+	for _, u := range doc.Users {
+		users[u.Name] = user{Password: passwordFingerprint(u.PasswordHash), IP: u.IP, Group: u.Group}
+	}
+	whitelist := make(map[string]bool, len(doc.Whitelist))
+	for _, ip := range doc.Whitelist {
+		whitelist[ip] = true
+	}
+	routing := make(map[string]Rule, len(doc.Routing))
+	for _, rule := range doc.Routing {
+		routing[rule.key()] = rule
+	}
+	return map[string]interface{}{
+		"listeners": listeners,
+		"timeouts":  doc.Timeouts,
+		"limiter":   doc.Limiter,
+		"security":  doc.Security,
+		"groups":    groups,
+		"users":     users,
+		"whitelist": whitelist,
+		"routing":   routing,
+	}
+}
+
+// validate checks the entries and settings given in a file
+func validate(file *Document) error {
+	seen := make(map[string]bool)
+	for i := range file.Listeners {
+		listener := &file.Listeners[i]
+		cfg := listener.model()
+		if err := config.ValidateProxyConfig(&cfg); err != nil {
+			return fmt.Errorf("listener %q: %w", listener.Name, err)
+		}
+		if seen[listener.Name] {
+			return fmt.Errorf("listener %q is defined twice", listener.Name)
+		}
+		seen[listener.Name] = true
+		// Store the defaults filled in by validation, so they do not show up as changes later
+		*listener = listenerFromModel(cfg)
+	}
+
+	seen = make(map[string]bool)
+	for i := range file.Groups {
+		group := &file.Groups[i]
+		group.Name = strings.TrimSpace(group.Name)
+		if group.Name == "" {
+			return fmt.Errorf("group name is required")
+		}
+		if seen[group.Name] {
+			return fmt.Errorf("group %q is defined twice", group.Name)
+		}
+		seen[group.Name] = true
+	}
+
+	seen = make(map[string]bool)
+	for _, user := range file.Users {
+		if strings.TrimSpace(user.Name) == "" {
+			return fmt.Errorf("user name is required")
+		}
+		if !auth.IsPasswordHash(user.PasswordHash) {
+			return fmt.Errorf("user %q: passwordHash must be a hash exported by this server ($sha256$<salt>$<hash>)", user.Name)
+		}
+		if seen[user.Name] {
+			return fmt.Errorf("user %q is defined twice", user.Name)
+		}
+		seen[user.Name] = true
+	}
+
+	seen = make(map[string]bool)
+	for _, ip := range file.Whitelist {
+		if net.ParseIP(ip) == nil {
+			return fmt.Errorf("invalid whitelist IP %q", ip)
+		}
+		if seen[ip] {
+			return fmt.Errorf("whitelist IP %q is listed twice", ip)
+		}
+		seen[ip] = true
+	}
+
+	seen = make(map[string]bool)
+	for i := range file.Routing {
+		rule := &file.Routing[i]
+		if err := rule.acl().Validate(); err != nil {
+			return fmt.Errorf("routing rule %s: %w", rule.key(), err)
+		}
+		if seen[rule.key()] {
+			return fmt.Errorf("routing rule %s is defined twice", rule.key())
+		}
+		seen[rule.key()] = true
+		*rule = ruleFromACL(rule.acl())
+	}
+	return nil
+}
+
+// validateReferences checks the settings and cross-references of the resulting configuration
+func validateReferences(doc *Document) error {
+	groups := make(map[string]bool, len(doc.Groups))
+	for _, group := range doc.Groups {
+		groups[group.Name] = true
+	}
+	for _, user := range doc.Users {
+		if user.Group != "" && !groups[user.Group] {
+			return fmt.Errorf("user %q: group %q does not exist", user.Name, user.Group)
+		}
+	}
+
+	if err := doc.timeoutConfig().Validate(); err != nil {
+		return err
+	}
+	limiter, userLimiter, bandwidth := doc.limiterConfig()
+	if err := limiter.Validate(); err != nil {
+		return err
+	}
+	if err := userLimiter.Validate(); err != nil {
+		return err
+	}
+	return bandwidth.Validate()
+}
+
+// merge returns the configuration that results from applying a file to the current one
+func merge(current, file *Document, mode string) *Document {
+	desired := *current
+	if mode == ModeDBWins {
+		// Stored settings win; only entries missing from the database are added
+		desired.Listeners = addMissing(current.Listeners, file.Listeners, func(l Listener) string { return l.Name })
+		desired.Groups = addMissing(current.Groups, file.Groups, func(g Group) string { return g.Name })
+		desired.Users = addMissing(current.Users, file.Users, func(u User) string { return u.Name })
+		desired.Whitelist = addMissing(current.Whitelist, file.Whitelist, func(ip string) string { return ip })
+		desired.Routing = addMissing(current.Routing, file.Routing, Rule.key)
+		return &desired
+	}
+
+	if file.Listeners != nil {
+		desired.Listeners = file.Listeners
+	}
+	if file.Groups != nil {
+		desired.Groups = file.Groups
+	}
+	if file.Users != nil {
+		desired.Users = file.Users
+	}
+	if file.Whitelist != nil {
+		desired.Whitelist = file.Whitelist
+	}
+	if file.Routing != nil {
+		desired.Routing = file.Routing
+	}
+
+	if t := file.Timeouts; t != nil {
+		timeouts := *current.Timeouts
+		override(&timeouts.Connect, t.Connect)
+		override(&timeouts.IdleRead, t.IdleRead)
+		override(&timeouts.IdleWrite, t.IdleWrite)
+		override(&timeouts.MaxConnectionAge, t.MaxConnectionAge)
+		override(&timeouts.Cleanup, t.Cleanup)
+		override(&timeouts.Drain, t.Drain)
+		desired.Timeouts = &timeouts
+	}
+	if l := file.Limiter; l != nil {
+		limiter := *current.Limiter
+		override(&limiter.MaxConcurrentConnections, l.MaxConcurrentConnections)
+		override(&limiter.MaxConcurrentConnectionsPerIP, l.MaxConcurrentConnectionsPerIP)
+		override(&limiter.MaxConcurrentConnectionsPerUser, l.MaxConcurrentConnectionsPerUser)
+		override(&limiter.MaxNewConnectionsPerUserSecond, l.MaxNewConnectionsPerUserSecond)
+		override(&limiter.MaxNewConnectionsPerUserMinute, l.MaxNewConnectionsPerUserMinute)
+		override(&limiter.MaxNewConnectionsPerIPSecond, l.MaxNewConnectionsPerIPSecond)
+		if b := l.Bandwidth; b != nil {
+			bandwidth := *current.Limiter.Bandwidth
+			override(&bandwidth.GlobalUpload, b.GlobalUpload)
+			override(&bandwidth.GlobalDownload, b.GlobalDownload)
+			override(&bandwidth.PerIPUpload, b.PerIPUpload)
+			override(&bandwidth.PerIPDownload, b.PerIPDownload)
+			override(&bandwidth.PerUserUpload, b.PerUserUpload)
+			override(&bandwidth.PerUserDownload, b.PerUserDownload)
+			override(&bandwidth.Burst, b.Burst)
+			limiter.Bandwidth = &bandwidth
+		}
+		desired.Limiter = &limiter
+	}
+	if s := file.Security; s != nil {
+		security := *current.Security
+		override(&security.AllowPrivateIPAccess, s.AllowPrivateIPAccess)
+		desired.Security = &security
+	}
+	return &desired
+}
+
+// override replaces a setting with the value given in the file, if any
+func override[T any](target **T, value *T) {
+	if value != nil {
+		*target = value
+	}
+}
+
+// addMissing appends the entries of a file whose keys are not stored yet
+func addMissing[T any](stored, file []T, key func(T) string) []T {
+	exists := make(map[string]bool, len(stored))
+	for _, entry := range stored {
+		exists[key(entry)] = true
+	}
+	result := append([]T{}, stored...)
+	for _, entry := range file {
+		if !exists[key(entry)] {
+			result = append(result, entry)
+		}
+	}
+	return result
+}
+
+// timeoutConfig returns the timeouts of a complete document
+func (d *Document) timeoutConfig() config.TimeoutConfig {
+	t := d.Timeouts
+	return config.TimeoutConfig{
+		Connect:          time.Duration(*t.Connect) * time.Second,
+		IdleRead:         time.Duration(*t.IdleRead) * time.Second,
+		IdleWrite:        time.Duration(*t.IdleWrite) * time.Second,
+		MaxConnectionAge: time.Duration(*t.MaxConnectionAge) * time.Second,
+		CleanupTimeout:   time.Duration(*t.Cleanup) * time.Second,
+		Drain:            time.Duration(*t.Drain) * time.Second,
+	}
+}
+
+// limiterConfig returns the connection limits and bandwidth shaping of a complete document
+func (d *Document) limiterConfig() (config.LimiterConfig, config.UserLimiterConfig, config.BandwidthConfig) {
+	l, b := d.Limiter, d.Limiter.Bandwidth
+	return config.LimiterConfig{
+		MaxConcurrentConnections:      *l.MaxConcurrentConnections,
+		MaxConcurrentConnectionsPerIP: *l.MaxConcurrentConnectionsPerIP,
+	}, config.UserLimiterConfig{
+		MaxConcurrentConnectionsPerUser: *l.MaxConcurrentConnectionsPerUser,
+		MaxNewConnectionsPerUserSecond:  *l.MaxNewConnectionsPerUserSecond,
+		MaxNewConnectionsPerUserMinute:  *l.MaxNewConnectionsPerUserMinute,
+		MaxNewConnectionsPerIPSecond:    *l.MaxNewConnectionsPerIPSecond,
+	}, config.BandwidthConfig{
+		GlobalUpload:    *b.GlobalUpload,
+		GlobalDownload:  *b.GlobalDownload,
+		PerIPUpload:     *b.PerIPUpload,
+		PerIPDownload:   *b.PerIPDownload,
+		PerUserUpload:   *b.PerUserUpload,
+		PerUserDownload: *b.PerUserDownload,
+		Burst:           *b.Burst,
+	}
+}
+
+// Apply writes the planned configuration in one transaction and reloads it into the running server
+func (p *Plan) Apply(db *gorm.DB) error {
+	if len(p.Changes) == 0 {
+		return nil
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// Groups first, so users can be placed in new groups
+		if p.file.Groups != nil || p.Mode == ModeDBWins {
+			if err := saveGroups(tx, p.desired.Groups); err != nil {
+				return err
+			}
+		}
+		if p.file.Users != nil || p.Mode == ModeDBWins {
+			if err := saveUsers(tx, p.desired.Users); err != nil {
+				return err
+			}
+		}
+		if p.file.Routing != nil || p.Mode == ModeDBWins {
+			if err := saveRules(tx, p.desired.Routing); err != nil {
+				return err
+			}
+		}
+		if p.file.Whitelist != nil || p.Mode == ModeDBWins {
+			if err := saveWhitelist(tx, p.desired.Whitelist); err != nil {
+				return err
+			}
+		}
+		if p.file.Listeners != nil || p.Mode == ModeDBWins {
+			if err := saveListeners(tx, p.desired.Listeners); err != nil {
+				return err
+			}
+		}
+		if p.Mode == ModeFileWins {
+			return saveSettings(tx, p.file, p.desired)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to apply configuration: %w", err)
+	}
+
+	// Usage counters are held by the quota manager and deleted through it
+	for _, username := range p.removed {
+		if manager := quota.GetManager(); manager != nil {
+			err = manager.Delete(username)
+		} else {
+			err = db.Unscoped().Where("username = ?", username).Delete(&models.UserQuota{}).Error
+		}
+		if err != nil {
+			return fmt.Errorf("failed to delete traffic quota of user %s: %w", username, err)
+		}
+	}
+	// Bring the running server in line, including its listeners when a web manager runs them
+	return reload.All()
+}
+
+// saveGroups stores the groups and deletes the others with their access rules, schedules and memberships
+func saveGroups(tx *gorm.DB, groups []Group) error {
+	names := make([]string, 0, len(groups))
+	for _, group := range groups {
+		names = append(names, group.Name)
+		var existing models.UserGroup
+		if err := tx.Where("name = ?", group.Name).Attrs(models.UserGroup{Name: group.Name}).FirstOrInit(&existing).Error; err != nil {
+			return err
+		}
+		existing.Description = group.Description
+		if err := tx.Save(&existing).Error; err != nil {
+			return fmt.Errorf("failed to save group %s: %w", group.Name, err)
+		}
+	}
+
+	var removed []string
+	if err := tx.Model(&models.UserGroup{}).Where("name NOT IN ?", append(names, "")).Pluck("name", &removed).Error; err != nil {
+		return err
+	}
+	if len(removed) == 0 {
+		return nil
+	}
+	if err := tx.Unscoped().Where("name IN ?", removed).Delete(&models.UserGroup{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Unscoped().Where("scope = ? AND subject IN ?", acl.ScopeGroup, removed).Delete(&models.AccessRule{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Unscoped().Where("scope = ? AND subject IN ?", schedule.ScopeGroup, removed).Delete(&models.ScheduleAssignment{}).Error; err != nil {
+		return err
+	}
+	return tx.Model(&models.User{}).Where("group_name IN ?", removed).Update("group_name", "").Error
+}
+
+// saveUsers stores the users and deletes the others with their limits, access rules and schedules
+func saveUsers(tx *gorm.DB, users []User) error {
+	names := make([]string, 0, len(users))
+	for _, user := range users {
+		names = append(names, user.Name)
+		var existing models.User
+		if err := tx.Where("username = ?", user.Name).Attrs(models.User{Username: user.Name}).FirstOrInit(&existing).Error; err != nil {
+			return err
+		}
+		existing.Password = []byte(user.PasswordHash)
+		existing.IP = user.IP
+		existing.GroupName = user.Group
+		if err := tx.Save(&existing).Error; err != nil {
+			return fmt.Errorf("failed to save user %s: %w", user.Name, err)
+		}
+	}
+
+	var removed []string
+	if err := tx.Model(&models.User{}).Where("username NOT IN ?", append(names, "")).Pluck("username", &removed).Error; err != nil {
+		return err
+	}
+	if len(removed) == 0 {
+		return nil
+	}
+	if err := tx.Unscoped().Where("username IN ?", removed).Delete(&models.User{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Unscoped().Where("username IN ?", removed).Delete(&models.UserLimit{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Unscoped().Where("scope = ? AND subject IN ?", acl.ScopeUser, removed).Delete(&models.AccessRule{}).Error; err != nil {
+		return err
+	}
+	return tx.Unscoped().Where("scope = ? AND subject IN ?", schedule.ScopeUser, removed).Delete(&models.ScheduleAssignment{}).Error
+}
+
+// saveRules stores the access rules and deletes the others
+func saveRules(tx *gorm.DB, rules []Rule) error {
+	keep := make(map[string]bool, len(rules))
+	for _, rule := range rules {
+		keep[rule.key()] = true
+		if err := acl.SaveRule(tx, rule.acl()); err != nil {
+			return fmt.Errorf("failed to save routing rule %s: %w", rule.key(), err)
+		}
+	}
+	var stored []models.AccessRule
+	if err := tx.Find(&stored).Error; err != nil {
+		return err
+	}
+	for _, row := range stored {
+		if !keep[row.Scope+":"+row.Subject] {
+			if err := tx.Unscoped().Delete(&row).Error; err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// saveWhitelist stores the whitelisted IPs and deletes the others with their schedules
+func saveWhitelist(tx *gorm.DB, ips []string) error {
+	for _, ip := range ips {
+		entry := models.Whitelist{IP: ip}
+		if err := tx.Where("ip = ?", ip).FirstOrCreate(&entry).Error; err != nil {
+			return fmt.Errorf("failed to whitelist %s: %w", ip, err)
+		}
+	}
+	var removed []string
+	if err := tx.Model(&models.Whitelist{}).Where("ip NOT IN ?", append(ips, "")).Pluck("ip", &removed).Error; err != nil {
+		return err
+	}
+	if len(removed) == 0 {
+		return nil
+	}
+	if err := tx.Unscoped().Where("ip IN ?", removed).Delete(&models.Whitelist{}).Error; err != nil {
+		return err
+	}
+	return tx.Unscoped().Where("scope = ? AND subject IN ?", schedule.ScopeWhitelist, removed).Delete(&models.ScheduleAssignment{}).Error
+}
+
+// saveListeners stores the listener configurations and deletes the others
+func saveListeners(tx *gorm.DB, listeners []Listener) error {
+	names := make([]string, 0, len(listeners))
+	for _, listener := range listeners {
+		names = append(names, listener.Name)
+		cfg := listener.model()
+		if err := config.SaveProxyConfig(tx, &cfg); err != nil {
+			return fmt.Errorf("failed to save listener %s: %w", listener.Name, err)
+		}
+	}
+	return tx.Unscoped().Where("name NOT IN ?", append(names, "")).Delete(&models.ProxyConfig{}).Error
+}
+
+// saveSettings stores the settings sections present in the file
+func saveSettings(tx *gorm.DB, file, desired *Document) error {
+	if file.Timeouts != nil {
+		if err := config.SaveTimeoutToDB(tx, desired.timeoutConfig()); err != nil {
+			return fmt.Errorf("failed to save timeouts: %w", err)
+		}
+	}
+	if file.Limiter != nil {
+		limiter, userLimiter, bandwidth := desired.limiterConfig()
+		values := map[string]int64{
+			config.KeyMaxConcurrentConnections:        int64(limiter.MaxConcurrentConnections),
+			config.KeyMaxConcurrentConnectionsPerIP:   int64(limiter.MaxConcurrentConnectionsPerIP),
+			config.KeyMaxConcurrentConnectionsPerUser: int64(userLimiter.MaxConcurrentConnectionsPerUser),
+			config.KeyMaxNewConnectionsPerUserSecond:  int64(userLimiter.MaxNewConnectionsPerUserSecond),
+			config.KeyMaxNewConnectionsPerUserMinute:  int64(userLimiter.MaxNewConnectionsPerUserMinute),
+			config.KeyMaxNewConnectionsPerIPSecond:    int64(userLimiter.MaxNewConnectionsPerIPSecond),
+			config.KeyBandwidthGlobalUpload:           bandwidth.GlobalUpload,
+			config.KeyBandwidthGlobalDownload:         bandwidth.GlobalDownload,
+			config.KeyBandwidthPerIPUpload:            bandwidth.PerIPUpload,
+			config.KeyBandwidthPerIPDownload:          bandwidth.PerIPDownload,
+			config.KeyBandwidthPerUserUpload:          bandwidth.PerUserUpload,
+			config.KeyBandwidthPerUserDownload:        bandwidth.PerUserDownload,
+			config.KeyBandwidthBurst:                  bandwidth.Burst,
+		}
+		for key, value := range values {
+			if err := config.SetSystemConfig(tx, key, strconv.FormatInt(value, 10)); err != nil {
+				return fmt.Errorf("failed to save %s: %w", key, err)
+			}
+		}
+	}
+	if file.Security != nil {
+		value := strconv.FormatBool(*desired.Security.AllowPrivateIPAccess)
+		if err := config.SetSystemConfig(tx, config.KeyAllowPrivateIPAccess, value); err != nil {
+			return fmt.Errorf("failed to save %s: %w", config.KeyAllowPrivateIPAccess, err)
+		}
+	}
+	return nil
+}
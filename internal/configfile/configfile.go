@@ -0,0 +1,418 @@
+// Package configfile implements the declarative configuration file, which describes listeners, settings,
+// users, groups, the whitelist and routing rules in YAML, TOML or JSON so deployments can be versioned and templated
+package configfile
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+	"gorm.io/gorm"
+
+	"go-proxy-server/internal/acl"
+	"go-proxy-server/internal/config"
+	"go-proxy-server/internal/models"
+)
+
+// File formats
+const (
+	FormatYAML = "yaml"
+	FormatTOML = "toml"
+	FormatJSON = "json"
+)
+
+// Document is the declarative configuration
+// Sections left out of a file are not managed by it; a list section that is present describes all its entries,
+// and settings left out of a present settings section keep their current values
+type Document struct {
+	Listeners []Listener `json:"listeners" yaml:"listeners" toml:"listeners"`
+	Timeouts  *Timeouts  `json:"timeouts" yaml:"timeouts" toml:"timeouts"`
+	Limiter   *Limiter   `json:"limiter" yaml:"limiter" toml:"limiter"`
+	Security  *Security  `json:"security" yaml:"security" toml:"security"`
+	Groups    []Group    `json:"groups" yaml:"groups" toml:"groups"`
+	Users     []User     `json:"users" yaml:"users" toml:"users"`
+	Whitelist []string   `json:"whitelist" yaml:"whitelist" toml:"whitelist"`
+	// Routing holds the access rules deciding which destinations, listeners and commands users and groups may use
+	Routing []Rule `json:"routing" yaml:"routing" toml:"routing"`
+}
+
+// Listener is a proxy listener, identified by its name
+type Listener struct {
+	Name                string `json:"name" yaml:"name" toml:"name"`
+	Type                string `json:"type" yaml:"type" toml:"type"`
+	Listen              string `json:"listen" yaml:"listen" toml:"listen"`
+	IPFamily            string `json:"ipFamily" yaml:"ipFamily" toml:"ipFamily"`
+	ListenEach          bool   `json:"listenEach" yaml:"listenEach" toml:"listenEach"`
+	Port                int    `json:"port" yaml:"port" toml:"port"`
+	BindListen          bool   `json:"bindListen" yaml:"bindListen" toml:"bindListen"`
+	AutoStart           bool   `json:"autoStart" yaml:"autoStart" toml:"autoStart"`
+	AuthMode            string `json:"authMode" yaml:"authMode" toml:"authMode"`
+	TLS                 bool   `json:"tls" yaml:"tls" toml:"tls"`
+	TLSCert             string `json:"tlsCert" yaml:"tlsCert" toml:"tlsCert"`
+	TLSKey              string `json:"tlsKey" yaml:"tlsKey" toml:"tlsKey"`
+	UploadRate          int64  `json:"uploadRate" yaml:"uploadRate" toml:"uploadRate"`
+	DownloadRate        int64  `json:"downloadRate" yaml:"downloadRate" toml:"downloadRate"`
+	MaxConnections      int32  `json:"maxConnections" yaml:"maxConnections" toml:"maxConnections"`
+	MaxConnectionsPerIP int32  `json:"maxConnectionsPerIP" yaml:"maxConnectionsPerIP" toml:"maxConnectionsPerIP"`
+}
+
+// Timeouts holds the connection timeouts in seconds
+type Timeouts struct {
+	Connect          *int `json:"connect" yaml:"connect" toml:"connect"`
+	IdleRead         *int `json:"idleRead" yaml:"idleRead" toml:"idleRead"`
+	IdleWrite        *int `json:"idleWrite" yaml:"idleWrite" toml:"idleWrite"`
+	MaxConnectionAge *int `json:"maxConnectionAge" yaml:"maxConnectionAge" toml:"maxConnectionAge"`
+	Cleanup          *int `json:"cleanup" yaml:"cleanup" toml:"cleanup"`
+	Drain            *int `json:"drain" yaml:"drain" toml:"drain"`
+}
+
+// Limiter holds the global connection limits, the per-user defaults and the bandwidth shaping (0 = unlimited)
+type Limiter struct {
+	MaxConcurrentConnections        *int32     `json:"maxConcurrentConnections" yaml:"maxConcurrentConnections" toml:"maxConcurrentConnections"`
+	MaxConcurrentConnectionsPerIP   *int32     `json:"maxConcurrentConnectionsPerIP" yaml:"maxConcurrentConnectionsPerIP" toml:"maxConcurrentConnectionsPerIP"`
+	MaxConcurrentConnectionsPerUser *int32     `json:"maxConcurrentConnectionsPerUser" yaml:"maxConcurrentConnectionsPerUser" toml:"maxConcurrentConnectionsPerUser"`
+	MaxNewConnectionsPerUserSecond  *int32     `json:"maxNewConnectionsPerUserSecond" yaml:"maxNewConnectionsPerUserSecond" toml:"maxNewConnectionsPerUserSecond"`
+	MaxNewConnectionsPerUserMinute  *int32     `json:"maxNewConnectionsPerUserMinute" yaml:"maxNewConnectionsPerUserMinute" toml:"maxNewConnectionsPerUserMinute"`
+	MaxNewConnectionsPerIPSecond    *int32     `json:"maxNewConnectionsPerIPSecond" yaml:"maxNewConnectionsPerIPSecond" toml:"maxNewConnectionsPerIPSecond"`
+	Bandwidth                       *Bandwidth `json:"bandwidth" yaml:"bandwidth" toml:"bandwidth"`
+}
+
+// Bandwidth holds the bandwidth shaping rates in bytes/sec and the burst size in bytes
+type Bandwidth struct {
+	GlobalUpload    *int64 `json:"globalUpload" yaml:"globalUpload" toml:"globalUpload"`
+	GlobalDownload  *int64 `json:"globalDownload" yaml:"globalDownload" toml:"globalDownload"`
+	PerIPUpload     *int64 `json:"perIPUpload" yaml:"perIPUpload" toml:"perIPUpload"`
+	PerIPDownload   *int64 `json:"perIPDownload" yaml:"perIPDownload" toml:"perIPDownload"`
+	PerUserUpload   *int64 `json:"perUserUpload" yaml:"perUserUpload" toml:"perUserUpload"`
+	PerUserDownload *int64 `json:"perUserDownload" yaml:"perUserDownload" toml:"perUserDownload"`
+	Burst           *int64 `json:"burst" yaml:"burst" toml:"burst"`
+}
+
+// Security holds the security settings
+type Security struct {
+	AllowPrivateIPAccess *bool `json:"allowPrivateIPAccess" yaml:"allowPrivateIPAccess" toml:"allowPrivateIPAccess"`
+}
+
+// Group is a user group
+type Group struct {
+	Name        string `json:"name" yaml:"name" toml:"name"`
+	Description string `json:"description" yaml:"description" toml:"description"`
+}
+
+// User is a proxy user; the password is given as a hash in the format stored in the database
+type User struct {
+	Name         string `json:"name" yaml:"name" toml:"name"`
+	PasswordHash string `json:"passwordHash" yaml:"passwordHash" toml:"passwordHash"`
+	IP           string `json:"ip" yaml:"ip" toml:"ip"`
+	Group        string `json:"group" yaml:"group" toml:"group"`
+}
+
+// Rule is the access rule of a group or user; empty lists place no restriction
+type Rule struct {
+	Scope            string   `json:"scope" yaml:"scope" toml:"scope"`
+	Subject          string   `json:"subject" yaml:"subject" toml:"subject"`
+	AllowedDomains   []string `json:"allowedDomains" yaml:"allowedDomains" toml:"allowedDomains"`
+	DeniedDomains    []string `json:"deniedDomains" yaml:"deniedDomains" toml:"deniedDomains"`
+	AllowedCIDRs     []string `json:"allowedCIDRs" yaml:"allowedCIDRs" toml:"allowedCIDRs"`
+	DeniedCIDRs      []string `json:"deniedCIDRs" yaml:"deniedCIDRs" toml:"deniedCIDRs"`
+	AllowedPorts     []string `json:"allowedPorts" yaml:"allowedPorts" toml:"allowedPorts"`
+	DeniedPorts      []string `json:"deniedPorts" yaml:"deniedPorts" toml:"deniedPorts"`
+	AllowedListeners []string `json:"allowedListeners" yaml:"allowedListeners" toml:"allowedListeners"`
+	AllowedCommands  []string `json:"allowedCommands" yaml:"allowedCommands" toml:"allowedCommands"`
+	BypassSSRF       *bool    `json:"bypassSSRF,omitempty" yaml:"bypassSSRF,omitempty" toml:"bypassSSRF,omitempty"` // Omitted = inherit the group setting
+}
+
+// FormatFromPath returns the format of a file by its extension
+func FormatFromPath(path string) (string, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return FormatYAML, nil
+	case ".toml":
+		return FormatTOML, nil
+	case ".json":
+		return FormatJSON, nil
+	}
+	return "", fmt.Errorf("unknown configuration file format %q (expected .yaml, .yml, .toml or .json)", filepath.Ext(path))
+}
+
+// Load reads a configuration file in the format given by its extension
+func Load(path string) (*Document, error) {
+	format, err := FormatFromPath(path)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read configuration file: %w", err)
+	}
+	doc, err := Parse(data, format)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return doc, nil
+}
+
+// Parse decodes a configuration file, rejecting unknown keys so misspelled settings are not silently ignored
+func Parse(data []byte, format string) (*Document, error) {
+	doc := &Document{}
+	switch format {
+	case FormatYAML:
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(doc); err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("invalid YAML: %w", err)
+		}
+	case FormatTOML:
+		meta, err := toml.Decode(string(data), doc)
+		if err != nil {
+			return nil, fmt.Errorf("invalid TOML: %w", err)
+		}
+		if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+			return nil, fmt.Errorf("unknown TOML key %q", undecoded[0].String())
+		}
+	case FormatJSON:
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(doc); err != nil {
+			return nil, fmt.Errorf("invalid JSON: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unknown configuration file format %q", format)
+	}
+	return doc, nil
+}
+
+// Marshal encodes a document in a format
+func Marshal(doc *Document, format string) ([]byte, error) {
+	var buf bytes.Buffer
+	switch format {
+	case FormatYAML:
+		encoder := yaml.NewEncoder(&buf)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(doc); err != nil {
+			return nil, err
+		}
+		if err := encoder.Close(); err != nil {
+			return nil, err
+		}
+	case FormatTOML:
+		if err := toml.NewEncoder(&buf).Encode(doc); err != nil {
+			return nil, err
+		}
+	case FormatJSON:
+		data, err := json.MarshalIndent(doc, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(append(data, '\n'))
+	default:
+		return nil, fmt.Errorf("unknown configuration file format %q", format)
+	}
+	return buf.Bytes(), nil
+}
+
+// Export returns the complete configuration: settings as currently loaded, entries as stored in the database
+func Export(db *gorm.DB) (*Document, error) {
+	doc := &Document{
+		Listeners: []Listener{},
+		Groups:    []Group{},
+		Users:     []User{},
+		Whitelist: []string{},
+		Routing:   []Rule{},
+	}
+
+	configs, err := config.ListProxyConfigs(db)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load listeners: %w", err)
+	}
+	for _, cfg := range configs {
+		doc.Listeners = append(doc.Listeners, listenerFromModel(cfg))
+	}
+
+	timeout := config.GetTimeout()
+	doc.Timeouts = &Timeouts{
+		Connect:          seconds(timeout.Connect.Seconds()),
+		IdleRead:         seconds(timeout.IdleRead.Seconds()),
+		IdleWrite:        seconds(timeout.IdleWrite.Seconds()),
+		MaxConnectionAge: seconds(timeout.MaxConnectionAge.Seconds()),
+		Cleanup:          seconds(timeout.CleanupTimeout.Seconds()),
+		Drain:            seconds(timeout.Drain.Seconds()),
+	}
+
+	limiter := config.GetLimiterConfig()
+	userLimiter := config.GetUserLimiterConfig()
+	bandwidth := config.GetBandwidthConfig()
+	doc.Limiter = &Limiter{
+		MaxConcurrentConnections:        &limiter.MaxConcurrentConnections,
+		MaxConcurrentConnectionsPerIP:   &limiter.MaxConcurrentConnectionsPerIP,
+		MaxConcurrentConnectionsPerUser: &userLimiter.MaxConcurrentConnectionsPerUser,
+		MaxNewConnectionsPerUserSecond:  &userLimiter.MaxNewConnectionsPerUserSecond,
+		MaxNewConnectionsPerUserMinute:  &userLimiter.MaxNewConnectionsPerUserMinute,
+		MaxNewConnectionsPerIPSecond:    &userLimiter.MaxNewConnectionsPerIPSecond,
+		Bandwidth: &Bandwidth{
+			GlobalUpload:    &bandwidth.GlobalUpload,
+			GlobalDownload:  &bandwidth.GlobalDownload,
+			PerIPUpload:     &bandwidth.PerIPUpload,
+			PerIPDownload:   &bandwidth.PerIPDownload,
+			PerUserUpload:   &bandwidth.PerUserUpload,
+			PerUserDownload: &bandwidth.PerUserDownload,
+			Burst:           &bandwidth.Burst,
+		},
+	}
+
+	allowPrivate := config.GetAllowPrivateIPAccess()
+	doc.Security = &Security{AllowPrivateIPAccess: &allowPrivate}
+
+	groups, err := acl.ListGroups(db)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load groups: %w", err)
+	}
+	for _, group := range groups {
+		doc.Groups = append(doc.Groups, Group{Name: group.Name, Description: group.Description})
+	}
+
+	var users []models.User
+	if err := db.Order("username").Find(&users).Error; err != nil {
+		return nil, fmt.Errorf("failed to load users: %w", err)
+	}
+	for _, user := range users {
+		doc.Users = append(doc.Users, User{
+			Name:         user.Username,
+			PasswordHash: string(user.Password),
+			IP:           user.IP,
+			Group:        user.GroupName,
+		})
+	}
+
+	var whitelist []models.Whitelist
+	if err := db.Order("ip").Find(&whitelist).Error; err != nil {
+		return nil, fmt.Errorf("failed to load the whitelist: %w", err)
+	}
+	for _, entry := range whitelist {
+		doc.Whitelist = append(doc.Whitelist, entry.IP)
+	}
+
+	rules, err := acl.ListRules(db)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load access rules: %w", err)
+	}
+	for _, rule := range rules {
+		doc.Routing = append(doc.Routing, ruleFromACL(rule))
+	}
+	return doc, nil
+}
+
+// seconds returns a duration in whole seconds for a settings field
+func seconds(value float64) *int {
+	s := int(value)
+	return &s
+}
+
+// listenerFromModel converts a stored listener configuration
+func listenerFromModel(cfg models.ProxyConfig) Listener {
+	return Listener{
+		Name:                cfg.Name,
+		Type:                cfg.Type,
+		Listen:              cfg.ListenAddress,
+		IPFamily:            cfg.IPFamily,
+		ListenEach:          cfg.ListenEach,
+		Port:                cfg.Port,
+		BindListen:          cfg.BindListen,
+		AutoStart:           cfg.AutoStart,
+		AuthMode:            cfg.AuthMode,
+		TLS:                 cfg.TLS,
+		TLSCert:             cfg.TLSCert,
+		TLSKey:              cfg.TLSKey,
+		UploadRate:          cfg.UploadRate,
+		DownloadRate:        cfg.DownloadRate,
+		MaxConnections:      cfg.MaxConnections,
+		MaxConnectionsPerIP: cfg.MaxConnectionsPerIP,
+	}
+}
+
+// model converts a listener to its stored configuration
+func (l Listener) model() models.ProxyConfig {
+	return models.ProxyConfig{
+		Name:                l.Name,
+		Type:                l.Type,
+		ListenAddress:       l.Listen,
+		IPFamily:            l.IPFamily,
+		ListenEach:          l.ListenEach,
+		Port:                l.Port,
+		BindListen:          l.BindListen,
+		AutoStart:           l.AutoStart,
+		AuthMode:            l.AuthMode,
+		TLS:                 l.TLS,
+		TLSCert:             l.TLSCert,
+		TLSKey:              l.TLSKey,
+		UploadRate:          l.UploadRate,
+		DownloadRate:        l.DownloadRate,
+		MaxConnections:      l.MaxConnections,
+		MaxConnectionsPerIP: l.MaxConnectionsPerIP,
+	}
+}
+
+// ruleFromACL converts an access rule, with empty lists instead of missing ones
+func ruleFromACL(rule acl.Rule) Rule {
+	return Rule{
+		Scope:            rule.Scope,
+		Subject:          rule.Subject,
+		AllowedDomains:   nonNil(rule.AllowedDomains),
+		DeniedDomains:    nonNil(rule.DeniedDomains),
+		AllowedCIDRs:     nonNil(rule.AllowedCIDRs),
+		DeniedCIDRs:      nonNil(rule.DeniedCIDRs),
+		AllowedPorts:     nonNil(rule.AllowedPorts),
+		DeniedPorts:      nonNil(rule.DeniedPorts),
+		AllowedListeners: nonNil(rule.AllowedListeners),
+		AllowedCommands:  nonNil(rule.AllowedCommands),
+		BypassSSRF:       rule.BypassSSRF,
+	}
+}
+
+// acl converts a rule to the access rule it is stored as
+func (r Rule) acl() acl.Rule {
+	return acl.Rule{
+		Scope:            r.Scope,
+		Subject:          r.Subject,
+		AllowedDomains:   r.AllowedDomains,
+		DeniedDomains:    r.DeniedDomains,
+		AllowedCIDRs:     r.AllowedCIDRs,
+		DeniedCIDRs:      r.DeniedCIDRs,
+		AllowedPorts:     r.AllowedPorts,
+		DeniedPorts:      r.DeniedPorts,
+		AllowedListeners: r.AllowedListeners,
+		AllowedCommands:  r.AllowedCommands,
+		BypassSSRF:       r.BypassSSRF,
+	}
+}
+
+// key identifies a rule by scope and subject
+func (r Rule) key() string {
+	return r.Scope + ":" + r.Subject
+}
+
+// nonNil returns an empty list instead of nil, so exported files show the key
+func nonNil(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
+
+// passwordFingerprint identifies a password hash in diffs without revealing it
+func passwordFingerprint(hash string) string {
+	if hash == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(hash))
+	return "sha256:" + hex.EncodeToString(sum[:4])
+}
@@ -0,0 +1,116 @@
+package configfile
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  string
+		data    string
+		wantErr bool
+	}{
+		{name: "yaml", format: FormatYAML, data: "listeners:\n  - name: socks\n    type: socks5\n    port: 1080\nwhitelist:\n  - 192.0.2.1\nsecurity:\n  allowPrivateIPAccess: true\n"},
+		{name: "yaml empty", format: FormatYAML, data: ""},
+		{name: "yaml unknown key", format: FormatYAML, data: "listners: []\n", wantErr: true},
+		{name: "yaml unknown nested key", format: FormatYAML, data: "listeners:\n  - name: socks\n    prot: 1080\n", wantErr: true},
+		{name: "yaml unknown settings key", format: FormatYAML, data: "security:\n  allowPrivateIP: true\n", wantErr: true},
+		{name: "yaml syntax error", format: FormatYAML, data: "listeners: [\n", wantErr: true},
+
+		{name: "toml", format: FormatTOML, data: "whitelist = [\"192.0.2.1\"]\n\n[security]\nallowPrivateIPAccess = true\n\n[[listeners]]\nname = \"socks\"\ntype = \"socks5\"\nport = 1080\n"},
+		{name: "toml unknown key", format: FormatTOML, data: "listners = []\n", wantErr: true},
+		{name: "toml unknown nested key", format: FormatTOML, data: "[[listeners]]\nname = \"socks\"\nprot = 1080\n", wantErr: true},
+		{name: "toml unknown settings key", format: FormatTOML, data: "[security]\nallowPrivateIP = true\n", wantErr: true},
+		{name: "toml syntax error", format: FormatTOML, data: "[security\n", wantErr: true},
+
+		{name: "json", format: FormatJSON, data: `{"listeners": [{"name": "socks", "type": "socks5", "port": 1080}], "whitelist": ["192.0.2.1"], "security": {"allowPrivateIPAccess": true}}`},
+		{name: "json unknown key", format: FormatJSON, data: `{"listners": []}`, wantErr: true},
+		{name: "json unknown nested key", format: FormatJSON, data: `{"listeners": [{"name": "socks", "prot": 1080}]}`, wantErr: true},
+		{name: "json unknown settings key", format: FormatJSON, data: `{"security": {"allowPrivateIP": true}}`, wantErr: true},
+		{name: "json syntax error", format: FormatJSON, data: `{"listeners": [`, wantErr: true},
+
+		{name: "unknown format", format: "ini", data: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := Parse([]byte(tt.data), tt.format)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Parse() = %+v, want an error", doc)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if tt.data == "" {
+				return
+			}
+			if len(doc.Listeners) != 1 || doc.Listeners[0].Name != "socks" || doc.Listeners[0].Port != 1080 {
+				t.Errorf("Listeners = %+v, want the socks listener on port 1080", doc.Listeners)
+			}
+			if !reflect.DeepEqual(doc.Whitelist, []string{"192.0.2.1"}) {
+				t.Errorf("Whitelist = %v, want [192.0.2.1]", doc.Whitelist)
+			}
+			if doc.Security == nil || doc.Security.AllowPrivateIPAccess == nil || !*doc.Security.AllowPrivateIPAccess {
+				t.Errorf("Security = %+v, want allowPrivateIPAccess true", doc.Security)
+			}
+			// Sections left out of the file stay nil, so they are not managed by it
+			if doc.Timeouts != nil || doc.Limiter != nil || doc.Users != nil {
+				t.Errorf("sections missing from the file were decoded: %+v", doc)
+			}
+		})
+	}
+}
+
+func TestMarshalRoundTrip(t *testing.T) {
+	connect := 30
+	allow := false
+	doc := &Document{
+		Listeners: []Listener{{Name: "http", Type: "http", Port: 8080, AutoStart: true}},
+		Timeouts:  &Timeouts{Connect: &connect},
+		Security:  &Security{AllowPrivateIPAccess: &allow},
+		Users:     []User{{Name: "alice", PasswordHash: "hash", Group: "staff"}},
+		Groups:    []Group{{Name: "staff"}},
+		Whitelist: []string{"192.0.2.0/24"},
+		Routing:   []Rule{{Scope: "group", Subject: "staff", AllowedPorts: []string{"443"}}},
+	}
+	for _, format := range []string{FormatYAML, FormatTOML, FormatJSON} {
+		data, err := Marshal(doc, format)
+		if err != nil {
+			t.Fatalf("%s: Marshal() error = %v", format, err)
+		}
+		parsed, err := Parse(data, format)
+		if err != nil {
+			t.Fatalf("%s: Parse() of the marshaled document: %v", format, err)
+		}
+		if !reflect.DeepEqual(parsed.Listeners, doc.Listeners) || *parsed.Timeouts.Connect != connect ||
+			*parsed.Security.AllowPrivateIPAccess != allow || !reflect.DeepEqual(parsed.Users, doc.Users) ||
+			!reflect.DeepEqual(parsed.Whitelist, doc.Whitelist) || parsed.Routing[0].AllowedPorts[0] != "443" {
+			t.Errorf("%s: round trip = %+v, want %+v", format, parsed, doc)
+		}
+	}
+}
+
+func TestFormatFromPath(t *testing.T) {
+	tests := []struct {
+		path    string
+		want    string
+		wantErr bool
+	}{
+		{path: "proxy.yaml", want: FormatYAML},
+		{path: "proxy.YML", want: FormatYAML},
+		{path: "/etc/proxy.toml", want: FormatTOML},
+		{path: "proxy.json", want: FormatJSON},
+		{path: "proxy.ini", wantErr: true},
+		{path: "proxy", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := FormatFromPath(tt.path)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("FormatFromPath(%q) = %q, %v; want %q (error %v)", tt.path, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
@@ -11,13 +11,20 @@ const (
 	BufferSizeLarge = 32 * 1024 // 32KB
 )
 
-// Configuration reload intervals
+// Background task intervals
 const (
-	// ConfigReloadInterval is the interval for reloading configuration from database
-	ConfigReloadInterval = 30 * time.Second
+	// QuotaFlushInterval is the interval for persisting traffic quota usage to the database
+	QuotaFlushInterval = 10 * time.Second
 
-	// TimeoutReloadInterval is the interval for reloading timeout configuration
-	TimeoutReloadInterval = 60 * time.Second
+	// InterfaceWatchInterval is the interval for re-resolving listeners bound to interface addresses
+	InterfaceWatchInterval = 10 * time.Second
+
+	// BackupCheckInterval is the interval for checking whether a scheduled database backup is due
+	BackupCheckInterval = 1 * time.Minute
+
+	// ConfigRevisionInterval is the interval for checking whether a command changed the database,
+	// on platforms where commands cannot signal the running server
+	ConfigRevisionInterval = 10 * time.Second
 )
 
 // Authentication and caching
@@ -31,6 +38,12 @@ const (
 
 	// AuthCacheCleanupInterval is the interval for cleaning up expired auth cache entries
 	AuthCacheCleanupInterval = 1 * time.Minute
+
+	// WebhookCacheMaxSize is the maximum number of decisions cached by the webhook authentication backend (LRU)
+	WebhookCacheMaxSize = 10000
+
+	// LDAPCacheMaxSize is the maximum number of logins cached by the LDAP authentication backend (LRU)
+	LDAPCacheMaxSize = 10000
 )
 
 // DNS caching
@@ -77,6 +90,12 @@ const (
 
 	// AcceptErrorBackoff is the backoff duration after an accept error
 	AcceptErrorBackoff = 100 * time.Millisecond
+
+	// UpgradeReadyTimeout is how long a hot upgrade waits for the new process to take over the listeners
+	UpgradeReadyTimeout = 60 * time.Second
+
+	// HealthCheckTimeout bounds the database ping of the health check gating systemd watchdog keep-alives
+	HealthCheckTimeout = 5 * time.Second
 )
 
 // Concurrency limits
@@ -0,0 +1,173 @@
+package ctl
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// requestTimeout bounds every management API request
+const requestTimeout = 30 * time.Second
+
+// listPageSize is the page size used to fetch complete v1 lists
+const listPageSize = 500
+
+// Client calls the management API of a server
+type Client struct {
+	baseURL string
+	token   string
+	http    *http.Client
+}
+
+// NewClient creates a client for a server profile
+func NewClient(profile Profile) (*Client, error) {
+	if profile.URL == "" {
+		return nil, fmt.Errorf("no server given; use -server or save a profile with 'ctl profile add'")
+	}
+	base, err := url.Parse(profile.URL)
+	if err != nil || (base.Scheme != "http" && base.Scheme != "https") || base.Host == "" {
+		return nil, fmt.Errorf("invalid server URL %q", profile.URL)
+	}
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: profile.Insecure}
+	if profile.CACert != "" {
+		pem, err := os.ReadFile(profile.CACert)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA certificate: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", profile.CACert)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+
+	return &Client{
+		baseURL: strings.TrimSuffix(base.String(), "/"),
+		token:   profile.Token,
+		http:    &http.Client{Transport: transport, Timeout: requestTimeout},
+	}, nil
+}
+
+// APIError is a failed management API request
+type APIError struct {
+	Status  int
+	Message string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("server returned %d %s: %s", e.Status, http.StatusText(e.Status), e.Message)
+}
+
+// do sends a request with an optional JSON body and decodes the JSON response into out (nil = discard)
+func (c *Client) do(method, path string, query url.Values, body, out interface{}) error {
+	var reader io.Reader
+	contentType := ""
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+		contentType = "application/json"
+	}
+	data, err := c.send(method, path, query, contentType, reader)
+	if err != nil {
+		return err
+	}
+	if out == nil || len(data) == 0 {
+		return nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(out); err != nil {
+		return fmt.Errorf("invalid response from server: %v", err)
+	}
+	return nil
+}
+
+// send sends a request with an optional body of the given content type and returns the response body
+func (c *Client) send(method, path string, query url.Values, contentType string, body io.Reader) ([]byte, error) {
+	target := c.baseURL + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	req, err := http.NewRequest(method, target, body)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		return nil, &APIError{Status: resp.StatusCode, Message: errorMessage(data)}
+	}
+	return data, nil
+}
+
+// errorMessage extracts the message of an error response: the v1 envelope or the plain-text body
+func errorMessage(data []byte) string {
+	var envelope struct {
+		Error struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if json.Unmarshal(data, &envelope) == nil && envelope.Error.Message != "" {
+		return envelope.Error.Message
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// get fetches a resource
+func (c *Client) get(path string, query url.Values, out interface{}) error {
+	return c.do(http.MethodGet, path, query, nil, out)
+}
+
+// list fetches every page of a v1 list endpoint
+func (c *Client) list(path string, query url.Values) ([]map[string]interface{}, error) {
+	if query == nil {
+		query = url.Values{}
+	}
+	query.Set("pageSize", strconv.Itoa(listPageSize))
+
+	var items []map[string]interface{}
+	for page := 1; ; page++ {
+		query.Set("page", strconv.Itoa(page))
+		var result struct {
+			Items []map[string]interface{} `json:"items"`
+			Total int                      `json:"total"`
+		}
+		if err := c.get(path, query, &result); err != nil {
+			return nil, err
+		}
+		items = append(items, result.Items...)
+		if len(result.Items) == 0 || len(items) >= result.Total {
+			return items, nil
+		}
+	}
+}
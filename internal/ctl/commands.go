@@ -0,0 +1,876 @@
+package ctl
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Table columns of the listed resources
+var (
+	profileColumns = []column{
+		{title: "NAME", field: "name"},
+		{title: "URL", field: "url"},
+		{title: "TOKEN", field: "token"},
+		{title: "DEFAULT", field: "default", format: formatBool},
+	}
+	userColumns = []column{
+		{title: "NAME", field: "name"},
+		{title: "IP", field: "ip"},
+		{title: "GROUP", field: "group"},
+		{title: "CREATED", field: "createdAt", format: formatTime},
+	}
+	whitelistColumns = []column{
+		{title: "ID", field: "id"},
+		{title: "IP", field: "ip"},
+		{title: "CREATED", field: "createdAt", format: formatTime},
+	}
+	listenerColumns = []column{
+		{title: "ID", field: "id"},
+		{title: "TYPE", field: "type"},
+		{title: "RUNNING", field: "running", format: formatBool},
+		{title: "LISTEN", field: "listen"},
+		{title: "FAMILY", field: "ipFamily"},
+		{title: "EACH", field: "listenEach", format: formatBool},
+		{title: "PORT", field: "port"},
+		{title: "ADDRESSES", field: "addresses", format: formatList},
+		{title: "AUTH", field: "authMode"},
+		{title: "TLS", field: "tls", format: formatBool},
+		{title: "BIND-LISTEN", field: "bindListen", format: formatBool},
+		{title: "AUTOSTART", field: "autoStart", format: formatBool},
+		{title: "UPLOAD", field: "uploadRate", format: formatLimit},
+		{title: "DOWNLOAD", field: "downloadRate", format: formatLimit},
+		{title: "MAX-CONNS", field: "maxConnections", format: formatConnectionLimit},
+		{title: "MAX-CONNS/IP", field: "maxConnectionsPerIP", format: formatConnectionLimit},
+	}
+	metricsColumns = []column{
+		{title: "Active connections", field: "activeConnections"},
+		{title: "Peak connections", field: "maxActiveConnections"},
+		{title: "Total connections", field: "totalConnections"},
+		{title: "Upload speed", field: "uploadSpeed", format: formatRate},
+		{title: "Download speed", field: "downloadSpeed", format: formatRate},
+		{title: "Bytes sent", field: "bytesSent", format: formatBytes},
+		{title: "Bytes received", field: "bytesReceived", format: formatBytes},
+		{title: "Errors", field: "errorCount"},
+		{title: "Reload failures", field: "reloadFailures"},
+		{title: "Uptime", field: "uptime", format: formatSeconds},
+	}
+	connectionColumns = []column{
+		{title: "ID", field: "id"},
+		{title: "LISTENER", field: "listener"},
+		{title: "CLIENT", field: "clientIP"},
+		{title: "USER", field: "username"},
+		{title: "AGE", field: "startedAt", format: formatAge},
+		{title: "IN", field: "bytesIn", format: formatBytes},
+		{title: "OUT", field: "bytesOut", format: formatBytes},
+	}
+)
+
+// profileCommands manage the saved server profiles
+var profileCommands = map[string]command{
+	"list": {usage: "", run: runProfileList},
+	"add":  {usage: "<name> -server <url> [-token <token>] [-ca <file>] [-insecure] [-default]", run: runProfileAdd},
+	"del":  {usage: "<name>", run: runProfileDel},
+	"use":  {usage: "<name>", run: runProfileUse},
+}
+
+func runProfileList(s *session, fs *flag.FlagSet, args []string) error {
+	if _, err := s.parse(fs, args, 0, 0); err != nil {
+		return err
+	}
+	path, err := s.profilesPath()
+	if err != nil {
+		return err
+	}
+	profiles, err := loadProfiles(path)
+	if err != nil {
+		return err
+	}
+	items := make([]map[string]interface{}, 0, len(profiles.Profiles))
+	for _, name := range profiles.names() {
+		profile := profiles.Profiles[name]
+		token := ""
+		if profile.Token != "" {
+			token = "(set)"
+		}
+		items = append(items, map[string]interface{}{
+			"name": name, "url": profile.URL, "token": token, "default": name == profiles.Default,
+		})
+	}
+	return s.out.table(profileColumns, items)
+}
+
+func runProfileAdd(s *session, fs *flag.FlagSet, args []string) error {
+	makeDefault := fs.Bool("default", false, "Make this the default profile")
+	positional, err := s.parse(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	name := positional[0]
+	if s.opts.server == "" {
+		return fmt.Errorf("-server is required")
+	}
+	profile := &Profile{URL: s.opts.server, Token: s.opts.token, CACert: s.opts.caCert, Insecure: s.opts.insecure}
+	if _, err := NewClient(*profile); err != nil {
+		return err
+	}
+
+	path, err := s.profilesPath()
+	if err != nil {
+		return err
+	}
+	profiles, err := loadProfiles(path)
+	if err != nil {
+		return err
+	}
+	profiles.Profiles[name] = profile
+	if *makeDefault || profiles.Default == "" {
+		profiles.Default = name
+	}
+	if err := profiles.save(path); err != nil {
+		return fmt.Errorf("failed to save profiles: %v", err)
+	}
+	s.out.message("Profile %s saved to %s", name, path)
+	return nil
+}
+
+func runProfileDel(s *session, fs *flag.FlagSet, args []string) error {
+	positional, err := s.parse(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	name := positional[0]
+	path, err := s.profilesPath()
+	if err != nil {
+		return err
+	}
+	profiles, err := loadProfiles(path)
+	if err != nil {
+		return err
+	}
+	if _, ok := profiles.Profiles[name]; !ok {
+		return fmt.Errorf("unknown profile %q", name)
+	}
+	delete(profiles.Profiles, name)
+	if profiles.Default == name {
+		profiles.Default = ""
+	}
+	if err := profiles.save(path); err != nil {
+		return fmt.Errorf("failed to save profiles: %v", err)
+	}
+	s.out.message("Profile %s deleted", name)
+	return nil
+}
+
+func runProfileUse(s *session, fs *flag.FlagSet, args []string) error {
+	positional, err := s.parse(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	name := positional[0]
+	path, err := s.profilesPath()
+	if err != nil {
+		return err
+	}
+	profiles, err := loadProfiles(path)
+	if err != nil {
+		return err
+	}
+	if _, ok := profiles.Profiles[name]; !ok {
+		return fmt.Errorf("unknown profile %q", name)
+	}
+	profiles.Default = name
+	if err := profiles.save(path); err != nil {
+		return fmt.Errorf("failed to save profiles: %v", err)
+	}
+	s.out.message("Default profile set to %s", name)
+	return nil
+}
+
+// userCommands manage proxy users through /api/v1/users
+var userCommands = map[string]command{
+	"list": {usage: "[-q <text>] [-group <group>] [-ip <ip>]", run: runUserList},
+	"get":  {usage: "<name>", run: runUserGet},
+	"add":  {usage: "<name> -password <password> [-ip <ip>] [-group <group>]", run: runUserAdd},
+	"set":  {usage: "<name> [-password <password>] [-ip <ip>] [-group <group>]", run: runUserSet},
+	"del":  {usage: "<name>", run: runUserDel},
+}
+
+func runUserList(s *session, fs *flag.FlagSet, args []string) error {
+	search := fs.String("q", "", "Only users whose name contains this text")
+	group := fs.String("group", "", "Only members of this group")
+	ip := fs.String("ip", "", "Only users with this IP")
+	if _, err := s.parse(fs, args, 0, 0); err != nil {
+		return err
+	}
+	client, err := s.api()
+	if err != nil {
+		return err
+	}
+	query := url.Values{}
+	for name, value := range map[string]string{"q": *search, "group": *group, "ip": *ip} {
+		if value != "" {
+			query.Set(name, value)
+		}
+	}
+	users, err := client.list("/api/v1/users", query)
+	if err != nil {
+		return err
+	}
+	return s.out.table(userColumns, users)
+}
+
+func runUserGet(s *session, fs *flag.FlagSet, args []string) error {
+	positional, err := s.parse(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	client, err := s.api()
+	if err != nil {
+		return err
+	}
+	var user map[string]interface{}
+	if err := client.get("/api/v1/users/"+url.PathEscape(positional[0]), nil, &user); err != nil {
+		return err
+	}
+	return s.out.object(userColumns, user)
+}
+
+func runUserAdd(s *session, fs *flag.FlagSet, args []string) error {
+	password := fs.String("password", "", "Password of the user")
+	ip := fs.String("ip", "", "IP the user connects from")
+	group := fs.String("group", "", "User group")
+	positional, err := s.parse(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	if *password == "" {
+		return fmt.Errorf("-password is required")
+	}
+	client, err := s.api()
+	if err != nil {
+		return err
+	}
+	body := map[string]string{"name": positional[0], "password": *password, "ip": *ip, "group": *group}
+	var user map[string]interface{}
+	if err := client.do(http.MethodPost, "/api/v1/users", nil, body, &user); err != nil {
+		return err
+	}
+	if s.out.format == formatJSON {
+		return s.out.json(user)
+	}
+	s.out.message("User %s added", positional[0])
+	return nil
+}
+
+func runUserSet(s *session, fs *flag.FlagSet, args []string) error {
+	password := fs.String("password", "", "New password")
+	ip := fs.String("ip", "", "New IP the user connects from")
+	group := fs.String("group", "", "New user group (empty = none)")
+	positional, err := s.parse(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	body := make(map[string]string)
+	for name, value := range map[string]*string{"password": password, "ip": ip, "group": group} {
+		if given(fs, name) {
+			body[name] = *value
+		}
+	}
+	if len(body) == 0 {
+		return fmt.Errorf("nothing to change; give -password, -ip or -group")
+	}
+	client, err := s.api()
+	if err != nil {
+		return err
+	}
+	var user map[string]interface{}
+	if err := client.do(http.MethodPatch, "/api/v1/users/"+url.PathEscape(positional[0]), nil, body, &user); err != nil {
+		return err
+	}
+	if s.out.format == formatJSON {
+		return s.out.json(user)
+	}
+	s.out.message("User %s updated", positional[0])
+	return nil
+}
+
+func runUserDel(s *session, fs *flag.FlagSet, args []string) error {
+	positional, err := s.parse(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	client, err := s.api()
+	if err != nil {
+		return err
+	}
+	if err := client.do(http.MethodDelete, "/api/v1/users/"+url.PathEscape(positional[0]), nil, nil, nil); err != nil {
+		return err
+	}
+	s.out.message("User %s deleted", positional[0])
+	return nil
+}
+
+// whitelistCommands manage the IP whitelist through /api/v1/whitelist
+var whitelistCommands = map[string]command{
+	"list": {usage: "[-q <text>]", run: runWhitelistList},
+	"add":  {usage: "<ip>", run: runWhitelistAdd},
+	"del":  {usage: "<ip|id>", run: runWhitelistDel},
+}
+
+func runWhitelistList(s *session, fs *flag.FlagSet, args []string) error {
+	search := fs.String("q", "", "Only entries whose IP contains this text")
+	if _, err := s.parse(fs, args, 0, 0); err != nil {
+		return err
+	}
+	client, err := s.api()
+	if err != nil {
+		return err
+	}
+	query := url.Values{}
+	if *search != "" {
+		query.Set("q", *search)
+	}
+	entries, err := client.list("/api/v1/whitelist", query)
+	if err != nil {
+		return err
+	}
+	return s.out.table(whitelistColumns, entries)
+}
+
+func runWhitelistAdd(s *session, fs *flag.FlagSet, args []string) error {
+	positional, err := s.parse(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	client, err := s.api()
+	if err != nil {
+		return err
+	}
+	var entry map[string]interface{}
+	if err := client.do(http.MethodPost, "/api/v1/whitelist", nil, map[string]string{"ip": positional[0]}, &entry); err != nil {
+		return err
+	}
+	if s.out.format == formatJSON {
+		return s.out.json(entry)
+	}
+	s.out.message("IP %s whitelisted", positional[0])
+	return nil
+}
+
+func runWhitelistDel(s *session, fs *flag.FlagSet, args []string) error {
+	positional, err := s.parse(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	client, err := s.api()
+	if err != nil {
+		return err
+	}
+
+	// Entries are addressed by ID; look an IP up first
+	id := positional[0]
+	if _, err := strconv.ParseUint(id, 10, 64); err != nil {
+		entries, err := client.list("/api/v1/whitelist", url.Values{"q": {id}})
+		if err != nil {
+			return err
+		}
+		found := false
+		for _, entry := range entries {
+			if entry["ip"] == id {
+				id, found = fmt.Sprint(entry["id"]), true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("IP %s is not whitelisted", positional[0])
+		}
+	}
+	if err := client.do(http.MethodDelete, "/api/v1/whitelist/"+id, nil, nil, nil); err != nil {
+		return err
+	}
+	s.out.message("Whitelist entry %s removed", positional[0])
+	return nil
+}
+
+// listenerSettingsUsage lists the flags of the listener settings
+const listenerSettingsUsage = "[-listen <ip|interface>] [-ip-family dual|ipv4|ipv6] [-listen-each] [-port <port>] [-auth default|password|whitelist] [-tls -tls-cert <file> -tls-key <file>] " +
+	"[-bind-listen] [-autostart] [-upload-rate <bytes/s>] [-download-rate <bytes/s>] [-max-conns <n>] [-max-conns-per-ip <n>]"
+
+// listenerCommands manage the proxy listeners through /api/v1/listeners
+var listenerCommands = map[string]command{
+	"list":  {usage: "[-type socks5|http]", run: runListenerList},
+	"get":   {usage: "<id>", run: runListenerGet},
+	"add":   {usage: "<id> -type socks5|http " + listenerSettingsUsage, run: runListenerAdd},
+	"set":   {usage: "<id> " + listenerSettingsUsage, run: runListenerSet},
+	"del":   {usage: "<id>", run: runListenerDel},
+	"start": {usage: "<id>", run: runListenerAction("start")},
+	"stop":  {usage: "<id>", run: runListenerAction("stop")},
+}
+
+// listenerSettingFlags registers the flags of the listener settings
+// and returns a function that collects the given ones into an API request body
+func listenerSettingFlags(fs *flag.FlagSet) func() map[string]interface{} {
+	listen := fs.String("listen", "", "IP address or interface name to listen on (empty = all addresses; listener must be stopped)")
+	ipFamily := fs.String("ip-family", "", "Address family: dual, ipv4 or ipv6 (IPv6 only; listener must be stopped)")
+	listenEach := fs.Bool("listen-each", false, "Listen on every local address individually (listener must be stopped)")
+	port := fs.Int("port", 0, "Port to listen on (listener must be stopped)")
+	authMode := fs.String("auth", "", "Authentication: default, password (ignore the whitelist) or whitelist (listener must be stopped)")
+	useTLS := fs.Bool("tls", false, "Wrap client connections in TLS (listener must be stopped)")
+	tlsCert := fs.String("tls-cert", "", "PEM certificate file for -tls")
+	tlsKey := fs.String("tls-key", "", "PEM private key file for -tls")
+	bindListen := fs.Bool("bind-listen", false, "Use the connection's local address for outbound connections (listener must be stopped)")
+	autoStart := fs.Bool("autostart", false, "Start the listener with the server")
+	uploadRate := fs.Int64("upload-rate", 0, "Upload limit in bytes per second (0 = unlimited)")
+	downloadRate := fs.Int64("download-rate", 0, "Download limit in bytes per second (0 = unlimited)")
+	maxConns := fs.Int("max-conns", 0, "Concurrent connection limit (0 = global setting)")
+	maxConnsPerIP := fs.Int("max-conns-per-ip", 0, "Concurrent connection limit per client IP (0 = global setting)")
+
+	return func() map[string]interface{} {
+		body := make(map[string]interface{})
+		for name, field := range map[string]struct {
+			key   string
+			value interface{}
+		}{
+			"listen":           {"listen", *listen},
+			"ip-family":        {"ipFamily", *ipFamily},
+			"listen-each":      {"listenEach", *listenEach},
+			"port":             {"port", *port},
+			"auth":             {"authMode", *authMode},
+			"tls":              {"tls", *useTLS},
+			"tls-cert":         {"tlsCert", *tlsCert},
+			"tls-key":          {"tlsKey", *tlsKey},
+			"bind-listen":      {"bindListen", *bindListen},
+			"autostart":        {"autoStart", *autoStart},
+			"upload-rate":      {"uploadRate", *uploadRate},
+			"download-rate":    {"downloadRate", *downloadRate},
+			"max-conns":        {"maxConnections", *maxConns},
+			"max-conns-per-ip": {"maxConnectionsPerIP", *maxConnsPerIP},
+		} {
+			if given(fs, name) {
+				body[field.key] = field.value
+			}
+		}
+		return body
+	}
+}
+
+func runListenerList(s *session, fs *flag.FlagSet, args []string) error {
+	listenerType := fs.String("type", "", "Only listeners of this type")
+	if _, err := s.parse(fs, args, 0, 0); err != nil {
+		return err
+	}
+	client, err := s.api()
+	if err != nil {
+		return err
+	}
+	query := url.Values{}
+	if *listenerType != "" {
+		query.Set("type", *listenerType)
+	}
+	listeners, err := client.list("/api/v1/listeners", query)
+	if err != nil {
+		return err
+	}
+	return s.out.table(listenerColumns, listeners)
+}
+
+func runListenerGet(s *session, fs *flag.FlagSet, args []string) error {
+	positional, err := s.parse(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	client, err := s.api()
+	if err != nil {
+		return err
+	}
+	var listener map[string]interface{}
+	if err := client.get("/api/v1/listeners/"+url.PathEscape(positional[0]), nil, &listener); err != nil {
+		return err
+	}
+	return s.out.object(listenerColumns, listener)
+}
+
+func runListenerAdd(s *session, fs *flag.FlagSet, args []string) error {
+	listenerType := fs.String("type", "", "Listener type: socks5 or http")
+	settings := listenerSettingFlags(fs)
+	positional, err := s.parse(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	if *listenerType == "" {
+		return fmt.Errorf("-type is required")
+	}
+	body := settings()
+	body["id"] = positional[0]
+	body["type"] = *listenerType
+	client, err := s.api()
+	if err != nil {
+		return err
+	}
+	var listener map[string]interface{}
+	if err := client.do(http.MethodPost, "/api/v1/listeners", nil, body, &listener); err != nil {
+		return err
+	}
+	return s.out.object(listenerColumns, listener)
+}
+
+func runListenerSet(s *session, fs *flag.FlagSet, args []string) error {
+	settings := listenerSettingFlags(fs)
+	positional, err := s.parse(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	body := settings()
+	if len(body) == 0 {
+		return fmt.Errorf("nothing to change; give at least one setting flag")
+	}
+	client, err := s.api()
+	if err != nil {
+		return err
+	}
+	var listener map[string]interface{}
+	if err := client.do(http.MethodPatch, "/api/v1/listeners/"+url.PathEscape(positional[0]), nil, body, &listener); err != nil {
+		return err
+	}
+	return s.out.object(listenerColumns, listener)
+}
+
+func runListenerDel(s *session, fs *flag.FlagSet, args []string) error {
+	positional, err := s.parse(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	client, err := s.api()
+	if err != nil {
+		return err
+	}
+	if err := client.do(http.MethodDelete, "/api/v1/listeners/"+url.PathEscape(positional[0]), nil, nil, nil); err != nil {
+		return err
+	}
+	s.out.message("Listener %s deleted", positional[0])
+	return nil
+}
+
+// runListenerAction returns the command that starts or stops a listener
+func runListenerAction(action string) func(s *session, fs *flag.FlagSet, args []string) error {
+	return func(s *session, fs *flag.FlagSet, args []string) error {
+		positional, err := s.parse(fs, args, 1, 1)
+		if err != nil {
+			return err
+		}
+		client, err := s.api()
+		if err != nil {
+			return err
+		}
+		var listener map[string]interface{}
+		if err := client.do(http.MethodPost, "/api/v1/listeners/"+url.PathEscape(positional[0])+"/"+action, nil, nil, &listener); err != nil {
+			return err
+		}
+		return s.out.object(listenerColumns, listener)
+	}
+}
+
+// configCommands read and change the server configuration through /api/config
+var configCommands = map[string]command{
+	"get":    {usage: "[<key>]", run: runConfigGet},
+	"set":    {usage: "<key>=<value>...", run: runConfigSet},
+	"export": {usage: "[-format yaml|toml|json] [-f <file>]", run: runConfigExport},
+	"import": {usage: "<file> [-mode file-wins|db-wins] [-dry-run]", run: runConfigImport},
+}
+
+// configFileFormats maps the extensions of configuration files to their formats
+var configFileFormats = map[string]string{
+	".yaml": "yaml",
+	".yml":  "yaml",
+	".toml": "toml",
+	".json": "json",
+}
+
+func runConfigGet(s *session, fs *flag.FlagSet, args []string) error {
+	positional, err := s.parse(fs, args, 0, 1)
+	if err != nil {
+		return err
+	}
+	client, err := s.api()
+	if err != nil {
+		return err
+	}
+	var current map[string]interface{}
+	if err := client.get("/api/config", nil, &current); err != nil {
+		return err
+	}
+
+	settings := make(map[string]interface{})
+	flattenConfig(settings, "", current)
+	if len(positional) == 1 {
+		key := positional[0]
+		if value, ok := settings[key]; ok {
+			if s.out.format == formatJSON {
+				return s.out.json(value)
+			}
+			fmt.Fprintln(s.out.w, value)
+			return nil
+		}
+		section, ok := current[key]
+		if !ok {
+			return fmt.Errorf("unknown setting %q", key)
+		}
+		if s.out.format == formatJSON {
+			return s.out.json(section)
+		}
+		settings = make(map[string]interface{})
+		flattenConfig(settings, key, section)
+	} else if s.out.format == formatJSON {
+		return s.out.json(current)
+	}
+
+	keys := make([]string, 0, len(settings))
+	for key := range settings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	items := make([]map[string]interface{}, 0, len(keys))
+	for _, key := range keys {
+		items = append(items, map[string]interface{}{"key": key, "value": settings[key]})
+	}
+	return s.out.table([]column{{title: "KEY", field: "key"}, {title: "VALUE", field: "value"}}, items)
+}
+
+// runConfigSet changes settings by their dotted keys, e.g. timeout.connect=30
+// The server replaces whole sections, so the changed sections are sent with their current values filled in
+func runConfigSet(s *session, fs *flag.FlagSet, args []string) error {
+	positional, err := s.parse(fs, args, 1, -1)
+	if err != nil {
+		return err
+	}
+	client, err := s.api()
+	if err != nil {
+		return err
+	}
+	var current map[string]interface{}
+	if err := client.get("/api/config", nil, &current); err != nil {
+		return err
+	}
+
+	changed := make(map[string]interface{})
+	for _, arg := range positional {
+		key, raw, ok := strings.Cut(arg, "=")
+		sectionName, field, nested := strings.Cut(key, ".")
+		if !ok || !nested {
+			return fmt.Errorf("invalid setting %q; expected <section>.<key>=<value>", arg)
+		}
+		section, ok := current[sectionName].(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("unknown setting %q", key)
+		}
+		if _, ok := section[field]; !ok {
+			return fmt.Errorf("unknown setting %q", key)
+		}
+		// Values are JSON (numbers, true/false); anything else is taken as a string
+		var value interface{}
+		decoder := json.NewDecoder(strings.NewReader(raw))
+		decoder.UseNumber()
+		if err := decoder.Decode(&value); err != nil {
+			value = raw
+		}
+		section[field] = value
+		changed[sectionName] = section
+	}
+
+	if err := client.do(http.MethodPost, "/api/config", nil, changed, nil); err != nil {
+		return err
+	}
+	s.out.message("Configuration updated")
+	return nil
+}
+
+// runConfigExport downloads the configuration as a declarative configuration file
+func runConfigExport(s *session, fs *flag.FlagSet, args []string) error {
+	format := fs.String("format", "yaml", "File format: yaml, toml or json")
+	file := fs.String("f", "", "File to write (default: standard output; the format follows its extension)")
+	if _, err := s.parse(fs, args, 0, 0); err != nil {
+		return err
+	}
+	if *file != "" && !given(fs, "format") {
+		detected, ok := configFileFormats[strings.ToLower(filepath.Ext(*file))]
+		if !ok {
+			return fmt.Errorf("unknown configuration file format of %s; use -format", *file)
+		}
+		*format = detected
+	}
+	client, err := s.api()
+	if err != nil {
+		return err
+	}
+	data, err := client.send(http.MethodGet, "/api/config/export", url.Values{"format": {*format}}, "", nil)
+	if err != nil {
+		return err
+	}
+	if *file == "" {
+		_, err := s.out.w.Write(data)
+		return err
+	}
+	// The file holds password hashes
+	if err := os.WriteFile(*file, data, 0600); err != nil {
+		return err
+	}
+	s.out.message("Configuration exported to %s", *file)
+	return nil
+}
+
+// runConfigImport shows the changes a configuration file makes and applies them unless -dry-run is given
+func runConfigImport(s *session, fs *flag.FlagSet, args []string) error {
+	mode := fs.String("mode", "file-wins", "file-wins replaces the stored configuration, db-wins only adds what is missing")
+	dryRun := fs.Bool("dry-run", false, "Show the changes without applying them")
+	positional, err := s.parse(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	format, ok := configFileFormats[strings.ToLower(filepath.Ext(positional[0]))]
+	if !ok {
+		return fmt.Errorf("unknown configuration file format of %s (expected .yaml, .yml, .toml or .json)", positional[0])
+	}
+	data, err := os.ReadFile(positional[0])
+	if err != nil {
+		return err
+	}
+	client, err := s.api()
+	if err != nil {
+		return err
+	}
+
+	query := url.Values{"format": {format}, "mode": {*mode}, "dryRun": {strconv.FormatBool(*dryRun)}}
+	body, err := client.send(http.MethodPost, "/api/config/import", query, "application/octet-stream", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	var result struct {
+		Applied bool                     `json:"applied"`
+		Changes []map[string]interface{} `json:"changes"`
+	}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if err := decoder.Decode(&result); err != nil {
+		return fmt.Errorf("invalid response from server: %v", err)
+	}
+
+	if err := s.out.table([]column{
+		{title: "FIELD", field: "field"},
+		{title: "BEFORE", field: "before", format: formatJSONValue},
+		{title: "AFTER", field: "after", format: formatJSONValue},
+	}, result.Changes); err != nil {
+		return err
+	}
+	switch {
+	case *dryRun:
+		s.out.message("%d changes (dry run, nothing applied)", len(result.Changes))
+	case result.Applied:
+		s.out.message("%d changes applied", len(result.Changes))
+	default:
+		s.out.message("No changes")
+	}
+	return nil
+}
+
+// runBackup downloads an online backup of the server's database
+func runBackup(s *session, fs *flag.FlagSet, args []string) error {
+	file := fs.String("f", "", "File to write")
+	if _, err := s.parse(fs, args, 0, 0); err != nil {
+		return err
+	}
+	if *file == "" {
+		return fmt.Errorf("-f is required")
+	}
+	client, err := s.api()
+	if err != nil {
+		return err
+	}
+	data, err := client.send(http.MethodGet, "/api/backup", nil, "", nil)
+	if err != nil {
+		return err
+	}
+	// The database holds password hashes
+	if err := os.WriteFile(*file, data, 0600); err != nil {
+		return err
+	}
+	s.out.message("Database backed up to %s (%d bytes)", *file, len(data))
+	return nil
+}
+
+// flattenConfig maps the dotted key of every setting below prefix to its value
+func flattenConfig(settings map[string]interface{}, prefix string, v interface{}) {
+	object, ok := v.(map[string]interface{})
+	if !ok {
+		settings[prefix] = v
+		return
+	}
+	for key, value := range object {
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+		flattenConfig(settings, key, value)
+	}
+}
+
+// runMetrics shows the live traffic metrics, optionally refreshing them until interrupted
+func runMetrics(s *session, fs *flag.FlagSet, args []string) error {
+	watch := fs.Duration("watch", 0, "Refresh interval, e.g. 2s (0 = show once)")
+	if _, err := s.parse(fs, args, 0, 0); err != nil {
+		return err
+	}
+	client, err := s.api()
+	if err != nil {
+		return err
+	}
+	for {
+		var snapshot map[string]interface{}
+		if err := client.get("/api/metrics/realtime", nil, &snapshot); err != nil {
+			return err
+		}
+		if err := s.out.object(metricsColumns, snapshot); err != nil {
+			return err
+		}
+		if *watch <= 0 {
+			return nil
+		}
+		time.Sleep(*watch)
+		if s.out.format == formatTable {
+			fmt.Fprintln(s.out.w)
+		}
+	}
+}
+
+// runConnections lists the client connections open on the proxy listeners
+func runConnections(s *session, fs *flag.FlagSet, args []string) error {
+	listener := fs.String("listener", "", "Only connections accepted by this listener")
+	user := fs.String("user", "", "Only connections of this user")
+	ip := fs.String("ip", "", "Only connections from this client IP")
+	if _, err := s.parse(fs, args, 0, 0); err != nil {
+		return err
+	}
+	client, err := s.api()
+	if err != nil {
+		return err
+	}
+	query := url.Values{}
+	for name, value := range map[string]string{"listener": *listener, "user": *user, "ip": *ip} {
+		if value != "" {
+			query.Set(name, value)
+		}
+	}
+	connections, err := client.list("/api/v1/connections", query)
+	if err != nil {
+		return err
+	}
+	return s.out.table(connectionColumns, connections)
+}
@@ -0,0 +1,268 @@
+// Package ctl implements the "ctl" command group, which manages a running server
+// through its management API instead of opening the database directly
+package ctl
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Environment variables that supply the server and token when no flag is given
+const (
+	envServer = "GPS_CTL_SERVER"
+	envToken  = "GPS_CTL_TOKEN"
+)
+
+// errUsage reports invalid command line usage; the usage has already been printed
+var errUsage = errors.New("invalid usage")
+
+// options are the connection and output flags accepted by every ctl command
+type options struct {
+	configPath string
+	profile    string
+	server     string
+	token      string
+	caCert     string
+	insecure   bool
+	output     string
+}
+
+// bind registers the options on a flag set, keeping values parsed by an earlier flag set as defaults
+func (o *options) bind(fs *flag.FlagSet) {
+	fs.StringVar(&o.configPath, "config", o.configPath, "Profiles file (default: ctl.json in the data directory)")
+	fs.StringVar(&o.profile, "profile", o.profile, "Saved server profile to use (default: the default profile)")
+	fs.StringVar(&o.server, "server", o.server, "Server URL, e.g. https://proxy.example.com:8443 (env "+envServer+")")
+	fs.StringVar(&o.token, "token", o.token, "API token (env "+envToken+")")
+	fs.StringVar(&o.caCert, "ca", o.caCert, "PEM file of the CA that signed the server certificate")
+	fs.BoolVar(&o.insecure, "insecure", o.insecure, "Skip TLS certificate verification")
+	fs.StringVar(&o.output, "o", o.output, "Output format: table or json")
+}
+
+// session is the state shared by the commands of one invocation
+type session struct {
+	opts   *options
+	stdout io.Writer
+	out    *printer // Set once the command line is parsed
+	client *Client
+}
+
+// profilesPath returns the profiles file in use
+func (s *session) profilesPath() (string, error) {
+	if s.opts.configPath != "" {
+		return s.opts.configPath, nil
+	}
+	return defaultProfilesPath()
+}
+
+// api returns the client of the selected server: the profile, overridden by environment variables and flags
+func (s *session) api() (*Client, error) {
+	if s.client != nil {
+		return s.client, nil
+	}
+	path, err := s.profilesPath()
+	if err != nil {
+		return nil, err
+	}
+	profiles, err := loadProfiles(path)
+	if err != nil {
+		return nil, err
+	}
+	profile, err := profiles.resolve(s.opts.profile)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, override := range []struct {
+		target *string
+		env    string
+		flag   string
+	}{
+		{&profile.URL, os.Getenv(envServer), s.opts.server},
+		{&profile.Token, os.Getenv(envToken), s.opts.token},
+		{&profile.CACert, "", s.opts.caCert},
+	} {
+		if override.env != "" {
+			*override.target = override.env
+		}
+		if override.flag != "" {
+			*override.target = override.flag
+		}
+	}
+	if s.opts.insecure {
+		profile.Insecure = true
+	}
+
+	if s.client, err = NewClient(profile); err != nil {
+		return nil, err
+	}
+	return s.client, nil
+}
+
+// command is a ctl subcommand
+type command struct {
+	usage string // Arguments and flags, shown in the usage
+	run   func(s *session, fs *flag.FlagSet, args []string) error
+}
+
+// commandGroups lists the subcommands by group and action
+var commandGroups = map[string]map[string]command{
+	"profile":     profileCommands,
+	"users":       userCommands,
+	"whitelist":   whitelistCommands,
+	"listeners":   listenerCommands,
+	"config":      configCommands,
+	"metrics":     {"": {usage: "[-watch <interval>]", run: runMetrics}},
+	"connections": {"": {usage: "[-listener <id>] [-user <name>] [-ip <ip>]", run: runConnections}},
+	"backup":      {"": {usage: "-f <file>", run: runBackup}},
+}
+
+// groupOrder is the order of the groups in the usage
+var groupOrder = []string{"profile", "users", "whitelist", "listeners", "config", "metrics", "connections", "backup"}
+
+// Run executes a ctl command line (the arguments after "ctl") and returns the process exit code
+func Run(args []string) int {
+	return run(args, os.Stdout, os.Stderr)
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	opts := &options{output: formatTable}
+	global := flag.NewFlagSet("ctl", flag.ContinueOnError)
+	global.SetOutput(stderr)
+	opts.bind(global)
+	global.Usage = func() { printUsage(stderr, global) }
+	if err := global.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	args = global.Args()
+	if len(args) == 0 {
+		printUsage(stderr, global)
+		return 2
+	}
+
+	group, ok := commandGroups[args[0]]
+	if !ok {
+		fmt.Fprintf(stderr, "Unknown command: %s\n\n", args[0])
+		printUsage(stderr, global)
+		return 2
+	}
+	name, action := args[0], ""
+	args = args[1:]
+	if _, single := group[""]; !single {
+		if len(args) == 0 {
+			printGroupUsage(stderr, name, group)
+			return 2
+		}
+		action, args = args[0], args[1:]
+	}
+	cmd, ok := group[action]
+	if !ok {
+		fmt.Fprintf(stderr, "Unknown command: %s %s\n\n", name, action)
+		printGroupUsage(stderr, name, group)
+		return 2
+	}
+
+	fs := flag.NewFlagSet(strings.TrimSpace("ctl "+name+" "+action), flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	opts.bind(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: %s %s\n", fs.Name(), cmd.usage)
+		fs.PrintDefaults()
+	}
+
+	s := &session{opts: opts, stdout: stdout}
+	switch err := cmd.run(s, fs, args); {
+	case err == nil, errors.Is(err, flag.ErrHelp):
+		return 0
+	case errors.Is(err, errUsage):
+		return 2
+	default:
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		return 1
+	}
+}
+
+// parse parses the flags of a command, which may be given before or after its positional arguments,
+// and checks the number of positional arguments
+func (s *session) parse(fs *flag.FlagSet, args []string, minArgs, maxArgs int) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return nil, err
+			}
+			return nil, errUsage // The flag package has printed the error and usage
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			break
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+	if len(positional) < minArgs || (maxArgs >= 0 && len(positional) > maxArgs) {
+		fs.Usage()
+		return nil, errUsage
+	}
+	if s.opts.output != formatTable && s.opts.output != formatJSON {
+		return nil, fmt.Errorf("unknown output format %q", s.opts.output)
+	}
+	s.out = &printer{w: s.stdout, format: s.opts.output}
+	return positional, nil
+}
+
+// given reports whether a flag was set on the command line
+func given(fs *flag.FlagSet, name string) bool {
+	set := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+// printUsage prints the ctl commands and global flags
+func printUsage(w io.Writer, global *flag.FlagSet) {
+	fmt.Fprintln(w, "Usage: ctl [flags] <command> [arguments]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	for _, name := range groupOrder {
+		group := commandGroups[name]
+		for _, action := range sortedActions(group) {
+			fmt.Fprintln(w, "  "+strings.TrimSpace(name+" "+action+" "+group[action].usage))
+		}
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Flags (accepted before or after the command):")
+	global.SetOutput(w)
+	global.PrintDefaults()
+}
+
+// actionOrder is the order of the actions of a group in the usage
+var actionOrder = []string{"", "list", "get", "add", "set", "del", "use", "start", "stop", "export", "import"}
+
+// sortedActions returns the actions of a group in usage order
+func sortedActions(group map[string]command) []string {
+	var actions []string
+	for _, action := range actionOrder {
+		if _, ok := group[action]; ok {
+			actions = append(actions, action)
+		}
+	}
+	return actions
+}
+
+// printGroupUsage prints the commands of a group
+func printGroupUsage(w io.Writer, name string, group map[string]command) {
+	fmt.Fprintln(w, "Usage:")
+	for _, action := range sortedActions(group) {
+		fmt.Fprintln(w, "  "+strings.TrimSpace("ctl "+name+" "+action+" "+group[action].usage))
+	}
+}
@@ -0,0 +1,202 @@
+package ctl
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Output formats
+const (
+	formatTable = "table"
+	formatJSON  = "json"
+)
+
+// column is a table column showing one field of the listed objects
+type column struct {
+	title  string
+	field  string
+	format func(interface{}) string // nil = plain value
+}
+
+// printer writes command results in the selected output format
+type printer struct {
+	w      io.Writer
+	format string
+}
+
+// json writes v as indented JSON
+func (p *printer) json(v interface{}) error {
+	encoder := json.NewEncoder(p.w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+// table writes objects as a table, or as a JSON array in JSON mode
+func (p *printer) table(columns []column, items []map[string]interface{}) error {
+	if p.format == formatJSON {
+		if items == nil {
+			items = []map[string]interface{}{}
+		}
+		return p.json(items)
+	}
+	tw := tabwriter.NewWriter(p.w, 0, 0, 2, ' ', 0)
+	titles := make([]string, len(columns))
+	for i, col := range columns {
+		titles[i] = col.title
+	}
+	fmt.Fprintln(tw, strings.Join(titles, "\t"))
+	for _, item := range items {
+		cells := make([]string, len(columns))
+		for i, col := range columns {
+			cells[i] = formatCell(col, item[col.field])
+		}
+		fmt.Fprintln(tw, strings.Join(cells, "\t"))
+	}
+	return tw.Flush()
+}
+
+// object writes a single object as field/value rows, or as JSON in JSON mode
+func (p *printer) object(columns []column, item map[string]interface{}) error {
+	if p.format == formatJSON {
+		return p.json(item)
+	}
+	tw := tabwriter.NewWriter(p.w, 0, 0, 2, ' ', 0)
+	for _, col := range columns {
+		fmt.Fprintf(tw, "%s:\t%s\n", col.title, formatCell(col, item[col.field]))
+	}
+	return tw.Flush()
+}
+
+// message writes a confirmation, which JSON mode leaves out to keep the output machine-readable
+func (p *printer) message(format string, args ...interface{}) {
+	if p.format != formatJSON {
+		fmt.Fprintf(p.w, format+"\n", args...)
+	}
+}
+
+// formatCell renders a value of a column
+func formatCell(col column, value interface{}) string {
+	if value == nil {
+		return "-"
+	}
+	if col.format != nil {
+		return col.format(value)
+	}
+	if s := fmt.Sprint(value); s != "" {
+		return s
+	}
+	return "-"
+}
+
+// number converts a decoded JSON number to float64
+func number(value interface{}) float64 {
+	switch v := value.(type) {
+	case json.Number:
+		f, _ := v.Float64()
+		return f
+	case float64:
+		return v
+	case int64:
+		return float64(v)
+	case int:
+		return float64(v)
+	}
+	return 0
+}
+
+// formatBytes renders a byte count with a binary unit
+func formatBytes(value interface{}) string {
+	size := number(value)
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB"}
+	unit := 0
+	for size >= 1024 && unit < len(units)-1 {
+		size /= 1024
+		unit++
+	}
+	if unit == 0 {
+		return fmt.Sprintf("%.0f %s", size, units[unit])
+	}
+	return fmt.Sprintf("%.1f %s", size, units[unit])
+}
+
+// formatRate renders a transfer rate in bytes per second
+func formatRate(value interface{}) string {
+	return formatBytes(value) + "/s"
+}
+
+// formatLimit renders a bandwidth limit, where 0 means unlimited
+func formatLimit(value interface{}) string {
+	if number(value) == 0 {
+		return "unlimited"
+	}
+	return formatRate(value)
+}
+
+// formatConnectionLimit renders a listener connection limit, where 0 means the global setting applies
+func formatConnectionLimit(value interface{}) string {
+	if number(value) == 0 {
+		return "global"
+	}
+	return fmt.Sprint(value)
+}
+
+// formatSeconds renders a duration in seconds
+func formatSeconds(value interface{}) string {
+	return (time.Duration(number(value)) * time.Second).String()
+}
+
+// formatTime renders an RFC 3339 timestamp in local time
+func formatTime(value interface{}) string {
+	s := fmt.Sprint(value)
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return s
+	}
+	return t.Local().Format("2006-01-02 15:04:05")
+}
+
+// formatAge renders the time elapsed since an RFC 3339 timestamp
+func formatAge(value interface{}) string {
+	t, err := time.Parse(time.RFC3339Nano, fmt.Sprint(value))
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return time.Since(t).Truncate(time.Second).String()
+}
+
+// formatList renders a JSON array as a comma-separated list
+func formatList(value interface{}) string {
+	items, ok := value.([]interface{})
+	if !ok {
+		return fmt.Sprint(value)
+	}
+	if len(items) == 0 {
+		return "-"
+	}
+	parts := make([]string, len(items))
+	for i, item := range items {
+		parts[i] = fmt.Sprint(item)
+	}
+	return strings.Join(parts, ",")
+}
+
+// formatBool renders a flag as yes/no
+func formatBool(value interface{}) string {
+	if b, ok := value.(bool); ok && b {
+		return "yes"
+	}
+	return "no"
+}
+
+// formatJSONValue renders a value as JSON, so strings, lists and objects stay distinguishable
+func formatJSONValue(value interface{}) string {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(data)
+}
@@ -0,0 +1,95 @@
+package ctl
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"go-proxy-server/internal/config"
+)
+
+// profilesFileName is the name of the profiles file in the data directory
+const profilesFileName = "ctl.json"
+
+// Profile is a saved management server connection
+type Profile struct {
+	URL      string `json:"url"`                // Base URL of the web interface, e.g. https://proxy.example.com:8443
+	Token    string `json:"token,omitempty"`    // API token (gps_...)
+	CACert   string `json:"caCert,omitempty"`   // PEM file of the CA that signed the server certificate
+	Insecure bool   `json:"insecure,omitempty"` // Skip TLS certificate verification
+}
+
+// Profiles is the content of the profiles file
+type Profiles struct {
+	Default  string              `json:"default,omitempty"`
+	Profiles map[string]*Profile `json:"profiles"`
+}
+
+// defaultProfilesPath returns the profiles file path in the data directory
+func defaultProfilesPath() (string, error) {
+	dataDir, err := config.GetDataDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get data directory: %v", err)
+	}
+	return filepath.Join(dataDir, profilesFileName), nil
+}
+
+// loadProfiles reads the profiles file; a missing file yields no profiles
+func loadProfiles(path string) (*Profiles, error) {
+	profiles := &Profiles{Profiles: make(map[string]*Profile)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return profiles, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, profiles); err != nil {
+		return nil, fmt.Errorf("invalid profiles file %s: %v", path, err)
+	}
+	if profiles.Profiles == nil {
+		profiles.Profiles = make(map[string]*Profile)
+	}
+	return profiles, nil
+}
+
+// save writes the profiles file, readable by the owner only since it holds API tokens
+func (p *Profiles) save(path string) error {
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0600)
+}
+
+// names returns the profile names in alphabetical order
+func (p *Profiles) names() []string {
+	names := make([]string, 0, len(p.Profiles))
+	for name := range p.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// resolve returns the named profile, the default profile when name is empty,
+// or an empty profile when no profile is selected
+func (p *Profiles) resolve(name string) (Profile, error) {
+	if name == "" {
+		name = p.Default
+	}
+	if name == "" {
+		return Profile{}, nil
+	}
+	profile, ok := p.Profiles[name]
+	if !ok {
+		return Profile{}, fmt.Errorf("unknown profile %q", name)
+	}
+	return *profile, nil
+}
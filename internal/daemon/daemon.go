@@ -0,0 +1,231 @@
+// Package daemon implements the service commands (start, stop, status, reload) that control
+// a server running in the background with "serve", using its PID file to find it
+package daemon
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"go-proxy-server/internal/config"
+	"go-proxy-server/internal/pidfile"
+)
+
+// PIDFileName is the PID file in the data directory used when no -pid-file is given
+const PIDFileName = "go-proxy-server.pid"
+
+// Exit codes of the status command, as defined for LSB init scripts
+const (
+	StatusRunning    = 0
+	StatusDead       = 1 // PID file left behind by a process that is gone
+	StatusNotRunning = 3
+	StatusUnknown    = 4 // The status could not be determined
+)
+
+// DefaultPIDFile returns the PID file used when no -pid-file is given
+func DefaultPIDFile() (string, error) {
+	dataDir, err := config.GetDataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dataDir, PIDFileName), nil
+}
+
+// Commands lists the service commands handled by Run
+var Commands = map[string]bool{"start": true, "stop": true, "status": true, "reload": true}
+
+// Run runs a service command and returns the process exit code
+func Run(command string, args []string) int {
+	return run(command, args, os.Stdout, os.Stderr)
+}
+
+func run(command string, args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet(command, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	pidPath := fs.String("pid-file", "", "PID file of the server (default: "+PIDFileName+" in the data directory)")
+	var timeout *time.Duration
+	var upgrade *bool
+	switch command {
+	case "start":
+		timeout = fs.Duration("timeout", 30*time.Second, "How long to wait for the server to become ready")
+	case "stop":
+		timeout = fs.Duration("timeout", 90*time.Second, "How long to wait for the server to drain its connections and exit")
+	case "reload":
+		upgrade = fs.Bool("upgrade", false, "Hand the listeners over to a newly started binary instead of reloading the configuration")
+	}
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if fs.NArg() > 0 {
+		fmt.Fprintf(stderr, "Unexpected arguments: %v\n", fs.Args())
+		return 2
+	}
+
+	path := *pidPath
+	if path == "" {
+		defaultPath, err := DefaultPIDFile()
+		if err != nil {
+			fmt.Fprintf(stderr, "Error: %v\n", err)
+			return 1
+		}
+		path = defaultPath
+	}
+
+	var err error
+	switch command {
+	case "start":
+		err = start(stdout, path, *timeout)
+	case "stop":
+		err = stop(stdout, path, *timeout)
+	case "status":
+		return status(stdout, stderr, path)
+	case "reload":
+		err = reload(stdout, path, *upgrade)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// runningPID returns the process ID of the server holding the PID file (0 = not running)
+func runningPID(path string) (int, error) {
+	locked, err := pidfile.IsLocked(path)
+	if err != nil || !locked {
+		return 0, err
+	}
+	pid, err := pidfile.Read(path)
+	if err != nil {
+		// The server locked the file but has not recorded its ID yet
+		return 0, nil
+	}
+	if !processAlive(pid) {
+		return 0, nil
+	}
+	return pid, nil
+}
+
+// Running returns the process ID of the server holding a PID file (0 = not running)
+func Running(path string) (int, error) {
+	return runningPID(path)
+}
+
+// SignalReload asks the server holding a PID file to reload its configuration; it does nothing if no server runs
+func SignalReload(path string) error {
+	pid, err := runningPID(path)
+	if err != nil || pid == 0 {
+		return err
+	}
+	if err := signalReload(pid); err != nil {
+		return fmt.Errorf("failed to signal pid %d: %w", pid, err)
+	}
+	return nil
+}
+
+// status reports whether the server runs, with the LSB exit codes
+func status(stdout, stderr io.Writer, path string) int {
+	pid, err := runningPID(path)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		return StatusUnknown
+	}
+	if pid != 0 {
+		fmt.Fprintf(stdout, "go-proxy-server is running (pid %d)\n", pid)
+		return StatusRunning
+	}
+	if _, err := os.Stat(path); err == nil {
+		fmt.Fprintf(stdout, "go-proxy-server is not running (stale PID file %s)\n", path)
+		return StatusDead
+	}
+	fmt.Fprintln(stdout, "go-proxy-server is not running")
+	return StatusNotRunning
+}
+
+// start runs "serve" in the background and waits until it records its ID in the PID file
+func start(stdout io.Writer, path string, timeout time.Duration) error {
+	if pid, err := runningPID(path); err != nil {
+		return err
+	} else if pid != 0 {
+		return fmt.Errorf("go-proxy-server is already running (pid %d)", pid)
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to locate the executable: %w", err)
+	}
+	pid, exited, err := spawn(executable, "serve", "-pid-file", path)
+	if err != nil {
+		return fmt.Errorf("failed to start the server: %w", err)
+	}
+
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		select {
+		case <-exited:
+			return fmt.Errorf("the server exited during startup; see app.log in the data directory")
+		case <-time.After(100 * time.Millisecond):
+		}
+		if running, _ := runningPID(path); running == pid {
+			fmt.Fprintf(stdout, "go-proxy-server started (pid %d)\n", pid)
+			return nil
+		}
+	}
+	return fmt.Errorf("the server (pid %d) was not ready within %v; see app.log in the data directory", pid, timeout)
+}
+
+// stop asks the server to shut down and waits until it has drained its connections and exited
+func stop(stdout io.Writer, path string, timeout time.Duration) error {
+	pid, err := runningPID(path)
+	if err != nil {
+		return err
+	}
+	if pid == 0 {
+		fmt.Fprintln(stdout, "go-proxy-server is not running")
+		return nil
+	}
+	if err := signalStop(pid); err != nil {
+		return fmt.Errorf("failed to signal pid %d: %w", pid, err)
+	}
+	fmt.Fprintf(stdout, "Stopping go-proxy-server (pid %d)...\n", pid)
+
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if !processAlive(pid) {
+			fmt.Fprintln(stdout, "go-proxy-server stopped")
+			return nil
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+	return fmt.Errorf("pid %d is still draining connections after %v", pid, timeout)
+}
+
+// reload asks the server to reload its configuration, or to hand over to a newly started binary
+func reload(stdout io.Writer, path string, upgrade bool) error {
+	pid, err := runningPID(path)
+	if err != nil {
+		return err
+	}
+	if pid == 0 {
+		return errors.New("go-proxy-server is not running")
+	}
+	if upgrade {
+		if err := signalUpgrade(pid); err != nil {
+			return fmt.Errorf("failed to signal pid %d: %w", pid, err)
+		}
+		fmt.Fprintf(stdout, "Upgrade requested from go-proxy-server (pid %d); check status for the new process\n", pid)
+		return nil
+	}
+	if err := signalReload(pid); err != nil {
+		return fmt.Errorf("failed to signal pid %d: %w", pid, err)
+	}
+	fmt.Fprintf(stdout, "Configuration reload requested from go-proxy-server (pid %d)\n", pid)
+	return nil
+}
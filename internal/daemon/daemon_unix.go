@@ -0,0 +1,49 @@
+//go:build !windows
+// +build !windows
+
+package daemon
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// CanSignal reports whether commands can signal a running server
+const CanSignal = true
+
+// spawn starts a detached process in its own session, returning its ID and a channel closed when it exits
+func spawn(executable string, args ...string) (int, <-chan struct{}, error) {
+	cmd := exec.Command(executable, args...)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	// Standard streams go to /dev/null; the server logs to app.log in the data directory
+	if err := cmd.Start(); err != nil {
+		return 0, nil, err
+	}
+	exited := make(chan struct{})
+	go func() {
+		cmd.Wait()
+		close(exited)
+	}()
+	return cmd.Process.Pid, exited, nil
+}
+
+// processAlive reports whether a process with the ID exists
+func processAlive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || err == syscall.EPERM
+}
+
+// signalStop asks the server to drain its connections and exit
+func signalStop(pid int) error {
+	return syscall.Kill(pid, syscall.SIGTERM)
+}
+
+// signalReload asks the server to reload its configuration
+func signalReload(pid int) error {
+	return syscall.Kill(pid, syscall.SIGHUP)
+}
+
+// signalUpgrade asks the server to hand over to a newly started binary
+func signalUpgrade(pid int) error {
+	return syscall.Kill(pid, syscall.SIGUSR2)
+}
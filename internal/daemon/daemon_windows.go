@@ -0,0 +1,37 @@
+//go:build windows
+// +build windows
+
+package daemon
+
+import "errors"
+
+// errUnsupported is returned by the service commands on Windows, which runs the server in the system tray
+var errUnsupported = errors.New("service commands are not supported on Windows")
+
+// CanSignal reports whether commands can signal a running server; Windows servers watch the configuration revision instead
+const CanSignal = false
+
+// spawn is not supported on Windows
+func spawn(executable string, args ...string) (int, <-chan struct{}, error) {
+	return 0, nil, errUnsupported
+}
+
+// processAlive cannot check processes on Windows
+func processAlive(pid int) bool {
+	return false
+}
+
+// signalStop is not supported on Windows
+func signalStop(pid int) error {
+	return errUnsupported
+}
+
+// signalReload is not supported on Windows
+func signalReload(pid int) error {
+	return errUnsupported
+}
+
+// signalUpgrade is not supported on Windows
+func signalUpgrade(pid int) error {
+	return errUnsupported
+}
@@ -0,0 +1,99 @@
+package daemon
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go-proxy-server/internal/config"
+	"go-proxy-server/internal/pidfile"
+)
+
+// InstanceDirName is the directory in the data directory where every running server registers itself,
+// so commands that change the database find servers started without the default PID file
+const InstanceDirName = "run"
+
+// instanceDir returns the registration directory
+func instanceDir() (string, error) {
+	dataDir, err := config.GetDataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dataDir, InstanceDirName), nil
+}
+
+// Register records the current process as a running server; the registration is locked until it is released
+// Every server mode registers, whether or not it also holds a PID file
+func Register() (*pidfile.Lock, error) {
+	dir, err := instanceDir()
+	if err != nil {
+		return nil, err
+	}
+	lock, err := pidfile.Acquire(filepath.Join(dir, strconv.Itoa(os.Getpid())+".pid"))
+	if err != nil {
+		return nil, err
+	}
+	if err := lock.Write(); err != nil {
+		lock.Release()
+		return nil, err
+	}
+	return lock, nil
+}
+
+// Instances returns the process IDs of the running servers: the registered ones and the one holding the default PID file
+// Registrations left behind by servers that are gone are removed
+func Instances() ([]int, error) {
+	dir, err := instanceDir()
+	if err != nil {
+		return nil, err
+	}
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pid"))
+	if err != nil {
+		return nil, err
+	}
+	if defaultPath, err := DefaultPIDFile(); err == nil {
+		paths = append(paths, defaultPath)
+	}
+
+	seen := make(map[int]bool)
+	var pids []int
+	for _, path := range paths {
+		pid, err := runningPID(path)
+		if err != nil {
+			return nil, err
+		}
+		if pid == 0 {
+			// The file is named after the process that registered, which may not have locked it yet
+			name := strings.TrimSuffix(filepath.Base(path), ".pid")
+			if registered, err := strconv.Atoi(name); err == nil && filepath.Dir(path) == dir && !processAlive(registered) {
+				os.Remove(path)
+			}
+			continue
+		}
+		if !seen[pid] {
+			seen[pid] = true
+			pids = append(pids, pid)
+		}
+	}
+	sort.Ints(pids)
+	return pids, nil
+}
+
+// SignalReloadAll asks every running server to reload its configuration; it does nothing if no server runs
+func SignalReloadAll() error {
+	pids, err := Instances()
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, pid := range pids {
+		if err := signalReload(pid); err != nil {
+			errs = append(errs, fmt.Errorf("failed to signal pid %d: %w", pid, err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,237 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"go-proxy-server/internal/config"
+	"go-proxy-server/internal/constants"
+	"go-proxy-server/internal/logger"
+	"go-proxy-server/internal/models"
+)
+
+// BackupDirName is the directory in the data directory holding the backups
+const BackupDirName = "backups"
+
+// Backup file names: scheduled backups rotate, copies taken before a restore are kept
+const (
+	backupPrefix        = "data-"
+	preRestorePrefix    = "pre-restore-"
+	backupSuffix        = ".db"
+	backupTimestampForm = "20060102-150405"
+)
+
+// ErrBackupUnsupported is returned for databases that are not SQLite files
+var ErrBackupUnsupported = errors.New("backups are only supported for SQLite; use pg_dump or mysqldump for PostgreSQL and MySQL")
+
+// BackupDir returns the backup directory, creating it if needed
+func BackupDir() (string, error) {
+	dataDir, err := config.GetDataDir()
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(dataDir, BackupDirName)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+// Backup writes a consistent copy of a SQLite database to a new file with VACUUM INTO
+// The copy is made in a read transaction, so a running server keeps serving while it is written
+func Backup(db *gorm.DB, path string) error {
+	if db.Dialector.Name() != DialectSQLite {
+		return ErrBackupUnsupported
+	}
+	// VACUUM INTO refuses to overwrite a file
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("%s already exists", path)
+	}
+	if err := db.Exec("VACUUM INTO ?", path).Error; err != nil {
+		return fmt.Errorf("failed to back up the database: %w", err)
+	}
+	// The file holds password hashes
+	return os.Chmod(path, 0600)
+}
+
+// CreateBackup writes a timestamped backup to the backup directory and deletes the oldest ones beyond retention
+func CreateBackup(db *gorm.DB, retention int) (string, error) {
+	dir, err := BackupDir()
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, backupPrefix+time.Now().Format(backupTimestampForm)+backupSuffix)
+	if err := Backup(db, path); err != nil {
+		return "", err
+	}
+
+	backups, err := ListBackups()
+	if err != nil {
+		return path, err
+	}
+	for len(backups) > retention {
+		if err := os.Remove(backups[0]); err != nil {
+			return path, fmt.Errorf("failed to delete old backup: %w", err)
+		}
+		backups = backups[1:]
+	}
+	return path, nil
+}
+
+// ListBackups returns the scheduled backups in the backup directory, oldest first
+func ListBackups() ([]string, error) {
+	dir, err := BackupDir()
+	if err != nil {
+		return nil, err
+	}
+	backups, err := filepath.Glob(filepath.Join(dir, backupPrefix+"*"+backupSuffix))
+	if err != nil {
+		return nil, err
+	}
+	// The timestamps in the names sort chronologically
+	sort.Strings(backups)
+	return backups, nil
+}
+
+// lastBackupTime returns when the newest scheduled backup was written (zero if there is none)
+func lastBackupTime() time.Time {
+	backups, err := ListBackups()
+	if err != nil || len(backups) == 0 {
+		return time.Time{}
+	}
+	name := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(backups[len(backups)-1]), backupPrefix), backupSuffix)
+	taken, err := time.ParseInLocation(backupTimestampForm, name, time.Local)
+	if err != nil {
+		return time.Time{}
+	}
+	return taken
+}
+
+// StartBackupScheduler writes scheduled backups of a SQLite database in the background
+// The interval is counted from the newest backup, so restarting the server neither repeats nor postpones one
+func StartBackupScheduler(db *gorm.DB) {
+	if db.Dialector.Name() != DialectSQLite {
+		logger.Info("Scheduled backups are disabled: the database is not a SQLite file")
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(constants.BackupCheckInterval)
+		defer ticker.Stop()
+		for {
+			cfg := config.GetBackupConfig()
+			interval := time.Duration(cfg.IntervalHours) * time.Hour
+			if interval > 0 && time.Since(lastBackupTime()) >= interval {
+				if path, err := CreateBackup(db, cfg.Retention); err != nil {
+					logger.Error("Scheduled backup failed: %v", err)
+				} else {
+					logger.Info("Scheduled backup written to %s", path)
+				}
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+// Restore replaces a SQLite database with a backup; the server must not be running
+// The backup is checked before anything changes and the current database is kept as a pre-restore copy,
+// whose path is returned. Migrations pending for the backup are applied when the server next starts
+func Restore(target Target, backup string) (string, error) {
+	if target.Dialect != DialectSQLite {
+		return "", ErrBackupUnsupported
+	}
+	if err := checkBackup(backup); err != nil {
+		return "", err
+	}
+
+	var kept string
+	if _, err := os.Stat(target.DSN); err == nil {
+		dir, err := BackupDir()
+		if err != nil {
+			return "", err
+		}
+		kept = filepath.Join(dir, preRestorePrefix+time.Now().Format(backupTimestampForm)+backupSuffix)
+		if err := copyFile(target.DSN, kept); err != nil {
+			return "", fmt.Errorf("failed to keep the current database: %w", err)
+		}
+	}
+
+	// Copy next to the database first, so the database is replaced in one rename
+	temp := target.DSN + ".restore"
+	if err := copyFile(backup, temp); err != nil {
+		os.Remove(temp)
+		return "", fmt.Errorf("failed to copy the backup: %w", err)
+	}
+	if err := os.Rename(temp, target.DSN); err != nil {
+		os.Remove(temp)
+		return "", fmt.Errorf("failed to replace the database: %w", err)
+	}
+	// Journal files of the replaced database would be applied to the restored one
+	for _, suffix := range []string{"-journal", "-wal", "-shm"} {
+		os.Remove(target.DSN + suffix)
+	}
+	return kept, nil
+}
+
+// checkBackup verifies that a file is an intact database of this server that this build can migrate
+func checkBackup(path string) error {
+	if _, err := os.Stat(path); err != nil {
+		return err
+	}
+	db, err := Open(Target{Dialect: DialectSQLite, DSN: path})
+	if err != nil {
+		return fmt.Errorf("failed to open the backup: %w", err)
+	}
+	if sqlDB, err := db.DB(); err == nil {
+		defer sqlDB.Close()
+	}
+
+	var result string
+	if err := db.Raw("PRAGMA integrity_check").Scan(&result).Error; err != nil {
+		return fmt.Errorf("%s is not a SQLite database: %w", path, err)
+	}
+	if result != "ok" {
+		return fmt.Errorf("%s is damaged: %s", path, result)
+	}
+	if !db.Migrator().HasTable(&models.SystemConfig{}) {
+		return fmt.Errorf("%s is not a go-proxy-server database", path)
+	}
+	version, err := Version(db)
+	if err != nil {
+		return fmt.Errorf("failed to read the schema version of the backup: %w", err)
+	}
+	if version > Latest() {
+		return fmt.Errorf("the backup has schema version %d, newer than this build supports (%d)", version, Latest())
+	}
+	return nil
+}
+
+// copyFile copies a file and flushes it to disk
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,132 @@
+package database
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go-proxy-server/internal/models"
+)
+
+// useTempHome points the data and backup directories at a temporary directory
+func useTempHome(t *testing.T) string {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_DATA_HOME", filepath.Join(home, "data"))
+	return home
+}
+
+// newDatabaseFile creates a migrated SQLite database holding one user
+func newDatabaseFile(t *testing.T, path, username string) {
+	t.Helper()
+	db, err := Open(Target{Dialect: DialectSQLite, DSN: path})
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	if sqlDB, err := db.DB(); err == nil {
+		defer sqlDB.Close()
+	}
+	if err := Migrate(db); err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+	if err := db.Create(&models.User{Username: username, Password: []byte("hash")}).Error; err != nil {
+		t.Fatalf("insert user: %v", err)
+	}
+}
+
+func TestRestoreRejectsInvalidBackup(t *testing.T) {
+	home := useTempHome(t)
+	target := Target{Dialect: DialectSQLite, DSN: filepath.Join(home, "data.db")}
+	newDatabaseFile(t, target.DSN, "alice")
+	original, err := os.ReadFile(target.DSN)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	write := func(name string, data []byte) string {
+		path := filepath.Join(home, name)
+		if err := os.WriteFile(path, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	foreign := filepath.Join(home, "foreign.db")
+	db, err := Open(Target{Dialect: DialectSQLite, DSN: foreign})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Exec("CREATE TABLE notes (id INTEGER PRIMARY KEY)").Error; err != nil {
+		t.Fatal(err)
+	}
+	if sqlDB, err := db.DB(); err == nil {
+		sqlDB.Close()
+	}
+
+	tests := []struct {
+		name   string
+		backup string
+	}{
+		{name: "missing file", backup: filepath.Join(home, "missing.db")},
+		{name: "not a database", backup: write("junk.db", []byte("this is not a SQLite database, just some text padding it out"))},
+		{name: "empty file", backup: write("empty.db", nil)},
+		{name: "another application's database", backup: foreign},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Restore(target, tt.backup); err == nil {
+				t.Fatalf("Restore(%s) succeeded, want an error", tt.backup)
+			}
+			current, err := os.ReadFile(target.DSN)
+			if err != nil || string(current) != string(original) {
+				t.Fatalf("the database changed although the restore was refused (%v)", err)
+			}
+		})
+	}
+
+	if _, err := Restore(Target{Dialect: DialectPostgres, DSN: "postgres://db.example.com/proxy"}, foreign); err != ErrBackupUnsupported {
+		t.Errorf("Restore() to PostgreSQL error = %v, want %v", err, ErrBackupUnsupported)
+	}
+}
+
+func TestBackupAndRestore(t *testing.T) {
+	home := useTempHome(t)
+	target := Target{Dialect: DialectSQLite, DSN: filepath.Join(home, "data.db")}
+	backup := filepath.Join(home, "backup.db")
+
+	newDatabaseFile(t, backup+".src", "alice")
+	src, err := Open(Target{Dialect: DialectSQLite, DSN: backup + ".src"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Backup(src, backup); err != nil {
+		t.Fatalf("Backup() error = %v", err)
+	}
+	if err := Backup(src, backup); err == nil {
+		t.Error("Backup() over an existing file succeeded, want an error")
+	}
+	if sqlDB, err := src.DB(); err == nil {
+		sqlDB.Close()
+	}
+
+	newDatabaseFile(t, target.DSN, "bob")
+	kept, err := Restore(target, backup)
+	if err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+	if _, err := os.Stat(kept); err != nil {
+		t.Errorf("pre-restore copy %q: %v", kept, err)
+	}
+
+	db, err := Open(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sqlDB, err := db.DB(); err == nil {
+		defer sqlDB.Close()
+	}
+	var names []string
+	if err := db.Model(&models.User{}).Pluck("username", &names).Error; err != nil || len(names) != 1 || names[0] != "alice" {
+		t.Errorf("users after restore = %v, %v; want [alice]", names, err)
+	}
+}
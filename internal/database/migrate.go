@@ -0,0 +1,177 @@
+package database
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"go-proxy-server/internal/logger"
+)
+
+// Migration is a versioned change of the database schema
+// Up applies it and Down reverts it; both run in a transaction together with the schema_migrations record
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(tx *gorm.DB) error
+	Down    func(tx *gorm.DB) error
+}
+
+// schemaMigration records an applied migration
+type schemaMigration struct {
+	Version   int `gorm:"primaryKey;autoIncrement:false"`
+	Name      string
+	AppliedAt time.Time
+}
+
+// TableName keeps the conventional name of the migration table
+func (schemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// metricsTimestampIndex speeds up the metrics history queries, which select snapshots by time
+const metricsTimestampIndex = "idx_metrics_snapshots_timestamp"
+
+// migrations lists every schema change in version order; released migrations must not change,
+// so they name tables directly or use frozen copies of the models instead of the models package
+var migrations = []Migration{
+	{
+		Version: 1,
+		Name:    "baseline schema",
+		// Databases created before versioning already hold these tables and are brought up to date
+		Up: func(tx *gorm.DB) error {
+			if err := migrateV1ProxyConfigs(tx); err != nil {
+				return fmt.Errorf("failed to migrate listener configurations: %w", err)
+			}
+			return tx.AutoMigrate(v1Models...)
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(v1Models...)
+		},
+	},
+	{
+		Version: 2,
+		Name:    "index metrics snapshots by time",
+		Up: func(tx *gorm.DB) error {
+			if tx.Migrator().HasIndex("metrics_snapshots", metricsTimestampIndex) {
+				return nil
+			}
+			return tx.Exec("CREATE INDEX ? ON ? (?)", clause.Column{Name: metricsTimestampIndex},
+				clause.Table{Name: "metrics_snapshots"}, clause.Column{Name: "timestamp"}).Error
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropIndex("metrics_snapshots", metricsTimestampIndex)
+		},
+	},
+}
+
+// MigrationStatus describes a migration and whether it is applied
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	AppliedAt *time.Time // nil = pending
+}
+
+// Latest returns the schema version this build migrates to
+func Latest() int {
+	return migrations[len(migrations)-1].Version
+}
+
+// Version returns the schema version of a database (0 = no migration applied)
+func Version(db *gorm.DB) (int, error) {
+	if !db.Migrator().HasTable(&schemaMigration{}) {
+		return 0, nil
+	}
+	var version int
+	err := db.Model(&schemaMigration{}).Select("COALESCE(MAX(version), 0)").Scan(&version).Error
+	return version, err
+}
+
+// Status lists the migrations of this build and the migrations recorded in the database
+func Status(db *gorm.DB) ([]MigrationStatus, error) {
+	var applied []schemaMigration
+	if db.Migrator().HasTable(&schemaMigration{}) {
+		if err := db.Order("version").Find(&applied).Error; err != nil {
+			return nil, err
+		}
+	}
+	appliedAt := make(map[int]time.Time, len(applied))
+	for _, record := range applied {
+		appliedAt[record.Version] = record.AppliedAt
+	}
+
+	statuses := make([]MigrationStatus, 0, len(migrations))
+	for _, m := range migrations {
+		status := MigrationStatus{Version: m.Version, Name: m.Name}
+		if at, ok := appliedAt[m.Version]; ok {
+			status.AppliedAt = &at
+		}
+		statuses = append(statuses, status)
+	}
+	// Migrations of a newer build are listed too, so the status explains why this build refuses the database
+	for _, record := range applied {
+		if record.Version > Latest() {
+			at := record.AppliedAt
+			statuses = append(statuses, MigrationStatus{Version: record.Version, Name: record.Name, AppliedAt: &at})
+		}
+	}
+	return statuses, nil
+}
+
+// Migrate applies all pending migrations
+func Migrate(db *gorm.DB) error {
+	return MigrateTo(db, Latest())
+}
+
+// MigrateTo applies or reverts migrations until the database is at the target version
+func MigrateTo(db *gorm.DB, target int) error {
+	if target < 0 || target > Latest() {
+		return fmt.Errorf("schema version must be between 0 and %d", Latest())
+	}
+	if err := db.AutoMigrate(&schemaMigration{}); err != nil {
+		return fmt.Errorf("failed to create the migration table: %w", err)
+	}
+	current, err := Version(db)
+	if err != nil {
+		return fmt.Errorf("failed to read the schema version: %w", err)
+	}
+	if current > Latest() {
+		return fmt.Errorf("database schema version %d is newer than this build supports (%d); upgrade the server or run \"migrate down\" with the newer build", current, Latest())
+	}
+
+	for _, m := range migrations {
+		if m.Version <= current || m.Version > target {
+			continue
+		}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := m.Up(tx); err != nil {
+				return err
+			}
+			return tx.Create(&schemaMigration{Version: m.Version, Name: m.Name, AppliedAt: time.Now()}).Error
+		})
+		if err != nil {
+			return fmt.Errorf("migration %d (%s) failed: %w", m.Version, m.Name, err)
+		}
+		logger.Info("Applied migration %d (%s)", m.Version, m.Name)
+	}
+
+	for i := len(migrations) - 1; i >= 0; i-- {
+		m := migrations[i]
+		if m.Version > current || m.Version <= target {
+			continue
+		}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := m.Down(tx); err != nil {
+				return err
+			}
+			return tx.Delete(&schemaMigration{}, m.Version).Error
+		})
+		if err != nil {
+			return fmt.Errorf("reverting migration %d (%s) failed: %w", m.Version, m.Name, err)
+		}
+		logger.Info("Reverted migration %d (%s)", m.Version, m.Name)
+	}
+	return nil
+}
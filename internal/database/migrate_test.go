@@ -0,0 +1,118 @@
+package database
+
+import (
+	"testing"
+
+	"gorm.io/gorm"
+
+	"go-proxy-server/internal/models"
+)
+
+// openMemory opens an empty in-memory SQLite database
+// A single connection keeps every query on the same database, which each new connection would otherwise recreate
+func openMemory(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := Open(Target{Dialect: DialectSQLite, DSN: ":memory:"})
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("DB() error = %v", err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+	return db
+}
+
+func TestMigrateTo(t *testing.T) {
+	db := openMemory(t)
+
+	tests := []struct {
+		name        string
+		target      int
+		wantTables  bool
+		wantIndex   bool
+		wantVersion int
+	}{
+		{name: "up to latest", target: Latest(), wantTables: true, wantIndex: true, wantVersion: Latest()},
+		{name: "latest again is a no-op", target: Latest(), wantTables: true, wantIndex: true, wantVersion: Latest()},
+		{name: "down to baseline", target: 1, wantTables: true, wantVersion: 1},
+		{name: "down to empty", target: 0, wantVersion: 0},
+		{name: "up again", target: Latest(), wantTables: true, wantIndex: true, wantVersion: Latest()},
+	}
+	for _, tt := range tests {
+		if err := MigrateTo(db, tt.target); err != nil {
+			t.Fatalf("%s: MigrateTo(%d) error = %v", tt.name, tt.target, err)
+		}
+		if version, err := Version(db); err != nil || version != tt.wantVersion {
+			t.Fatalf("%s: Version() = %d, %v; want %d", tt.name, version, err, tt.wantVersion)
+		}
+		for _, model := range v1Models {
+			if got := db.Migrator().HasTable(model); got != tt.wantTables {
+				t.Errorf("%s: HasTable(%T) = %v, want %v", tt.name, model, got, tt.wantTables)
+			}
+		}
+		if got := db.Migrator().HasTable("metrics_snapshots") && db.Migrator().HasIndex("metrics_snapshots", metricsTimestampIndex); got != tt.wantIndex {
+			t.Errorf("%s: metrics timestamp index present = %v, want %v", tt.name, got, tt.wantIndex)
+		}
+	}
+
+	// The migrated schema serves the current models
+	if err := db.Create(&models.User{Username: "alice", Password: []byte("hash")}).Error; err != nil {
+		t.Fatalf("insert into the migrated schema: %v", err)
+	}
+}
+
+func TestMigrateToRejectsInvalidVersion(t *testing.T) {
+	db := openMemory(t)
+	for _, target := range []int{-1, Latest() + 1} {
+		if err := MigrateTo(db, target); err == nil {
+			t.Errorf("MigrateTo(%d) succeeded, want an error", target)
+		}
+	}
+	if err := db.AutoMigrate(&schemaMigration{}); err != nil {
+		t.Fatalf("AutoMigrate() error = %v", err)
+	}
+	if err := db.Create(&schemaMigration{Version: Latest() + 1, Name: "from a newer build"}).Error; err != nil {
+		t.Fatalf("recording a newer migration: %v", err)
+	}
+	if err := Migrate(db); err == nil {
+		t.Error("Migrate() of a database from a newer build succeeded, want an error")
+	}
+}
+
+func TestMigrateNamesLegacyListeners(t *testing.T) {
+	db := openMemory(t)
+	// The proxy configuration table of releases before named listeners held one row per type
+	type legacyProxyConfig struct {
+		gorm.Model
+		Type       string `gorm:"uniqueIndex"`
+		Port       int
+		BindListen bool
+		AutoStart  bool
+	}
+	if err := db.Table("proxy_configs").AutoMigrate(&legacyProxyConfig{}); err != nil {
+		t.Fatalf("AutoMigrate() error = %v", err)
+	}
+	for _, row := range []legacyProxyConfig{{Type: "socks5", Port: 1080}, {Type: "http", Port: 8080}} {
+		if err := db.Table("proxy_configs").Create(&row).Error; err != nil {
+			t.Fatalf("insert legacy listener: %v", err)
+		}
+	}
+
+	if err := Migrate(db); err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+	var listeners []models.ProxyConfig
+	if err := db.Order("port").Find(&listeners).Error; err != nil {
+		t.Fatalf("Find() error = %v", err)
+	}
+	if len(listeners) != 2 || listeners[0].Name != "socks5" || listeners[1].Name != "http" {
+		t.Fatalf("listeners = %+v, want socks5 and http named after their type", listeners)
+	}
+	// The type is no longer unique, so a second listener of a type can be added
+	if err := db.Create(&models.ProxyConfig{Name: "socks-alt", Type: "socks5", Port: 1081}).Error; err != nil {
+		t.Fatalf("second socks5 listener: %v", err)
+	}
+}
@@ -0,0 +1,281 @@
+package database
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// The baseline schema (migration 1) as it was released, frozen so that the migration creates the same tables
+// however the models change later. Changes to the models are made by new migrations, never here
+
+type v1User struct {
+	gorm.Model
+	IP        string
+	Username  string `gorm:"size:191;uniqueIndex"`
+	Password  []byte
+	GroupName string `gorm:"index"`
+}
+
+func (v1User) TableName() string { return "users" }
+
+type v1Whitelist struct {
+	gorm.Model
+	IP string `gorm:"size:191;uniqueIndex"`
+}
+
+func (v1Whitelist) TableName() string { return "whitelists" }
+
+type v1ProxyConfig struct {
+	gorm.Model
+	Name                string `gorm:"size:191;uniqueIndex"`
+	Type                string `gorm:"index"`
+	ListenAddress       string
+	IPFamily            string
+	ListenEach          bool
+	Port                int
+	BindListen          bool
+	AutoStart           bool
+	AuthMode            string
+	TLS                 bool
+	TLSCert             string
+	TLSKey              string
+	UploadRate          int64
+	DownloadRate        int64
+	MaxConnections      int32
+	MaxConnectionsPerIP int32
+}
+
+func (v1ProxyConfig) TableName() string { return "proxy_configs" }
+
+type v1SystemConfig struct {
+	gorm.Model
+	Key   string `gorm:"size:191;uniqueIndex"`
+	Value string
+}
+
+func (v1SystemConfig) TableName() string { return "system_configs" }
+
+type v1MetricsSnapshot struct {
+	gorm.Model
+	Timestamp            int64
+	ActiveConnections    int
+	MaxActiveConnections int
+	TotalConnections     int64
+	BytesReceived        int64
+	BytesSent            int64
+	UploadSpeed          float64
+	DownloadSpeed        float64
+	MaxUploadSpeed       float64
+	MaxDownloadSpeed     float64
+	ErrorCount           int64
+}
+
+func (v1MetricsSnapshot) TableName() string { return "metrics_snapshots" }
+
+type v1AlertConfig struct {
+	gorm.Model
+	Name        string `gorm:"size:191;uniqueIndex"`
+	Metric      string
+	Operator    string
+	Threshold   float64
+	Duration    int
+	Enabled     bool
+	NotifyEmail string
+}
+
+func (v1AlertConfig) TableName() string { return "alert_configs" }
+
+type v1AlertHistory struct {
+	gorm.Model
+	AlertConfigID uint
+	Timestamp     int64
+	MetricValue   float64
+	Message       string
+	Resolved      bool
+	ResolvedAt    *int64
+}
+
+func (v1AlertHistory) TableName() string { return "alert_histories" }
+
+type v1UserQuota struct {
+	gorm.Model
+	Username      string `gorm:"size:191;uniqueIndex"`
+	DailyLimit    int64
+	MonthlyLimit  int64
+	TotalLimit    int64
+	DailyUsed     int64
+	MonthlyUsed   int64
+	TotalUsed     int64
+	UploadBytes   int64
+	DownloadBytes int64
+	DayStart      int64
+	MonthStart    int64
+}
+
+func (v1UserQuota) TableName() string { return "user_quota" }
+
+type v1UserLimit struct {
+	gorm.Model
+	Username                string `gorm:"size:191;uniqueIndex"`
+	UploadRate              int64
+	DownloadRate            int64
+	MaxConnections          int32
+	MaxConnectionsPerSecond int32
+	MaxConnectionsPerMinute int32
+}
+
+func (v1UserLimit) TableName() string { return "user_limits" }
+
+type v1UserGroup struct {
+	gorm.Model
+	Name        string `gorm:"size:191;uniqueIndex"`
+	Description string
+}
+
+func (v1UserGroup) TableName() string { return "user_groups" }
+
+type v1AccessRule struct {
+	gorm.Model
+	Scope            string `gorm:"size:191;uniqueIndex:idx_access_rule_subject"`
+	Subject          string `gorm:"size:191;uniqueIndex:idx_access_rule_subject"`
+	AllowedDomains   string
+	DeniedDomains    string
+	AllowedCIDRs     string
+	DeniedCIDRs      string
+	AllowedPorts     string
+	DeniedPorts      string
+	AllowedListeners string
+	AllowedCommands  string
+	BypassSSRF       *bool
+}
+
+func (v1AccessRule) TableName() string { return "access_rules" }
+
+type v1Schedule struct {
+	gorm.Model
+	Name             string `gorm:"size:191;uniqueIndex"`
+	TimeZone         string
+	Windows          string
+	Holidays         string
+	EnforceOnTunnels bool
+}
+
+func (v1Schedule) TableName() string { return "schedules" }
+
+type v1ScheduleAssignment struct {
+	gorm.Model
+	Scope        string `gorm:"size:191;uniqueIndex:idx_schedule_assignment_subject"`
+	Subject      string `gorm:"size:191;uniqueIndex:idx_schedule_assignment_subject"`
+	ScheduleName string `gorm:"index"`
+}
+
+func (v1ScheduleAssignment) TableName() string { return "schedule_assignments" }
+
+type v1AdminUser struct {
+	gorm.Model
+	Username          string `gorm:"size:191;uniqueIndex"`
+	Password          []byte
+	Role              string `gorm:"default:admin"`
+	TOTPSecret        string
+	TOTPPendingSecret string
+	TOTPEnabled       bool
+	TOTPRequired      bool
+	TOTPLastStep      int64
+}
+
+func (v1AdminUser) TableName() string { return "admin_users" }
+
+type v1AdminSession struct {
+	gorm.Model
+	TokenHash  string `gorm:"size:191;uniqueIndex"`
+	Username   string `gorm:"index"`
+	CSRFToken  string
+	ClientIP   string
+	ExpiresAt  time.Time
+	LastSeenAt time.Time
+}
+
+func (v1AdminSession) TableName() string { return "admin_sessions" }
+
+type v1AdminToken struct {
+	gorm.Model
+	Username   string `gorm:"index"`
+	Name       string
+	TokenHash  string `gorm:"size:191;uniqueIndex"`
+	Prefix     string
+	ExpiresAt  *time.Time
+	LastUsedAt *time.Time
+}
+
+func (v1AdminToken) TableName() string { return "admin_tokens" }
+
+type v1AdminRecoveryCode struct {
+	gorm.Model
+	Username string `gorm:"index"`
+	CodeHash string
+}
+
+func (v1AdminRecoveryCode) TableName() string { return "admin_recovery_codes" }
+
+type v1AdminTrustedDevice struct {
+	gorm.Model
+	Username   string `gorm:"index"`
+	TokenHash  string `gorm:"size:191;uniqueIndex"`
+	ClientIP   string
+	UserAgent  string
+	ExpiresAt  time.Time
+	LastUsedAt time.Time
+}
+
+func (v1AdminTrustedDevice) TableName() string { return "admin_trusted_devices" }
+
+type v1AuditLog struct {
+	ID        uint      `gorm:"primarykey"`
+	Timestamp time.Time `gorm:"index"`
+	Actor     string    `gorm:"index"`
+	SourceIP  string    `gorm:"index"`
+	Method    string
+	Endpoint  string `gorm:"index"`
+	Status    int
+	Changes   string
+}
+
+func (v1AuditLog) TableName() string { return "audit_logs" }
+
+// v1Models lists the tables of the baseline schema
+var v1Models = []interface{}{
+	&v1User{}, &v1Whitelist{}, &v1ProxyConfig{}, &v1SystemConfig{}, &v1MetricsSnapshot{},
+	&v1AlertConfig{}, &v1AlertHistory{}, &v1UserQuota{}, &v1UserLimit{}, &v1UserGroup{},
+	&v1AccessRule{}, &v1Schedule{}, &v1ScheduleAssignment{}, &v1AdminUser{}, &v1AdminSession{},
+	&v1AdminToken{}, &v1AdminRecoveryCode{}, &v1AdminTrustedDevice{}, &v1AuditLog{},
+}
+
+// unindexedListenerName declares the listener name column without its unique index for migrateV1ProxyConfigs
+type unindexedListenerName struct {
+	Name string
+}
+
+// migrateV1ProxyConfigs upgrades a proxy configuration table from one row per proxy type to named listeners
+// It must run before AutoMigrate, which cannot create the unique name index while names are empty
+// Existing rows are named after their type, so access rules and bandwidth limits keep applying to them
+func migrateV1ProxyConfigs(tx *gorm.DB) error {
+	migrator := tx.Migrator()
+	if !migrator.HasTable("proxy_configs") || migrator.HasColumn(&v1ProxyConfig{}, "Name") {
+		return nil
+	}
+	// Types are no longer unique; AutoMigrate recreates the index as a plain one
+	if migrator.HasIndex("proxy_configs", "idx_proxy_configs_type") {
+		if err := migrator.DropIndex("proxy_configs", "idx_proxy_configs_type"); err != nil {
+			return fmt.Errorf("failed to drop the proxy type index: %w", err)
+		}
+	}
+	// Added as a plain column: SQLite cannot add a UNIQUE column, and the names are only filled in below
+	if err := tx.Table("proxy_configs").Migrator().AddColumn(&unindexedListenerName{}, "Name"); err != nil {
+		return fmt.Errorf("failed to add the listener name column: %w", err)
+	}
+	return tx.Table("proxy_configs").
+		Where("name IS NULL OR name = ''").
+		Update("name", gorm.Expr("type")).Error
+}
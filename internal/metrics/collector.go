@@ -20,6 +20,7 @@ type Collector struct {
 	bytesReceived        int64
 	bytesSent            int64
 	errorCount           int64
+	reloadFailures       int64
 
 	// For speed calculation
 	lastSnapshot      time.Time
@@ -99,6 +100,11 @@ func (c *Collector) RecordError() {
 	atomic.AddInt64(&c.errorCount, 1)
 }
 
+// RecordReloadFailure increments the counter of configuration reloads that failed
+func (c *Collector) RecordReloadFailure() {
+	atomic.AddInt64(&c.reloadFailures, 1)
+}
+
 // GetSnapshot returns current metrics snapshot
 func (c *Collector) GetSnapshot() *MetricsSnapshot {
 	c.mu.RLock()
@@ -116,6 +122,7 @@ func (c *Collector) GetSnapshot() *MetricsSnapshot {
 		MaxUploadSpeed:       c.maxUploadSpeed,
 		MaxDownloadSpeed:     c.maxDownloadSpeed,
 		ErrorCount:           atomic.LoadInt64(&c.errorCount),
+		ReloadFailures:       atomic.LoadInt64(&c.reloadFailures),
 		Uptime:               int64(time.Since(c.startTime).Seconds()),
 	}
 }
@@ -133,6 +140,7 @@ type MetricsSnapshot struct {
 	MaxUploadSpeed       float64 `json:"maxUploadSpeed"`
 	MaxDownloadSpeed     float64 `json:"maxDownloadSpeed"`
 	ErrorCount           int64   `json:"errorCount"`
+	ReloadFailures       int64   `json:"reloadFailures"`
 	Uptime               int64   `json:"uptime"`
 }
 
@@ -336,6 +344,7 @@ func (c *Collector) Reset() {
 	atomic.StoreInt64(&c.bytesReceived, 0)
 	atomic.StoreInt64(&c.bytesSent, 0)
 	atomic.StoreInt64(&c.errorCount, 0)
+	atomic.StoreInt64(&c.reloadFailures, 0)
 
 	c.mu.Lock()
 	c.startTime = time.Now()
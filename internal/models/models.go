@@ -1,34 +1,52 @@
 package models
 
 import (
+	"time"
+
 	"gorm.io/gorm"
 )
 
 type User struct {
 	gorm.Model
-	IP       string // For audit/logging only
-	Username string `gorm:"uniqueIndex"` // Globally unique
-	Password []byte
+	IP        string // For audit/logging only
+	Username  string `gorm:"size:191;uniqueIndex"` // Globally unique
+	Password  []byte
+	GroupName string `gorm:"index"` // Name of the user's group (empty = no group)
 }
 
 type Whitelist struct {
 	gorm.Model
-	IP string `gorm:"uniqueIndex"`
+	IP string `gorm:"size:191;uniqueIndex"`
 }
 
-// ProxyConfig stores proxy server configuration
+// ProxyConfig stores the configuration of a proxy listener
 type ProxyConfig struct {
 	gorm.Model
-	Type       string `gorm:"uniqueIndex"` // "socks5" or "http"
-	Port       int
-	BindListen bool
-	AutoStart  bool // Whether to auto-start on application launch
+	Name          string `gorm:"size:191;uniqueIndex"` // Listener name, used by access rules and bandwidth limits
+	Type          string `gorm:"index"`                // "socks5" or "http"
+	ListenAddress string // IP address or interface name to listen on (empty = all addresses)
+	IPFamily      string // Address family: "dual", "ipv4" or "ipv6" (IPv6 only)
+	ListenEach    bool   // Bind every local address individually instead of the wildcard address
+	Port          int
+	BindListen    bool
+	AutoStart     bool   // Whether to auto-start on application launch
+	AuthMode      string // How clients authenticate: "default", "password" or "whitelist"
+	// TLS wraps client connections in TLS using the certificate and key files
+	TLS     bool
+	TLSCert string
+	TLSKey  string
+	// Bandwidth limits shared by all connections of this listener (bytes/sec, 0 = unlimited)
+	UploadRate   int64
+	DownloadRate int64
+	// Connection limits of this listener (0 = use the global limiter configuration)
+	MaxConnections      int32
+	MaxConnectionsPerIP int32
 }
 
 // SystemConfig stores system-level configuration
 type SystemConfig struct {
 	gorm.Model
-	Key   string `gorm:"uniqueIndex"` // Configuration key
+	Key   string `gorm:"size:191;uniqueIndex"` // Configuration key
 	Value string // Configuration value
 }
 
@@ -51,7 +69,7 @@ type MetricsSnapshot struct {
 // AlertConfig stores alert configuration
 type AlertConfig struct {
 	gorm.Model
-	Name        string `gorm:"uniqueIndex"` // Alert name
+	Name        string `gorm:"size:191;uniqueIndex"` // Alert name
 	Metric      string // Metric to monitor (connections, bandwidth, errors)
 	Operator    string // Comparison operator (gt, lt, eq)
 	Threshold   float64 // Threshold value
@@ -70,3 +88,146 @@ type AlertHistory struct {
 	Resolved      bool    // Whether alert has been resolved
 	ResolvedAt    *int64  // When alert was resolved
 }
+
+// UserQuota stores traffic quota limits and persisted usage counters for a user
+// Limits count upload and download bytes together; 0 means unlimited
+type UserQuota struct {
+	gorm.Model
+	Username      string `gorm:"size:191;uniqueIndex"` // Owner of the quota
+	DailyLimit    int64  // Bytes allowed per calendar day
+	MonthlyLimit  int64  // Bytes allowed per calendar month
+	TotalLimit    int64  // Bytes allowed over the lifetime of the account
+	DailyUsed     int64  // Bytes used in the current day
+	MonthlyUsed   int64  // Bytes used in the current month
+	TotalUsed     int64  // Bytes used since the last total reset
+	UploadBytes   int64  // Lifetime upload bytes (client -> server)
+	DownloadBytes int64  // Lifetime download bytes (server -> client)
+	DayStart      int64  // Unix timestamp of the current day period start
+	MonthStart    int64  // Unix timestamp of the current month period start
+}
+
+// UserLimit stores per-user overrides of connection and bandwidth limits
+// A value of 0 means the global per-user default applies
+type UserLimit struct {
+	gorm.Model
+	Username     string `gorm:"size:191;uniqueIndex"` // Owner of the limits
+	UploadRate   int64  // Upload bandwidth shared by the user's connections (bytes/sec)
+	DownloadRate int64  // Download bandwidth shared by the user's connections (bytes/sec)
+	// Connection limits
+	MaxConnections          int32 // Maximum concurrent connections
+	MaxConnectionsPerSecond int32 // Maximum new connections per second
+	MaxConnectionsPerMinute int32 // Maximum new connections per minute
+}
+
+// UserGroup stores a named group of users sharing access rules
+type UserGroup struct {
+	gorm.Model
+	Name        string `gorm:"size:191;uniqueIndex"` // Group name
+	Description string // Free-form description
+}
+
+// AccessRule stores destination and feature access rules for a group or a single user
+// List fields are comma-separated; an empty list places no restriction
+// A user rule overrides the corresponding non-empty fields of the user's group rule
+type AccessRule struct {
+	gorm.Model
+	Scope   string `gorm:"size:191;uniqueIndex:idx_access_rule_subject"` // "group" or "user"
+	Subject string `gorm:"size:191;uniqueIndex:idx_access_rule_subject"` // Group name or username
+	// Destinations
+	AllowedDomains string // Domains the subject may reach (suffix match, e.g. "example.com")
+	DeniedDomains  string // Domains the subject may not reach
+	AllowedCIDRs   string // Networks the subject may reach
+	DeniedCIDRs    string // Networks the subject may not reach
+	AllowedPorts   string // Ports or ranges the subject may reach (e.g. "80,443,8000-9000")
+	DeniedPorts    string // Ports or ranges the subject may not reach
+	// Features
+	AllowedListeners string // Listeners the subject may use ("socks5", "http")
+	AllowedCommands  string // Commands the subject may use ("CONNECT", "BIND", "UDP")
+	BypassSSRF       *bool  // Allow access to private addresses (nil = inherit)
+}
+
+// Schedule stores a named access schedule
+// Outside its windows (and on holidays) the assigned users, groups and whitelist entries cannot connect
+type Schedule struct {
+	gorm.Model
+	Name             string `gorm:"size:191;uniqueIndex"` // Schedule name
+	TimeZone         string // IANA time zone the windows are evaluated in (empty = local time)
+	Windows          string // JSON-encoded list of weekday time windows
+	Holidays         string // Comma-separated dates (YYYY-MM-DD) on which access is denied all day
+	EnforceOnTunnels bool   // Close open tunnels when the current window ends
+}
+
+// ScheduleAssignment attaches a schedule to a user, group or whitelist entry
+type ScheduleAssignment struct {
+	gorm.Model
+	Scope        string `gorm:"size:191;uniqueIndex:idx_schedule_assignment_subject"` // "user", "group" or "whitelist"
+	Subject      string `gorm:"size:191;uniqueIndex:idx_schedule_assignment_subject"` // Username, group name or IP address
+	ScheduleName string `gorm:"index"`                                                // Name of the assigned schedule
+}
+
+// AdminUser stores an account of the web management interface (separate from proxy users)
+type AdminUser struct {
+	gorm.Model
+	Username string `gorm:"size:191;uniqueIndex"`
+	Password []byte // Salted hash, same format as proxy user passwords
+	Role     string `gorm:"default:admin"` // viewer, operator or admin
+	// TOTP two-factor authentication (RFC 6238)
+	TOTPSecret        string // Base32 secret of the enrolled authenticator
+	TOTPPendingSecret string // Secret awaiting confirmation during enrolment
+	TOTPEnabled       bool
+	TOTPRequired      bool  // Admin must enrol before using the interface
+	TOTPLastStep      int64 // Last accepted time step, codes are not accepted twice
+}
+
+// AdminSession stores a logged-in browser session of an admin
+type AdminSession struct {
+	gorm.Model
+	TokenHash  string `gorm:"size:191;uniqueIndex"` // SHA-256 of the session cookie value
+	Username   string `gorm:"index"`
+	CSRFToken  string // Must accompany state-changing requests of this session
+	ClientIP   string // Address the session was created from (for audit/logging only)
+	ExpiresAt  time.Time
+	LastSeenAt time.Time
+}
+
+// AdminToken stores an API token of an admin for automation
+type AdminToken struct {
+	gorm.Model
+	Username   string     `gorm:"index"`
+	Name       string     // Free-form label
+	TokenHash  string     `gorm:"size:191;uniqueIndex"` // SHA-256 of the token
+	Prefix     string     // First characters of the token, shown to identify it
+	ExpiresAt  *time.Time // nil = never expires
+	LastUsedAt *time.Time
+}
+
+// AdminRecoveryCode stores an unused single-use recovery code of an admin's two-factor authentication
+type AdminRecoveryCode struct {
+	gorm.Model
+	Username string `gorm:"index"`
+	CodeHash string // SHA-256 of the normalized code
+}
+
+// AdminTrustedDevice stores a browser that may skip the TOTP code at login
+type AdminTrustedDevice struct {
+	gorm.Model
+	Username   string `gorm:"index"`
+	TokenHash  string `gorm:"size:191;uniqueIndex"` // SHA-256 of the remember-device cookie value
+	ClientIP   string // Address the device was remembered from
+	UserAgent  string
+	ExpiresAt  time.Time
+	LastUsedAt time.Time
+}
+
+// AuditLog stores a change made through the web management API
+// Entries are only ever appended, never updated or deleted
+type AuditLog struct {
+	ID        uint      `gorm:"primarykey"`
+	Timestamp time.Time `gorm:"index"`
+	Actor     string    `gorm:"index"` // Admin who made the change
+	SourceIP  string    `gorm:"index"` // Client address of the request
+	Method    string    // HTTP method
+	Endpoint  string    `gorm:"index"` // API path
+	Status    int       // HTTP status of the response
+	Changes   string    // JSON-encoded list of changed fields with their before and after values
+}
@@ -0,0 +1,16 @@
+//go:build windows
+// +build windows
+
+package pidfile
+
+import "os"
+
+// lockFile does not lock on Windows, where the single instance check uses a named mutex
+func lockFile(file *os.File) error {
+	return nil
+}
+
+// probeLock reports no lock on Windows
+func probeLock(file *os.File) (bool, error) {
+	return false, nil
+}
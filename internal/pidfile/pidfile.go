@@ -0,0 +1,102 @@
+// Package pidfile records the process ID of the running server so scripts, service commands and upgrades can find it
+// The file stays locked while the server runs, which keeps a second instance from starting with the same file
+package pidfile
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ErrLocked is returned by Acquire when another running process holds the PID file
+var ErrLocked = errors.New("another instance is running")
+
+// Lock is a PID file held by the current process
+type Lock struct {
+	path string
+	file *os.File
+}
+
+// Acquire opens and locks the PID file at path
+// Returns an error wrapping ErrLocked if another process holds it
+func Acquire(path string) (*Lock, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create PID file directory: %w", err)
+	}
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open PID file: %w", err)
+	}
+	if err := lockFile(file); err != nil {
+		file.Close()
+		if errors.Is(err, ErrLocked) {
+			if pid, readErr := Read(path); readErr == nil {
+				return nil, fmt.Errorf("%w (pid %d, PID file %s)", ErrLocked, pid, path)
+			}
+			return nil, fmt.Errorf("%w (PID file %s)", ErrLocked, path)
+		}
+		return nil, fmt.Errorf("failed to lock PID file: %w", err)
+	}
+	return &Lock{path: path, file: file}, nil
+}
+
+// Adopt takes over a PID file locked by the process this one upgraded; file is the descriptor it handed over
+func Adopt(path string, file *os.File) *Lock {
+	return &Lock{path: path, file: file}
+}
+
+// File returns the locked descriptor, which keeps the lock while any process holds it open
+func (l *Lock) File() *os.File {
+	return l.file
+}
+
+// Write records the current process ID
+func (l *Lock) Write() error {
+	if err := l.file.Truncate(0); err != nil {
+		return fmt.Errorf("failed to write PID file: %w", err)
+	}
+	if _, err := l.file.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0); err != nil {
+		return fmt.Errorf("failed to write PID file: %w", err)
+	}
+	return nil
+}
+
+// Release deletes the PID file if it still records the current process and gives up the lock
+// A process that handed over to an upgraded one leaves the new process's PID file in place
+func (l *Lock) Release() error {
+	var err error
+	if pid, readErr := Read(l.path); readErr == nil && pid == os.Getpid() {
+		err = os.Remove(l.path)
+	}
+	l.file.Close()
+	return err
+}
+
+// Read returns the process ID recorded in path
+func Read(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || pid <= 0 {
+		return 0, fmt.Errorf("invalid PID file %s", path)
+	}
+	return pid, nil
+}
+
+// IsLocked reports whether a running process holds the PID file at path
+func IsLocked(path string) (bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	defer file.Close()
+	return probeLock(file)
+}
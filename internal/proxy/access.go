@@ -0,0 +1,133 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	"go-proxy-server/internal/acl"
+	"go-proxy-server/internal/auth"
+	"go-proxy-server/internal/schedule"
+	"go-proxy-server/internal/security"
+)
+
+// policy returns the current access policy of the session's user
+// It is looked up on every check so rule changes apply to open keep-alive connections
+func (s *session) policy() *acl.Policy {
+	if s == nil || s.username == "" {
+		return nil
+	}
+	return acl.PolicyFor(s.username, s.group)
+}
+
+// ErrOutsideSchedule is returned for logins outside the user's access schedule
+var ErrOutsideSchedule = errors.New("outside access schedule")
+
+// checkLogin checks whether an authenticated user may use the session's listener at this time
+// It runs before setUser, so logins rejected by the listener rules or the schedule do not use up the user's connection limits
+func (s *session) checkLogin(result *auth.Result) error {
+	if err := acl.PolicyFor(result.Username, result.Group).CheckListener(s.listener); err != nil {
+		return err
+	}
+	if !schedule.ForUser(result.Username, result.Group).Allowed(time.Now()) {
+		return ErrOutsideSchedule
+	}
+	return nil
+}
+
+// checkRequest checks whether the session's user may run the command against the destination
+func (s *session) checkRequest(command, host string) error {
+	policy := s.policy()
+	if err := policy.CheckCommand(command); err != nil {
+		return err
+	}
+	return policy.CheckDestination(host)
+}
+
+// checkSSRF performs the SSRF check unless the session's user may bypass it
+func (s *session) checkSSRF(host string) error {
+	if s.policy().BypassSSRF() {
+		return nil
+	}
+	return security.CheckSSRF(host)
+}
+
+// verifyConnectedIP checks the connected address against SSRF protection and the user's network rules
+func (s *session) verifyConnectedIP(conn net.Conn) error {
+	policy := s.policy()
+	if !policy.BypassSSRF() {
+		if err := security.VerifyConnectedIP(conn); err != nil {
+			return err
+		}
+	}
+	if policy == nil {
+		return nil
+	}
+	if addr, ok := conn.RemoteAddr().(*net.TCPAddr); ok {
+		return policy.CheckConnectedIP(addr.IP)
+	}
+	return nil
+}
+
+// schedule returns the access schedule of the session's user or whitelist entry
+func (s *session) schedule() *schedule.Schedule {
+	if s == nil {
+		return nil
+	}
+	if s.username != "" {
+		return schedule.ForUser(s.username, s.group)
+	}
+	if s.whitelisted {
+		return schedule.ForWhitelistIP(s.clientIP)
+	}
+	return nil
+}
+
+// scheduleAllowed reports whether the session's schedule currently allows access
+func (s *session) scheduleAllowed() bool {
+	return s.schedule().Allowed(time.Now())
+}
+
+// tunnelContext returns the context bounding a tunnel's lifetime
+// It ends after maxAge, or earlier when the schedule window ends and the schedule is enforced on tunnels,
+// or when the session time granted by the authentication backend runs out
+func (s *session) tunnelContext(maxAge time.Duration) (context.Context, context.CancelFunc) {
+	now := time.Now()
+	deadline := now.Add(maxAge)
+	if sched := s.schedule(); sched.EnforceOnTunnels() {
+		if end, ok := sched.WindowEnd(now); ok && !end.IsZero() && end.Before(deadline) {
+			deadline = end
+		}
+	}
+	if s != nil && !s.expiresAt.IsZero() && s.expiresAt.Before(deadline) {
+		deadline = s.expiresAt
+	}
+	return context.WithDeadline(context.Background(), deadline)
+}
+
+// outboundAddr returns the local address outbound connections are bound to (nil = any)
+// An egress IP granted by the authentication backend takes precedence over the listener address
+func (s *session) outboundAddr(bindListen bool, listenerAddr *net.TCPAddr) *net.TCPAddr {
+	if s != nil && s.egressIP != nil {
+		return &net.TCPAddr{IP: s.egressIP}
+	}
+	if bindListen {
+		return listenerAddr
+	}
+	return nil
+}
+
+// sessionContextKey is the context key carrying the session into HTTP transport dials
+type sessionContextKey struct{}
+
+// withSession returns a context carrying the session
+func withSession(ctx context.Context, sess *session) context.Context {
+	return context.WithValue(ctx, sessionContextKey{}, sess)
+}
+
+// sessionFromContext returns the session carried by the context, or nil
+func sessionFromContext(ctx context.Context) *session {
+	sess, _ := ctx.Value(sessionContextKey{}).(*session)
+	return sess
+}
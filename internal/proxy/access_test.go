@@ -0,0 +1,88 @@
+package proxy
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+
+	"go-proxy-server/internal/acl"
+	"go-proxy-server/internal/auth"
+	"go-proxy-server/internal/config"
+)
+
+// socks5Login runs the SOCKS5 greeting and username/password login against a listener and returns the login status
+func socks5Login(t *testing.T, listener Listener, username, password string) byte {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	defer ln.Close()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if conn, err := ln.Accept(); err == nil {
+			HandleSocks5Connection(conn, listener)
+		}
+	}()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer func() {
+		conn.Close()
+		<-done
+	}()
+
+	reply := make([]byte, 2)
+	conn.Write([]byte{socks5Version, 1, authMethodUserPassword})
+	if _, err := io.ReadFull(conn, reply); err != nil || !bytes.Equal(reply, []byte{socks5Version, authMethodUserPassword}) {
+		t.Fatalf("method reply = %v, %v; want username/password", reply, err)
+	}
+	request := append([]byte{authSubVersion, byte(len(username))}, username...)
+	request = append(append(request, byte(len(password))), password...)
+	conn.Write(request)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		t.Fatalf("login reply: %v", err)
+	}
+	return reply[1]
+}
+
+func TestRejectedLoginKeepsUserBudget(t *testing.T) {
+	// Start from empty rate windows
+	previous := userLimiter
+	userLimiter = NewUserLimiter()
+	t.Cleanup(func() { userLimiter = previous })
+
+	db := openTestDB(t)
+	if err := auth.AddUser(db, "", "carol", "Carol-Passw0rd"); err != nil {
+		t.Fatalf("AddUser() error = %v", err)
+	}
+	t.Cleanup(func() { auth.DeleteUser(db, "carol") })
+	if err := acl.SetRule(db, acl.Rule{Scope: acl.ScopeUser, Subject: "carol", AllowedListeners: []string{"socks-staff"}}); err != nil {
+		t.Fatalf("SetRule() error = %v", err)
+	}
+	t.Cleanup(func() { acl.DeleteRule(db, acl.ScopeUser, "carol") })
+
+	tests := []struct {
+		name       string
+		listener   string
+		wantStatus byte
+		wantCount  int32
+	}{
+		{name: "listener not allowed", listener: "socks", wantStatus: 0x01, wantCount: 0},
+		{name: "listener allowed", listener: "socks-staff", wantStatus: replySuccess, wantCount: 1},
+	}
+	for _, tt := range tests {
+		status := socks5Login(t, Listener{Name: tt.listener, Type: config.ListenerSOCKS5}, "carol", "Carol-Passw0rd")
+		if status != tt.wantStatus {
+			t.Fatalf("%s: login status = %d, want %d", tt.name, status, tt.wantStatus)
+		}
+		// Only logins admitted by the listener rules count against the user's connection rate
+		if got := userLimiter.GetUsage("carol").NewLastSecond; got != tt.wantCount {
+			t.Errorf("%s: new connections in the last second = %d, want %d", tt.name, got, tt.wantCount)
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package proxy
+
+import (
+	"context"
+	"sync"
+
+	"go-proxy-server/internal/config"
+	"go-proxy-server/internal/ratelimit"
+)
+
+// bucketPair holds the upload and download token buckets of one shaping scope
+type bucketPair struct {
+	up   *ratelimit.Bucket
+	down *ratelimit.Bucket
+	refs int // Number of sessions using this pair (per-user and per-IP scopes only)
+}
+
+// newBucketPair creates a pair of token buckets with the given rates
+func newBucketPair(upRate, downRate, burst int64) *bucketPair {
+	return &bucketPair{
+		up:   ratelimit.NewBucket(upRate, burst),
+		down: ratelimit.NewBucket(downRate, burst),
+	}
+}
+
+// set updates the rates of both buckets
+func (p *bucketPair) set(upRate, downRate, burst int64) {
+	p.up.SetRate(upRate, burst)
+	p.down.SetRate(downRate, burst)
+}
+
+// listenerRate holds the configured bandwidth of a listener
+type listenerRate struct {
+	up, down int64
+}
+
+// Shaper applies token bucket bandwidth limits globally, per listener, per user and per client IP
+// Connections sharing a scope share its bucket, so a user's concurrent connections split the user's rate
+type Shaper struct {
+	mu            sync.Mutex
+	global        *bucketPair
+	listeners     map[string]*bucketPair
+	listenerRates map[string]listenerRate
+	users         map[string]*bucketPair
+	ips           map[string]*bucketPair
+}
+
+// NewShaper creates a shaper using the current bandwidth configuration
+func NewShaper() *Shaper {
+	cfg := config.GetBandwidthConfig()
+	return &Shaper{
+		global:        newBucketPair(cfg.GlobalUpload, cfg.GlobalDownload, cfg.Burst),
+		listeners:     make(map[string]*bucketPair),
+		listenerRates: make(map[string]listenerRate),
+		users:         make(map[string]*bucketPair),
+		ips:           make(map[string]*bucketPair),
+	}
+}
+
+// Global bandwidth shaper instance
+var shaper = NewShaper()
+
+// GetShaper returns the global bandwidth shaper
+func GetShaper() *Shaper {
+	return shaper
+}
+
+// SetListenerRate sets the bandwidth shared by all connections of a listener
+func (s *Shaper) SetListenerRate(listener string, upRate, downRate int64) {
+	burst := config.GetBandwidthConfig().Burst
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.listenerRates[listener] = listenerRate{up: upRate, down: downRate}
+	if pair, ok := s.listeners[listener]; ok {
+		pair.set(upRate, downRate, burst)
+	}
+}
+
+// Reconfigure applies the current bandwidth configuration to all existing buckets
+// Called after the configuration or per-user overrides change
+func (s *Shaper) Reconfigure() {
+	cfg := config.GetBandwidthConfig()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.global.set(cfg.GlobalUpload, cfg.GlobalDownload, cfg.Burst)
+	for name, pair := range s.listeners {
+		rate := s.listenerRates[name]
+		pair.set(rate.up, rate.down, cfg.Burst)
+	}
+	for username, pair := range s.users {
+		limits := config.GetUserLimits(username)
+		pair.set(limits.UploadRate, limits.DownloadRate, cfg.Burst)
+	}
+	for _, pair := range s.ips {
+		pair.set(cfg.PerIPUpload, cfg.PerIPDownload, cfg.Burst)
+	}
+}
+
+// listener returns the bucket pair of a listener, creating it on first use
+func (s *Shaper) listener(name string) *bucketPair {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pair, ok := s.listeners[name]
+	if !ok {
+		rate := s.listenerRates[name]
+		pair = newBucketPair(rate.up, rate.down, config.GetBandwidthConfig().Burst)
+		s.listeners[name] = pair
+	}
+	return pair
+}
+
+// acquireIP returns the shared bucket pair of a client IP and takes a reference
+func (s *Shaper) acquireIP(clientIP string) *bucketPair {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pair, ok := s.ips[clientIP]
+	if !ok {
+		cfg := config.GetBandwidthConfig()
+		pair = newBucketPair(cfg.PerIPUpload, cfg.PerIPDownload, cfg.Burst)
+		s.ips[clientIP] = pair
+	}
+	pair.refs++
+	return pair
+}
+
+// releaseIP drops a reference to a client IP's bucket pair
+func (s *Shaper) releaseIP(clientIP string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if pair, ok := s.ips[clientIP]; ok {
+		pair.refs--
+		if pair.refs <= 0 {
+			delete(s.ips, clientIP)
+		}
+	}
+}
+
+// acquireUser returns the shared bucket pair of a user and takes a reference
+func (s *Shaper) acquireUser(username string) *bucketPair {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pair, ok := s.users[username]
+	if !ok {
+		limits := config.GetUserLimits(username)
+		pair = newBucketPair(limits.UploadRate, limits.DownloadRate, config.GetBandwidthConfig().Burst)
+		s.users[username] = pair
+	}
+	pair.refs++
+	return pair
+}
+
+// releaseUser drops a reference to a user's bucket pair
+func (s *Shaper) releaseUser(username string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if pair, ok := s.users[username]; ok {
+		pair.refs--
+		if pair.refs <= 0 {
+			delete(s.users, username)
+		}
+	}
+}
+
+// maxThrottleChunk caps a single reservation so concurrent connections sharing
+// a bucket take turns in small slices instead of one connection draining the burst
+const maxThrottleChunk = 16 * 1024
+
+// throttle blocks until n bytes may pass in the given direction for the session
+func (s *session) throttle(ctx context.Context, n int, isUpload bool) error {
+	if s == nil {
+		return nil
+	}
+
+	buckets := make([]*ratelimit.Bucket, 0, 5)
+	for _, pair := range []*bucketPair{shaper.global, s.listenerBuckets, s.ipBuckets, s.userBuckets, s.grantBuckets} {
+		if pair == nil {
+			continue
+		}
+		b := pair.down
+		if isUpload {
+			b = pair.up
+		}
+		if !b.Unlimited() {
+			buckets = append(buckets, b)
+		}
+	}
+	if len(buckets) == 0 {
+		return nil
+	}
+
+	for n > 0 {
+		chunk := n
+		if chunk > maxThrottleChunk {
+			chunk = maxThrottleChunk
+		}
+		if err := ratelimit.WaitAll(ctx, chunk, buckets...); err != nil {
+			return err
+		}
+		n -= chunk
+	}
+	return nil
+}
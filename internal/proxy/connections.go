@@ -0,0 +1,143 @@
+package proxy
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ActiveConnection describes a client connection currently handled by a listener
+// Destinations are deliberately not tracked to avoid exposing users' targets
+type ActiveConnection struct {
+	ID        uint64    `json:"id"`
+	ClientIP  string    `json:"clientIP"`
+	Listener  string    `json:"listener"`
+	Username  string    `json:"username"` // Empty for whitelisted clients and before authentication
+	StartedAt time.Time `json:"startedAt"`
+	BytesIn   int64     `json:"bytesIn"`  // Bytes received from the client
+	BytesOut  int64     `json:"bytesOut"` // Bytes sent to the client
+}
+
+// connectionRegistry tracks the sessions of all open client connections
+type connectionRegistry struct {
+	mu       sync.Mutex
+	nextID   atomic.Uint64
+	sessions map[uint64]*trackedSession
+}
+
+// trackedSession is a registered session with the attributes readable from other goroutines
+type trackedSession struct {
+	sess      *session
+	cancel    func() // Force-closes the client connection, ending the session
+	username  string // Guarded by connectionRegistry.mu
+	startedAt time.Time
+}
+
+// Global registry of open client connections
+var connections = &connectionRegistry{sessions: make(map[uint64]*trackedSession)}
+
+// add registers a session with the function force-closing it and returns its connection ID
+func (cr *connectionRegistry) add(s *session, cancel func()) uint64 {
+	id := cr.nextID.Add(1)
+	cr.mu.Lock()
+	cr.sessions[id] = &trackedSession{sess: s, cancel: cancel, startedAt: time.Now()}
+	cr.mu.Unlock()
+	return id
+}
+
+// setUser records the user a connection was attributed to
+func (cr *connectionRegistry) setUser(id uint64, username string) {
+	cr.mu.Lock()
+	if tracked, ok := cr.sessions[id]; ok {
+		tracked.username = username
+	}
+	cr.mu.Unlock()
+}
+
+// remove unregisters a closed connection
+func (cr *connectionRegistry) remove(id uint64) {
+	cr.mu.Lock()
+	delete(cr.sessions, id)
+	cr.mu.Unlock()
+}
+
+// snapshot returns the IDs of the open connections of a listener ("" = every listener) by listener name
+func (cr *connectionRegistry) snapshot(listener string) map[uint64]string {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	ids := make(map[uint64]string)
+	for id, tracked := range cr.sessions {
+		if listener == "" || tracked.sess.listener == listener {
+			ids[id] = tracked.sess.listener
+		}
+	}
+	return ids
+}
+
+// drain asks the given connections to finish, closing those idle between keep-alive requests right away
+func (cr *connectionRegistry) drain(ids map[uint64]string) {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	for id := range ids {
+		if tracked, ok := cr.sessions[id]; ok {
+			tracked.sess.draining.Store(true)
+			if tracked.sess.idle.Load() {
+				tracked.cancel()
+			}
+		}
+	}
+}
+
+// remaining returns how many of the given connections are still open, by listener name
+func (cr *connectionRegistry) remaining(ids map[uint64]string) map[string]int {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	counts := make(map[string]int)
+	for id, listener := range ids {
+		if _, ok := cr.sessions[id]; ok {
+			counts[listener]++
+		}
+	}
+	return counts
+}
+
+// forceClose closes the given connections that are still open and returns how many it closed
+func (cr *connectionRegistry) forceClose(ids map[uint64]string) int {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	closed := 0
+	for id := range ids {
+		if tracked, ok := cr.sessions[id]; ok {
+			tracked.cancel()
+			closed++
+		}
+	}
+	return closed
+}
+
+// CountConnections returns the number of open connections of a listener
+func CountConnections(listener string) int {
+	return len(connections.snapshot(listener))
+}
+
+// ListConnections returns the open client connections, oldest first
+func ListConnections() []ActiveConnection {
+	connections.mu.Lock()
+	result := make([]ActiveConnection, 0, len(connections.sessions))
+	for id, tracked := range connections.sessions {
+		result = append(result, ActiveConnection{
+			ID:        id,
+			ClientIP:  tracked.sess.clientIP,
+			Listener:  tracked.sess.listener,
+			Username:  tracked.username,
+			StartedAt: tracked.startedAt,
+			BytesIn:   tracked.sess.bytesIn.Load(),
+			BytesOut:  tracked.sess.bytesOut.Load(),
+		})
+	}
+	connections.mu.Unlock()
+
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result
+}
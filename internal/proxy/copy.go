@@ -24,7 +24,8 @@ var bufferPool = sync.Pool{
 // It resets the deadline after each successful read/write operation
 // Uses buffer pool to reduce GC pressure
 // isUpload: true for client->server (upload), false for server->client (download)
-func copyWithIdleTimeout(ctx context.Context, dst, src net.Conn, readTimeout, writeTimeout time.Duration, isUpload bool) error {
+// sess: the client session the traffic is accounted to
+func copyWithIdleTimeout(ctx context.Context, dst, src net.Conn, readTimeout, writeTimeout time.Duration, isUpload bool, sess *session) error {
 	// Get buffer from pool
 	buf := bufferPool.Get().([]byte)
 	defer bufferPool.Put(buf) // Return buffer to pool when done
@@ -42,15 +43,15 @@ func copyWithIdleTimeout(ctx context.Context, dst, src net.Conn, readTimeout, wr
 
 		n, err := src.Read(buf)
 		if n > 0 {
-			// Record bytes based on direction
-			if collector := metrics.GetCollector(); collector != nil {
-				if isUpload {
-					// Client -> Server: record as sent (upload)
-					collector.RecordBytesSent(int64(n))
-				} else {
-					// Server -> Client: record as received (download)
-					collector.RecordBytesReceived(int64(n))
-				}
+			// Record bytes based on direction and enforce the user's traffic quota
+			if recErr := sess.recordTransfer(n, isUpload); recErr != nil {
+				logger.Info("Closing connection for user %s: %v", sess.username, recErr)
+				return recErr
+			}
+
+			// Apply bandwidth shaping before forwarding the data
+			if err := sess.throttle(ctx, n, isUpload); err != nil {
+				return err
 			}
 
 			// Set write deadline (idle timeout)
@@ -0,0 +1,118 @@
+package proxy
+
+import (
+	"sync"
+	"time"
+
+	"go-proxy-server/internal/logger"
+)
+
+// drainPollInterval is how often a drain checks whether its connections have finished
+const drainPollInterval = 100 * time.Millisecond
+
+// DrainProgress describes the drain of a stopped listener's connections
+type DrainProgress struct {
+	StartedAt time.Time `json:"startedAt"`
+	Deadline  time.Time `json:"deadline"`  // Connections still open then are force-closed
+	Initial   int       `json:"initial"`   // Connections open when the drain started
+	Remaining int       `json:"remaining"` // Connections still open
+}
+
+// drainTracker holds the progress of the running drains by listener name
+type drainTracker struct {
+	mu     sync.Mutex
+	drains map[string]*DrainProgress
+}
+
+// Global tracker of running drains
+var drains = &drainTracker{drains: make(map[string]*DrainProgress)}
+
+// DrainConnections lets the open connections of a listener ("" = every listener) finish,
+// then force-closes those still open after timeout and returns how many it closed
+// Connections idle between keep-alive requests are closed right away, busy ones after their current request
+// The listener must already have stopped accepting connections; DrainConnections blocks until the drain ends
+func DrainConnections(listener string, timeout time.Duration) int {
+	ids := connections.snapshot(listener)
+	if len(ids) == 0 {
+		return 0
+	}
+
+	started := time.Now()
+	deadline := started.Add(timeout)
+	progress := make(map[string]*DrainProgress)
+	for _, name := range ids {
+		if progress[name] == nil {
+			progress[name] = &DrainProgress{StartedAt: started, Deadline: deadline}
+		}
+		progress[name].Initial++
+		progress[name].Remaining++
+	}
+	drains.start(progress)
+	defer drains.finish(progress)
+
+	connections.drain(ids)
+	for time.Now().Before(deadline) {
+		remaining := connections.remaining(ids)
+		drains.update(progress, remaining)
+		if len(remaining) == 0 {
+			return 0
+		}
+		time.Sleep(drainPollInterval)
+	}
+
+	forced := connections.forceClose(ids)
+	if forced > 0 {
+		if listener == "" {
+			logger.Warn("Force-closed %d connections still open after the %v drain deadline", forced, timeout)
+		} else {
+			logger.Warn("Force-closed %d connections of listener %s still open after the %v drain deadline", forced, listener, timeout)
+		}
+	}
+	return forced
+}
+
+// start registers the progress of a new drain, replacing older drains of the same listeners in the status
+func (dt *drainTracker) start(progress map[string]*DrainProgress) {
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
+	for name, p := range progress {
+		dt.drains[name] = p
+	}
+}
+
+// update records the connections still open
+func (dt *drainTracker) update(progress map[string]*DrainProgress, remaining map[string]int) {
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
+	for name, p := range progress {
+		p.Remaining = remaining[name]
+	}
+}
+
+// finish removes the progress of an ended drain unless a newer drain of the listener replaced it
+func (dt *drainTracker) finish(progress map[string]*DrainProgress) {
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
+	for name, p := range progress {
+		if dt.drains[name] == p {
+			delete(dt.drains, name)
+		}
+	}
+}
+
+// GetDrainProgress returns the progress of a listener's running drain
+func GetDrainProgress(listener string) (DrainProgress, bool) {
+	drains.mu.Lock()
+	defer drains.mu.Unlock()
+	if p, ok := drains.drains[listener]; ok {
+		return *p, true
+	}
+	return DrainProgress{}, false
+}
+
+// Shutdown stops accepting connections on every open listener group and drains every open connection
+// Returns the number of connections force-closed after timeout
+func Shutdown(timeout time.Duration) int {
+	openGroups.closeAll()
+	return DrainConnections("", timeout)
+}
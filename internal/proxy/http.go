@@ -12,12 +12,12 @@ import (
 	"sync"
 	"time"
 
+	"go-proxy-server/internal/acl"
 	"go-proxy-server/internal/auth"
 	"go-proxy-server/internal/config"
 	"go-proxy-server/internal/constants"
 	"go-proxy-server/internal/logger"
 	"go-proxy-server/internal/metrics"
-	"go-proxy-server/internal/security"
 )
 
 // Transport pool for connection reuse to destination servers
@@ -68,8 +68,8 @@ func getDefaultTransport() *http.Transport {
 				if err != nil {
 					return nil, err
 				}
-				// Verify connected IP to prevent DNS rebinding attacks
-				if err := security.VerifyConnectedIP(conn); err != nil {
+				// Verify connected IP to prevent DNS rebinding attacks and enforce the user's network rules
+				if err := sessionFromContext(ctx).verifyConnectedIP(conn); err != nil {
 					conn.Close()
 					return nil, err
 				}
@@ -106,8 +106,8 @@ func getTransportForLocalAddr(localAddr *net.TCPAddr, timeout config.TimeoutConf
 			if err != nil {
 				return nil, err
 			}
-			// Verify connected IP to prevent DNS rebinding attacks
-			if err := security.VerifyConnectedIP(conn); err != nil {
+			// Verify connected IP to prevent DNS rebinding attacks and enforce the user's network rules
+			if err := sessionFromContext(ctx).verifyConnectedIP(conn); err != nil {
 				conn.Close()
 				return nil, err
 			}
@@ -154,11 +154,28 @@ func writeHTTPError(conn net.Conn, statusCode int, statusText string, headers ma
 	return resp.Write(conn)
 }
 
+// requestDestination returns the "host:port" destination of a proxy request
+func requestDestination(req *http.Request) string {
+	if req.Method == http.MethodConnect {
+		if !strings.Contains(req.Host, ":") {
+			return req.Host + ":443"
+		}
+		return req.Host
+	}
+	if req.URL.Port() != "" {
+		return req.URL.Host
+	}
+	if req.URL.Scheme == "https" {
+		return net.JoinHostPort(req.URL.Hostname(), "443")
+	}
+	return net.JoinHostPort(req.URL.Hostname(), "80")
+}
+
 // validateAndConnect performs SSRF check, establishes connection, and verifies connected IP
 // Returns the connection and any error encountered
-func validateAndConnect(host string, bindListen bool, localAddr *net.TCPAddr, timeout config.TimeoutConfig) (net.Conn, error) {
+func validateAndConnect(host string, bindListen bool, localAddr *net.TCPAddr, timeout config.TimeoutConfig, sess *session) (net.Conn, error) {
 	// Check for SSRF attacks (prevent access to private IPs)
-	if err := security.CheckSSRF(host); err != nil {
+	if err := sess.checkSSRF(host); err != nil {
 		// Don't log the host to avoid leaking user's target destinations
 		logger.Warn("SSRF protection triggered")
 		return nil, fmt.Errorf("SSRF protection: %w", err)
@@ -168,8 +185,8 @@ func validateAndConnect(host string, bindListen bool, localAddr *net.TCPAddr, ti
 	dialer := &net.Dialer{
 		Timeout: timeout.Connect,
 	}
-	if bindListen {
-		dialer.LocalAddr = localAddr
+	if addr := sess.outboundAddr(bindListen, localAddr); addr != nil {
+		dialer.LocalAddr = addr
 	}
 	destConn, err := dialer.Dial("tcp", host)
 	if err != nil {
@@ -178,7 +195,7 @@ func validateAndConnect(host string, bindListen bool, localAddr *net.TCPAddr, ti
 	}
 
 	// Verify connected IP to prevent DNS rebinding attacks
-	if err := security.VerifyConnectedIP(destConn); err != nil {
+	if err := sess.verifyConnectedIP(destConn); err != nil {
 		// Don't log the error details to avoid leaking target IP information
 		logger.Warn("DNS rebinding protection triggered")
 		destConn.Close()
@@ -207,7 +224,7 @@ func shouldCloseConnection(req *http.Request, resp *http.Response) bool {
 	return false
 }
 
-func HandleHTTPConnection(conn net.Conn, bindListen bool) {
+func HandleHTTPConnection(conn net.Conn, listener Listener) {
 	defer conn.Close()
 
 	// Record connection
@@ -228,9 +245,10 @@ func HandleHTTPConnection(conn net.Conn, bindListen bool) {
 	clientIP := clientAddr.IP.String()
 
 	// Apply connection rate limiting
-	limiter := GetHTTPLimiter()
-	if !limiter.Acquire(clientIP) {
-		logger.Warn("Connection limit reached for IP %s", clientIP)
+	limiter := GetListenerLimiter(listener.Name)
+	slot, err := limiter.Acquire(clientIP)
+	if err != nil {
+		logger.Warn("Connection rejected for IP %s: %v", clientIP, err)
 		// Try to send 503 Service Unavailable before closing
 		writeHTTPError(conn, http.StatusServiceUnavailable, "Service Unavailable", nil)
 		if collector := metrics.GetCollector(); collector != nil {
@@ -238,7 +256,10 @@ func HandleHTTPConnection(conn net.Conn, bindListen bool) {
 		}
 		return
 	}
-	defer limiter.Release(clientIP)
+	defer slot.Release()
+
+	sess := newSession(conn, clientIP, listener)
+	defer sess.close()
 
 	// Get local TCP addresses with type assertion checks
 	tcpLocalAddr, ok := conn.LocalAddr().(*net.TCPAddr)
@@ -259,14 +280,22 @@ func HandleHTTPConnection(conn net.Conn, bindListen bool) {
 	// Track request count to periodically re-verify credentials for security
 	var isAuthenticated bool
 	var requestCount int
+	// Destination the credentials were verified for, when a backend decides by destination
+	var authDestination string
 
 	// Handle multiple requests on the same connection (HTTP/1.1 Keep-Alive)
 	for {
+		// Close the connection between requests while the listener drains
+		if sess.enterIdle() {
+			return
+		}
+
 		// Set read timeout for waiting for next request (use IdleRead timeout)
 		conn.SetReadDeadline(time.Now().Add(timeout.IdleRead))
 
 		// Read the HTTP request
 		req, err := http.ReadRequest(reader)
+		sess.idle.Store(false)
 		if err != nil {
 			// EOF or timeout is normal for persistent connections
 			if err == io.EOF {
@@ -296,6 +325,11 @@ func HandleHTTPConnection(conn net.Conn, bindListen bool) {
 			isAuthenticated = false
 			requestCount = 0
 		}
+		// A backend deciding by destination must see every destination the connection is used for
+		destination := requestDestination(req)
+		if isAuthenticated && !sess.whitelisted && destination != authDestination && auth.UsesDestination() {
+			isAuthenticated = false
+		}
 
 		// Check authentication
 		// For Keep-Alive connections, use cached authentication state to avoid repeated bcrypt verification
@@ -304,13 +338,14 @@ func HandleHTTPConnection(conn net.Conn, bindListen bool) {
 
 		if !authenticated {
 			// Check if the client's IP address is in the whitelist first
-			if auth.CheckIPWhitelist(clientIP) {
+			if sess.whitelistAdmits() {
+				sess.whitelisted = true
 				authenticated = true
 				isAuthenticated = true
 			} else {
 				// Check for Proxy-Authorization header
 				authHeader := req.Header.Get("Proxy-Authorization")
-				if authHeader != "" {
+				if authHeader != "" && sess.passwordAllowed() {
 					// Parse Basic authentication
 					if strings.HasPrefix(authHeader, "Basic ") {
 						encoded := strings.TrimPrefix(authHeader, "Basic ")
@@ -321,10 +356,29 @@ func HandleHTTPConnection(conn net.Conn, bindListen bool) {
 								username := authParts[0]
 								password := authParts[1]
 
-								// Verify credentials
-								if auth.VerifyCredentials(username, []byte(password)) == nil {
+								// Verify credentials with the configured authentication backends
+								if result, err := auth.Authenticate(&auth.Request{
+									Username:    username,
+									Password:    []byte(password),
+									ClientIP:    clientIP,
+									Listener:    sess.listener,
+									Destination: destination,
+								}); err == nil {
+									// Check whether the user may use this listener now, before the login counts against the user's limits
+									if err := sess.checkLogin(result); err != nil {
+										logger.Info("Connection rejected for user %s from %s: %v", username, clientIP, err)
+										writeHTTPError(conn, http.StatusForbidden, "Forbidden", nil)
+										return
+									}
+									// Enforce per-user connection limits
+									if err := sess.setUser(result); err != nil {
+										logger.Info("Connection rejected for user %s from %s: %v", username, clientIP, err)
+										writeHTTPError(conn, http.StatusTooManyRequests, "Too Many Requests", nil)
+										return
+									}
 									authenticated = true
 									isAuthenticated = true
+									authDestination = destination
 								}
 							}
 						}
@@ -333,6 +387,12 @@ func HandleHTTPConnection(conn net.Conn, bindListen bool) {
 			}
 		}
 
+		if !authenticated && !sess.passwordAllowed() {
+			// Credentials cannot help on whitelist-only listeners
+			logger.Info("Connection from %s rejected: not whitelisted", clientIP)
+			writeHTTPError(conn, http.StatusForbidden, "Forbidden", nil)
+			return
+		}
 		if !authenticated {
 			// Send 407 Proxy Authentication Required
 			headers := map[string]string{
@@ -344,14 +404,35 @@ func HandleHTTPConnection(conn net.Conn, bindListen bool) {
 			return
 		}
 
+		// Reject requests from users who have used up their traffic quota
+		if sess.quotaExceeded() {
+			logger.Info("Traffic quota exceeded for user %s from %s", sess.username, clientIP)
+			writeHTTPError(conn, http.StatusForbidden, "Forbidden", nil)
+			return
+		}
+
+		// Close the connection once the session time granted at login is used up
+		if sess.expired() {
+			logger.Info("Session time of user %s from %s expired", sess.username, clientIP)
+			writeHTTPError(conn, http.StatusForbidden, "Forbidden", nil)
+			return
+		}
+
+		// Reject requests outside the access schedule of the user or whitelist entry
+		if !sess.scheduleAllowed() {
+			logger.Info("Request from %s rejected outside access schedule", clientIP)
+			writeHTTPError(conn, http.StatusForbidden, "Forbidden", nil)
+			return
+		}
+
 		// Handle the request based on method
 		if req.Method == http.MethodConnect {
 			// HTTPS tunneling (CONNECT method) - closes connection after tunnel
-			handleHTTPSConnect(conn, req, bindListen, localAddr, timeout)
+			handleHTTPSConnect(conn, req, listener.BindListen, localAddr, timeout, sess)
 			return
 		} else {
 			// Regular HTTP proxy - may support keep-alive
-			shouldClose := handleHTTPRequest(conn, req, reader, bindListen, localAddr, timeout)
+			shouldClose := handleHTTPRequest(conn, req, reader, listener.BindListen, localAddr, timeout, sess)
 			if shouldClose {
 				return
 			}
@@ -359,15 +440,22 @@ func HandleHTTPConnection(conn net.Conn, bindListen bool) {
 	}
 }
 
-func handleHTTPSConnect(conn net.Conn, req *http.Request, bindListen bool, localAddr *net.TCPAddr, timeout config.TimeoutConfig) {
+func handleHTTPSConnect(conn net.Conn, req *http.Request, bindListen bool, localAddr *net.TCPAddr, timeout config.TimeoutConfig, sess *session) {
 	// Extract host and port from request
 	host := req.Host
 	if !strings.Contains(host, ":") {
 		host = host + ":443"
 	}
 
+	// Apply the user's access rules
+	if err := sess.checkRequest(acl.CommandConnect, host); err != nil {
+		logger.Info("Request rejected for user %s from %s: %v", sess.username, sess.clientIP, err)
+		writeHTTPError(conn, http.StatusForbidden, "Forbidden", nil)
+		return
+	}
+
 	// Validate and connect to destination (includes SSRF check and DNS rebinding protection)
-	destConn, err := validateAndConnect(host, bindListen, localAddr, timeout)
+	destConn, err := validateAndConnect(host, bindListen, localAddr, timeout, sess)
 	if err != nil {
 		// Determine response based on error type
 		if strings.Contains(err.Error(), "SSRF protection") || strings.Contains(err.Error(), "DNS rebinding") {
@@ -394,8 +482,8 @@ func handleHTTPSConnect(conn net.Conn, req *http.Request, bindListen bool, local
 		return
 	}
 
-	// Create context for cancellation with maximum connection age
-	ctx, cancel := context.WithTimeout(context.Background(), timeout.MaxConnectionAge)
+	// Create context for cancellation with maximum connection age (and schedule window end)
+	ctx, cancel := sess.tunnelContext(timeout.MaxConnectionAge)
 	defer cancel()
 
 	// Start bidirectional data transfer with idle timeout
@@ -406,7 +494,7 @@ func handleHTTPSConnect(conn net.Conn, req *http.Request, bindListen bool, local
 	// Client to destination (upload)
 	go func() {
 		defer wg.Done()
-		err := copyWithIdleTimeout(ctx, destConn, conn, timeout.IdleRead, timeout.IdleWrite, true)
+		err := copyWithIdleTimeout(ctx, destConn, conn, timeout.IdleRead, timeout.IdleWrite, true, sess)
 		if tcpConn, ok := destConn.(*net.TCPConn); ok {
 			tcpConn.CloseWrite()
 		}
@@ -416,7 +504,7 @@ func handleHTTPSConnect(conn net.Conn, req *http.Request, bindListen bool, local
 	// Destination to client (download)
 	go func() {
 		defer wg.Done()
-		err := copyWithIdleTimeout(ctx, conn, destConn, timeout.IdleRead, timeout.IdleWrite, false)
+		err := copyWithIdleTimeout(ctx, conn, destConn, timeout.IdleRead, timeout.IdleWrite, false, sess)
 		if tcpConn, ok := conn.(*net.TCPConn); ok {
 			tcpConn.CloseWrite()
 		}
@@ -451,19 +539,29 @@ func handleHTTPSConnect(conn net.Conn, req *http.Request, bindListen bool, local
 	}
 }
 
-func handleHTTPRequest(conn net.Conn, req *http.Request, reader *bufio.Reader, bindListen bool, localAddr *net.TCPAddr, timeout config.TimeoutConfig) bool {
+func handleHTTPRequest(conn net.Conn, req *http.Request, reader *bufio.Reader, bindListen bool, localAddr *net.TCPAddr, timeout config.TimeoutConfig, sess *session) bool {
 	// Extract host from request
 	host := req.Host
 	if !strings.Contains(host, ":") {
 		host = host + ":80"
 	}
 
+	// Apply the user's access rules
+	if err := sess.checkRequest(acl.CommandConnect, host); err != nil {
+		logger.Info("Request rejected for user %s from %s: %v", sess.username, sess.clientIP, err)
+		writeHTTPError(conn, http.StatusForbidden, "Forbidden", nil)
+		return true // Close connection
+	}
+
 	// SSRF check before making request
-	if err := security.CheckSSRF(host); err != nil {
+	if err := sess.checkSSRF(host); err != nil {
 		writeHTTPError(conn, http.StatusForbidden, "Forbidden", nil)
 		return true // Close connection
 	}
 
+	// Carry the session into the transport so dials apply the user's rules
+	req = req.WithContext(withSession(req.Context(), sess))
+
 	// Remove Proxy-Authorization header before forwarding
 	req.Header.Del("Proxy-Authorization")
 	req.Header.Del("Proxy-Connection")
@@ -471,11 +569,16 @@ func handleHTTPRequest(conn net.Conn, req *http.Request, reader *bufio.Reader, b
 	// Convert request to absolute form to relative form
 	req.RequestURI = ""
 
+	// Account the forwarded request body as upload traffic
+	if req.Body != nil && req.Body != http.NoBody {
+		req.Body = &meteredReadCloser{ReadCloser: req.Body, sess: sess, isUpload: true}
+	}
+
 	// Use HTTP client with connection pooling
 	var transport *http.Transport
-	if bindListen {
+	if addr := sess.outboundAddr(bindListen, localAddr); addr != nil {
 		// Use cached transport for this local address to enable connection pooling
-		transport = getTransportForLocalAddr(localAddr, timeout)
+		transport = getTransportForLocalAddr(addr, timeout)
 	} else {
 		// Use default shared transport
 		transport = getDefaultTransport()
@@ -513,8 +616,8 @@ func handleHTTPRequest(conn net.Conn, req *http.Request, reader *bufio.Reader, b
 	// Set write timeout for sending response
 	conn.SetWriteDeadline(time.Now().Add(timeout.IdleWrite))
 
-	// Write response to client
-	err = resp.Write(conn)
+	// Write response to client, accounting it as download traffic
+	err = resp.Write(&meteredWriter{w: conn, sess: sess, isUpload: false})
 	if err != nil {
 		logger.Error("Failed to write response to client: %v", err)
 		return true // Close connection
@@ -1,123 +1,184 @@
 package proxy
 
 import (
+	"errors"
+	"sort"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"go-proxy-server/internal/config"
+	"go-proxy-server/internal/ratelimit"
+)
+
+// perIPRateSweepInterval is how often expired per-IP rate counters are removed
+const perIPRateSweepInterval = time.Minute
+
+// Errors returned by ConnectionLimiter.Acquire
+var (
+	ErrGlobalConnectionLimit = errors.New("global connection limit reached")
+	ErrPerIPConnectionLimit  = errors.New("per-IP connection limit reached")
+	ErrPerIPRateLimit        = errors.New("per-IP new connection rate limit reached")
+)
+
+// Rejection reasons reported in LimiterStats
+const (
+	RejectGlobalLimit = "global"
+	RejectPerIPLimit  = "perIP"
+	RejectPerIPRate   = "perIPRate"
 )
 
 // ConnectionLimiter limits the number of concurrent connections globally and per IP
+// Limits are read from the configuration on every Acquire, so changes apply immediately
+// without replacing the limiter; connections over a lowered limit finish normally
 type ConnectionLimiter struct {
-	// Global semaphore for total connection limit
-	globalSem chan struct{}
-	// Per-IP connection counters
-	perIPCounters sync.Map // map[string]*int32
-	// Current total connections (for metrics)
+	// Current total connections
 	totalConnections atomic.Int64
+	// Total connections accepted since start
+	accepted atomic.Int64
+
+	// Limits overriding the configuration for this limiter's listener (0 = use the configuration)
+	maxConnections      atomic.Int32
+	maxConnectionsPerIP atomic.Int32
+
+	// Per-IP connection counts, always tracked so enabling the per-IP limit at runtime is accurate
+	mu    sync.Mutex
+	perIP map[string]int32
+
+	// Per-IP new connection counters for rate limiting
+	perIPRates sync.Map // map[string]*ratelimit.WindowCounter
+	// Unix nanoseconds of the last sweep of expired per-IP rate counters
+	lastRateSweep atomic.Int64
+
+	// Rejected connections by reason
+	rejectedGlobal    atomic.Int64
+	rejectedPerIP     atomic.Int64
+	rejectedPerIPRate atomic.Int64
+}
+
+// ConnectionSlot is a connection admitted by a ConnectionLimiter
+// Releasing the slot always returns it to the limiter it was acquired from
+type ConnectionSlot struct {
+	limiter  *ConnectionLimiter
+	clientIP string
+	once     sync.Once
 }
 
 // NewConnectionLimiter creates a new connection limiter
 func NewConnectionLimiter() *ConnectionLimiter {
-	cfg := config.GetLimiterConfig()
-	// If MaxConcurrentConnections is 0 (unlimited), use max int32 for channel size
-	semSize := cfg.MaxConcurrentConnections
-	if semSize == 0 {
-		semSize = 2147483647 // int32 max value for unlimited
-	}
 	return &ConnectionLimiter{
-		globalSem: make(chan struct{}, semSize),
+		perIP: make(map[string]int32),
 	}
 }
 
 // Acquire attempts to acquire a connection slot for the given IP
-// Returns true if successful, false if the limit is reached
-func (cl *ConnectionLimiter) Acquire(clientIP string) bool {
-	// Get current limit from configuration
+// Returns the slot on success, or an error describing which limit was reached
+func (cl *ConnectionLimiter) Acquire(clientIP string) (*ConnectionSlot, error) {
+	// Get current limits from configuration
 	cfg := config.GetLimiterConfig()
+	if limit := cl.maxConnections.Load(); limit > 0 {
+		cfg.MaxConcurrentConnections = limit
+	}
+	if limit := cl.maxConnectionsPerIP.Load(); limit > 0 {
+		cfg.MaxConcurrentConnectionsPerIP = limit
+	}
 
-	// Check global limit (skip if 0 = unlimited)
-	if cfg.MaxConcurrentConnections > 0 {
-		// Try to acquire global semaphore (non-blocking)
-		select {
-		case cl.globalSem <- struct{}{}:
-			// Global limit not reached, continue to per-IP check
-		default:
-			// Global limit reached
-			return false
-		}
+	// Check per-IP new connection rate first to blunt connection floods cheaply
+	rate, ok := cl.newConnectionRate(clientIP)
+	if !ok {
+		cl.rejectedPerIPRate.Add(1)
+		return nil, ErrPerIPRateLimit
 	}
 
-	// Check per-IP limit (skip if 0 = unlimited)
-	if cfg.MaxConcurrentConnectionsPerIP > 0 {
-		// Check and increment per-IP counter
-		counterInterface, _ := cl.perIPCounters.LoadOrStore(clientIP, new(int32))
-		counter := counterInterface.(*int32)
-
-		// Atomically increment and check if limit exceeded
-		newCount := atomic.AddInt32(counter, 1)
-		if newCount > cfg.MaxConcurrentConnectionsPerIP {
-			// Per-IP limit exceeded, rollback
-			atomic.AddInt32(counter, -1)
-			// Release global semaphore if it was acquired
-			if cfg.MaxConcurrentConnections > 0 {
-				<-cl.globalSem
-			}
-			return false
+	// Reserve a global slot (0 = unlimited)
+	for {
+		current := cl.totalConnections.Load()
+		if cfg.MaxConcurrentConnections > 0 && current >= int64(cfg.MaxConcurrentConnections) {
+			cl.rejectedGlobal.Add(1)
+			return nil, ErrGlobalConnectionLimit
 		}
+		if cl.totalConnections.CompareAndSwap(current, current+1) {
+			break
+		}
+	}
+
+	// Reserve a per-IP slot (0 = unlimited)
+	cl.mu.Lock()
+	if cfg.MaxConcurrentConnectionsPerIP > 0 && cl.perIP[clientIP] >= cfg.MaxConcurrentConnectionsPerIP {
+		cl.mu.Unlock()
+		// Roll back the global slot
+		cl.totalConnections.Add(-1)
+		cl.rejectedPerIP.Add(1)
+		return nil, ErrPerIPConnectionLimit
 	}
+	cl.perIP[clientIP]++
+	cl.mu.Unlock()
 
-	// Successfully acquired, increment total counter
-	cl.totalConnections.Add(1)
-	return true
+	// Only admitted connections count against the rate
+	if rate != nil {
+		rate.Record()
+	}
+	cl.accepted.Add(1)
+	return &ConnectionSlot{limiter: cl, clientIP: clientIP}, nil
 }
 
-// Release releases a connection slot for the given IP
-func (cl *ConnectionLimiter) Release(clientIP string) {
-	// Get current configuration to check if limits are enabled
-	cfg := config.GetLimiterConfig()
+// SetLimits overrides the configured concurrent connection limits (0 = use the configuration)
+// Lowered limits apply to new connections; existing connections finish normally
+func (cl *ConnectionLimiter) SetLimits(maxConnections, maxConnectionsPerIP int32) {
+	cl.maxConnections.Store(maxConnections)
+	cl.maxConnectionsPerIP.Store(maxConnectionsPerIP)
+}
 
-	// Decrement per-IP counter (only if per-IP limit is enabled)
-	if cfg.MaxConcurrentConnectionsPerIP > 0 {
-		if counterInterface, ok := cl.perIPCounters.Load(clientIP); ok {
-			counter := counterInterface.(*int32)
-
-			// Use CAS loop to ensure we don't go below zero
-			for {
-				oldCount := atomic.LoadInt32(counter)
-				if oldCount <= 0 {
-					// Already at zero or negative (shouldn't happen), don't decrement
-					break
-				}
-				newCount := oldCount - 1
-				if atomic.CompareAndSwapInt32(counter, oldCount, newCount) {
-					// Successfully decremented
-					// Clean up counter if it reaches zero to prevent memory leak
-					if newCount == 0 {
-						cl.perIPCounters.Delete(clientIP)
-					}
-					break
-				}
-				// CAS failed, retry
+// newConnectionRate returns the per-IP new-connection rate counter of a client (nil = unlimited)
+// and whether it has room for another connection; the caller records the connection once it is admitted
+func (cl *ConnectionLimiter) newConnectionRate(clientIP string) (*ratelimit.WindowCounter, bool) {
+	limit := config.GetUserLimiterConfig().MaxNewConnectionsPerIPSecond
+	if limit <= 0 {
+		return nil, true
+	}
+
+	// Periodically drop counters of IPs that stopped connecting
+	now := time.Now().UnixNano()
+	last := cl.lastRateSweep.Load()
+	if now-last >= int64(perIPRateSweepInterval) && cl.lastRateSweep.CompareAndSwap(last, now) {
+		cl.perIPRates.Range(func(key, value interface{}) bool {
+			if value.(*ratelimit.WindowCounter).Expired() {
+				cl.perIPRates.Delete(key)
 			}
-		}
+			return true
+		})
 	}
 
-	// Release global semaphore (only if global limit is enabled)
-	if cfg.MaxConcurrentConnections > 0 {
-		select {
-		case <-cl.globalSem:
-		default:
-			// Should not happen, but handle gracefully
-		}
+	value, _ := cl.perIPRates.LoadOrStore(clientIP, ratelimit.NewWindowCounter(time.Second))
+	counter := value.(*ratelimit.WindowCounter)
+	return counter, counter.Check(limit)
+}
+
+// Release returns the slot to its limiter
+// It is safe to call more than once; only the first call has an effect
+func (s *ConnectionSlot) Release() {
+	if s == nil {
+		return
 	}
+	s.once.Do(func() {
+		s.limiter.release(s.clientIP)
+	})
+}
 
-	// Decrement total counter (use Add with negative value, which is atomic)
-	newTotal := cl.totalConnections.Add(-1)
-	// Ensure total doesn't go negative
-	if newTotal < 0 {
-		cl.totalConnections.Store(0)
+// release frees a connection slot for the given IP
+func (cl *ConnectionLimiter) release(clientIP string) {
+	cl.mu.Lock()
+	if count, ok := cl.perIP[clientIP]; ok {
+		if count <= 1 {
+			// Clean up the entry to prevent memory growth
+			delete(cl.perIP, clientIP)
+		} else {
+			cl.perIP[clientIP] = count - 1
+		}
 	}
+	cl.mu.Unlock()
+
+	cl.totalConnections.Add(-1)
 }
 
 // GetTotalConnections returns the current number of active connections
@@ -127,32 +188,98 @@ func (cl *ConnectionLimiter) GetTotalConnections() int64 {
 
 // GetPerIPConnections returns the current number of connections for a given IP
 func (cl *ConnectionLimiter) GetPerIPConnections(clientIP string) int32 {
-	if counterInterface, ok := cl.perIPCounters.Load(clientIP); ok {
-		counter := counterInterface.(*int32)
-		return atomic.LoadInt32(counter)
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	return cl.perIP[clientIP]
+}
+
+// IPConnections is the number of active connections of one client IP
+type IPConnections struct {
+	IP          string `json:"ip"`
+	Connections int32  `json:"connections"`
+}
+
+// LimiterStats is a point-in-time snapshot of a connection limiter
+type LimiterStats struct {
+	ActiveConnections int64            `json:"activeConnections"`
+	AcceptedTotal     int64            `json:"acceptedTotal"`
+	UniqueIPs         int              `json:"uniqueIPs"`
+	TopIPs            []IPConnections  `json:"topIPs"`
+	Rejections        map[string]int64 `json:"rejections"`
+}
+
+// Stats returns a snapshot of the limiter including the topN IPs by active connections
+func (cl *ConnectionLimiter) Stats(topN int) LimiterStats {
+	cl.mu.Lock()
+	ips := make([]IPConnections, 0, len(cl.perIP))
+	for ip, count := range cl.perIP {
+		ips = append(ips, IPConnections{IP: ip, Connections: count})
+	}
+	cl.mu.Unlock()
+
+	sort.Slice(ips, func(i, j int) bool {
+		if ips[i].Connections != ips[j].Connections {
+			return ips[i].Connections > ips[j].Connections
+		}
+		return ips[i].IP < ips[j].IP
+	})
+	uniqueIPs := len(ips)
+	if topN >= 0 && len(ips) > topN {
+		ips = ips[:topN]
+	}
+
+	return LimiterStats{
+		ActiveConnections: cl.totalConnections.Load(),
+		AcceptedTotal:     cl.accepted.Load(),
+		UniqueIPs:         uniqueIPs,
+		TopIPs:            ips,
+		Rejections: map[string]int64{
+			RejectGlobalLimit: cl.rejectedGlobal.Load(),
+			RejectPerIPLimit:  cl.rejectedPerIP.Load(),
+			RejectPerIPRate:   cl.rejectedPerIPRate.Load(),
+		},
 	}
-	return 0
 }
 
-// Global connection limiter instances
+// Connection limiters by listener name
+// A limiter lives until its listener is deleted; configuration changes are picked up on the next Acquire
 var (
-	socks5Limiter = NewConnectionLimiter()
-	httpLimiter   = NewConnectionLimiter()
+	limitersMu sync.Mutex
+	limiters   = make(map[string]*ConnectionLimiter)
 )
 
-// GetSOCKS5Limiter returns the global SOCKS5 connection limiter
-func GetSOCKS5Limiter() *ConnectionLimiter {
-	return socks5Limiter
+// GetListenerLimiter returns the connection limiter of a listener, creating it on first use
+func GetListenerLimiter(name string) *ConnectionLimiter {
+	limitersMu.Lock()
+	defer limitersMu.Unlock()
+	limiter, ok := limiters[name]
+	if !ok {
+		limiter = NewConnectionLimiter()
+		limiters[name] = limiter
+	}
+	return limiter
 }
 
-// GetHTTPLimiter returns the global HTTP connection limiter
-func GetHTTPLimiter() *ConnectionLimiter {
-	return httpLimiter
+// RemoveListenerLimiter forgets the limiter of a deleted listener
+// Connections still open keep releasing their slots to the old limiter
+func RemoveListenerLimiter(name string) {
+	limitersMu.Lock()
+	delete(limiters, name)
+	limitersMu.Unlock()
 }
 
-// RecreateLimiters recreates the global limiters with new configuration
-// This should be called when the connection limit configuration is updated
-func RecreateLimiters() {
-	socks5Limiter = NewConnectionLimiter()
-	httpLimiter = NewConnectionLimiter()
+// ListenerLimiterStats returns a snapshot of the limiter of every listener, by listener name
+func ListenerLimiterStats(topN int) map[string]LimiterStats {
+	limitersMu.Lock()
+	snapshot := make(map[string]*ConnectionLimiter, len(limiters))
+	for name, limiter := range limiters {
+		snapshot[name] = limiter
+	}
+	limitersMu.Unlock()
+
+	stats := make(map[string]LimiterStats, len(snapshot))
+	for name, limiter := range snapshot {
+		stats[name] = limiter.Stats(topN)
+	}
+	return stats
 }
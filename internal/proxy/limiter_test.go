@@ -0,0 +1,68 @@
+package proxy
+
+import (
+	"errors"
+	"testing"
+
+	"gorm.io/gorm"
+
+	"go-proxy-server/internal/config"
+	"go-proxy-server/internal/database"
+)
+
+// openTestDB opens a migrated in-memory database
+// A single connection keeps every query on the same database, which each new connection would otherwise recreate
+func openTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := database.Open(database.Target{Dialect: database.DialectSQLite, DSN: ":memory:"})
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("DB() error = %v", err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+	if err := database.Migrate(db); err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+	return db
+}
+
+// setUserLimiterConfig applies per-user and connection-rate limits for the duration of a test
+func setUserLimiterConfig(t *testing.T, cfg config.UserLimiterConfig) {
+	t.Helper()
+	db := openTestDB(t)
+	previous := config.GetUserLimiterConfig()
+	if err := config.UpdateUserLimiterConfig(db, cfg); err != nil {
+		t.Fatalf("UpdateUserLimiterConfig() error = %v", err)
+	}
+	t.Cleanup(func() { config.UpdateUserLimiterConfig(db, previous) })
+}
+
+func TestConnectionLimiterRateCountsAdmittedConnections(t *testing.T) {
+	setUserLimiterConfig(t, config.UserLimiterConfig{MaxNewConnectionsPerIPSecond: 2})
+	limiter := NewConnectionLimiter()
+	limiter.SetLimits(0, 1)
+
+	first, err := limiter.Acquire("192.0.2.1")
+	if err != nil {
+		t.Fatalf("first connection: %v", err)
+	}
+	// Rejected by the concurrent limit, so it must not use up the rate
+	if _, err := limiter.Acquire("192.0.2.1"); !errors.Is(err, ErrPerIPConnectionLimit) {
+		t.Fatalf("second connection: error = %v, want %v", err, ErrPerIPConnectionLimit)
+	}
+	first.Release()
+
+	second, err := limiter.Acquire("192.0.2.1")
+	if err != nil {
+		t.Fatalf("connection after the slot was released: %v", err)
+	}
+	second.Release()
+	// Two admitted connections used up the rate of this second
+	if _, err := limiter.Acquire("192.0.2.1"); !errors.Is(err, ErrPerIPRateLimit) {
+		t.Fatalf("third admitted connection: error = %v, want %v", err, ErrPerIPRateLimit)
+	}
+}
@@ -0,0 +1,416 @@
+package proxy
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go-proxy-server/internal/config"
+	"go-proxy-server/internal/constants"
+	"go-proxy-server/internal/logger"
+	"go-proxy-server/internal/upgrade"
+)
+
+// ListenSpec selects the local addresses a proxy listener accepts connections on
+type ListenSpec struct {
+	Address  string // IP address or interface name (empty = all addresses)
+	IPFamily string // One of the config.IPFamily* values (empty = dual-stack)
+	Each     bool   // Bind every local address individually instead of the wildcard address
+	Port     int
+}
+
+// Dynamic reports whether the bound addresses follow the addresses of the network interfaces
+// An interface name always binds each address of the interface
+func (spec ListenSpec) Dynamic() bool {
+	if spec.Address == "" {
+		return spec.Each
+	}
+	return net.ParseIP(spec.Address) == nil
+}
+
+// String describes the spec for log messages
+func (spec ListenSpec) String() string {
+	host := spec.Address
+	switch {
+	case spec.Dynamic() && host == "":
+		host = "each local address"
+	case spec.Dynamic():
+		host = "each address of " + host
+	case host == "":
+		host = "*"
+	}
+	description := net.JoinHostPort(host, strconv.Itoa(spec.Port))
+	if spec.IPFamily == config.IPFamilyIPv4 || spec.IPFamily == config.IPFamilyIPv6 {
+		description += " (" + spec.IPFamily + " only)"
+	}
+	return description
+}
+
+// Inherited reports whether the process this one upgraded handed over a socket of the spec
+func (spec ListenSpec) Inherited() bool {
+	addrs, err := spec.resolve()
+	if err != nil {
+		return false
+	}
+	for _, addr := range addrs {
+		if upgrade.Inherits(addr.network, addr.address) {
+			return true
+		}
+	}
+	return false
+}
+
+// socketAddr is a socket bound by a listener, in the form net.Listen takes it
+type socketAddr struct {
+	network string
+	address string
+}
+
+// resolve returns the sockets the spec binds
+func (spec ListenSpec) resolve() ([]socketAddr, error) {
+	port := strconv.Itoa(spec.Port)
+	if ip := net.ParseIP(spec.Address); ip != nil {
+		return []socketAddr{{network: spec.network(ip), address: net.JoinHostPort(spec.Address, port)}}, nil
+	}
+	if !spec.Dynamic() {
+		// Go sets IPV6_V6ONLY on tcp6 wildcard sockets and clears it on tcp ones
+		switch spec.IPFamily {
+		case config.IPFamilyIPv4:
+			return []socketAddr{{network: "tcp4", address: net.JoinHostPort("0.0.0.0", port)}}, nil
+		case config.IPFamilyIPv6:
+			return []socketAddr{{network: "tcp6", address: net.JoinHostPort("::", port)}}, nil
+		default:
+			return []socketAddr{{network: "tcp", address: ":" + port}}, nil
+		}
+	}
+
+	ips, err := interfaceIPs(spec.Address)
+	if err != nil {
+		return nil, err
+	}
+	var addrs []socketAddr
+	for _, ip := range ips {
+		// IPv6 link-local addresses need a zone and are not reachable through routers anyway
+		if ip.To4() == nil && ip.IsLinkLocalUnicast() {
+			continue
+		}
+		if (spec.IPFamily == config.IPFamilyIPv4 && ip.To4() == nil) || (spec.IPFamily == config.IPFamilyIPv6 && ip.To4() != nil) {
+			continue
+		}
+		addrs = append(addrs, socketAddr{network: spec.network(ip), address: net.JoinHostPort(ip.String(), port)})
+	}
+	if len(addrs) == 0 {
+		if spec.Address == "" {
+			return nil, fmt.Errorf("no usable local addresses")
+		}
+		return nil, fmt.Errorf("interface %s has no usable addresses", spec.Address)
+	}
+	return addrs, nil
+}
+
+// network returns the network a socket bound to ip listens on
+func (spec ListenSpec) network(ip net.IP) string {
+	if ip.To4() != nil {
+		return "tcp4"
+	}
+	if ip.IsUnspecified() && spec.IPFamily != config.IPFamilyIPv6 {
+		// "::" with dual-stack also accepts IPv4 connections
+		return "tcp"
+	}
+	return "tcp6"
+}
+
+// interfaceIPs returns the addresses of the named interface, or of every interface that is up if name is empty
+func interfaceIPs(name string) ([]net.IP, error) {
+	var interfaces []net.Interface
+	if name == "" {
+		all, err := net.Interfaces()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list network interfaces: %w", err)
+		}
+		interfaces = all
+	} else {
+		iface, err := net.InterfaceByName(name)
+		if err != nil {
+			return nil, fmt.Errorf("unknown network interface %s: %w", name, err)
+		}
+		interfaces = []net.Interface{*iface}
+	}
+
+	var ips []net.IP
+	for _, iface := range interfaces {
+		if iface.Flags&net.FlagUp == 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the addresses of interface %s: %w", iface.Name, err)
+		}
+		for _, addr := range addrs {
+			switch v := addr.(type) {
+			case *net.IPNet:
+				ips = append(ips, v.IP)
+			case *net.IPAddr:
+				ips = append(ips, v.IP)
+			}
+		}
+	}
+	sort.Slice(ips, func(i, j int) bool { return bytes.Compare(ips[i].To16(), ips[j].To16()) < 0 })
+	return ips, nil
+}
+
+// ListenerGroup is the set of sockets a proxy listener accepts connections on
+// Groups with a dynamic spec re-resolve it while open, so their sockets follow interface address changes
+type ListenerGroup struct {
+	spec      ListenSpec
+	settings  Listener
+	tlsConfig *tls.Config // nil = plain TCP
+	failed    chan error
+	done      chan struct{}
+
+	mu      sync.Mutex
+	sockets map[socketAddr]net.Listener
+	closed  bool
+}
+
+// groupRegistry tracks the open listener groups so shutdown can stop them all
+type groupRegistry struct {
+	mu     sync.Mutex
+	groups map[*ListenerGroup]struct{}
+}
+
+// Global registry of open listener groups
+var openGroups = &groupRegistry{groups: make(map[*ListenerGroup]struct{})}
+
+// add registers an opened listener group
+func (gr *groupRegistry) add(g *ListenerGroup) {
+	gr.mu.Lock()
+	gr.groups[g] = struct{}{}
+	gr.mu.Unlock()
+}
+
+// remove unregisters a closed listener group
+func (gr *groupRegistry) remove(g *ListenerGroup) {
+	gr.mu.Lock()
+	delete(gr.groups, g)
+	gr.mu.Unlock()
+}
+
+// closeAll closes every open listener group
+func (gr *groupRegistry) closeAll() {
+	gr.mu.Lock()
+	groups := make([]*ListenerGroup, 0, len(gr.groups))
+	for g := range gr.groups {
+		groups = append(groups, g)
+	}
+	gr.mu.Unlock()
+	for _, g := range groups {
+		g.Close()
+	}
+}
+
+// CheckListeners returns an error if an open listener group lost all its sockets
+// Groups following interface addresses may legitimately have none while their interfaces are down
+func CheckListeners() error {
+	openGroups.mu.Lock()
+	groups := make([]*ListenerGroup, 0, len(openGroups.groups))
+	for g := range openGroups.groups {
+		groups = append(groups, g)
+	}
+	openGroups.mu.Unlock()
+
+	for _, g := range groups {
+		g.mu.Lock()
+		lost := !g.closed && len(g.sockets) == 0 && !g.spec.Dynamic()
+		g.mu.Unlock()
+		if lost {
+			return fmt.Errorf("%s proxy %s is no longer listening on %s", g.settings.Type, g.settings.Name, g.spec)
+		}
+	}
+	return nil
+}
+
+// NewListenerGroup creates the sockets of a listener; connections are served with settings,
+// wrapped in TLS if tlsConfig is not nil
+func NewListenerGroup(spec ListenSpec, settings Listener, tlsConfig *tls.Config) *ListenerGroup {
+	return &ListenerGroup{
+		spec:      spec,
+		settings:  settings,
+		tlsConfig: tlsConfig,
+		failed:    make(chan error, 1),
+		done:      make(chan struct{}),
+		sockets:   make(map[socketAddr]net.Listener),
+	}
+}
+
+// Open binds every resolved address and starts accepting connections
+// It fails without keeping any socket open if an address cannot be bound
+func (g *ListenerGroup) Open() error {
+	addrs, err := g.spec.resolve()
+	if err != nil {
+		return err
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, addr := range addrs {
+		if err := g.bind(addr); err != nil {
+			for _, socket := range g.sockets {
+				socket.Close()
+			}
+			g.sockets = make(map[socketAddr]net.Listener)
+			return err
+		}
+	}
+	if g.spec.Dynamic() {
+		go g.watchInterfaces()
+	}
+	openGroups.add(g)
+	return nil
+}
+
+// bind opens one socket and serves its connections (caller holds g.mu)
+// A socket handed over by the process this one upgraded is taken over instead of opened
+func (g *ListenerGroup) bind(addr socketAddr) error {
+	socket, err := upgrade.Listen(addr.network, addr.address)
+	if err != nil {
+		return err
+	}
+	if g.tlsConfig != nil {
+		socket = tls.NewListener(socket, g.tlsConfig)
+	}
+	g.sockets[addr] = socket
+	go g.serve(addr, socket)
+	return nil
+}
+
+// serve accepts connections on a socket until it is closed or keeps failing
+func (g *ListenerGroup) serve(addr socketAddr, socket net.Listener) {
+	consecutiveErrors := 0
+	for {
+		conn, err := socket.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			logger.Error("%s proxy %s accept failed on %s: %v", g.settings.Type, g.settings.Name, addr.address, err)
+			consecutiveErrors++
+			if consecutiveErrors >= constants.MaxConsecutiveAcceptErrors {
+				g.mu.Lock()
+				if g.sockets[addr] == socket {
+					delete(g.sockets, addr)
+				}
+				g.mu.Unlock()
+				socket.Close()
+				select {
+				case g.failed <- fmt.Errorf("too many consecutive accept errors on %s: %w", addr.address, err):
+				default:
+				}
+				return
+			}
+			time.Sleep(constants.AcceptErrorBackoff)
+			continue
+		}
+		consecutiveErrors = 0
+		go HandleConnection(conn, g.settings)
+	}
+}
+
+// watchInterfaces re-resolves the spec until the group is closed
+func (g *ListenerGroup) watchInterfaces() {
+	ticker := time.NewTicker(constants.InterfaceWatchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-g.done:
+			return
+		case <-ticker.C:
+			g.Refresh()
+		}
+	}
+}
+
+// Refresh re-resolves the spec, closing the sockets of addresses that went away and binding new ones
+// Addresses that fail to bind are retried on the next refresh
+func (g *ListenerGroup) Refresh() {
+	addrs, err := g.spec.resolve()
+	if err != nil {
+		// The interface lost its addresses or went away; its sockets no longer receive connections
+		addrs = nil
+	}
+	wanted := make(map[socketAddr]bool, len(addrs))
+	for _, addr := range addrs {
+		wanted[addr] = true
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.closed {
+		return
+	}
+	for addr, socket := range g.sockets {
+		if !wanted[addr] {
+			socket.Close()
+			delete(g.sockets, addr)
+			logger.Info("%s proxy %s stopped listening on %s", g.settings.Type, g.settings.Name, addr.address)
+		}
+	}
+	for _, addr := range addrs {
+		if _, ok := g.sockets[addr]; ok {
+			continue
+		}
+		if err := g.bind(addr); err != nil {
+			logger.Warn("%s proxy %s failed to listen on %s: %v", g.settings.Type, g.settings.Name, addr.address, err)
+			continue
+		}
+		logger.Info("%s proxy %s listening on %s", g.settings.Type, g.settings.Name, addr.address)
+	}
+	if len(g.sockets) == 0 && err != nil {
+		logger.Warn("%s proxy %s has no addresses to listen on: %v", g.settings.Type, g.settings.Name, err)
+	}
+}
+
+// Addresses returns the addresses the group is listening on
+func (g *ListenerGroup) Addresses() []string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	addresses := make([]string, 0, len(g.sockets))
+	for _, socket := range g.sockets {
+		addresses = append(addresses, socket.Addr().String())
+	}
+	sort.Strings(addresses)
+	return addresses
+}
+
+// String lists the addresses the group is listening on for log messages
+func (g *ListenerGroup) String() string {
+	return strings.Join(g.Addresses(), ", ")
+}
+
+// Failed receives an error when a socket is given up after too many consecutive accept errors
+func (g *ListenerGroup) Failed() <-chan error {
+	return g.failed
+}
+
+// Close closes every socket and stops following interface changes
+func (g *ListenerGroup) Close() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.closed {
+		return
+	}
+	g.closed = true
+	close(g.done)
+	openGroups.remove(g)
+	for addr, socket := range g.sockets {
+		socket.Close()
+		delete(g.sockets, addr)
+	}
+}
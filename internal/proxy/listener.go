@@ -0,0 +1,38 @@
+package proxy
+
+import (
+	"net"
+
+	"go-proxy-server/internal/auth"
+	"go-proxy-server/internal/config"
+)
+
+// Listener describes the listener a client connection was accepted by
+type Listener struct {
+	Name       string // Used by access rules, bandwidth limits and connection limits
+	Type       string // config.ListenerSOCKS5 or config.ListenerHTTP
+	BindListen bool   // Use the connection's local address for outbound connections
+	AuthMode   string // One of the config.AuthMode* values (empty = default)
+}
+
+// HandleConnection serves a client connection with the protocol of its listener
+func HandleConnection(conn net.Conn, listener Listener) {
+	switch listener.Type {
+	case config.ListenerSOCKS5:
+		HandleSocks5Connection(conn, listener)
+	case config.ListenerHTTP:
+		HandleHTTPConnection(conn, listener)
+	default:
+		conn.Close()
+	}
+}
+
+// whitelistAdmits reports whether the listener's authentication mode admits the client through the IP whitelist
+func (s *session) whitelistAdmits() bool {
+	return s.authMode != config.AuthModePassword && auth.CheckIPWhitelist(s.clientIP)
+}
+
+// passwordAllowed reports whether the listener's authentication mode accepts username/password authentication
+func (s *session) passwordAllowed() bool {
+	return s.authMode != config.AuthModeWhitelist
+}
@@ -0,0 +1,220 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"go-proxy-server/internal/auth"
+	"go-proxy-server/internal/config"
+	"go-proxy-server/internal/metrics"
+	"go-proxy-server/internal/quota"
+)
+
+// session describes the client behind a proxied connection
+// It is passed to the data transfer path so traffic can be attributed to a user
+type session struct {
+	id       uint64 // Connection ID in the registry of open connections
+	clientIP string
+	listener string // Name of the listener that accepted the connection
+	authMode string // Authentication mode of the listener
+	username string // Empty for whitelisted (unauthenticated) clients
+	group    string // User group reported by the authentication backend
+
+	whitelisted bool // Admitted through the IP whitelist
+
+	// Bandwidth buckets shared with other sessions of the same scope
+	listenerBuckets *bucketPair
+	ipBuckets       *bucketPair
+	userBuckets     *bucketPair
+
+	// Session attributes granted by the authentication backend
+	grantBuckets *bucketPair             // Bandwidth granted to this session only (nil = none)
+	expiresAt    time.Time               // End of the granted session time (zero = unlimited)
+	egressIP     net.IP                  // Local address for outbound connections (nil = default)
+	accounting   *auth.AccountingSession // RADIUS accounting of the session (nil = none)
+	bytesIn      atomic.Int64            // Bytes received from the client
+	bytesOut     atomic.Int64            // Bytes sent to the client
+
+	// Drain state: a draining session finishes its current request and closes instead of waiting for the next one
+	idle     atomic.Bool // Waiting for the next request of a keep-alive connection
+	draining atomic.Bool // The listener was stopped; close as soon as the connection is idle
+}
+
+// newSession creates a session for a client connection accepted by the given listener
+// The caller must call close when the connection ends
+func newSession(conn net.Conn, clientIP string, listener Listener) *session {
+	s := &session{
+		clientIP:        clientIP,
+		listener:        listener.Name,
+		authMode:        listener.AuthMode,
+		listenerBuckets: shaper.listener(listener.Name),
+		ipBuckets:       shaper.acquireIP(clientIP),
+	}
+	s.id = connections.add(s, func() { conn.Close() })
+	return s
+}
+
+// enterIdle marks a keep-alive connection as waiting for its next request
+// Returns true if the listener is draining and the connection should be closed instead
+func (s *session) enterIdle() bool {
+	s.idle.Store(true)
+	return s.draining.Load()
+}
+
+// setUser attributes the session to an authenticated user
+// Returns an error when the user's connection limits reject the connection
+// A user authenticating again (e.g. for a new destination of a keep-alive connection) keeps its connection slot
+// and buckets, but the grant of the new login replaces the previous one
+func (s *session) setUser(result *auth.Result) error {
+	username := result.Username
+	s.group = result.Group
+	if s.username == username {
+		s.accounting.Stop(auth.StopUserRequest)
+		s.applyGrant(result)
+		return nil
+	}
+	if err := userLimiter.Acquire(username); err != nil {
+		return err
+	}
+	if s.username != "" {
+		s.releaseUser()
+	}
+	s.username = username
+	connections.setUser(s.id, username)
+	s.userBuckets = shaper.acquireUser(username)
+	s.applyGrant(result)
+	return nil
+}
+
+// applyGrant applies the session time, egress address and bandwidth granted by the authentication backend
+// and starts accounting the session's traffic from this point on
+func (s *session) applyGrant(result *auth.Result) {
+	s.expiresAt = time.Time{}
+	if result.SessionTimeout > 0 {
+		s.expiresAt = time.Now().Add(result.SessionTimeout)
+	}
+	s.egressIP = net.ParseIP(result.EgressIP)
+	s.grantBuckets = nil
+	if result.UploadRate > 0 || result.DownloadRate > 0 {
+		s.grantBuckets = newBucketPair(result.UploadRate, result.DownloadRate, config.GetBandwidthConfig().Burst)
+	}
+
+	baseIn, baseOut := s.bytesIn.Load(), s.bytesOut.Load()
+	s.accounting = result.StartAccounting(s.clientIP, func() (int64, int64) {
+		return s.bytesIn.Load() - baseIn, s.bytesOut.Load() - baseOut
+	})
+}
+
+// expired reports whether the session time granted by the authentication backend is used up
+func (s *session) expired() bool {
+	return s != nil && !s.expiresAt.IsZero() && !time.Now().Before(s.expiresAt)
+}
+
+// releaseUser releases the per-user resources held by the session
+func (s *session) releaseUser() {
+	userLimiter.Release(s.username)
+	shaper.releaseUser(s.username)
+
+	cause := auth.StopUserRequest
+	if s.expired() {
+		cause = auth.StopSessionTimeout
+	}
+	s.accounting.Stop(cause)
+	s.accounting = nil
+}
+
+// close releases the shared resources held by the session
+func (s *session) close() {
+	connections.remove(s.id)
+	shaper.releaseIP(s.clientIP)
+	if s.username != "" {
+		s.releaseUser()
+	}
+}
+
+// quotaExceeded reports whether the session's user has used up a traffic quota
+func (s *session) quotaExceeded() bool {
+	if s == nil || s.username == "" {
+		return false
+	}
+	if manager := quota.GetManager(); manager != nil {
+		return manager.Exceeded(s.username)
+	}
+	return false
+}
+
+// recordTransfer accounts n transferred bytes to metrics and the user's quota
+// Returns quota.ErrQuotaExceeded when the transfer must be stopped
+func (s *session) recordTransfer(n int, isUpload bool) error {
+	if s != nil {
+		if isUpload {
+			s.bytesIn.Add(int64(n))
+		} else {
+			s.bytesOut.Add(int64(n))
+		}
+	}
+	if collector := metrics.GetCollector(); collector != nil {
+		if isUpload {
+			// Client -> Server: record as sent (upload)
+			collector.RecordBytesSent(int64(n))
+		} else {
+			// Server -> Client: record as received (download)
+			collector.RecordBytesReceived(int64(n))
+		}
+	}
+
+	if s == nil || s.username == "" {
+		return nil
+	}
+	if manager := quota.GetManager(); manager != nil {
+		return manager.Record(s.username, int64(n), isUpload)
+	}
+	return nil
+}
+
+// meteredWriter counts bytes written through it against a session
+// Used for the plain HTTP forwarding path, which does not go through copyWithIdleTimeout
+type meteredWriter struct {
+	w        io.Writer
+	sess     *session
+	isUpload bool
+}
+
+// Write writes p and records the written bytes
+func (mw *meteredWriter) Write(p []byte) (int, error) {
+	n, err := mw.w.Write(p)
+	if n > 0 {
+		if recErr := mw.sess.recordTransfer(n, mw.isUpload); recErr != nil && err == nil {
+			err = recErr
+		}
+		if waitErr := mw.sess.throttle(context.Background(), n, mw.isUpload); waitErr != nil && err == nil {
+			err = waitErr
+		}
+	}
+	return n, err
+}
+
+// meteredReadCloser counts bytes read through it against a session
+// Used to account request bodies forwarded on the plain HTTP path
+type meteredReadCloser struct {
+	io.ReadCloser
+	sess     *session
+	isUpload bool
+}
+
+// Read reads into p and records the read bytes
+func (mr *meteredReadCloser) Read(p []byte) (int, error) {
+	n, err := mr.ReadCloser.Read(p)
+	if n > 0 {
+		if recErr := mr.sess.recordTransfer(n, mr.isUpload); recErr != nil && err == nil {
+			err = recErr
+		}
+		if waitErr := mr.sess.throttle(context.Background(), n, mr.isUpload); waitErr != nil && err == nil {
+			err = waitErr
+		}
+	}
+	return n, err
+}
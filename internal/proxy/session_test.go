@@ -0,0 +1,49 @@
+package proxy
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"go-proxy-server/internal/auth"
+)
+
+func TestSetUserReplacesGrant(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	sess := newSession(server, "192.0.2.1", Listener{Name: "http"})
+	defer sess.close()
+
+	// The same user logs in again on a keep-alive connection for a destination with another grant
+	grants := []struct {
+		name     string
+		result   auth.Result
+		egressIP string
+		timeout  bool
+		buckets  bool
+	}{
+		{name: "first destination", result: auth.Result{Username: "alice", EgressIP: "198.51.100.1", UploadRate: 1024}, egressIP: "198.51.100.1", buckets: true},
+		{name: "second destination", result: auth.Result{Username: "alice", EgressIP: "198.51.100.2", SessionTimeout: time.Hour}, egressIP: "198.51.100.2", timeout: true},
+		{name: "third destination", result: auth.Result{Username: "alice"}},
+	}
+	for _, tt := range grants {
+		result := tt.result
+		if err := sess.setUser(&result); err != nil {
+			t.Fatalf("%s: setUser() error = %v", tt.name, err)
+		}
+		if !sess.egressIP.Equal(net.ParseIP(tt.egressIP)) {
+			t.Errorf("%s: egressIP = %v, want %q", tt.name, sess.egressIP, tt.egressIP)
+		}
+		if got := !sess.expiresAt.IsZero(); got != tt.timeout {
+			t.Errorf("%s: session timeout set = %v, want %v", tt.name, got, tt.timeout)
+		}
+		if got := sess.grantBuckets != nil; got != tt.buckets {
+			t.Errorf("%s: granted bandwidth = %v, want %v", tt.name, got, tt.buckets)
+		}
+	}
+
+	// Logging in again does not take another connection slot
+	if usage := userLimiter.GetUsage("alice"); usage.ActiveConnections != 1 {
+		t.Errorf("active connections = %d, want 1", usage.ActiveConnections)
+	}
+}
@@ -1,7 +1,6 @@
 package proxy
 
 import (
-	"context"
 	"encoding/binary"
 	"fmt"
 	"io"
@@ -10,11 +9,11 @@ import (
 	"sync"
 	"time"
 
+	"go-proxy-server/internal/acl"
 	"go-proxy-server/internal/auth"
 	"go-proxy-server/internal/config"
 	"go-proxy-server/internal/logger"
 	"go-proxy-server/internal/metrics"
-	"go-proxy-server/internal/security"
 )
 
 // SOCKS5 protocol constants
@@ -58,7 +57,7 @@ const (
 	maxDomainLen    = 255 // RFC 1035: maximum domain name length
 )
 
-func HandleSocks5Connection(conn net.Conn, bindListen bool) {
+func HandleSocks5Connection(conn net.Conn, listener Listener) {
 	defer conn.Close()
 
 	// Record connection
@@ -79,15 +78,19 @@ func HandleSocks5Connection(conn net.Conn, bindListen bool) {
 	clientIP := clientAddr.IP.String()
 
 	// Apply connection rate limiting
-	limiter := GetSOCKS5Limiter()
-	if !limiter.Acquire(clientIP) {
-		logger.Warn("Connection limit reached for IP %s", clientIP)
+	limiter := GetListenerLimiter(listener.Name)
+	slot, err := limiter.Acquire(clientIP)
+	if err != nil {
+		logger.Warn("Connection rejected for IP %s: %v", clientIP, err)
 		if collector := metrics.GetCollector(); collector != nil {
 			collector.RecordError()
 		}
 		return
 	}
-	defer limiter.Release(clientIP)
+	defer slot.Release()
+
+	sess := newSession(conn, clientIP, listener)
+	defer sess.close()
 
 	// Initial version/method negotiation
 	methods, err := readMethods(conn)
@@ -105,13 +108,21 @@ func HandleSocks5Connection(conn net.Conn, bindListen bool) {
 	localAddr := &net.TCPAddr{IP: tcpLocalAddr.IP}
 
 	// Check if the client's IP address is in the whitelist first
-	if auth.CheckIPWhitelist(clientIP) {
-		// IP in whitelist, no authentication required
+	if sess.whitelistAdmits() {
+		// IP in whitelist, no authentication required unless outside its access schedule
+		sess.whitelisted = true
+		if !sess.scheduleAllowed() {
+			logger.Info("Connection from whitelisted %s rejected outside its access schedule", clientIP)
+			if _, err := conn.Write([]byte{socks5Version, authMethodNoAcceptable}); err != nil {
+				logger.Error("Failed to write response: %v", err)
+			}
+			return
+		}
 		if _, err := conn.Write([]byte{socks5Version, authMethodNoAuth}); err != nil {
 			logger.Error("Failed to write response: %v", err)
 			return
 		}
-	} else if isAuthMethodSupported(methods) {
+	} else if sess.passwordAllowed() && isAuthMethodSupported(methods) {
 		// Not in whitelist, but supports authentication
 		if _, err := conn.Write([]byte{socks5Version, authMethodUserPassword}); err != nil {
 			logger.Error("Failed to write response: %v", err)
@@ -119,7 +130,8 @@ func HandleSocks5Connection(conn net.Conn, bindListen bool) {
 		}
 
 		// Read the Username/Password authentication request
-		if err = readAuthenticationRequest(conn); err != nil {
+		result, err := readAuthenticationRequest(conn, sess)
+		if err != nil {
 			logger.Info("Authentication failed from %s: %v", clientIP, err)
 			// Send authentication failure response
 			if _, err := conn.Write([]byte{authSubVersion, 0x01}); err != nil {
@@ -128,6 +140,20 @@ func HandleSocks5Connection(conn net.Conn, bindListen bool) {
 			return
 		}
 
+		// Check whether the user may use this listener now, then enforce per-user connection limits before reporting success
+		username := result.Username
+		err = sess.checkLogin(result)
+		if err == nil {
+			err = sess.setUser(result)
+		}
+		if err != nil {
+			logger.Info("Connection rejected for user %s from %s: %v", username, clientIP, err)
+			if _, err := conn.Write([]byte{authSubVersion, 0x01}); err != nil {
+				logger.Error("Failed to write response: %v", err)
+			}
+			return
+		}
+
 		// Send the authentication response with success
 		if _, err := conn.Write([]byte{authSubVersion, replySuccess}); err != nil {
 			logger.Error("Failed to write response: %v", err)
@@ -143,7 +169,7 @@ func HandleSocks5Connection(conn net.Conn, bindListen bool) {
 	}
 
 	// Read the SOCKS5 request
-	host, err := readSocks5Request(conn)
+	command, host, err := readSocks5Request(conn)
 	if err != nil {
 		logger.Error("Failed to read SOCKS5 request: %v", err)
 		// Determine error code based on error type
@@ -156,8 +182,28 @@ func HandleSocks5Connection(conn net.Conn, bindListen bool) {
 		return
 	}
 
+	// Reject new connections from users who have used up their traffic quota
+	if sess.quotaExceeded() {
+		logger.Info("Traffic quota exceeded for user %s from %s", sess.username, clientIP)
+		sendSocks5Reply(conn, replyConnectionNotAllowed)
+		return
+	}
+
+	// Apply the user's access rules
+	if err := sess.checkRequest(socks5CommandName(command), host); err != nil {
+		logger.Info("Request rejected for user %s from %s: %v", sess.username, clientIP, err)
+		sendSocks5Reply(conn, replyConnectionNotAllowed)
+		return
+	}
+
+	// Only CONNECT is implemented
+	if command != cmdConnect {
+		sendSocks5Reply(conn, replyCommandNotSupported)
+		return
+	}
+
 	// Check for SSRF attacks (prevent access to private IPs)
-	if err := security.CheckSSRF(host); err != nil {
+	if err := sess.checkSSRF(host); err != nil {
 		// Don't log the error details to avoid leaking target host information
 		logger.Info("SSRF protection triggered for connection from %s", clientIP)
 		sendSocks5Reply(conn, replyConnectionNotAllowed)
@@ -169,8 +215,8 @@ func HandleSocks5Connection(conn net.Conn, bindListen bool) {
 	dialer := &net.Dialer{
 		Timeout: timeout.Connect,
 	}
-	if bindListen {
-		dialer.LocalAddr = localAddr
+	if addr := sess.outboundAddr(listener.BindListen, localAddr); addr != nil {
+		dialer.LocalAddr = addr
 	}
 	destConn, err := dialer.Dial("tcp", host)
 
@@ -202,7 +248,7 @@ func HandleSocks5Connection(conn net.Conn, bindListen bool) {
 	defer destConn.Close()
 
 	// Verify connected IP to prevent DNS rebinding attacks
-	if err := security.VerifyConnectedIP(destConn); err != nil {
+	if err := sess.verifyConnectedIP(destConn); err != nil {
 		// Don't log the error details to avoid leaking target IP information
 		logger.Info("DNS rebinding protection triggered for connection from %s", clientIP)
 		sendSocks5Reply(conn, replyConnectionNotAllowed)
@@ -212,8 +258,8 @@ func HandleSocks5Connection(conn net.Conn, bindListen bool) {
 	// Send success response to the client
 	sendSocks5Reply(conn, replySuccess)
 
-	// Create context for cancellation with maximum connection age
-	ctx, cancel := context.WithTimeout(context.Background(), timeout.MaxConnectionAge)
+	// Create context for cancellation with maximum connection age (and schedule window end)
+	ctx, cancel := sess.tunnelContext(timeout.MaxConnectionAge)
 	defer cancel()
 
 	// Copy data between client and destination with idle timeout
@@ -224,7 +270,7 @@ func HandleSocks5Connection(conn net.Conn, bindListen bool) {
 	// Client to destination (upload)
 	go func() {
 		defer wg.Done()
-		err := copyWithIdleTimeout(ctx, destConn, conn, timeout.IdleRead, timeout.IdleWrite, true)
+		err := copyWithIdleTimeout(ctx, destConn, conn, timeout.IdleRead, timeout.IdleWrite, true, sess)
 		if tcpConn, ok := destConn.(*net.TCPConn); ok {
 			tcpConn.CloseWrite()
 		}
@@ -234,7 +280,7 @@ func HandleSocks5Connection(conn net.Conn, bindListen bool) {
 	// Destination to client (download)
 	go func() {
 		defer wg.Done()
-		err := copyWithIdleTimeout(ctx, conn, destConn, timeout.IdleRead, timeout.IdleWrite, false)
+		err := copyWithIdleTimeout(ctx, conn, destConn, timeout.IdleRead, timeout.IdleWrite, false, sess)
 		if tcpConn, ok := conn.(*net.TCPConn); ok {
 			tcpConn.CloseWrite()
 		}
@@ -311,80 +357,90 @@ func isAuthMethodSupported(methods []byte) bool {
 	return false
 }
 
-func readAuthenticationRequest(conn net.Conn) error {
+// readAuthenticationRequest reads and verifies a username/password request
+// Returns the authentication result on success
+func readAuthenticationRequest(conn net.Conn, sess *session) (*auth.Result, error) {
 	// Get buffer from pool
 	buffer := bufferPool.Get().([]byte)
 	defer bufferPool.Put(buffer)
 
 	if _, err := io.ReadFull(conn, buffer[:1]); err != nil {
-		return err
+		return nil, err
 	}
 
 	// Verify authentication sub-protocol version (should be 0x01)
 	if buffer[0] != authSubVersion {
-		return fmt.Errorf("unsupported authentication version: 0x%02x", buffer[0])
+		return nil, fmt.Errorf("unsupported authentication version: 0x%02x", buffer[0])
 	}
 
 	var uLen, pLen byte
 	if err := binary.Read(conn, binary.BigEndian, &uLen); err != nil {
-		return err
+		return nil, err
 	}
 
 	// Validate username length (reasonable limit: 1-maxUsernameLen bytes)
 	if uLen < 1 {
-		return fmt.Errorf("invalid username length: %d (must be at least 1)", uLen)
+		return nil, fmt.Errorf("invalid username length: %d (must be at least 1)", uLen)
 	}
 	if uLen > maxUsernameLen {
-		return fmt.Errorf("invalid username length: %d (maximum %d allowed)", uLen, maxUsernameLen)
+		return nil, fmt.Errorf("invalid username length: %d (maximum %d allowed)", uLen, maxUsernameLen)
 	}
 
 	usernameBytes := make([]byte, uLen)
 	_, err := io.ReadFull(conn, usernameBytes)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	username := string(usernameBytes)
 
 	if err = binary.Read(conn, binary.BigEndian, &pLen); err != nil {
-		return err
+		return nil, err
 	}
 
 	// Validate password length (reasonable limit: 1-maxPasswordLen bytes)
 	if pLen < 1 {
-		return fmt.Errorf("invalid password length: %d (must be at least 1)", pLen)
+		return nil, fmt.Errorf("invalid password length: %d (must be at least 1)", pLen)
 	}
 	if pLen > maxPasswordLen {
-		return fmt.Errorf("invalid password length: %d (maximum %d allowed)", pLen, maxPasswordLen)
+		return nil, fmt.Errorf("invalid password length: %d (maximum %d allowed)", pLen, maxPasswordLen)
 	}
 
 	passwordBytes := make([]byte, pLen)
 	_, err = io.ReadFull(conn, passwordBytes)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	// Verify credentials without caching (security fix)
-	return auth.VerifyCredentials(username, passwordBytes)
+	// Verify credentials with the configured authentication backends
+	// The destination is not known yet: SOCKS5 authenticates before the request
+	return auth.Authenticate(&auth.Request{
+		Username: username,
+		Password: passwordBytes,
+		ClientIP: sess.clientIP,
+		Listener: sess.listener,
+	})
 }
 
-func readSocks5Request(conn net.Conn) (string, error) {
+// readSocks5Request reads a SOCKS5 request and returns its command and "host:port" destination
+func readSocks5Request(conn net.Conn) (byte, string, error) {
 	// Get buffer from pool
 	buffer := bufferPool.Get().([]byte)
 	defer bufferPool.Put(buffer)
 
 	_, err := io.ReadFull(conn, buffer[:4])
 	if err != nil {
-		return "", err
+		return 0, "", err
 	}
 
 	// Check SOCKS5 version
 	if buffer[0] != socks5Version {
-		return "", fmt.Errorf("unsupported SOCKS version: %d", buffer[0])
+		return 0, "", fmt.Errorf("unsupported SOCKS version: %d", buffer[0])
 	}
 
-	// Check CMD field - only support CONNECT (0x01)
-	if buffer[1] != cmdConnect {
-		return "", fmt.Errorf("unsupported command: %d (only CONNECT is supported)", buffer[1])
+	// Check CMD field
+	command := buffer[1]
+	if command != cmdConnect && command != cmdBind && command != cmdUDPAssociate {
+		return 0, "", fmt.Errorf("unsupported command: %d", command)
 	}
 
 	// Parse the destination address
@@ -394,47 +450,59 @@ func readSocks5Request(conn net.Conn) (string, error) {
 		ip := make([]byte, 4)
 		_, err = io.ReadFull(conn, ip)
 		if err != nil {
-			return "", err
+			return 0, "", err
 		}
 		host = net.IP(ip).String()
 	case addrTypeDomain: // Domain name
 		var domainLen byte
 		if err := binary.Read(conn, binary.BigEndian, &domainLen); err != nil {
-			return "", err
+			return 0, "", err
 		}
 		// Validate domain length (must be between 1 and 255 per SOCKS5 and DNS specs)
 		if domainLen < 1 {
-			return "", fmt.Errorf("invalid domain length: %d (must be at least 1)", domainLen)
+			return 0, "", fmt.Errorf("invalid domain length: %d (must be at least 1)", domainLen)
 		}
 		if domainLen > maxDomainLen {
-			return "", fmt.Errorf("invalid domain length: %d (maximum %d allowed)", domainLen, maxDomainLen)
+			return 0, "", fmt.Errorf("invalid domain length: %d (maximum %d allowed)", domainLen, maxDomainLen)
 		}
 		domainBytes := make([]byte, domainLen)
 		_, err = io.ReadFull(conn, domainBytes)
 		if err != nil {
-			return "", err
+			return 0, "", err
 		}
 		host = string(domainBytes)
 	case addrTypeIPv6: // IPv6 address
 		ip := make([]byte, 16)
 		_, err = io.ReadFull(conn, ip)
 		if err != nil {
-			return "", err
+			return 0, "", err
 		}
 		host = net.IP(ip).String()
 	default:
-		return "", fmt.Errorf("unsupported address type: 0x%02x", buffer[3])
+		return 0, "", fmt.Errorf("unsupported address type: 0x%02x", buffer[3])
 	}
 
 	// Parse the destination port
 	portBytes := make([]byte, 2)
 	_, err = io.ReadFull(conn, portBytes)
 	if err != nil {
-		return "", err
+		return 0, "", err
 	}
 	port := binary.BigEndian.Uint16(portBytes)
 
-	return fmt.Sprintf("%s:%d", host, port), nil
+	return command, fmt.Sprintf("%s:%d", host, port), nil
+}
+
+// socks5CommandName maps a SOCKS5 command code to its access rule name
+func socks5CommandName(command byte) string {
+	switch command {
+	case cmdBind:
+		return acl.CommandBind
+	case cmdUDPAssociate:
+		return acl.CommandUDP
+	default:
+		return acl.CommandConnect
+	}
 }
 
 // sendSocks5Reply sends a SOCKS5 reply message with the specified reply code
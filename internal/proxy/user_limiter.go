@@ -0,0 +1,142 @@
+package proxy
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"go-proxy-server/internal/config"
+	"go-proxy-server/internal/ratelimit"
+)
+
+// Errors returned by UserLimiter.Acquire
+var (
+	ErrUserConnectionLimit = errors.New("user concurrent connection limit reached")
+	ErrUserRateLimit       = errors.New("user new connection rate limit reached")
+)
+
+// userConnState tracks the connections of a single user
+type userConnState struct {
+	active    int32
+	perSecond *ratelimit.WindowCounter
+	perMinute *ratelimit.WindowCounter
+}
+
+// UserConnectionUsage reports a user's current connection usage and effective limits
+type UserConnectionUsage struct {
+	Username          string `json:"username"`
+	ActiveConnections int32  `json:"activeConnections"`
+	NewLastSecond     int32  `json:"newLastSecond"`
+	NewLastMinute     int32  `json:"newLastMinute"`
+}
+
+// UserLimiter limits concurrent connections and new-connection rates per authenticated user
+// Unlike ConnectionLimiter it is shared by all listeners, since a user may connect to any of them
+type UserLimiter struct {
+	mu    sync.Mutex
+	users map[string]*userConnState
+}
+
+// NewUserLimiter creates a new per-user connection limiter
+func NewUserLimiter() *UserLimiter {
+	return &UserLimiter{
+		users: make(map[string]*userConnState),
+	}
+}
+
+// Global per-user limiter instance
+var userLimiter = NewUserLimiter()
+
+// GetUserLimiter returns the global per-user connection limiter
+func GetUserLimiter() *UserLimiter {
+	return userLimiter
+}
+
+// Acquire attempts to take a connection slot for the user
+// Limits are read on every call, so overrides and default changes apply to new connections immediately
+func (ul *UserLimiter) Acquire(username string) error {
+	limits := config.GetUserLimits(username)
+
+	ul.mu.Lock()
+	defer ul.mu.Unlock()
+
+	state, ok := ul.users[username]
+	if !ok {
+		state = &userConnState{
+			perSecond: ratelimit.NewWindowCounter(time.Second),
+			perMinute: ratelimit.NewWindowCounter(time.Minute),
+		}
+		ul.users[username] = state
+	}
+
+	if limits.MaxConnections > 0 && state.active >= limits.MaxConnections {
+		return ErrUserConnectionLimit
+	}
+	// Both windows are checked before either counts the attempt, so rejected attempts use up neither
+	if !state.perSecond.Check(limits.MaxConnectionsPerSecond) || !state.perMinute.Check(limits.MaxConnectionsPerMinute) {
+		return ErrUserRateLimit
+	}
+	state.perSecond.Record()
+	state.perMinute.Record()
+
+	state.active++
+	return nil
+}
+
+// Release releases a connection slot taken by Acquire
+func (ul *UserLimiter) Release(username string) {
+	ul.mu.Lock()
+	defer ul.mu.Unlock()
+
+	state, ok := ul.users[username]
+	if !ok {
+		return
+	}
+	if state.active > 0 {
+		state.active--
+	}
+	// Drop idle users once their rate windows have passed to prevent memory growth
+	if state.active == 0 && state.perMinute.Expired() {
+		delete(ul.users, username)
+	}
+}
+
+// GetUsage returns the connection usage of a single user
+func (ul *UserLimiter) GetUsage(username string) UserConnectionUsage {
+	ul.mu.Lock()
+	defer ul.mu.Unlock()
+
+	usage := UserConnectionUsage{Username: username}
+	if state, ok := ul.users[username]; ok {
+		usage.ActiveConnections = state.active
+		usage.NewLastSecond = state.perSecond.Count()
+		usage.NewLastMinute = state.perMinute.Count()
+	}
+	return usage
+}
+
+// Snapshot returns the connection usage of all tracked users sorted by username
+func (ul *UserLimiter) Snapshot() []UserConnectionUsage {
+	ul.mu.Lock()
+	defer ul.mu.Unlock()
+
+	result := make([]UserConnectionUsage, 0, len(ul.users))
+	for username, state := range ul.users {
+		if state.active == 0 && state.perMinute.Expired() {
+			// Idle entry left behind by a rejected attempt
+			delete(ul.users, username)
+			continue
+		}
+		result = append(result, UserConnectionUsage{
+			Username:          username,
+			ActiveConnections: state.active,
+			NewLastSecond:     state.perSecond.Count(),
+			NewLastMinute:     state.perMinute.Count(),
+		})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Username < result[j].Username
+	})
+	return result
+}
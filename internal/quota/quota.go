@@ -0,0 +1,406 @@
+package quota
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	"go-proxy-server/internal/logger"
+	"go-proxy-server/internal/models"
+)
+
+// Reset periods accepted by Reset
+const (
+	PeriodDaily   = "daily"
+	PeriodMonthly = "monthly"
+	PeriodTotal   = "total"
+	PeriodAll     = "all"
+)
+
+// ErrQuotaExceeded is returned when a user has used up one of their traffic quotas
+var ErrQuotaExceeded = errors.New("traffic quota exceeded")
+
+// Limits holds the configurable quota limits for a user (bytes, 0 = unlimited)
+type Limits struct {
+	DailyLimit   int64 `json:"dailyLimit"`
+	MonthlyLimit int64 `json:"monthlyLimit"`
+	TotalLimit   int64 `json:"totalLimit"`
+}
+
+// Usage is a point-in-time view of a user's quota and usage
+type Usage struct {
+	Username      string `json:"username"`
+	DailyLimit    int64  `json:"dailyLimit"`
+	MonthlyLimit  int64  `json:"monthlyLimit"`
+	TotalLimit    int64  `json:"totalLimit"`
+	DailyUsed     int64  `json:"dailyUsed"`
+	MonthlyUsed   int64  `json:"monthlyUsed"`
+	TotalUsed     int64  `json:"totalUsed"`
+	UploadBytes   int64  `json:"uploadBytes"`
+	DownloadBytes int64  `json:"downloadBytes"`
+	DayStart      int64  `json:"dayStart"`
+	MonthStart    int64  `json:"monthStart"`
+	Exceeded      bool   `json:"exceeded"`
+}
+
+// userQuota is the in-memory state of a single user's quota
+type userQuota struct {
+	mu    sync.Mutex
+	row   models.UserQuota
+	dirty bool
+}
+
+// exceeded reports whether any configured limit has been reached (caller holds mu)
+func (q *userQuota) exceeded() bool {
+	r := &q.row
+	return (r.DailyLimit > 0 && r.DailyUsed >= r.DailyLimit) ||
+		(r.MonthlyLimit > 0 && r.MonthlyUsed >= r.MonthlyLimit) ||
+		(r.TotalLimit > 0 && r.TotalUsed >= r.TotalLimit)
+}
+
+// rollover resets period counters whose period has ended (caller holds mu)
+func (q *userQuota) rollover(now time.Time) {
+	dayStart := startOfDay(now).Unix()
+	if q.row.DayStart != dayStart {
+		q.row.DayStart = dayStart
+		q.row.DailyUsed = 0
+		q.dirty = true
+	}
+	monthStart := startOfMonth(now).Unix()
+	if q.row.MonthStart != monthStart {
+		q.row.MonthStart = monthStart
+		q.row.MonthlyUsed = 0
+		q.dirty = true
+	}
+}
+
+// usage converts the in-memory state to a Usage view (caller holds mu)
+func (q *userQuota) usage() Usage {
+	r := q.row
+	return Usage{
+		Username:      r.Username,
+		DailyLimit:    r.DailyLimit,
+		MonthlyLimit:  r.MonthlyLimit,
+		TotalLimit:    r.TotalLimit,
+		DailyUsed:     r.DailyUsed,
+		MonthlyUsed:   r.MonthlyUsed,
+		TotalUsed:     r.TotalUsed,
+		UploadBytes:   r.UploadBytes,
+		DownloadBytes: r.DownloadBytes,
+		DayStart:      r.DayStart,
+		MonthStart:    r.MonthStart,
+		Exceeded:      q.exceeded(),
+	}
+}
+
+// Manager tracks per-user traffic usage and enforces quotas
+// Usage is accumulated in memory and flushed to the database periodically
+type Manager struct {
+	db            *gorm.DB
+	mu            sync.RWMutex
+	users         map[string]*userQuota
+	flushMu       sync.Mutex // Serializes database writes so new rows are created once
+	flushInterval time.Duration
+	stopChan      chan struct{}
+	stopOnce      sync.Once
+}
+
+var (
+	globalManager *Manager
+	once          sync.Once
+)
+
+// InitManager initializes the global quota manager and loads persisted usage
+func InitManager(db *gorm.DB, flushInterval time.Duration) (*Manager, error) {
+	var initErr error
+	once.Do(func() {
+		m := &Manager{
+			db:            db,
+			users:         make(map[string]*userQuota),
+			flushInterval: flushInterval,
+			stopChan:      make(chan struct{}),
+		}
+		if err := m.load(); err != nil {
+			initErr = err
+			return
+		}
+		globalManager = m
+
+		// Start background flushing
+		go m.backgroundFlush()
+	})
+	return globalManager, initErr
+}
+
+// GetManager returns the global quota manager (nil if not initialized)
+func GetManager() *Manager {
+	return globalManager
+}
+
+// load reads all persisted quotas from the database
+func (m *Manager) load() error {
+	var rows []models.UserQuota
+	if err := m.db.Find(&rows).Error; err != nil {
+		return fmt.Errorf("failed to load user quotas: %w", err)
+	}
+
+	now := time.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, row := range rows {
+		q := &userQuota{row: row}
+		q.rollover(now)
+		m.users[row.Username] = q
+	}
+	return nil
+}
+
+// get returns the quota state for a user, creating it if create is true
+func (m *Manager) get(username string, create bool) *userQuota {
+	m.mu.RLock()
+	q, ok := m.users[username]
+	m.mu.RUnlock()
+	if ok || !create {
+		return q
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if q, ok = m.users[username]; ok {
+		return q
+	}
+	q = &userQuota{row: models.UserQuota{Username: username}, dirty: true}
+	q.rollover(time.Now())
+	m.users[username] = q
+	return q
+}
+
+// Exceeded reports whether the user has reached any of their quota limits
+func (m *Manager) Exceeded(username string) bool {
+	if username == "" {
+		return false
+	}
+	q := m.get(username, false)
+	if q == nil {
+		return false
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.rollover(time.Now())
+	return q.exceeded()
+}
+
+// Record adds transferred bytes to the user's usage
+// Returns ErrQuotaExceeded once any limit has been reached
+func (m *Manager) Record(username string, n int64, isUpload bool) error {
+	if username == "" || n <= 0 {
+		return nil
+	}
+	q := m.get(username, true)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.rollover(time.Now())
+	q.row.DailyUsed += n
+	q.row.MonthlyUsed += n
+	q.row.TotalUsed += n
+	if isUpload {
+		q.row.UploadBytes += n
+	} else {
+		q.row.DownloadBytes += n
+	}
+	q.dirty = true
+
+	if q.exceeded() {
+		return ErrQuotaExceeded
+	}
+	return nil
+}
+
+// SetLimits updates the quota limits for a user and persists them immediately
+func (m *Manager) SetLimits(username string, limits Limits) error {
+	if username == "" {
+		return fmt.Errorf("username is required")
+	}
+	if limits.DailyLimit < 0 || limits.MonthlyLimit < 0 || limits.TotalLimit < 0 {
+		return fmt.Errorf("quota limits must not be negative")
+	}
+	q := m.get(username, true)
+
+	q.mu.Lock()
+	q.row.DailyLimit = limits.DailyLimit
+	q.row.MonthlyLimit = limits.MonthlyLimit
+	q.row.TotalLimit = limits.TotalLimit
+	q.dirty = true
+	q.mu.Unlock()
+
+	return m.flushOne(q)
+}
+
+// Reset clears the usage counters of the given period for a user
+func (m *Manager) Reset(username, period string) error {
+	q := m.get(username, false)
+	if q == nil {
+		return fmt.Errorf("no quota found for user '%s'", username)
+	}
+
+	q.mu.Lock()
+	switch period {
+	case PeriodDaily:
+		q.row.DailyUsed = 0
+	case PeriodMonthly:
+		q.row.MonthlyUsed = 0
+	case PeriodTotal:
+		q.row.TotalUsed = 0
+	case PeriodAll, "":
+		q.row.DailyUsed = 0
+		q.row.MonthlyUsed = 0
+		q.row.TotalUsed = 0
+	default:
+		q.mu.Unlock()
+		return fmt.Errorf("invalid reset period: %s", period)
+	}
+	q.dirty = true
+	q.mu.Unlock()
+
+	return m.flushOne(q)
+}
+
+// Delete removes a user's quota from memory and the database
+func (m *Manager) Delete(username string) error {
+	m.mu.Lock()
+	delete(m.users, username)
+	m.mu.Unlock()
+
+	return m.db.Unscoped().Where("username = ?", username).Delete(&models.UserQuota{}).Error
+}
+
+// GetUsage returns the current quota usage for a user
+func (m *Manager) GetUsage(username string) (Usage, bool) {
+	q := m.get(username, false)
+	if q == nil {
+		return Usage{}, false
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.rollover(time.Now())
+	return q.usage(), true
+}
+
+// ListUsage returns the quota usage of all tracked users sorted by username
+func (m *Manager) ListUsage() []Usage {
+	m.mu.RLock()
+	quotas := make([]*userQuota, 0, len(m.users))
+	for _, q := range m.users {
+		quotas = append(quotas, q)
+	}
+	m.mu.RUnlock()
+
+	now := time.Now()
+	result := make([]Usage, 0, len(quotas))
+	for _, q := range quotas {
+		q.mu.Lock()
+		q.rollover(now)
+		result = append(result, q.usage())
+		q.mu.Unlock()
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Username < result[j].Username
+	})
+	return result
+}
+
+// flushOne persists a single user's quota if it has pending changes
+func (m *Manager) flushOne(q *userQuota) error {
+	m.flushMu.Lock()
+	defer m.flushMu.Unlock()
+
+	q.mu.Lock()
+	if !q.dirty {
+		q.mu.Unlock()
+		return nil
+	}
+	row := q.row
+	q.dirty = false
+	q.mu.Unlock()
+
+	var err error
+	if row.ID == 0 {
+		err = m.db.Create(&row).Error
+	} else {
+		err = m.db.Save(&row).Error
+	}
+	if err != nil {
+		// Keep the entry dirty so the next flush retries
+		q.mu.Lock()
+		q.dirty = true
+		q.mu.Unlock()
+		return err
+	}
+
+	q.mu.Lock()
+	q.row.ID = row.ID
+	q.row.CreatedAt = row.CreatedAt
+	q.mu.Unlock()
+	return nil
+}
+
+// Flush persists all pending usage changes to the database
+func (m *Manager) Flush() error {
+	m.mu.RLock()
+	quotas := make([]*userQuota, 0, len(m.users))
+	for _, q := range m.users {
+		quotas = append(quotas, q)
+	}
+	m.mu.RUnlock()
+
+	var firstErr error
+	for _, q := range quotas {
+		if err := m.flushOne(q); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// backgroundFlush periodically persists usage counters
+func (m *Manager) backgroundFlush() {
+	ticker := time.NewTicker(m.flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := m.Flush(); err != nil {
+				logger.Error("Failed to flush quota usage: %v", err)
+			}
+		case <-m.stopChan:
+			return
+		}
+	}
+}
+
+// Stop stops background flushing and persists pending usage
+func (m *Manager) Stop() error {
+	m.stopOnce.Do(func() { close(m.stopChan) })
+	return m.Flush()
+}
+
+// startOfDay returns local midnight of the given time
+func startOfDay(t time.Time) time.Time {
+	y, mo, d := t.Date()
+	return time.Date(y, mo, d, 0, 0, 0, 0, t.Location())
+}
+
+// startOfMonth returns local midnight of the first day of the given time's month
+func startOfMonth(t time.Time) time.Time {
+	y, mo, _ := t.Date()
+	return time.Date(y, mo, 1, 0, 0, 0, 0, t.Location())
+}
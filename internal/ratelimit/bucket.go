@@ -0,0 +1,120 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Bucket is a token bucket rate limiter measured in bytes
+// Tokens may go negative: callers reserve what they need and wait off the debt,
+// which serves concurrent callers in arrival order and shares the rate fairly
+type Bucket struct {
+	mu     sync.Mutex
+	rate   float64 // Tokens added per second (0 = unlimited)
+	burst  float64 // Maximum number of stored tokens
+	tokens float64
+	last   time.Time
+}
+
+// NewBucket creates a token bucket with the given rate (bytes/sec) and burst size (bytes)
+// A rate of 0 disables limiting; a burst of 0 defaults to one second worth of tokens
+func NewBucket(rate, burst int64) *Bucket {
+	b := &Bucket{last: time.Now()}
+	b.SetRate(rate, burst)
+	b.tokens = b.burst
+	return b
+}
+
+// SetRate changes the bucket rate and burst size at runtime
+func (b *Bucket) SetRate(rate, burst int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.advance(time.Now())
+	if rate < 0 {
+		rate = 0
+	}
+	if burst <= 0 {
+		burst = rate
+	}
+	b.rate = float64(rate)
+	b.burst = float64(burst)
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+}
+
+// Rate returns the current rate in bytes per second (0 = unlimited)
+func (b *Bucket) Rate() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return int64(b.rate)
+}
+
+// Unlimited reports whether the bucket does not limit throughput
+func (b *Bucket) Unlimited() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.rate <= 0
+}
+
+// advance refills tokens for the time elapsed since the last update (caller holds mu)
+func (b *Bucket) advance(now time.Time) {
+	elapsed := now.Sub(b.last).Seconds()
+	b.last = now
+	if elapsed <= 0 || b.rate <= 0 {
+		return
+	}
+	b.tokens += elapsed * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+}
+
+// Reserve takes n tokens and returns how long the caller must wait before using them
+func (b *Bucket) Reserve(n int) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.rate <= 0 {
+		return 0
+	}
+	b.advance(time.Now())
+	b.tokens -= float64(n)
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// Wait blocks until n tokens are available or the context is done
+func (b *Bucket) Wait(ctx context.Context, n int) error {
+	return WaitAll(ctx, n, b)
+}
+
+// WaitAll reserves n tokens from every bucket and blocks until all of them allow it
+// Nil buckets are ignored
+func WaitAll(ctx context.Context, n int, buckets ...*Bucket) error {
+	var delay time.Duration
+	for _, b := range buckets {
+		if b == nil {
+			continue
+		}
+		if d := b.Reserve(n); d > delay {
+			delay = d
+		}
+	}
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
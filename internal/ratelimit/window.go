@@ -0,0 +1,83 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// WindowCounter counts events in fixed time windows
+// It is used for admission limits such as "new connections per second"
+type WindowCounter struct {
+	mu     sync.Mutex
+	window time.Duration
+	start  time.Time
+	count  int32
+}
+
+// NewWindowCounter creates a counter with the given window length
+func NewWindowCounter(window time.Duration) *WindowCounter {
+	return &WindowCounter{window: window}
+}
+
+// Allow records an event and reports whether it is within the limit for the current window
+// A limit of 0 or less means unlimited; rejected events are not counted
+func (w *WindowCounter) Allow(limit int32) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if !w.check(limit) {
+		return false
+	}
+	w.count++
+	return true
+}
+
+// Check reports whether an event would be within the limit for the current window without recording it
+// Used with Record when an event must pass several counters before it counts against any of them
+func (w *WindowCounter) Check(limit int32) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.check(limit)
+}
+
+// Record counts an event in the current window
+func (w *WindowCounter) Record() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.roll()
+	w.count++
+}
+
+// check reports whether the current window has room for an event; the caller holds the lock
+func (w *WindowCounter) check(limit int32) bool {
+	w.roll()
+	return limit <= 0 || w.count < limit
+}
+
+// roll starts a new window once the current one has ended; the caller holds the lock
+func (w *WindowCounter) roll() {
+	now := time.Now()
+	if now.Sub(w.start) >= w.window {
+		w.start = now
+		w.count = 0
+	}
+}
+
+// Count returns the number of events in the current window
+func (w *WindowCounter) Count() int32 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if time.Since(w.start) >= w.window {
+		return 0
+	}
+	return w.count
+}
+
+// Expired reports whether the current window has ended without new events
+func (w *WindowCounter) Expired() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return time.Since(w.start) >= w.window
+}
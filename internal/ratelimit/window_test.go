@@ -0,0 +1,63 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWindowCounterCheckDoesNotCount(t *testing.T) {
+	w := NewWindowCounter(time.Minute)
+	for i := 0; i < 5; i++ {
+		if !w.Check(1) {
+			t.Fatalf("Check(1) = false on an empty window")
+		}
+	}
+	if got := w.Count(); got != 0 {
+		t.Fatalf("Count() = %d after Check only, want 0", got)
+	}
+
+	w.Record()
+	if w.Check(1) {
+		t.Fatalf("Check(1) = true after one recorded event")
+	}
+	if !w.Check(0) {
+		t.Fatalf("Check(0) = false, want unlimited")
+	}
+}
+
+func TestWindowCounterAllow(t *testing.T) {
+	w := NewWindowCounter(time.Minute)
+	tests := []struct {
+		limit int32
+		want  bool
+		count int32
+	}{
+		{limit: 2, want: true, count: 1},
+		{limit: 2, want: true, count: 2},
+		{limit: 2, want: false, count: 2}, // Rejected events are not counted
+		{limit: 0, want: true, count: 3},
+	}
+	for i, tt := range tests {
+		if got := w.Allow(tt.limit); got != tt.want {
+			t.Errorf("event %d: Allow(%d) = %v, want %v", i, tt.limit, got, tt.want)
+		}
+		if got := w.Count(); got != tt.count {
+			t.Errorf("event %d: Count() = %d, want %d", i, got, tt.count)
+		}
+	}
+}
+
+func TestWindowCounterNewWindow(t *testing.T) {
+	w := NewWindowCounter(10 * time.Millisecond)
+	w.Record()
+	if w.Check(1) {
+		t.Fatalf("Check(1) = true in a full window")
+	}
+	time.Sleep(20 * time.Millisecond)
+	if !w.Expired() {
+		t.Fatalf("Expired() = false after the window ended")
+	}
+	if !w.Check(1) {
+		t.Fatalf("Check(1) = false in a new window")
+	}
+}
@@ -0,0 +1,93 @@
+// Package reload is the configuration change notification bus: writers announce which part of the
+// configuration they changed and the loaders registered for it bring the running server in line with the database
+package reload
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"go-proxy-server/internal/logger"
+	"go-proxy-server/internal/metrics"
+)
+
+// Topic is a part of the configuration that is loaded into memory
+type Topic string
+
+// Configuration topics
+const (
+	Users       Topic = "users"
+	Whitelist   Topic = "whitelist"
+	UserLimits  Topic = "userLimits"
+	AccessRules Topic = "accessRules"
+	Schedules   Topic = "schedules"
+	Timeouts    Topic = "timeouts"
+	Limiter     Topic = "limiter"
+	Security    Topic = "security"
+	Bandwidth   Topic = "bandwidth"
+	Backups     Topic = "backups"
+	Listeners   Topic = "listeners"
+)
+
+// Topics lists every topic in the order they are loaded, so that e.g. users exist before their access rules
+var Topics = []Topic{Timeouts, Limiter, Security, Bandwidth, Backups, Users, Whitelist, UserLimits, AccessRules, Schedules, Listeners}
+
+// loader brings one part of the running server in line with the database
+type loader struct {
+	name string
+	load func() error
+}
+
+var (
+	// Serializes reloads, so loaders never run concurrently
+	mu      sync.Mutex
+	loaders = make(map[Topic][]loader)
+)
+
+// Register adds the loader of a topic; registering a name again replaces its loader
+func Register(topic Topic, name string, load func() error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	for i, existing := range loaders[topic] {
+		if existing.name == name {
+			loaders[topic][i].load = load
+			return
+		}
+	}
+	loaders[topic] = append(loaders[topic], loader{name: name, load: load})
+}
+
+// Notify announces changed topics and runs their loaders before returning, so the change applies immediately
+// Failures are logged and counted in the metrics; the returned error joins them
+func Notify(topics ...Topic) error {
+	changed := make(map[Topic]bool, len(topics))
+	for _, topic := range topics {
+		changed[topic] = true
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	var errs []error
+	for _, topic := range Topics {
+		if !changed[topic] {
+			continue
+		}
+		for _, l := range loaders[topic] {
+			if err := l.load(); err != nil {
+				logger.Error("Failed to reload %s: %v", l.name, err)
+				if collector := metrics.GetCollector(); collector != nil {
+					collector.RecordReloadFailure()
+				}
+				errs = append(errs, fmt.Errorf("%s: %w", l.name, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// All reloads every topic, for changes made to the database from outside the server
+func All() error {
+	return Notify(Topics...)
+}
@@ -0,0 +1,219 @@
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// minutesPerDay is the end of the last window of a day ("24:00")
+const minutesPerDay = 24 * 60
+
+// weekdays maps accepted day names to time.Weekday
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// Window is a daily time window on the given weekdays
+// Start and End use "HH:MM"; an End before Start spans midnight into the next day
+type Window struct {
+	Days  []string `json:"days"` // "mon".."sun"; ranges such as "mon-fri" are accepted
+	Start string   `json:"start"`
+	End   string   `json:"end"`
+}
+
+// Definition is the API representation of a schedule
+type Definition struct {
+	Name             string   `json:"name"`
+	TimeZone         string   `json:"timeZone"`
+	Windows          []Window `json:"windows"`
+	Holidays         []string `json:"holidays"`
+	EnforceOnTunnels bool     `json:"enforceOnTunnels"`
+}
+
+// Validate checks the name, time zone, windows and holidays of the definition
+func (d Definition) Validate() error {
+	if strings.TrimSpace(d.Name) == "" {
+		return fmt.Errorf("schedule name is required")
+	}
+	_, err := compile(d)
+	return err
+}
+
+// span is an allowed interval within a day in minutes [start, end)
+type span struct {
+	start, end int
+}
+
+// Schedule is a compiled schedule
+// A nil Schedule always allows access
+type Schedule struct {
+	loc      *time.Location
+	days     [7][]span
+	holidays map[string]bool
+	enforce  bool
+}
+
+// compile parses a definition into a schedule
+func compile(d Definition) (*Schedule, error) {
+	s := &Schedule{loc: time.Local, holidays: make(map[string]bool), enforce: d.EnforceOnTunnels}
+
+	if d.TimeZone != "" {
+		loc, err := time.LoadLocation(d.TimeZone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid time zone %q", d.TimeZone)
+		}
+		s.loc = loc
+	}
+
+	for _, window := range d.Windows {
+		start, err := parseClock(window.Start)
+		if err != nil {
+			return nil, err
+		}
+		end, err := parseClock(window.End)
+		if err != nil {
+			return nil, err
+		}
+		if start == end {
+			return nil, fmt.Errorf("window %s-%s is empty", window.Start, window.End)
+		}
+		days, err := parseDays(window.Days)
+		if err != nil {
+			return nil, err
+		}
+		for _, day := range days {
+			if start < end {
+				s.days[day] = append(s.days[day], span{start, end})
+				continue
+			}
+			// Window spans midnight: split it across both days
+			s.days[day] = append(s.days[day], span{start, minutesPerDay})
+			if end > 0 {
+				next := (day + 1) % 7
+				s.days[next] = append(s.days[next], span{0, end})
+			}
+		}
+	}
+
+	for _, holiday := range d.Holidays {
+		holiday = strings.TrimSpace(holiday)
+		if holiday == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", holiday); err != nil {
+			return nil, fmt.Errorf("invalid holiday %q (expected YYYY-MM-DD)", holiday)
+		}
+		s.holidays[holiday] = true
+	}
+	return s, nil
+}
+
+// parseClock parses "HH:MM" into minutes since midnight ("24:00" is accepted as an end)
+func parseClock(value string) (int, error) {
+	hourStr, minuteStr, ok := strings.Cut(strings.TrimSpace(value), ":")
+	hour, err1 := strconv.Atoi(hourStr)
+	minute, err2 := strconv.Atoi(minuteStr)
+	if !ok || err1 != nil || err2 != nil || hour < 0 || minute < 0 || minute > 59 || hour > 24 || (hour == 24 && minute != 0) {
+		return 0, fmt.Errorf("invalid time %q (expected HH:MM)", value)
+	}
+	return hour*60 + minute, nil
+}
+
+// parseDays parses day names and ranges into weekdays
+func parseDays(values []string) ([]time.Weekday, error) {
+	if len(values) == 0 {
+		return nil, fmt.Errorf("window must list at least one day")
+	}
+	var days []time.Weekday
+	for _, value := range values {
+		value = strings.ToLower(strings.TrimSpace(value))
+		fromStr, toStr, isRange := strings.Cut(value, "-")
+		from, ok := weekdays[fromStr]
+		if !ok {
+			return nil, fmt.Errorf("invalid day %q", value)
+		}
+		if !isRange {
+			days = append(days, from)
+			continue
+		}
+		to, ok := weekdays[toStr]
+		if !ok {
+			return nil, fmt.Errorf("invalid day %q", value)
+		}
+		for day := from; ; day = (day + 1) % 7 {
+			days = append(days, day)
+			if day == to {
+				break
+			}
+		}
+	}
+	return days, nil
+}
+
+// spanEnd returns the end (in minutes) of the allowed period containing minute on the day of t,
+// or -1 when access is not allowed at that minute
+func (s *Schedule) spanEnd(t time.Time, minute int) int {
+	if s.holidays[t.Format("2006-01-02")] {
+		return -1
+	}
+	end := -1
+	for extended := true; extended; {
+		extended = false
+		for _, sp := range s.days[t.Weekday()] {
+			probe := minute
+			if end >= 0 {
+				probe = end
+			}
+			if sp.start <= probe && probe < sp.end && sp.end > end {
+				end = sp.end
+				extended = true
+			}
+		}
+	}
+	return end
+}
+
+// Allowed reports whether access is allowed at the given time
+func (s *Schedule) Allowed(now time.Time) bool {
+	if s == nil {
+		return true
+	}
+	t := now.In(s.loc)
+	return s.spanEnd(t, t.Hour()*60+t.Minute()) >= 0
+}
+
+// WindowEnd returns when the allowed period containing now ends
+// ok is false when access is not allowed at now; a schedule allowing access for
+// the whole next week returns the zero time
+func (s *Schedule) WindowEnd(now time.Time) (end time.Time, ok bool) {
+	if s == nil {
+		return time.Time{}, true
+	}
+	t := now.In(s.loc)
+	minute := t.Hour()*60 + t.Minute()
+	if s.spanEnd(t, minute) < 0 {
+		return time.Time{}, false
+	}
+
+	// Follow the allowed period across midnight for at most a week
+	for i := 0; i < 8; i++ {
+		endMinute := s.spanEnd(t, minute)
+		if endMinute < 0 {
+			return t, true
+		}
+		end = time.Date(t.Year(), t.Month(), t.Day(), 0, endMinute, 0, 0, s.loc)
+		if endMinute < minutesPerDay {
+			return end, true
+		}
+		t, minute = end, 0
+	}
+	return time.Time{}, true
+}
+
+// EnforceOnTunnels reports whether open tunnels must be closed when the window ends
+func (s *Schedule) EnforceOnTunnels() bool {
+	return s != nil && s.enforce
+}
@@ -0,0 +1,249 @@
+package schedule
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	"gorm.io/gorm"
+
+	"go-proxy-server/internal/logger"
+	"go-proxy-server/internal/models"
+)
+
+// Assignment scopes
+const (
+	ScopeUser      = "user"
+	ScopeGroup     = "group"
+	ScopeWhitelist = "whitelist"
+)
+
+// Assignment is the API representation of a schedule assignment
+type Assignment struct {
+	Scope    string `json:"scope"`
+	Subject  string `json:"subject"`
+	Schedule string `json:"schedule"`
+}
+
+// snapshot holds the assigned schedules, replaced atomically on reload
+type snapshot struct {
+	users     map[string]*Schedule // By username
+	groups    map[string]*Schedule // By group name
+	whitelist map[string]*Schedule // By whitelisted IP
+}
+
+var current atomic.Pointer[snapshot]
+
+func init() {
+	current.Store(&snapshot{
+		users:     make(map[string]*Schedule),
+		groups:    make(map[string]*Schedule),
+		whitelist: make(map[string]*Schedule),
+	})
+}
+
+// ForUser returns the effective schedule of a user in the given group (nil = no restriction)
+// A schedule assigned to the user takes precedence over the group's schedule
+func ForUser(username, group string) *Schedule {
+	snap := current.Load()
+	if s, ok := snap.users[username]; ok {
+		return s
+	}
+	return snap.groups[group]
+}
+
+// ForWhitelistIP returns the schedule of a whitelist entry (nil = no restriction)
+func ForWhitelistIP(ip string) *Schedule {
+	return current.Load().whitelist[ip]
+}
+
+// definitionFromModel converts a database row to a Definition
+func definitionFromModel(m models.Schedule) (Definition, error) {
+	d := Definition{
+		Name:             m.Name,
+		TimeZone:         m.TimeZone,
+		Windows:          []Window{},
+		Holidays:         []string{},
+		EnforceOnTunnels: m.EnforceOnTunnels,
+	}
+	if m.Windows != "" {
+		if err := json.Unmarshal([]byte(m.Windows), &d.Windows); err != nil {
+			return d, fmt.Errorf("invalid windows of schedule %s: %w", m.Name, err)
+		}
+	}
+	for _, holiday := range strings.Split(m.Holidays, ",") {
+		if holiday = strings.TrimSpace(holiday); holiday != "" {
+			d.Holidays = append(d.Holidays, holiday)
+		}
+	}
+	return d, nil
+}
+
+// LoadFromDB loads schedules and assignments and rebuilds the effective schedules
+func LoadFromDB(db *gorm.DB) error {
+	var rows []models.Schedule
+	if err := db.Find(&rows).Error; err != nil {
+		return fmt.Errorf("failed to load schedules: %w", err)
+	}
+	var assignments []models.ScheduleAssignment
+	if err := db.Find(&assignments).Error; err != nil {
+		return fmt.Errorf("failed to load schedule assignments: %w", err)
+	}
+
+	schedules := make(map[string]*Schedule, len(rows))
+	for _, row := range rows {
+		d, err := definitionFromModel(row)
+		if err == nil {
+			schedules[row.Name], err = compile(d)
+		}
+		if err != nil {
+			// Definitions are validated on save, so this only happens with hand-edited data
+			// Fail closed: an empty schedule never allows access
+			logger.Error("Invalid schedule %s: %v", row.Name, err)
+			schedules[row.Name] = &Schedule{}
+		}
+	}
+
+	byScope := map[string]map[string]*Schedule{
+		ScopeUser:      make(map[string]*Schedule),
+		ScopeGroup:     make(map[string]*Schedule),
+		ScopeWhitelist: make(map[string]*Schedule),
+	}
+	for _, assignment := range assignments {
+		s, ok := schedules[assignment.ScheduleName]
+		if !ok {
+			continue
+		}
+		if scope, ok := byScope[assignment.Scope]; ok {
+			scope[assignment.Subject] = s
+		}
+	}
+
+	snap := &snapshot{
+		users:     byScope[ScopeUser],
+		groups:    byScope[ScopeGroup],
+		whitelist: byScope[ScopeWhitelist],
+	}
+	current.Store(snap)
+	return nil
+}
+
+// ListSchedules returns all schedule definitions
+func ListSchedules(db *gorm.DB) ([]Definition, error) {
+	var rows []models.Schedule
+	if err := db.Order("name").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	definitions := make([]Definition, 0, len(rows))
+	for _, row := range rows {
+		d, err := definitionFromModel(row)
+		if err != nil {
+			return nil, err
+		}
+		definitions = append(definitions, d)
+	}
+	return definitions, nil
+}
+
+// SaveSchedule creates or replaces a schedule definition
+func SaveSchedule(db *gorm.DB, d Definition) error {
+	d.Name = strings.TrimSpace(d.Name)
+	if err := d.Validate(); err != nil {
+		return err
+	}
+	windows, err := json.Marshal(d.Windows)
+	if err != nil {
+		return err
+	}
+
+	var existing models.Schedule
+	err = db.Where("name = ?", d.Name).First(&existing).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		existing = models.Schedule{Name: d.Name}
+	} else if err != nil {
+		return err
+	}
+
+	existing.TimeZone = d.TimeZone
+	existing.Windows = string(windows)
+	existing.Holidays = strings.Join(d.Holidays, ",")
+	existing.EnforceOnTunnels = d.EnforceOnTunnels
+	if err := db.Save(&existing).Error; err != nil {
+		return err
+	}
+
+	return LoadFromDB(db)
+}
+
+// DeleteSchedule removes a schedule and all its assignments
+func DeleteSchedule(db *gorm.DB, name string) error {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("name = ?", name).Delete(&models.Schedule{}).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Where("schedule_name = ?", name).Delete(&models.ScheduleAssignment{}).Error
+	})
+	if err != nil {
+		return err
+	}
+	return LoadFromDB(db)
+}
+
+// ListAssignments returns all schedule assignments
+func ListAssignments(db *gorm.DB) ([]Assignment, error) {
+	var rows []models.ScheduleAssignment
+	if err := db.Order("scope, subject").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	assignments := make([]Assignment, 0, len(rows))
+	for _, row := range rows {
+		assignments = append(assignments, Assignment{Scope: row.Scope, Subject: row.Subject, Schedule: row.ScheduleName})
+	}
+	return assignments, nil
+}
+
+// Assign attaches a schedule to a user, group or whitelist entry (empty schedule detaches)
+func Assign(db *gorm.DB, scope, subject, scheduleName string) error {
+	if scope != ScopeUser && scope != ScopeGroup && scope != ScopeWhitelist {
+		return fmt.Errorf("scope must be %q, %q or %q", ScopeUser, ScopeGroup, ScopeWhitelist)
+	}
+	if subject == "" {
+		return fmt.Errorf("subject is required")
+	}
+
+	if scheduleName == "" {
+		return Unassign(db, scope, subject)
+	}
+
+	var count int64
+	if err := db.Model(&models.Schedule{}).Where("name = ?", scheduleName).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return fmt.Errorf("schedule '%s' does not exist", scheduleName)
+	}
+
+	var existing models.ScheduleAssignment
+	err := db.Where("scope = ? AND subject = ?", scope, subject).First(&existing).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		existing = models.ScheduleAssignment{Scope: scope, Subject: subject}
+	} else if err != nil {
+		return err
+	}
+	existing.ScheduleName = scheduleName
+	if err := db.Save(&existing).Error; err != nil {
+		return err
+	}
+
+	return LoadFromDB(db)
+}
+
+// Unassign detaches the schedule of a user, group or whitelist entry
+func Unassign(db *gorm.DB, scope, subject string) error {
+	if err := db.Unscoped().Where("scope = ? AND subject = ?", scope, subject).Delete(&models.ScheduleAssignment{}).Error; err != nil {
+		return err
+	}
+	return LoadFromDB(db)
+}
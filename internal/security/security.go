@@ -75,11 +75,6 @@ func CheckSSRF(host string) error {
 		return nil // Allow access, skip SSRF check
 	}
 
-	// Start DNS cache cleanup goroutine on first call
-	if dnsCacheCleanupStarted.CompareAndSwap(false, true) {
-		go cleanupDNSCache()
-	}
-
 	// Parse host to extract IP or hostname
 	// host can be "example.com:80" or "192.168.1.1:80" or just "example.com"
 	hostOnly := host
@@ -96,37 +91,9 @@ func CheckSSRF(host string) error {
 	}
 
 	// If not an IP, resolve the hostname with caching
-	var ips []net.IP
-
-	// Check DNS LRU cache first
-	if entry, ok := dnsLRUCache.Get(hostOnly); ok {
-		// Cache hit and not expired (Get already checks expiration)
-		if dnsEntry, ok := entry.Value.(DNSCacheEntry); ok {
-			ips = dnsEntry.IPs
-		}
-	}
-
-	// Cache miss or expired, perform DNS lookup
-	if ips == nil {
-		resolver := &net.Resolver{}
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancel()
-
-		var err error
-		ips, err = resolver.LookupIP(ctx, "ip", hostOnly)
-		if err != nil {
-			// DNS resolution failure could be used to bypass SSRF protection
-			// Return error to prevent potential security bypass
-			// Note: Don't log the hostname or error details to avoid leaking user's target destinations
-			logger.Warn("DNS resolution failed during SSRF check")
-			return fmt.Errorf("failed to resolve hostname: %v", err)
-		}
-
-		// Store in LRU cache with TTL
-		dnsLRUCache.Put(hostOnly, cache.Entry{
-			Value:     DNSCacheEntry{IPs: ips},
-			ExpiresAt: time.Now().Add(constants.DNSCacheTTL),
-		})
+	ips, err := ResolveHost(hostOnly)
+	if err != nil {
+		return err
 	}
 
 	// Check all resolved IPs
@@ -139,6 +106,44 @@ func CheckSSRF(host string) error {
 	return nil
 }
 
+// ResolveHost resolves a hostname to its IP addresses using the shared DNS cache
+// host must not include a port
+func ResolveHost(host string) ([]net.IP, error) {
+	// Start DNS cache cleanup goroutine on first call
+	if dnsCacheCleanupStarted.CompareAndSwap(false, true) {
+		go cleanupDNSCache()
+	}
+
+	// Check DNS LRU cache first
+	if entry, ok := dnsLRUCache.Get(host); ok {
+		// Cache hit and not expired (Get already checks expiration)
+		if dnsEntry, ok := entry.Value.(DNSCacheEntry); ok {
+			return dnsEntry.IPs, nil
+		}
+	}
+
+	// Cache miss or expired, perform DNS lookup
+	resolver := &net.Resolver{}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	ips, err := resolver.LookupIP(ctx, "ip", host)
+	if err != nil {
+		// DNS resolution failure could be used to bypass SSRF protection
+		// Return error to prevent potential security bypass
+		// Note: Don't log the hostname or error details to avoid leaking user's target destinations
+		logger.Warn("DNS resolution failed during destination check")
+		return nil, fmt.Errorf("failed to resolve hostname: %v", err)
+	}
+
+	// Store in LRU cache with TTL
+	dnsLRUCache.Put(host, cache.Entry{
+		Value:     DNSCacheEntry{IPs: ips},
+		ExpiresAt: time.Now().Add(constants.DNSCacheTTL),
+	})
+	return ips, nil
+}
+
 // VerifyConnectedIP verifies that the actual connected IP is not private
 // This prevents DNS rebinding attacks where DNS resolves to public IP initially
 // but later resolves to private IP when connection is established
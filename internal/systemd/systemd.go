@@ -0,0 +1,61 @@
+// Package systemd integrates the server with the systemd service manager: socket activation,
+// readiness and status notifications, and watchdog keep-alives
+// Everything does nothing when the process was not started by systemd
+package systemd
+
+import (
+	"time"
+
+	"go-proxy-server/internal/logger"
+)
+
+// Notification states understood by systemd
+const (
+	StateReady    = "READY=1"
+	StateStopping = "STOPPING=1"
+	StateWatchdog = "WATCHDOG=1"
+)
+
+// Status returns the notification setting the status line shown by systemctl status
+func Status(status string) string {
+	return "STATUS=" + status
+}
+
+// StartWatchdog sends watchdog keep-alives at half the interval systemd expects them,
+// as long as check passes; systemd restarts the service when they stop
+// Keep-alives end when stop is closed
+func StartWatchdog(check func() error, stop <-chan struct{}) {
+	interval := WatchdogInterval()
+	if interval == 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval / 2)
+		defer ticker.Stop()
+		healthy := true
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+
+			if err := check(); err != nil {
+				if healthy {
+					logger.Warn("Health check failed, withholding watchdog keep-alives: %v", err)
+				}
+				healthy = false
+				Notify(Status("Unhealthy: " + err.Error()))
+				continue
+			}
+			if !healthy {
+				logger.Info("Health check passed again, resuming watchdog keep-alives")
+				healthy = true
+				Notify(StateWatchdog, Status("Accepting connections"))
+				continue
+			}
+			Notify(StateWatchdog)
+		}
+	}()
+}
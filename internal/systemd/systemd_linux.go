@@ -0,0 +1,130 @@
+//go:build linux
+// +build linux
+
+package systemd
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// listenFDsStart is the first descriptor of the sockets passed by socket activation
+const listenFDsStart = 3
+
+var (
+	mu        sync.Mutex
+	activated []net.Listener // Sockets passed by socket activation and not taken yet
+)
+
+// init picks up the sockets passed by socket activation (LISTEN_PID, LISTEN_FDS)
+func init() {
+	pid, _ := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	count, _ := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	// Processes started later by this one must not take the variables for their own
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+	if pid != os.Getpid() {
+		return
+	}
+
+	for fd := listenFDsStart; fd < listenFDsStart+count; fd++ {
+		syscall.CloseOnExec(fd)
+		file := os.NewFile(uintptr(fd), "systemd-socket-"+strconv.Itoa(fd))
+		// Datagram sockets and other descriptors cannot serve proxy connections
+		listener, err := net.FileListener(file)
+		file.Close()
+		if err == nil {
+			activated = append(activated, listener)
+		}
+	}
+}
+
+// Notify sends state notifications to systemd (NOTIFY_SOCKET)
+// The variable is kept, so a process started by a hot upgrade can notify as well
+func Notify(states ...string) error {
+	socketPath := os.Getenv("NOTIFY_SOCKET")
+	if socketPath == "" {
+		return nil
+	}
+	// Names starting with @ are abstract sockets, which the net package handles
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socketPath, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte(strings.Join(states, "\n")))
+	return err
+}
+
+// Listener takes the activated socket bound to the address net.Listen would bind for network and address
+func Listener(network, address string) (net.Listener, bool) {
+	mu.Lock()
+	defer mu.Unlock()
+	for i, listener := range activated {
+		if matches(listener.Addr(), network, address) {
+			activated = append(activated[:i], activated[i+1:]...)
+			return listener, true
+		}
+	}
+	return nil, false
+}
+
+// HasListener reports whether an activated socket matching network and address was not taken yet
+func HasListener(network, address string) bool {
+	mu.Lock()
+	defer mu.Unlock()
+	for _, listener := range activated {
+		if matches(listener.Addr(), network, address) {
+			return true
+		}
+	}
+	return false
+}
+
+// matches reports whether a socket bound to addr is what net.Listen(network, address) would open
+func matches(addr net.Addr, network, address string) bool {
+	switch bound := addr.(type) {
+	case *net.UnixAddr:
+		return network == "unix" && bound.Name == address
+	case *net.TCPAddr:
+		if !strings.HasPrefix(network, "tcp") {
+			return false
+		}
+		host, port, err := net.SplitHostPort(address)
+		if err != nil || port != strconv.Itoa(bound.Port) {
+			return false
+		}
+		if host == "localhost" {
+			return bound.IP.IsLoopback()
+		}
+		ip := net.ParseIP(host)
+		if host != "" && ip == nil {
+			return false
+		}
+		if host == "" || ip.IsUnspecified() {
+			// Wildcard sockets of tcp4 are IPv4 ones; those of tcp and tcp6 are IPv6 ones (dual-stack unless IPv6-only)
+			wantIPv4 := network == "tcp4" || (ip != nil && ip.To4() != nil)
+			return bound.IP.IsUnspecified() && (bound.IP.To4() != nil) == wantIPv4
+		}
+		return ip.Equal(bound.IP)
+	}
+	return false
+}
+
+// WatchdogInterval returns the interval systemd expects watchdog keep-alives within (0 = watchdog disabled)
+func WatchdogInterval() time.Duration {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond
+}
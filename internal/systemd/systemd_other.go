@@ -0,0 +1,29 @@
+//go:build !linux
+// +build !linux
+
+package systemd
+
+import (
+	"net"
+	"time"
+)
+
+// Notify does nothing on this platform
+func Notify(states ...string) error {
+	return nil
+}
+
+// Listener returns no socket on this platform
+func Listener(network, address string) (net.Listener, bool) {
+	return nil, false
+}
+
+// HasListener reports that no socket was passed on this platform
+func HasListener(network, address string) bool {
+	return false
+}
+
+// WatchdogInterval returns 0 (no watchdog) on this platform
+func WatchdogInterval() time.Duration {
+	return 0
+}
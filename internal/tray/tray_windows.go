@@ -16,7 +16,6 @@ import (
 	"gorm.io/gorm"
 
 	"go-proxy-server/internal/auth"
-	"go-proxy-server/internal/config"
 	"go-proxy-server/internal/logger"
 	"go-proxy-server/internal/web"
 )
@@ -95,19 +94,7 @@ func onReady(webPort int) func() {
 		globalWebManager = web.NewManager(globalDB, webPort)
 
 		// Auto-start proxies based on saved configuration
-		if socksConfig, err := config.LoadProxyConfig(globalDB, "socks5"); err == nil && socksConfig != nil && socksConfig.AutoStart {
-			logger.Info("Auto-starting SOCKS5 proxy on port %d", socksConfig.Port)
-			if err := globalWebManager.AutoStartProxy("socks5", socksConfig.Port, socksConfig.BindListen); err != nil {
-				logger.Error("Failed to auto-start SOCKS5 proxy: %v", err)
-			}
-		}
-
-		if httpConfig, err := config.LoadProxyConfig(globalDB, "http"); err == nil && httpConfig != nil && httpConfig.AutoStart {
-			logger.Info("Auto-starting HTTP proxy on port %d", httpConfig.Port)
-			if err := globalWebManager.AutoStartProxy("http", httpConfig.Port, httpConfig.BindListen); err != nil {
-				logger.Error("Failed to auto-start HTTP proxy: %v", err)
-			}
-		}
+		globalWebManager.AutoStartProxies()
 
 		go func() {
 			if err := globalWebManager.StartServer(); err != nil {
@@ -118,10 +105,10 @@ func onReady(webPort int) func() {
 		// Wait for server to bind to port (StartServer sets actualPort before blocking on http.Serve)
 		time.Sleep(200 * time.Millisecond)
 		actualWebPort = globalWebManager.GetActualPort()
-		logger.Info("Web management interface started on http://localhost:%d", actualWebPort)
+		logger.Info("Web management interface started on %s", globalWebManager.URL())
 
 		// Update tooltip to show the actual port
-		tooltipText := fmt.Sprintf("Go Proxy Server\n管理界面: http://localhost:%d", actualWebPort)
+		tooltipText := fmt.Sprintf("Go Proxy Server\n管理界面: %s", globalWebManager.URL())
 		systray.SetTooltip(tooltipText)
 		logger.Info("Tooltip updated with port information")
 
@@ -143,12 +130,8 @@ func onReady(webPort int) func() {
 			for {
 				select {
 				case <-mOpen.ClickedCh:
-					// Use actual port
-					port := actualWebPort
-					if port == 0 {
-						port = webPort
-					}
-					openBrowser(fmt.Sprintf("http://localhost:%d", port))
+					// Use actual address (scheme, bind address and port)
+					openBrowser(globalWebManager.URL())
 				case <-mQuit.ClickedCh:
 					logger.Info("Quit requested by user")
 					systray.Quit()
@@ -0,0 +1,91 @@
+// Package upgrade hands the listening sockets of a running server over to a newly started binary,
+// so a deployment replaces the binary without refusing connections or cutting open tunnels
+//
+// Every socket a process accepts on is opened through Listen. On Upgrade the process starts its own
+// executable again with the sockets as inherited file descriptors and waits until the new process
+// calls Ready; it then stops accepting and drains its connections, while the new process serves
+// all new connections on the same sockets
+package upgrade
+
+import (
+	"errors"
+	"sync"
+
+	"go-proxy-server/internal/logger"
+	"go-proxy-server/internal/systemd"
+)
+
+// Environment variables passing the inherited sockets to the new process
+const (
+	listenersEnv = "GO_PROXY_SERVER_UPGRADE_LISTENERS" // JSON list of inheritedSocket
+	filesEnv     = "GO_PROXY_SERVER_UPGRADE_FILES"     // JSON object of descriptors passed with PassFile, by name
+	readyFDEnv   = "GO_PROXY_SERVER_UPGRADE_READY_FD"  // Pipe the new process signals readiness on
+)
+
+// ErrUnsupported is returned by Upgrade on platforms without socket handoff
+var ErrUnsupported = errors.New("hot upgrade is only supported on Linux")
+
+var (
+	handedOff = make(chan struct{}) // Closed once a new process took over the listening sockets
+	readyOnce sync.Once
+
+	hooksMu    sync.Mutex
+	readyHooks []func()
+)
+
+// inheritedSocket describes a socket passed to the new process
+type inheritedSocket struct {
+	Network string `json:"network"`
+	Address string `json:"address"` // Address the socket was opened with, which may differ from the bound one (port 0)
+	FD      int    `json:"fd"`
+}
+
+// socketKey identifies a socket by the arguments it was opened with
+func socketKey(network, address string) string {
+	return network + " " + address
+}
+
+// OnReady registers a function run by Ready before the old process hands over
+func OnReady(hook func()) {
+	hooksMu.Lock()
+	readyHooks = append(readyHooks, hook)
+	hooksMu.Unlock()
+}
+
+// Ready reports that the process has opened all its sockets and serves connections
+// It runs the OnReady hooks and, in a process started by Upgrade, lets the old process hand over;
+// otherwise it notifies systemd that the service is up
+// Later calls do nothing
+func Ready() {
+	readyOnce.Do(func() {
+		hooksMu.Lock()
+		hooks := readyHooks
+		hooksMu.Unlock()
+		for _, hook := range hooks {
+			hook()
+		}
+		// The old process announces an upgraded one to systemd once it handed over
+		if signalReady() {
+			return
+		}
+		if err := systemd.Notify(systemd.StateReady, systemd.Status("Accepting connections")); err != nil {
+			logger.Warn("Failed to notify systemd of readiness: %v", err)
+		}
+	})
+}
+
+// HandedOff is closed once a new process took over the listening sockets
+// The process should then drain its connections and exit
+func HandedOff() <-chan struct{} {
+	return handedOff
+}
+
+// IsHandedOff reports whether a new process took over the listening sockets
+func IsHandedOff() bool {
+	select {
+	case <-handedOff:
+		return true
+	default:
+		return false
+	}
+}
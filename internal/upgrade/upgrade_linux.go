@@ -0,0 +1,301 @@
+//go:build linux
+// +build linux
+
+package upgrade
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"go-proxy-server/internal/constants"
+	"go-proxy-server/internal/logger"
+	"go-proxy-server/internal/systemd"
+)
+
+// Signal triggers an upgrade
+var Signal os.Signal = syscall.SIGUSR2
+
+// socket is a listening socket opened through Listen
+type socket struct {
+	net.Listener
+	network string
+	address string
+}
+
+// Close closes the socket and stops handing it over on upgrades
+func (s *socket) Close() error {
+	mu.Lock()
+	delete(active, s)
+	mu.Unlock()
+	return s.Listener.Close()
+}
+
+var (
+	mu        sync.Mutex
+	active    = make(map[*socket]struct{})
+	inherited = make(map[string]*os.File) // Inherited sockets not opened yet, by socketKey
+	readyFile *os.File                    // Pipe to the old process (nil = not started by Upgrade)
+	upgrading bool
+
+	passedFiles    = make(map[string]*os.File) // Descriptors handed over on upgrade, by name
+	inheritedFiles = make(map[string]*os.File) // Descriptors the old process handed over, by name
+)
+
+// init picks up the sockets and readiness pipe passed by the old process
+func init() {
+	if fd, err := strconv.Atoi(os.Getenv(readyFDEnv)); err == nil {
+		syscall.CloseOnExec(fd)
+		readyFile = os.NewFile(uintptr(fd), "upgrade-ready")
+	}
+	// The logger is not set up yet; an unreadable list just means every socket is opened anew
+	var sockets []inheritedSocket
+	json.Unmarshal([]byte(os.Getenv(listenersEnv)), &sockets)
+	for _, s := range sockets {
+		syscall.CloseOnExec(s.FD)
+		inherited[socketKey(s.Network, s.Address)] = os.NewFile(uintptr(s.FD), s.Network+":"+s.Address)
+	}
+	var files map[string]int
+	json.Unmarshal([]byte(os.Getenv(filesEnv)), &files)
+	for name, fd := range files {
+		syscall.CloseOnExec(fd)
+		inheritedFiles[name] = os.NewFile(uintptr(fd), name)
+	}
+	// Processes started later by this one must not see the handoff of this one
+	os.Unsetenv(readyFDEnv)
+	os.Unsetenv(listenersEnv)
+	os.Unsetenv(filesEnv)
+}
+
+// PassFile registers a descriptor the new process receives on upgrade under name
+func PassFile(name string, file *os.File) {
+	mu.Lock()
+	passedFiles[name] = file
+	mu.Unlock()
+}
+
+// InheritedFile returns the descriptor the old process passed under name (nil = none)
+func InheritedFile(name string) *os.File {
+	mu.Lock()
+	defer mu.Unlock()
+	file := inheritedFiles[name]
+	delete(inheritedFiles, name)
+	return file
+}
+
+// Listen opens a listening socket, taking it over from the old process if it passed one opened with the same arguments,
+// or from systemd if socket activation passed one bound to the same address
+func Listen(network, address string) (net.Listener, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	var listener net.Listener
+	if file, ok := inherited[socketKey(network, address)]; ok {
+		delete(inherited, socketKey(network, address))
+		l, err := net.FileListener(file)
+		file.Close()
+		if err != nil {
+			logger.Warn("Failed to take over listening socket %s %s, opening a new one: %v", network, address, err)
+		} else {
+			listener = l
+		}
+	}
+	if listener == nil {
+		listener, _ = systemd.Listener(network, address)
+	}
+	if listener == nil {
+		l, err := net.Listen(network, address)
+		if err != nil {
+			return nil, err
+		}
+		listener = l
+	}
+
+	s := &socket{Listener: listener, network: network, address: address}
+	active[s] = struct{}{}
+	return s, nil
+}
+
+// Inherits reports whether the old process or systemd passed a socket for these arguments that was not taken over yet
+func Inherits(network, address string) bool {
+	mu.Lock()
+	defer mu.Unlock()
+	_, ok := inherited[socketKey(network, address)]
+	return ok || systemd.HasListener(network, address)
+}
+
+// signalReady lets the old process hand over and closes the inherited sockets this process does not use
+// Returns whether the process was started by an upgrade
+func signalReady() bool {
+	mu.Lock()
+	defer mu.Unlock()
+	for key, file := range inherited {
+		logger.Info("Closing inherited listening socket %s that is no longer configured", key)
+		file.Close()
+		delete(inherited, key)
+	}
+	if readyFile == nil {
+		return false
+	}
+	readyFile.Write([]byte{1})
+	readyFile.Close()
+	readyFile = nil
+	return true
+}
+
+// Upgrade starts the executable again with this process's arguments and listening sockets
+// and waits until it is ready; this process then stops accepting connections and closes HandedOff
+// Returns the ID of the new process
+func Upgrade() (int, error) {
+	mu.Lock()
+	if upgrading {
+		mu.Unlock()
+		return 0, errors.New("an upgrade is already in progress")
+	}
+	if IsHandedOff() {
+		mu.Unlock()
+		return 0, errors.New("the listeners were already handed over to a new process")
+	}
+	upgrading = true
+	sockets := make([]*socket, 0, len(active))
+	for s := range active {
+		sockets = append(sockets, s)
+	}
+	named := make(map[string]*os.File, len(passedFiles))
+	for name, file := range passedFiles {
+		named[name] = file
+	}
+	mu.Unlock()
+	defer func() {
+		mu.Lock()
+		upgrading = false
+		mu.Unlock()
+	}()
+
+	executable, err := os.Executable()
+	if err != nil {
+		return 0, fmt.Errorf("failed to locate the executable: %w", err)
+	}
+	// A binary replaced by the deployment still resolves to the deleted file
+	executable = strings.TrimSuffix(executable, " (deleted)")
+
+	readyReader, readyWriter, err := os.Pipe()
+	if err != nil {
+		return 0, fmt.Errorf("failed to create readiness pipe: %w", err)
+	}
+	defer readyReader.Close()
+
+	// ExtraFiles start at descriptor 3
+	files := []*os.File{readyWriter}
+	defer func() {
+		for _, file := range files {
+			file.Close()
+		}
+	}()
+	passed := make([]inheritedSocket, 0, len(sockets))
+	for _, s := range sockets {
+		filer, ok := s.Listener.(interface{ File() (*os.File, error) })
+		if !ok {
+			return 0, fmt.Errorf("listening socket %s %s cannot be handed over", s.network, s.address)
+		}
+		file, err := filer.File()
+		if err != nil {
+			return 0, fmt.Errorf("failed to hand over listening socket %s %s: %w", s.network, s.address, err)
+		}
+		passed = append(passed, inheritedSocket{Network: s.network, Address: s.address, FD: 3 + len(files)})
+		files = append(files, file)
+	}
+	listeners, err := json.Marshal(passed)
+	if err != nil {
+		return 0, err
+	}
+	// Named descriptors are passed as they are; the new process shares them with this one
+	extraFiles := files
+	namedFDs := make(map[string]int, len(named))
+	for name, file := range named {
+		namedFDs[name] = 3 + len(extraFiles)
+		extraFiles = append(extraFiles, file)
+	}
+	namedJSON, err := json.Marshal(namedFDs)
+	if err != nil {
+		return 0, err
+	}
+
+	cmd := exec.Command(executable, os.Args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(childEnviron(), listenersEnv+"="+string(listeners), filesEnv+"="+string(namedJSON), readyFDEnv+"=3")
+	cmd.ExtraFiles = extraFiles
+	if err := cmd.Start(); err != nil {
+		return 0, fmt.Errorf("failed to start %s: %w", executable, err)
+	}
+	// Only the new process may hold the write end, so its exit shows up as EOF
+	readyWriter.Close()
+	pid := cmd.Process.Pid
+	logger.Info("Started new process %d from %s with %d listening sockets, waiting for it to be ready", pid, executable, len(passed))
+
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+	ready := make(chan error, 1)
+	go func() {
+		_, err := io.ReadFull(readyReader, make([]byte, 1))
+		ready <- err
+	}()
+
+	timer := time.NewTimer(constants.UpgradeReadyTimeout)
+	defer timer.Stop()
+	select {
+	case err := <-ready:
+		if err != nil {
+			cmd.Process.Kill()
+			return 0, fmt.Errorf("new process %d did not become ready: %w", pid, err)
+		}
+	case err := <-exited:
+		return 0, fmt.Errorf("new process %d exited before it was ready: %v", pid, err)
+	case <-timer.C:
+		cmd.Process.Kill()
+		return 0, fmt.Errorf("new process %d was not ready within %v", pid, constants.UpgradeReadyTimeout)
+	}
+
+	// The new process accepts on the sockets now; stop accepting on our copies
+	mu.Lock()
+	for s := range active {
+		if unix, ok := s.Listener.(*net.UnixListener); ok {
+			// The socket file belongs to the new process
+			unix.SetUnlinkOnClose(false)
+		}
+		s.Listener.Close()
+		delete(active, s)
+	}
+	close(handedOff)
+	mu.Unlock()
+
+	// The new process becomes the main process of the systemd service
+	if err := systemd.Notify("MAINPID="+strconv.Itoa(pid), systemd.Status("Accepting connections")); err != nil {
+		logger.Warn("Failed to notify systemd of the new main process: %v", err)
+	}
+	logger.Info("Handed the listening sockets over to process %d", pid)
+	return pid, nil
+}
+
+// childEnviron returns the environment of the new process
+// The systemd watchdog applies to this process by PID; without WATCHDOG_PID it applies to the new one
+func childEnviron() []string {
+	var env []string
+	for _, kv := range os.Environ() {
+		if !strings.HasPrefix(kv, "WATCHDOG_PID=") {
+			env = append(env, kv)
+		}
+	}
+	return env
+}
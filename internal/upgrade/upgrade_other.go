@@ -0,0 +1,40 @@
+//go:build !linux
+// +build !linux
+
+package upgrade
+
+import (
+	"net"
+	"os"
+)
+
+// Signal triggers an upgrade (nil = no upgrade signal on this platform)
+var Signal os.Signal
+
+// Listen opens a listening socket (sockets are never inherited on this platform)
+func Listen(network, address string) (net.Listener, error) {
+	return net.Listen(network, address)
+}
+
+// Inherits reports whether a socket was inherited (never on this platform)
+func Inherits(network, address string) bool {
+	return false
+}
+
+// PassFile does nothing on this platform
+func PassFile(name string, file *os.File) {}
+
+// InheritedFile returns nil on this platform
+func InheritedFile(name string) *os.File {
+	return nil
+}
+
+// Upgrade is not supported on this platform
+func Upgrade() (int, error) {
+	return 0, ErrUnsupported
+}
+
+// signalReady does nothing on this platform; the process is never started by an upgrade
+func signalReady() bool {
+	return false
+}
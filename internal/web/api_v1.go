@@ -0,0 +1,281 @@
+package web
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// apiV1Prefix is the path prefix of the versioned REST API
+const apiV1Prefix = "/api/v1/"
+
+// Pagination limits of v1 list endpoints
+const (
+	defaultPageSize = 50
+	maxPageSize     = 500
+)
+
+// apiErrorBody describes a failed v1 request
+type apiErrorBody struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// apiErrorEnvelope is the body of every failed v1 request
+type apiErrorEnvelope struct {
+	Error apiErrorBody `json:"error"`
+}
+
+// apiList is the body of v1 list endpoints
+type apiList struct {
+	Items    interface{} `json:"items"`
+	Total    int         `json:"total"`
+	Page     int         `json:"page"`
+	PageSize int         `json:"pageSize"`
+}
+
+// apiParam documents a query parameter of a v1 route
+type apiParam struct {
+	Name        string
+	Type        string // OpenAPI type: "string", "integer" or "boolean"
+	Description string
+}
+
+// apiRoute is a v1 endpoint; the OpenAPI document is generated from these definitions
+type apiRoute struct {
+	Method  string
+	Path    string // Relative to /api/v1, path parameters in braces
+	Tag     string
+	Summary string
+	Query   []apiParam
+	Request interface{} // Zero value of the request body type, nil = no body
+	// Zero value of the response body type; nil = no content
+	// A slice is returned as a paginated list of its element type
+	Response    interface{}
+	Status      int  // Success status, 0 = 200
+	Conditional bool // Honours If-Match
+	handler     http.HandlerFunc
+}
+
+// errorCodes maps HTTP statuses to the machine-readable codes of the error envelope
+var errorCodes = map[int]string{
+	http.StatusBadRequest:          "bad_request",
+	http.StatusUnauthorized:        "unauthorized",
+	http.StatusForbidden:           "forbidden",
+	http.StatusNotFound:            "not_found",
+	http.StatusMethodNotAllowed:    "method_not_allowed",
+	http.StatusConflict:            "conflict",
+	http.StatusPreconditionFailed:  "precondition_failed",
+	http.StatusMisdirectedRequest:  "misdirected_request",
+	http.StatusTooManyRequests:     "too_many_requests",
+	http.StatusInternalServerError: "internal_error",
+}
+
+// isAPIv1 reports whether a path belongs to the versioned REST API
+func isAPIv1(path string) bool {
+	return strings.HasPrefix(path, apiV1Prefix)
+}
+
+// endpointKey returns the key a path is listed under in the permission and audit tables
+// v1 resources share the key of their collection, e.g. /api/v1/users/alice -> /api/v1/users
+func endpointKey(path string) string {
+	if !isAPIv1(path) {
+		return path
+	}
+	resource := strings.SplitN(strings.TrimPrefix(path, apiV1Prefix), "/", 2)[0]
+	return apiV1Prefix + resource
+}
+
+// writeJSON writes a JSON response body with a status
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeAPIError writes the v1 error envelope
+func writeAPIError(w http.ResponseWriter, status int, message string) {
+	code, ok := errorCodes[status]
+	if !ok {
+		code = strings.ToLower(strings.ReplaceAll(http.StatusText(status), " ", "_"))
+	}
+	writeJSON(w, status, apiErrorEnvelope{Error: apiErrorBody{Code: code, Message: message}})
+}
+
+// writeError rejects a management request, as an error envelope for v1 and as plain text otherwise
+func writeError(w http.ResponseWriter, r *http.Request, status int, message string) {
+	if isAPIv1(r.URL.Path) {
+		writeAPIError(w, status, message)
+		return
+	}
+	http.Error(w, message, status)
+}
+
+// decodeBody decodes a JSON request body, rejecting unknown fields
+func decodeBody(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return false
+	}
+	return true
+}
+
+// etagSourcer is a resource whose representation holds runtime state that is not part of its entity tag
+type etagSourcer interface {
+	etagSource() interface{}
+}
+
+// etagOf returns the entity tag of a resource representation
+func etagOf(v interface{}) string {
+	if sourcer, ok := v.(etagSourcer); ok {
+		v = sourcer.etagSource()
+	}
+	data, _ := json.Marshal(v)
+	sum := sha256.Sum256(data)
+	return `"` + hex.EncodeToString(sum[:8]) + `"`
+}
+
+// writeResource writes a single resource with its ETag
+func writeResource(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("ETag", etagOf(v))
+	writeJSON(w, status, v)
+}
+
+// checkIfMatch enforces optimistic concurrency: when the request carries If-Match,
+// one of its entity tags must match the current representation of the resource
+func checkIfMatch(w http.ResponseWriter, r *http.Request, current interface{}) bool {
+	header := r.Header.Get("If-Match")
+	if header == "" || strings.TrimSpace(header) == "*" {
+		return true
+	}
+	etag := etagOf(current)
+	for _, candidate := range strings.Split(header, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(candidate), "W/") == etag {
+			return true
+		}
+	}
+	writeAPIError(w, http.StatusPreconditionFailed, "The resource was changed by another request; fetch it again and retry")
+	return false
+}
+
+// listParams are the pagination and sorting parameters of a list request
+type listParams struct {
+	Page     int
+	PageSize int
+	Sort     string // Field name
+	Desc     bool
+}
+
+// paginationParams documents the parameters shared by all list endpoints
+var paginationParams = []apiParam{
+	{Name: "page", Type: "integer", Description: "Page number, starting at 1"},
+	{Name: "pageSize", Type: "integer", Description: "Items per page (1-500, default 50)"},
+	{Name: "sort", Type: "string", Description: "Field to sort by, prefixed with - for descending order"},
+}
+
+// parseListParams reads page, pageSize and sort; sort must name one of the sortable fields
+func parseListParams(w http.ResponseWriter, r *http.Request, sortable []string, defaultSort string) (listParams, bool) {
+	query := r.URL.Query()
+	params := listParams{Page: 1, PageSize: defaultPageSize, Sort: defaultSort}
+
+	for name, target := range map[string]*int{"page": &params.Page, "pageSize": &params.PageSize} {
+		if value := query.Get(name); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed < 1 {
+				writeAPIError(w, http.StatusBadRequest, name+" must be a positive number")
+				return params, false
+			}
+			*target = parsed
+		}
+	}
+	if params.PageSize > maxPageSize {
+		params.PageSize = maxPageSize
+	}
+
+	if value := query.Get("sort"); value != "" {
+		params.Desc = strings.HasPrefix(value, "-")
+		params.Sort = strings.TrimPrefix(value, "-")
+		valid := false
+		for _, field := range sortable {
+			if field == params.Sort {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			writeAPIError(w, http.StatusBadRequest, "sort must be one of: "+strings.Join(sortable, ", "))
+			return params, false
+		}
+	}
+	return params, true
+}
+
+// bounds returns the slice bounds of the requested page within total items
+func (p listParams) bounds(total int) (int, int) {
+	start := (p.Page - 1) * p.PageSize
+	if start > total {
+		start = total
+	}
+	end := start + p.PageSize
+	if end > total {
+		end = total
+	}
+	return start, end
+}
+
+// ordered applies the requested sort direction to a less function
+func (p listParams) ordered(less func(i, j int) bool) func(i, j int) bool {
+	if p.Desc {
+		return func(i, j int) bool { return less(j, i) }
+	}
+	return less
+}
+
+// registerAPIv1 adds the v1 routes and the OpenAPI document to a mux
+func (wm *Manager) registerAPIv1(mux *http.ServeMux) {
+	routes := wm.apiV1Routes()
+
+	// Group the routes by path so unsupported methods get an error envelope
+	byPath := make(map[string][]apiRoute)
+	var paths []string
+	for _, route := range routes {
+		if _, ok := byPath[route.Path]; !ok {
+			paths = append(paths, route.Path)
+		}
+		byPath[route.Path] = append(byPath[route.Path], route)
+	}
+	for _, path := range paths {
+		pathRoutes := byPath[path]
+		mux.HandleFunc(strings.TrimSuffix(apiV1Prefix, "/")+path, func(w http.ResponseWriter, r *http.Request) {
+			for _, route := range pathRoutes {
+				if route.Method == r.Method {
+					route.handler(w, r)
+					return
+				}
+			}
+			methods := make([]string, 0, len(pathRoutes))
+			for _, route := range pathRoutes {
+				methods = append(methods, route.Method)
+			}
+			w.Header().Set("Allow", strings.Join(methods, ", "))
+			writeAPIError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		})
+	}
+
+	document := openAPIDocument(routes)
+	mux.HandleFunc(apiV1Prefix+"openapi.json", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeAPIError(w, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+		writeJSON(w, http.StatusOK, document)
+	})
+	mux.HandleFunc(apiV1Prefix, func(w http.ResponseWriter, r *http.Request) {
+		writeAPIError(w, http.StatusNotFound, "Unknown API endpoint")
+	})
+}
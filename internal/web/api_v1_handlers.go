@@ -0,0 +1,781 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"go-proxy-server/internal/acl"
+	"go-proxy-server/internal/auth"
+	"go-proxy-server/internal/config"
+	"go-proxy-server/internal/models"
+	"go-proxy-server/internal/proxy"
+)
+
+// apiUser is the v1 representation of a proxy user
+type apiUser struct {
+	Name      string    `json:"name"`
+	IP        string    `json:"ip"`
+	Group     string    `json:"group"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// apiUserCreate is the body of POST /users
+type apiUserCreate struct {
+	Name     string `json:"name"`
+	Password string `json:"password"`
+	IP       string `json:"ip"`
+	Group    string `json:"group"`
+}
+
+// apiUserUpdate is the body of PATCH /users/{name}; omitted fields are unchanged
+type apiUserUpdate struct {
+	Password *string `json:"password"`
+	IP       *string `json:"ip"`
+	Group    *string `json:"group"`
+}
+
+// apiWhitelistEntry is the v1 representation of a whitelisted IP
+type apiWhitelistEntry struct {
+	ID        uint      `json:"id"`
+	IP        string    `json:"ip"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// apiWhitelistCreate is the body of POST /whitelist
+type apiWhitelistCreate struct {
+	IP string `json:"ip"`
+}
+
+// apiListener is the v1 representation of a proxy listener
+type apiListener struct {
+	ID                  string   `json:"id"`
+	Type                string   `json:"type"`
+	Running             bool     `json:"running"`
+	Listen              string   `json:"listen"`
+	IPFamily            string   `json:"ipFamily"`
+	ListenEach          bool     `json:"listenEach"`
+	Addresses           []string `json:"addresses"` // Addresses the running listener is bound to
+	Port                int      `json:"port"`
+	BindListen          bool     `json:"bindListen"`
+	AutoStart           bool     `json:"autoStart"`
+	AuthMode            string   `json:"authMode"`
+	TLS                 bool     `json:"tls"`
+	TLSCert             string   `json:"tlsCert"`
+	TLSKey              string   `json:"tlsKey"`
+	UploadRate          int64    `json:"uploadRate"`
+	DownloadRate        int64    `json:"downloadRate"`
+	MaxConnections      int32    `json:"maxConnections"`
+	MaxConnectionsPerIP int32    `json:"maxConnectionsPerIP"`
+}
+
+// etagSource leaves out the runtime state, so starting or stopping a listener does not change its entity tag
+func (l apiListener) etagSource() interface{} {
+	l.Running, l.Addresses = false, nil
+	return l
+}
+
+// apiListenerCreate is the body of POST /listeners; the listener is created stopped
+type apiListenerCreate struct {
+	ID                  string `json:"id"`
+	Type                string `json:"type"`
+	Listen              string `json:"listen"`
+	IPFamily            string `json:"ipFamily"`
+	ListenEach          bool   `json:"listenEach"`
+	Port                int    `json:"port"`
+	BindListen          bool   `json:"bindListen"`
+	AutoStart           bool   `json:"autoStart"`
+	AuthMode            string `json:"authMode"`
+	TLS                 bool   `json:"tls"`
+	TLSCert             string `json:"tlsCert"`
+	TLSKey              string `json:"tlsKey"`
+	UploadRate          int64  `json:"uploadRate"`
+	DownloadRate        int64  `json:"downloadRate"`
+	MaxConnections      int32  `json:"maxConnections"`
+	MaxConnectionsPerIP int32  `json:"maxConnectionsPerIP"`
+}
+
+// apiListenerUpdate is the body of PATCH /listeners/{id}; omitted fields are unchanged
+// Listen address, IP family, port, bindListen, authMode and TLS settings can only be changed while the listener is stopped;
+// bandwidth and connection limits apply immediately
+type apiListenerUpdate struct {
+	Listen              *string `json:"listen"`
+	IPFamily            *string `json:"ipFamily"`
+	ListenEach          *bool   `json:"listenEach"`
+	Port                *int    `json:"port"`
+	BindListen          *bool   `json:"bindListen"`
+	AutoStart           *bool   `json:"autoStart"`
+	AuthMode            *string `json:"authMode"`
+	TLS                 *bool   `json:"tls"`
+	TLSCert             *string `json:"tlsCert"`
+	TLSKey              *string `json:"tlsKey"`
+	UploadRate          *int64  `json:"uploadRate"`
+	DownloadRate        *int64  `json:"downloadRate"`
+	MaxConnections      *int32  `json:"maxConnections"`
+	MaxConnectionsPerIP *int32  `json:"maxConnectionsPerIP"`
+}
+
+// apiV1Routes returns the routes of the v1 API
+func (wm *Manager) apiV1Routes() []apiRoute {
+	return []apiRoute{
+		{Method: http.MethodGet, Path: "/users", Tag: "users", Summary: "List proxy users",
+			Query: append([]apiParam{
+				{Name: "q", Type: "string", Description: "Only users whose name contains this text"},
+				{Name: "group", Type: "string", Description: "Only members of this group"},
+				{Name: "ip", Type: "string", Description: "Only users with this IP"},
+			}, paginationParams...),
+			Response: []apiUser{}, handler: wm.v1ListUsers},
+		{Method: http.MethodPost, Path: "/users", Tag: "users", Summary: "Create a proxy user",
+			Request: apiUserCreate{}, Response: apiUser{}, Status: http.StatusCreated, handler: wm.v1CreateUser},
+		{Method: http.MethodGet, Path: "/users/{name}", Tag: "users", Summary: "Get a proxy user",
+			Response: apiUser{}, handler: wm.v1GetUser},
+		{Method: http.MethodPatch, Path: "/users/{name}", Tag: "users", Summary: "Update a proxy user",
+			Request: apiUserUpdate{}, Response: apiUser{}, Conditional: true, handler: wm.v1UpdateUser},
+		{Method: http.MethodDelete, Path: "/users/{name}", Tag: "users", Summary: "Delete a proxy user",
+			Status: http.StatusNoContent, Conditional: true, handler: wm.v1DeleteUser},
+
+		{Method: http.MethodGet, Path: "/whitelist", Tag: "whitelist", Summary: "List whitelisted IPs",
+			Query: append([]apiParam{
+				{Name: "q", Type: "string", Description: "Only entries whose IP contains this text"},
+			}, paginationParams...),
+			Response: []apiWhitelistEntry{}, handler: wm.v1ListWhitelist},
+		{Method: http.MethodPost, Path: "/whitelist", Tag: "whitelist", Summary: "Whitelist an IP",
+			Request: apiWhitelistCreate{}, Response: apiWhitelistEntry{}, Status: http.StatusCreated, handler: wm.v1CreateWhitelistEntry},
+		{Method: http.MethodGet, Path: "/whitelist/{id}", Tag: "whitelist", Summary: "Get a whitelist entry",
+			Response: apiWhitelistEntry{}, handler: wm.v1GetWhitelistEntry},
+		{Method: http.MethodDelete, Path: "/whitelist/{id}", Tag: "whitelist", Summary: "Remove a whitelist entry",
+			Status: http.StatusNoContent, Conditional: true, handler: wm.v1DeleteWhitelistEntry},
+
+		{Method: http.MethodGet, Path: "/listeners", Tag: "listeners", Summary: "List proxy listeners",
+			Query: append([]apiParam{
+				{Name: "running", Type: "boolean", Description: "Only running (true) or stopped (false) listeners"},
+				{Name: "type", Type: "string", Description: "Only listeners of this type (socks5 or http)"},
+			}, paginationParams...),
+			Response: []apiListener{}, handler: wm.v1ListListeners},
+		{Method: http.MethodPost, Path: "/listeners", Tag: "listeners", Summary: "Create a proxy listener",
+			Request: apiListenerCreate{}, Response: apiListener{}, Status: http.StatusCreated, handler: wm.v1CreateListener},
+		{Method: http.MethodGet, Path: "/listeners/{id}", Tag: "listeners", Summary: "Get a proxy listener",
+			Response: apiListener{}, handler: wm.v1GetListener},
+		{Method: http.MethodPatch, Path: "/listeners/{id}", Tag: "listeners", Summary: "Update a proxy listener",
+			Request: apiListenerUpdate{}, Response: apiListener{}, Conditional: true, handler: wm.v1UpdateListener},
+		{Method: http.MethodDelete, Path: "/listeners/{id}", Tag: "listeners", Summary: "Stop and delete a proxy listener",
+			Status: http.StatusNoContent, Conditional: true, handler: wm.v1DeleteListener},
+		{Method: http.MethodPost, Path: "/listeners/{id}/start", Tag: "listeners", Summary: "Start a proxy listener",
+			Response: apiListener{}, handler: wm.v1StartListener},
+		{Method: http.MethodPost, Path: "/listeners/{id}/stop", Tag: "listeners", Summary: "Stop a proxy listener",
+			Response: apiListener{}, handler: wm.v1StopListener},
+
+		{Method: http.MethodGet, Path: "/connections", Tag: "connections", Summary: "List active client connections",
+			Query: append([]apiParam{
+				{Name: "listener", Type: "string", Description: "Only connections accepted by this listener"},
+				{Name: "user", Type: "string", Description: "Only connections of this user"},
+				{Name: "ip", Type: "string", Description: "Only connections from this client IP"},
+			}, paginationParams...),
+			Response: []proxy.ActiveConnection{}, handler: wm.v1ListConnections},
+	}
+}
+
+// userFromModel converts a database row to its v1 representation
+func userFromModel(row models.User) apiUser {
+	return apiUser{
+		Name:      row.Username,
+		IP:        row.IP,
+		Group:     row.GroupName,
+		CreatedAt: row.CreatedAt,
+		UpdatedAt: row.UpdatedAt,
+	}
+}
+
+// findUser loads a user, writing a 404 envelope if it does not exist
+func (wm *Manager) findUser(w http.ResponseWriter, name string) (*apiUser, bool) {
+	var row models.User
+	err := wm.db.Where("username = ?", name).First(&row).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		writeAPIError(w, http.StatusNotFound, fmt.Sprintf("User '%s' not found", name))
+		return nil, false
+	} else if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err.Error())
+		return nil, false
+	}
+	user := userFromModel(row)
+	return &user, true
+}
+
+// v1ListUsers lists proxy users with filtering, sorting and pagination
+func (wm *Manager) v1ListUsers(w http.ResponseWriter, r *http.Request) {
+	params, ok := parseListParams(w, r, []string{"name", "ip", "group", "createdAt", "updatedAt"}, "name")
+	if !ok {
+		return
+	}
+	query := r.URL.Query()
+
+	db := wm.db.Model(&models.User{})
+	if q := query.Get("q"); q != "" {
+		// LIKE is case-sensitive on PostgreSQL, so both sides are lowered
+		db = db.Where("LOWER(username) LIKE ?", "%"+strings.ToLower(q)+"%")
+	}
+	if group := query.Get("group"); group != "" {
+		db = db.Where("group_name = ?", group)
+	}
+	if ip := query.Get("ip"); ip != "" {
+		db = db.Where("ip = ?", ip)
+	}
+	var rows []models.User
+	if err := db.Find(&rows).Error; err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	users := make([]apiUser, 0, len(rows))
+	for _, row := range rows {
+		users = append(users, userFromModel(row))
+	}
+	sort.SliceStable(users, params.ordered(func(i, j int) bool {
+		switch params.Sort {
+		case "ip":
+			return users[i].IP < users[j].IP
+		case "group":
+			return users[i].Group < users[j].Group
+		case "createdAt":
+			return users[i].CreatedAt.Before(users[j].CreatedAt)
+		case "updatedAt":
+			return users[i].UpdatedAt.Before(users[j].UpdatedAt)
+		}
+		return users[i].Name < users[j].Name
+	}))
+
+	start, end := params.bounds(len(users))
+	writeJSON(w, http.StatusOK, apiList{Items: users[start:end], Total: len(users), Page: params.Page, PageSize: params.PageSize})
+}
+
+// v1CreateUser creates a proxy user, optionally in a group
+func (wm *Manager) v1CreateUser(w http.ResponseWriter, r *http.Request) {
+	var req apiUserCreate
+	if !decodeBody(w, r, &req) {
+		return
+	}
+	if strings.TrimSpace(req.Name) == "" {
+		writeAPIError(w, http.StatusBadRequest, "name is required")
+		return
+	}
+
+	wm.userMu.Lock()
+	defer wm.userMu.Unlock()
+	var count int64
+	if err := wm.db.Model(&models.User{}).Where("username = ?", req.Name).Count(&count).Error; err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if count > 0 {
+		writeAPIError(w, http.StatusConflict, fmt.Sprintf("User '%s' already exists", req.Name))
+		return
+	}
+
+	if err := auth.AddUser(wm.db, req.IP, req.Name, req.Password); err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.Group != "" {
+		if err := acl.SetUserGroup(wm.db, req.Name, req.Group); err != nil {
+			// Do not leave a user without the requested group behind
+			auth.DeleteUser(wm.db, req.Name)
+			writeAPIError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if err := auth.LoadCredentialsFromDB(wm.db); err != nil {
+			writeAPIError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+
+	user, ok := wm.findUser(w, req.Name)
+	if !ok {
+		return
+	}
+	w.Header().Set("Location", apiV1Prefix+"users/"+user.Name)
+	writeResource(w, http.StatusCreated, user)
+}
+
+// v1GetUser returns a proxy user
+func (wm *Manager) v1GetUser(w http.ResponseWriter, r *http.Request) {
+	user, ok := wm.findUser(w, r.PathValue("name"))
+	if !ok {
+		return
+	}
+	writeResource(w, http.StatusOK, user)
+}
+
+// v1UpdateUser changes a proxy user's IP, password or group
+func (wm *Manager) v1UpdateUser(w http.ResponseWriter, r *http.Request) {
+	var req apiUserUpdate
+	if !decodeBody(w, r, &req) {
+		return
+	}
+
+	wm.userMu.Lock()
+	defer wm.userMu.Unlock()
+	user, ok := wm.findUser(w, r.PathValue("name"))
+	if !ok {
+		return
+	}
+	if !checkIfMatch(w, r, user) {
+		return
+	}
+
+	if req.IP != nil || req.Password != nil {
+		if err := auth.UpdateUser(wm.db, user.Name, req.IP, req.Password); err != nil {
+			writeAPIError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	if req.Group != nil {
+		if err := acl.SetUserGroup(wm.db, user.Name, *req.Group); err != nil {
+			writeAPIError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		// Local users carry their group in the credentials map
+		if err := auth.LoadCredentialsFromDB(wm.db); err != nil {
+			writeAPIError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+
+	if user, ok = wm.findUser(w, user.Name); ok {
+		writeResource(w, http.StatusOK, user)
+	}
+}
+
+// v1DeleteUser deletes a proxy user with its quota, limits, rule and schedule
+func (wm *Manager) v1DeleteUser(w http.ResponseWriter, r *http.Request) {
+	wm.userMu.Lock()
+	defer wm.userMu.Unlock()
+	user, ok := wm.findUser(w, r.PathValue("name"))
+	if !ok {
+		return
+	}
+	if !checkIfMatch(w, r, user) {
+		return
+	}
+	if err := auth.DeleteUser(wm.db, user.Name); err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// findWhitelistEntry loads a whitelist entry by its ID path parameter, writing an error envelope on failure
+func (wm *Manager) findWhitelistEntry(w http.ResponseWriter, r *http.Request) (*apiWhitelistEntry, bool) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "id must be a number")
+		return nil, false
+	}
+	var row models.Whitelist
+	err = wm.db.First(&row, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		writeAPIError(w, http.StatusNotFound, fmt.Sprintf("Whitelist entry %d not found", id))
+		return nil, false
+	} else if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err.Error())
+		return nil, false
+	}
+	return &apiWhitelistEntry{ID: row.ID, IP: row.IP, CreatedAt: row.CreatedAt}, true
+}
+
+// v1ListWhitelist lists whitelisted IPs with filtering, sorting and pagination
+func (wm *Manager) v1ListWhitelist(w http.ResponseWriter, r *http.Request) {
+	params, ok := parseListParams(w, r, []string{"id", "ip", "createdAt"}, "id")
+	if !ok {
+		return
+	}
+
+	db := wm.db.Model(&models.Whitelist{})
+	if q := r.URL.Query().Get("q"); q != "" {
+		db = db.Where("LOWER(ip) LIKE ?", "%"+strings.ToLower(q)+"%")
+	}
+	var rows []models.Whitelist
+	if err := db.Find(&rows).Error; err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	entries := make([]apiWhitelistEntry, 0, len(rows))
+	for _, row := range rows {
+		entries = append(entries, apiWhitelistEntry{ID: row.ID, IP: row.IP, CreatedAt: row.CreatedAt})
+	}
+	sort.SliceStable(entries, params.ordered(func(i, j int) bool {
+		switch params.Sort {
+		case "ip":
+			return entries[i].IP < entries[j].IP
+		case "createdAt":
+			return entries[i].CreatedAt.Before(entries[j].CreatedAt)
+		}
+		return entries[i].ID < entries[j].ID
+	}))
+
+	start, end := params.bounds(len(entries))
+	writeJSON(w, http.StatusOK, apiList{Items: entries[start:end], Total: len(entries), Page: params.Page, PageSize: params.PageSize})
+}
+
+// v1CreateWhitelistEntry whitelists an IP
+func (wm *Manager) v1CreateWhitelistEntry(w http.ResponseWriter, r *http.Request) {
+	var req apiWhitelistCreate
+	if !decodeBody(w, r, &req) {
+		return
+	}
+	var count int64
+	if err := wm.db.Model(&models.Whitelist{}).Where("ip = ?", req.IP).Count(&count).Error; err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if count > 0 {
+		writeAPIError(w, http.StatusConflict, "IP already in whitelist")
+		return
+	}
+	if err := auth.AddIPToWhitelist(wm.db, req.IP); err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var row models.Whitelist
+	if err := wm.db.Where("ip = ?", req.IP).First(&row).Error; err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	entry := apiWhitelistEntry{ID: row.ID, IP: row.IP, CreatedAt: row.CreatedAt}
+	w.Header().Set("Location", fmt.Sprintf("%swhitelist/%d", apiV1Prefix, entry.ID))
+	writeResource(w, http.StatusCreated, entry)
+}
+
+// v1GetWhitelistEntry returns a whitelist entry
+func (wm *Manager) v1GetWhitelistEntry(w http.ResponseWriter, r *http.Request) {
+	entry, ok := wm.findWhitelistEntry(w, r)
+	if !ok {
+		return
+	}
+	writeResource(w, http.StatusOK, entry)
+}
+
+// v1DeleteWhitelistEntry removes a whitelist entry
+func (wm *Manager) v1DeleteWhitelistEntry(w http.ResponseWriter, r *http.Request) {
+	entry, ok := wm.findWhitelistEntry(w, r)
+	if !ok {
+		return
+	}
+	if !checkIfMatch(w, r, entry) {
+		return
+	}
+	if err := auth.DeleteIPFromWhitelist(wm.db, entry.IP); err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// listenerFromServer returns the v1 representation of a proxy server (caller holds wm.mu)
+func listenerFromServer(server *ProxyServer) apiListener {
+	return apiListener{
+		ID:                  server.Name,
+		Type:                server.Type,
+		Running:             server.Running,
+		Listen:              server.ListenAddress,
+		IPFamily:            server.IPFamily,
+		ListenEach:          server.ListenEach,
+		Addresses:           server.addresses(),
+		Port:                server.Port,
+		BindListen:          server.BindListen,
+		AutoStart:           server.AutoStart,
+		AuthMode:            server.AuthMode,
+		TLS:                 server.TLS,
+		TLSCert:             server.TLSCert,
+		TLSKey:              server.TLSKey,
+		UploadRate:          server.UploadRate,
+		DownloadRate:        server.DownloadRate,
+		MaxConnections:      server.MaxConnections,
+		MaxConnectionsPerIP: server.MaxConnectionsPerIP,
+	}
+}
+
+// listenerByID returns the proxy server of a listener ID (caller holds wm.mu)
+func (wm *Manager) listenerByID(w http.ResponseWriter, id string) (*ProxyServer, bool) {
+	if server, ok := wm.servers[id]; ok {
+		return server, true
+	}
+	writeAPIError(w, http.StatusNotFound, fmt.Sprintf("Listener '%s' not found", id))
+	return nil, false
+}
+
+// v1ListListeners lists the proxy listeners
+func (wm *Manager) v1ListListeners(w http.ResponseWriter, r *http.Request) {
+	params, ok := parseListParams(w, r, []string{"id", "type", "port"}, "id")
+	if !ok {
+		return
+	}
+	var running *bool
+	if value := r.URL.Query().Get("running"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, "running must be true or false")
+			return
+		}
+		running = &parsed
+	}
+	listenerType := r.URL.Query().Get("type")
+
+	wm.mu.RLock()
+	listeners := make([]apiListener, 0, len(wm.servers))
+	for _, server := range wm.servers {
+		if (running == nil || server.Running == *running) && (listenerType == "" || server.Type == listenerType) {
+			listeners = append(listeners, listenerFromServer(server))
+		}
+	}
+	wm.mu.RUnlock()
+
+	sort.SliceStable(listeners, params.ordered(func(i, j int) bool {
+		switch params.Sort {
+		case "type":
+			if listeners[i].Type != listeners[j].Type {
+				return listeners[i].Type < listeners[j].Type
+			}
+		case "port":
+			if listeners[i].Port != listeners[j].Port {
+				return listeners[i].Port < listeners[j].Port
+			}
+		}
+		return listeners[i].ID < listeners[j].ID
+	}))
+
+	start, end := params.bounds(len(listeners))
+	writeJSON(w, http.StatusOK, apiList{Items: listeners[start:end], Total: len(listeners), Page: params.Page, PageSize: params.PageSize})
+}
+
+// v1CreateListener creates a stopped proxy listener
+func (wm *Manager) v1CreateListener(w http.ResponseWriter, r *http.Request) {
+	var req apiListenerCreate
+	if !decodeBody(w, r, &req) {
+		return
+	}
+
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
+	server, err := wm.addListener(models.ProxyConfig{
+		Name:                req.ID,
+		Type:                req.Type,
+		ListenAddress:       req.Listen,
+		IPFamily:            req.IPFamily,
+		ListenEach:          req.ListenEach,
+		Port:                req.Port,
+		BindListen:          req.BindListen,
+		AutoStart:           req.AutoStart,
+		AuthMode:            req.AuthMode,
+		TLS:                 req.TLS,
+		TLSCert:             req.TLSCert,
+		TLSKey:              req.TLSKey,
+		UploadRate:          req.UploadRate,
+		DownloadRate:        req.DownloadRate,
+		MaxConnections:      req.MaxConnections,
+		MaxConnectionsPerIP: req.MaxConnectionsPerIP,
+	})
+	if errors.Is(err, errListenerExists) {
+		writeAPIError(w, http.StatusConflict, fmt.Sprintf("Listener '%s' already exists", req.ID))
+		return
+	} else if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeResource(w, http.StatusCreated, listenerFromServer(server))
+}
+
+// v1GetListener returns a proxy listener
+func (wm *Manager) v1GetListener(w http.ResponseWriter, r *http.Request) {
+	wm.mu.RLock()
+	defer wm.mu.RUnlock()
+	server, ok := wm.listenerByID(w, r.PathValue("id"))
+	if !ok {
+		return
+	}
+	writeResource(w, http.StatusOK, listenerFromServer(server))
+}
+
+// v1UpdateListener changes a listener's configuration; bandwidth and connection limits apply immediately
+func (wm *Manager) v1UpdateListener(w http.ResponseWriter, r *http.Request) {
+	var req apiListenerUpdate
+	if !decodeBody(w, r, &req) {
+		return
+	}
+
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
+	server, ok := wm.listenerByID(w, r.PathValue("id"))
+	if !ok {
+		return
+	}
+	if !checkIfMatch(w, r, listenerFromServer(server)) {
+		return
+	}
+
+	updated := server.ProxyConfig
+	if req.Listen != nil {
+		updated.ListenAddress = *req.Listen
+	}
+	if req.IPFamily != nil {
+		updated.IPFamily = *req.IPFamily
+	}
+	if req.ListenEach != nil {
+		updated.ListenEach = *req.ListenEach
+	}
+	if req.Port != nil {
+		updated.Port = *req.Port
+	}
+	if req.BindListen != nil {
+		updated.BindListen = *req.BindListen
+	}
+	if req.AuthMode != nil {
+		updated.AuthMode = *req.AuthMode
+	}
+	if req.TLS != nil {
+		updated.TLS = *req.TLS
+	}
+	if req.TLSCert != nil {
+		updated.TLSCert = *req.TLSCert
+	}
+	if req.TLSKey != nil {
+		updated.TLSKey = *req.TLSKey
+	}
+	if server.Running && !sameListenerBinding(server.ProxyConfig, updated) {
+		writeAPIError(w, http.StatusConflict, "Stop the listener before changing its listen, ipFamily, listenEach, port, bindListen, authMode or TLS settings")
+		return
+	}
+	if req.AutoStart != nil {
+		updated.AutoStart = *req.AutoStart
+	}
+	if req.UploadRate != nil {
+		updated.UploadRate = *req.UploadRate
+	}
+	if req.DownloadRate != nil {
+		updated.DownloadRate = *req.DownloadRate
+	}
+	if req.MaxConnections != nil {
+		updated.MaxConnections = *req.MaxConnections
+	}
+	if req.MaxConnectionsPerIP != nil {
+		updated.MaxConnectionsPerIP = *req.MaxConnectionsPerIP
+	}
+
+	if err := config.ValidateProxyConfig(&updated); err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := config.SaveProxyConfig(wm.db, &updated); err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	server.ProxyConfig = updated
+	// Bandwidth and connection limits apply immediately, even to running proxies
+	applyListenerLimits(server)
+	writeResource(w, http.StatusOK, listenerFromServer(server))
+}
+
+// sameListenerBinding reports whether two configurations accept connections the same way,
+// i.e. whether a running listener can switch from one to the other without a restart
+func sameListenerBinding(a, b models.ProxyConfig) bool {
+	return a.ListenAddress == b.ListenAddress && a.IPFamily == b.IPFamily && a.ListenEach == b.ListenEach &&
+		a.Port == b.Port && a.BindListen == b.BindListen &&
+		a.AuthMode == b.AuthMode && a.TLS == b.TLS && a.TLSCert == b.TLSCert && a.TLSKey == b.TLSKey
+}
+
+// v1DeleteListener stops a listener and deletes its configuration
+func (wm *Manager) v1DeleteListener(w http.ResponseWriter, r *http.Request) {
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
+	server, ok := wm.listenerByID(w, r.PathValue("id"))
+	if !ok {
+		return
+	}
+	if !checkIfMatch(w, r, listenerFromServer(server)) {
+		return
+	}
+	if err := wm.removeListener(server); err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// v1StartListener starts a listener on its configured port
+func (wm *Manager) v1StartListener(w http.ResponseWriter, r *http.Request) {
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
+	server, ok := wm.listenerByID(w, r.PathValue("id"))
+	if !ok {
+		return
+	}
+	if server.Running {
+		writeAPIError(w, http.StatusConflict, "Listener already running")
+		return
+	}
+	if server.Port == 0 {
+		writeAPIError(w, http.StatusBadRequest, "Set the listener's port before starting it")
+		return
+	}
+	if err := wm.startProxy(server); err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeResource(w, http.StatusOK, listenerFromServer(server))
+}
+
+// v1StopListener stops a listener
+func (wm *Manager) v1StopListener(w http.ResponseWriter, r *http.Request) {
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
+	server, ok := wm.listenerByID(w, r.PathValue("id"))
+	if !ok {
+		return
+	}
+	if !server.Running {
+		writeAPIError(w, http.StatusConflict, "Listener not running")
+		return
+	}
+	wm.stopProxy(server)
+	writeResource(w, http.StatusOK, listenerFromServer(server))
+}
+
+// v1ListConnections lists the client connections currently open on the proxy listeners
+func (wm *Manager) v1ListConnections(w http.ResponseWriter, r *http.Request) {
+	params, ok := parseListParams(w, r, []string{"id", "startedAt", "bytesIn", "bytesOut"}, "id")
+	if !ok {
+		return
+	}
+	query := r.URL.Query()
+	listener, user, ip := query.Get("listener"), query.Get("user"), query.Get("ip")
+
+	connections := make([]proxy.ActiveConnection, 0)
+	for _, conn := range proxy.ListConnections() {
+		if (listener == "" || conn.Listener == listener) && (user == "" || conn.Username == user) && (ip == "" || conn.ClientIP == ip) {
+			connections = append(connections, conn)
+		}
+	}
+
+	sort.SliceStable(connections, params.ordered(func(i, j int) bool {
+		switch params.Sort {
+		case "startedAt":
+			return connections[i].StartedAt.Before(connections[j].StartedAt)
+		case "bytesIn":
+			return connections[i].BytesIn < connections[j].BytesIn
+		case "bytesOut":
+			return connections[i].BytesOut < connections[j].BytesOut
+		}
+		return connections[i].ID < connections[j].ID
+	}))
+
+	start, end := params.bounds(len(connections))
+	writeJSON(w, http.StatusOK, apiList{Items: connections[start:end], Total: len(connections), Page: params.Page, PageSize: params.PageSize})
+}
@@ -0,0 +1,284 @@
+package web
+
+import (
+	"net/http"
+	"strconv"
+
+	"go-proxy-server/internal/acl"
+	"go-proxy-server/internal/admin"
+	"go-proxy-server/internal/audit"
+	"go-proxy-server/internal/auth"
+	"go-proxy-server/internal/config"
+	"go-proxy-server/internal/configfile"
+	"go-proxy-server/internal/logger"
+	"go-proxy-server/internal/models"
+	"go-proxy-server/internal/quota"
+	"go-proxy-server/internal/schedule"
+)
+
+// snapshotFunc returns the state an API endpoint changes, keyed so that changes diff field by field
+// Passwords, secrets and hashes must never be part of a snapshot
+type snapshotFunc func(wm *Manager, r *http.Request) (interface{}, error)
+
+// auditSnapshots lists the state captured before and after changes per API endpoint
+// Changes to endpoints without a snapshot are recorded without a diff
+var auditSnapshots = map[string]snapshotFunc{
+	"/api/users":                 snapshotUsers,
+	"/api/users/group":           snapshotUsers,
+	"/api/users/limits":          snapshotUserLimits,
+	"/api/whitelist":             snapshotWhitelist,
+	"/api/quotas":                snapshotQuotas,
+	"/api/quotas/reset":          snapshotQuotas,
+	"/api/groups":                snapshotGroups,
+	"/api/acl":                   snapshotAccessRules,
+	"/api/schedules":             snapshotSchedules,
+	"/api/schedules/assignments": snapshotScheduleAssignments,
+	"/api/auth/config":           snapshotAuthConfig,
+	"/api/proxy/start":           snapshotProxies,
+	"/api/proxy/stop":            snapshotProxies,
+	"/api/proxy/config":          snapshotProxies,
+	"/api/config":                snapshotConfig,
+	"/api/config/import":         snapshotConfigFile,
+	"/api/admins":                snapshotAdmins,
+	"/api/admins/role":           snapshotAdmins,
+	"/api/admins/totp":           snapshotAdmins,
+	"/api/tokens":                snapshotTokens,
+	"/api/totp":                  snapshotTOTP,
+	"/api/totp/activate":         snapshotTOTP,
+	"/api/totp/recovery-codes":   snapshotTOTP,
+	"/api/totp/devices":          snapshotTOTP,
+	"/api/v1/users":              snapshotUsers,
+	"/api/v1/whitelist":          snapshotWhitelist,
+	"/api/v1/listeners":          snapshotProxies,
+}
+
+// statusRecorder captures the status code written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (rec *statusRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *statusRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	return rec.ResponseWriter.Write(b)
+}
+
+// Flush lets handlers flush responses through the recorder
+func (rec *statusRecorder) Flush() {
+	if f, ok := rec.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// serveAudited runs an authenticated API handler and records state-changing requests in the audit trail
+func (wm *Manager) serveAudited(w http.ResponseWriter, r *http.Request, next http.Handler) {
+	if !isStateChanging(r.Method) {
+		next.ServeHTTP(w, r)
+		return
+	}
+
+	snapshot := auditSnapshots[endpointKey(r.URL.Path)]
+	var before interface{}
+	if snapshot != nil {
+		var err error
+		if before, err = snapshot(wm, r); err != nil {
+			logger.Warn("Failed to capture audit snapshot of %s: %v", r.URL.Path, err)
+			snapshot = nil
+		}
+	}
+
+	rec := &statusRecorder{ResponseWriter: w}
+	next.ServeHTTP(rec, r)
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+
+	entry := audit.Entry{
+		Actor:    adminFromRequest(r),
+		SourceIP: clientIP(r),
+		Method:   r.Method,
+		Endpoint: r.URL.Path,
+		Status:   rec.status,
+	}
+	// Failed requests changed nothing, but the attempt is still recorded
+	if snapshot != nil && rec.status < http.StatusBadRequest {
+		after, err := snapshot(wm, r)
+		if err == nil {
+			entry.Changes, err = audit.Diff(before, after)
+		}
+		if err != nil {
+			logger.Warn("Failed to compare audit snapshots of %s: %v", r.URL.Path, err)
+		}
+	}
+	if err := audit.Record(wm.db, entry); err != nil {
+		logger.Error("Failed to record audit entry for %s %s by %s: %v", r.Method, r.URL.Path, entry.Actor, err)
+	}
+}
+
+// snapshotConfigFile returns the configuration a declarative configuration file manages
+func snapshotConfigFile(wm *Manager, r *http.Request) (interface{}, error) {
+	doc, err := configfile.Export(wm.db)
+	if err != nil {
+		return nil, err
+	}
+	return configfile.Snapshot(doc), nil
+}
+
+// snapshotUsers returns the proxy users by username (without password hashes)
+func snapshotUsers(wm *Manager, r *http.Request) (interface{}, error) {
+	var users []models.User
+	if err := wm.db.Find(&users).Error; err != nil {
+		return nil, err
+	}
+	type user struct {
+		IP    string `json:"ip"`
+		Group string `json:"group"`
+	}
+	result := make(map[string]user, len(users))
+	for _, u := range users {
+		result[u.Username] = user{IP: u.IP, Group: u.GroupName}
+	}
+	return result, nil
+}
+
+// snapshotUserLimits returns the per-user limit overrides by username
+func snapshotUserLimits(wm *Manager, r *http.Request) (interface{}, error) {
+	var users []models.User
+	if err := wm.db.Find(&users).Error; err != nil {
+		return nil, err
+	}
+	result := make(map[string]config.UserLimits)
+	for _, u := range users {
+		if override, ok := config.GetUserLimitOverride(u.Username); ok {
+			result[u.Username] = override
+		}
+	}
+	return result, nil
+}
+
+// snapshotWhitelist returns the whitelisted IPs
+func snapshotWhitelist(wm *Manager, r *http.Request) (interface{}, error) {
+	result := make(map[string]bool)
+	for _, ip := range auth.GetWhitelistIPs() {
+		result[ip] = true
+	}
+	return result, nil
+}
+
+// snapshotQuotas returns the traffic quotas and usage by username
+func snapshotQuotas(wm *Manager, r *http.Request) (interface{}, error) {
+	result := make(map[string]quota.Usage)
+	if manager := quota.GetManager(); manager != nil {
+		for _, usage := range manager.ListUsage() {
+			result[usage.Username] = usage
+		}
+	}
+	return result, nil
+}
+
+// snapshotGroups returns the user groups by name
+func snapshotGroups(wm *Manager, r *http.Request) (interface{}, error) {
+	groups, err := acl.ListGroups(wm.db)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]acl.Group, len(groups))
+	for _, group := range groups {
+		result[group.Name] = group
+	}
+	return result, nil
+}
+
+// snapshotAccessRules returns the access rules by scope and subject
+func snapshotAccessRules(wm *Manager, r *http.Request) (interface{}, error) {
+	rules, err := acl.ListRules(wm.db)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]acl.Rule, len(rules))
+	for _, rule := range rules {
+		result[rule.Scope+":"+rule.Subject] = rule
+	}
+	return result, nil
+}
+
+// snapshotSchedules returns the schedule definitions by name
+func snapshotSchedules(wm *Manager, r *http.Request) (interface{}, error) {
+	schedules, err := schedule.ListSchedules(wm.db)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]schedule.Definition, len(schedules))
+	for _, definition := range schedules {
+		result[definition.Name] = definition
+	}
+	return result, nil
+}
+
+// snapshotScheduleAssignments returns the assigned schedule names by scope and subject
+func snapshotScheduleAssignments(wm *Manager, r *http.Request) (interface{}, error) {
+	assignments, err := schedule.ListAssignments(wm.db)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]string, len(assignments))
+	for _, assignment := range assignments {
+		result[assignment.Scope+":"+assignment.Subject] = assignment.Schedule
+	}
+	return result, nil
+}
+
+// snapshotAuthConfig returns the authentication backend configuration without secrets
+func snapshotAuthConfig(wm *Manager, r *http.Request) (interface{}, error) {
+	return redactedAuthConfig(), nil
+}
+
+// snapshotProxies returns the state and configuration of the proxy servers
+func snapshotProxies(wm *Manager, r *http.Request) (interface{}, error) {
+	return wm.proxyStatus(), nil
+}
+
+// snapshotConfig returns the unified configuration
+func snapshotConfig(wm *Manager, r *http.Request) (interface{}, error) {
+	return wm.currentConfig(), nil
+}
+
+// snapshotAdmins returns the admin accounts by username
+func snapshotAdmins(wm *Manager, r *http.Request) (interface{}, error) {
+	admins, err := admin.List(wm.db)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]admin.Admin, len(admins))
+	for _, a := range admins {
+		result[a.Username] = a
+	}
+	return result, nil
+}
+
+// snapshotTokens returns the API tokens of the requesting admin by ID
+func snapshotTokens(wm *Manager, r *http.Request) (interface{}, error) {
+	tokens, err := admin.ListTokens(wm.db, adminFromRequest(r))
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]admin.Token, len(tokens))
+	for _, token := range tokens {
+		result[strconv.FormatUint(uint64(token.ID), 10)] = token
+	}
+	return result, nil
+}
+
+// snapshotTOTP returns the two-factor authentication state of the requesting admin
+func snapshotTOTP(wm *Manager, r *http.Request) (interface{}, error) {
+	return admin.GetTOTPStatus(wm.db, adminFromRequest(r))
+}
@@ -0,0 +1,60 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"go-proxy-server/internal/database"
+	"go-proxy-server/internal/logger"
+)
+
+// handleBackup takes an online backup of the SQLite database and returns it as a download (GET)
+func (wm *Manager) handleBackup(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	dir, err := os.MkdirTemp("", "go-proxy-server-backup-")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "data.db")
+	if err := database.Backup(wm.db, path); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, database.ErrBackupUnsupported) {
+			status = http.StatusNotImplemented
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	name := fmt.Sprintf("go-proxy-server-%s.db", time.Now().Format("20060102-150405"))
+	w.Header().Set("Content-Type", "application/vnd.sqlite3")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, name))
+	w.Header().Set("Content-Length", fmt.Sprint(info.Size()))
+	if _, err := io.Copy(w, file); err != nil {
+		logger.Warn("Failed to send database backup: %v", err)
+		return
+	}
+	logger.Info("Database backup downloaded from %s", r.RemoteAddr)
+}
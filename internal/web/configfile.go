@@ -0,0 +1,125 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"go-proxy-server/internal/configfile"
+	"go-proxy-server/internal/logger"
+)
+
+// maxConfigFileSize limits the configuration files accepted by /api/config/import
+const maxConfigFileSize = 8 << 20
+
+// configFileContentTypes maps the configuration file formats to their media types
+var configFileContentTypes = map[string]string{
+	configfile.FormatYAML: "application/yaml",
+	configfile.FormatTOML: "application/toml",
+	configfile.FormatJSON: "application/json",
+}
+
+// handleConfigExport returns the complete configuration as a declarative configuration file (GET, ?format=yaml|toml|json)
+func (wm *Manager) handleConfigExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = configfile.FormatYAML
+	}
+	contentType, ok := configFileContentTypes[format]
+	if !ok {
+		http.Error(w, "format must be yaml, toml or json", http.StatusBadRequest)
+		return
+	}
+
+	doc, err := configfile.Export(wm.db)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	data, err := configfile.Marshal(doc, format)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="proxy-server.%s"`, format))
+	w.Write(data)
+}
+
+// handleConfigImport compares a configuration file with the current configuration and applies it (POST)
+// The file is the request body, in the format given by ?format or the Content-Type (default YAML);
+// ?mode selects file-wins (default) or db-wins and ?dryRun=true only returns the changes
+func (wm *Manager) handleConfigImport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	format := query.Get("format")
+	if format == "" {
+		format = configfile.FormatYAML
+		if mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err == nil {
+			for name, contentType := range configFileContentTypes {
+				if mediaType == contentType {
+					format = name
+				}
+			}
+		}
+	}
+	mode := query.Get("mode")
+	if mode == "" {
+		mode = configfile.ModeFileWins
+	}
+	dryRun := false
+	if value := query.Get("dryRun"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			http.Error(w, "dryRun must be true or false", http.StatusBadRequest)
+			return
+		}
+		dryRun = parsed
+	}
+
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxConfigFileSize))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to read configuration file: %v", err), http.StatusBadRequest)
+		return
+	}
+	file, err := configfile.Parse(data, format)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	plan, err := configfile.Prepare(wm.db, file, mode)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// Applying reloads the configuration, including the listeners through reloadListeners
+	if !dryRun {
+		if err := plan.Apply(wm.db); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		logger.Info("Configuration file imported (%s, %d changes)", mode, len(plan.Changes))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"mode":    plan.Mode,
+		"dryRun":  dryRun,
+		"applied": !dryRun && len(plan.Changes) > 0,
+		"changes": plan.Changes,
+	})
+}
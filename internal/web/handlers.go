@@ -1,19 +1,30 @@
 package web
 
 import (
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
+	"go-proxy-server/internal/acl"
+	"go-proxy-server/internal/admin"
+	"go-proxy-server/internal/audit"
 	"go-proxy-server/internal/auth"
 	"go-proxy-server/internal/autostart"
 	"go-proxy-server/internal/config"
+	"go-proxy-server/internal/logger"
 	"go-proxy-server/internal/metrics"
 	"go-proxy-server/internal/models"
+	"go-proxy-server/internal/proxy"
+	"go-proxy-server/internal/quota"
+	"go-proxy-server/internal/schedule"
+	"go-proxy-server/internal/upgrade"
 )
 
 // StartServer starts the web management server
@@ -22,48 +33,152 @@ func (wm *Manager) StartServer() error {
 	mux := http.NewServeMux()
 
 	// Setup API routes
+	mux.HandleFunc("/api/setup", wm.handleSetup)
+	mux.HandleFunc("/api/login", wm.handleLogin)
+	mux.HandleFunc("/api/logout", wm.handleLogout)
+	mux.HandleFunc("/api/session", wm.handleSession)
+	mux.HandleFunc("/api/admins", wm.handleAdmins)
+	mux.HandleFunc("/api/admins/password", wm.handleAdminPassword)
+	mux.HandleFunc("/api/admins/role", wm.handleAdminRole)
+	mux.HandleFunc("/api/login/verify", wm.handleLoginVerify)
+	mux.HandleFunc("/api/tokens", wm.handleTokens)
+	mux.HandleFunc("/api/totp", wm.handleTOTP)
+	mux.HandleFunc("/api/totp/enroll", wm.handleTOTPEnroll)
+	mux.HandleFunc("/api/totp/activate", wm.handleTOTPActivate)
+	mux.HandleFunc("/api/totp/recovery-codes", wm.handleTOTPRecoveryCodes)
+	mux.HandleFunc("/api/totp/devices", wm.handleTOTPDevices)
+	mux.HandleFunc("/api/admins/totp", wm.handleAdminTOTP)
 	mux.HandleFunc("/api/status", wm.handleStatus)
 	mux.HandleFunc("/api/users", wm.handleUsers)
+	mux.HandleFunc("/api/users/limits", wm.handleUserLimits)
 	mux.HandleFunc("/api/whitelist", wm.handleWhitelist)
+	mux.HandleFunc("/api/quotas", wm.handleQuotas)
+	mux.HandleFunc("/api/quotas/reset", wm.handleQuotaReset)
+	mux.HandleFunc("/api/groups", wm.handleGroups)
+	mux.HandleFunc("/api/users/group", wm.handleUserGroup)
+	mux.HandleFunc("/api/acl", wm.handleAccessRules)
+	mux.HandleFunc("/api/schedules", wm.handleSchedules)
+	mux.HandleFunc("/api/schedules/assignments", wm.handleScheduleAssignments)
+	mux.HandleFunc("/api/auth/config", wm.handleAuthConfig)
+	mux.HandleFunc("/api/auth/test", wm.handleAuthTest)
 	mux.HandleFunc("/api/proxy/start", wm.handleProxyStart)
 	mux.HandleFunc("/api/proxy/stop", wm.handleProxyStop)
 	mux.HandleFunc("/api/proxy/config", wm.handleProxyConfig)
 	mux.HandleFunc("/api/config", wm.handleConfig)
+	mux.HandleFunc("/api/config/export", wm.handleConfigExport)
+	mux.HandleFunc("/api/config/import", wm.handleConfigImport)
+	mux.HandleFunc("/api/backup", wm.handleBackup)
 	mux.HandleFunc("/api/metrics/realtime", wm.handleMetricsRealtime)
 	mux.HandleFunc("/api/metrics/history", wm.handleMetricsHistory)
+	mux.HandleFunc("/api/limiter/stats", wm.handleLimiterStats)
 	mux.HandleFunc("/api/shutdown", wm.handleShutdown)
+	mux.HandleFunc("/api/upgrade", wm.handleUpgrade)
+	mux.HandleFunc("/api/audit", wm.handleAudit)
+
+	// Versioned REST API and its OpenAPI document
+	wm.registerAPIv1(mux)
 
 	// Static files and SPA fallback (must be last)
 	mux.HandleFunc("/", wm.handleIndex)
 
 	// Create listener
-	addr := fmt.Sprintf("localhost:%d", wm.webPort)
-	listener, err := net.Listen("tcp", addr)
+	cfg := config.GetWebConfig()
+	allowed, err := cfg.AllowedNetworks()
+	if err != nil {
+		return err
+	}
+	listener, err := wm.listen(cfg)
 	if err != nil {
 		return fmt.Errorf("failed to start web server: %w", err)
 	}
 
-	// Get actual port (useful when port is 0 for random assignment)
-	actualPort := listener.Addr().(*net.TCPAddr).Port
-	wm.SetActualPort(actualPort)
+	var tlsCfg *tls.Config
+	if cfg.TLS {
+		if tlsCfg, err = tlsConfig(cfg); err != nil {
+			listener.Close()
+			return err
+		}
+	}
+
+	wm.mu.Lock()
+	wm.webConfig = cfg
+	wm.allowedNetworks = allowed
+	wm.mu.Unlock()
 
 	// Print URL with actual port
-	fmt.Printf("Web management interface started at http://localhost:%d\n", actualPort)
-	fmt.Printf("Open your browser and visit: http://localhost:%d\n", actualPort)
+	url := wm.URL()
+	fmt.Printf("Web management interface started at %s\n", url)
+	if !cfg.IsUnixSocket() {
+		fmt.Printf("Open your browser and visit: %s\n", url)
+	}
+	if !cfg.IsLoopbackOnly() {
+		logger.Info("Web management interface listening on %s", listener.Addr())
+		if !cfg.TLS {
+			logger.Warn("Web management interface is reachable from the network without TLS; enable -tls to protect passwords")
+		}
+		if len(allowed) == 0 {
+			logger.Warn("Web management interface has no IP allowlist; consider -allow to restrict access")
+		}
+	}
 
 	// Create HTTP server with graceful shutdown support
 	wm.webHttpServer = &http.Server{
-		Handler: mux,
+		Handler:           wm.protect(mux),
+		TLSConfig:         tlsCfg,
+		ReadHeaderTimeout: 10 * time.Second,
 	}
 
+	// Proxies and the web interface are up; a process started by an upgrade lets the old one hand over now
+	upgrade.Ready()
+
 	// Start serving (this will block until Shutdown is called)
-	if err := wm.webHttpServer.Serve(listener); err != nil && err != http.ErrServerClosed {
+	if tlsCfg != nil {
+		err = wm.webHttpServer.ServeTLS(listener, "", "")
+	} else {
+		err = wm.webHttpServer.Serve(listener)
+	}
+	// After a handoff the upgraded process serves the interface
+	if err != nil && err != http.ErrServerClosed && !upgrade.IsHandedOff() {
 		return err
 	}
 
 	return nil
 }
 
+// listen opens the configured TCP address or unix socket and records the actual port
+func (wm *Manager) listen(cfg config.WebConfig) (net.Listener, error) {
+	if cfg.IsUnixSocket() {
+		path := cfg.SocketPath()
+		// Remove a socket left behind by a previous run, unless the upgraded process handed it over
+		if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSocket != 0 && !upgrade.Inherits("unix", path) {
+			os.Remove(path)
+		}
+		listener, err := upgrade.Listen("unix", path)
+		if err != nil {
+			return nil, err
+		}
+		// Access is controlled by the socket's file permissions
+		if err := os.Chmod(path, 0660); err != nil {
+			listener.Close()
+			return nil, err
+		}
+		return listener, nil
+	}
+
+	port := wm.webPort
+	if port == 0 {
+		port = cfg.Port
+	}
+	listener, err := upgrade.Listen("tcp", net.JoinHostPort(cfg.Listen, strconv.Itoa(port)))
+	if err != nil {
+		return nil, err
+	}
+
+	// Get actual port (useful when port is 0 for random assignment)
+	wm.SetActualPort(listener.Addr().(*net.TCPAddr).Port)
+	return listener, nil
+}
+
 // handleIndex serves the static files and SPA fallback
 func (wm *Manager) handleIndex(w http.ResponseWriter, r *http.Request) {
 	// If requesting API path, return 404
@@ -99,26 +214,73 @@ func (wm *Manager) handleStatus(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(wm.proxyStatus())
+}
+
+// proxyStatus returns the state and configuration of the proxy listeners by name
+func (wm *Manager) proxyStatus() map[string]interface{} {
 	wm.mu.RLock()
 	defer wm.mu.RUnlock()
 
-	status := map[string]interface{}{
-		"socks5": map[string]interface{}{
-			"running":    wm.socksServer.Running,
-			"port":       wm.socksServer.Port,
-			"bindListen": wm.socksServer.BindListen,
-			"autoStart":  wm.socksServer.AutoStart,
-		},
-		"http": map[string]interface{}{
-			"running":    wm.httpServer.Running,
-			"port":       wm.httpServer.Port,
-			"bindListen": wm.httpServer.BindListen,
-			"autoStart":  wm.httpServer.AutoStart,
-		},
+	status := make(map[string]interface{}, len(wm.servers)+2)
+	// The original API always reported a socks5 and an http proxy
+	for _, name := range []string{config.ListenerSOCKS5, config.ListenerHTTP} {
+		server, _ := wm.legacyServer(name)
+		status[name] = serverStatus(server)
+	}
+	for name, server := range wm.servers {
+		status[name] = serverStatus(server)
 	}
+	return status
+}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(status)
+// serverStatus returns the status entry of a listener (caller holds wm.mu)
+func serverStatus(server *ProxyServer) map[string]interface{} {
+	return map[string]interface{}{
+		"type":                server.Type,
+		"running":             server.Running,
+		"listen":              server.ListenAddress,
+		"ipFamily":            server.IPFamily,
+		"listenEach":          server.ListenEach,
+		"addresses":           server.addresses(),
+		"port":                server.Port,
+		"bindListen":          server.BindListen,
+		"autoStart":           server.AutoStart,
+		"authMode":            server.AuthMode,
+		"tls":                 server.TLS,
+		"uploadRate":          server.UploadRate,
+		"downloadRate":        server.DownloadRate,
+		"maxConnections":      server.MaxConnections,
+		"maxConnectionsPerIP": server.MaxConnectionsPerIP,
+		"activeConnections":   proxy.CountConnections(server.Name),
+		"drain":               drainStatus(server.Name),
+	}
+}
+
+// drainStatus returns the progress of a listener's connection drain, or nil if none is running
+func drainStatus(name string) interface{} {
+	if progress, ok := proxy.GetDrainProgress(name); ok {
+		return progress
+	}
+	return nil
+}
+
+// legacyServer returns the listener addressed by the type of the original proxy API, which had one listener per type
+// A missing socks5 or http listener is returned unregistered, as the original API created them on first use
+func (wm *Manager) legacyServer(proxyType string) (*ProxyServer, bool) {
+	if proxyType != config.ListenerSOCKS5 && proxyType != config.ListenerHTTP {
+		return nil, false
+	}
+	if server, ok := wm.servers[proxyType]; ok {
+		return server, true
+	}
+	return &ProxyServer{ProxyConfig: models.ProxyConfig{
+		Name:     proxyType,
+		Type:     proxyType,
+		AuthMode: config.AuthModeDefault,
+		IPFamily: config.IPFamilyDual,
+	}}, true
 }
 
 // handleUsers handles user management (GET, POST, DELETE)
@@ -176,44 +338,125 @@ func (wm *Manager) handleUsers(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// handleWhitelist handles IP whitelist management
-func (wm *Manager) handleWhitelist(w http.ResponseWriter, r *http.Request) {
+// handleUserLimits handles per-user limit overrides (GET, POST)
+func (wm *Manager) handleUserLimits(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
 	switch r.Method {
 	case http.MethodGet:
-		// List whitelist IPs
-		ips := auth.GetWhitelistIPs()
-		json.NewEncoder(w).Encode(ips)
+		// List all users with their effective limits
+		var users []models.User
+		if err := wm.db.Find(&users).Error; err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		type userLimits struct {
+			Username    string                    `json:"username"`
+			Effective   config.UserLimits         `json:"effective"`
+			Override    *config.UserLimits        `json:"override,omitempty"`
+			Connections proxy.UserConnectionUsage `json:"connections"`
+		}
+		result := make([]userLimits, 0, len(users))
+		for _, user := range users {
+			entry := userLimits{
+				Username:    user.Username,
+				Effective:   config.GetUserLimits(user.Username),
+				Connections: proxy.GetUserLimiter().GetUsage(user.Username),
+			}
+			if override, ok := config.GetUserLimitOverride(user.Username); ok {
+				entry.Override = &override
+			}
+			result = append(result, entry)
+		}
+		json.NewEncoder(w).Encode(result)
 
 	case http.MethodPost:
-		// Add IP to whitelist
+		// Set limit overrides for a user
 		var req struct {
-			IP string `json:"ip"`
+			Username string `json:"username"`
+			config.UserLimits
 		}
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
 
-		if err := auth.AddIPToWhitelist(wm.db, req.IP); err != nil {
+		var count int64
+		if err := wm.db.Model(&models.User{}).Where("username = ?", req.Username).Count(&count).Error; err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
+		if count == 0 {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+
+		if err := config.SetUserLimits(wm.db, req.Username, req.UserLimits); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		proxy.GetShaper().Reconfigure()
+
+		json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleGroups handles user group management (GET, POST, DELETE)
+func (wm *Manager) handleGroups(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	switch r.Method {
+	case http.MethodGet:
+		// List all groups with their members
+		groups, err := acl.ListGroups(wm.db)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(groups)
+
+	case http.MethodPost:
+		// Create a group or update its description
+		var req struct {
+			Name        string `json:"name"`
+			Description string `json:"description"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := acl.SaveGroup(wm.db, req.Name, req.Description); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 
 		json.NewEncoder(w).Encode(map[string]string{"status": "success"})
 
 	case http.MethodDelete:
-		// Delete IP from whitelist
+		// Delete a group, its rule and memberships
 		var req struct {
-			IP string `json:"ip"`
+			Name string `json:"name"`
 		}
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
 
-		if err := auth.DeleteIPFromWhitelist(wm.db, req.IP); err != nil {
+		if err := acl.DeleteGroup(wm.db, req.Name); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err := schedule.LoadFromDB(wm.db); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		// Members of the deleted group no longer belong to any group
+		if err := auth.LoadCredentialsFromDB(wm.db); err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -225,44 +468,28 @@ func (wm *Manager) handleWhitelist(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// handleProxyStart starts a proxy server
-func (wm *Manager) handleProxyStart(w http.ResponseWriter, r *http.Request) {
+// handleUserGroup assigns a user to a group
+func (wm *Manager) handleUserGroup(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
 	var req struct {
-		Type       string `json:"type"` // "socks5" or "http"
-		Port       int    `json:"port"`
-		BindListen bool   `json:"bindListen"`
+		Username string `json:"username"`
+		Group    string `json:"group"` // Empty removes the membership
 	}
-
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	wm.mu.Lock()
-	defer wm.mu.Unlock()
-
-	var server *ProxyServer
-	if req.Type == "socks5" {
-		server = wm.socksServer
-	} else if req.Type == "http" {
-		server = wm.httpServer
-	} else {
-		http.Error(w, "Invalid proxy type", http.StatusBadRequest)
-		return
-	}
-
-	if server.Running {
-		http.Error(w, "Proxy already running", http.StatusBadRequest)
+	if err := acl.SetUserGroup(wm.db, req.Username, req.Group); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-
-	// Start the proxy server
-	if err := wm.startProxy(server, req.Port, req.BindListen); err != nil {
+	// Local users carry their group in the credentials map
+	if err := auth.LoadCredentialsFromDB(wm.db); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -271,253 +498,1423 @@ func (wm *Manager) handleProxyStart(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
 }
 
-// handleProxyStop stops a proxy server
-func (wm *Manager) handleProxyStop(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
-	var req struct {
-		Type string `json:"type"` // "socks5" or "http"
-	}
-
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
-	}
-
-	wm.mu.Lock()
-	defer wm.mu.Unlock()
-
-	var server *ProxyServer
-	if req.Type == "socks5" {
-		server = wm.socksServer
-	} else if req.Type == "http" {
-		server = wm.httpServer
-	} else {
-		http.Error(w, "Invalid proxy type", http.StatusBadRequest)
-		return
-	}
-
-	if !server.Running {
-		http.Error(w, "Proxy not running", http.StatusBadRequest)
-		return
-	}
+// handleAccessRules handles group and user access rules (GET, POST, DELETE)
+func (wm *Manager) handleAccessRules(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
 
-	// Stop the proxy server
-	wm.stopProxy(server)
+	switch r.Method {
+	case http.MethodGet:
+		// List all access rules
+		rules, err := acl.ListRules(wm.db)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(rules)
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
-}
+	case http.MethodPost:
+		// Create or replace the rule of a group or user
+		var rule acl.Rule
+		if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 
-// handleProxyConfig handles proxy configuration updates
-func (wm *Manager) handleProxyConfig(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
+		// The subject must exist
+		var count int64
+		var err error
+		switch rule.Scope {
+		case acl.ScopeUser:
+			err = wm.db.Model(&models.User{}).Where("username = ?", rule.Subject).Count(&count).Error
+		case acl.ScopeGroup:
+			err = wm.db.Model(&models.UserGroup{}).Where("name = ?", rule.Subject).Count(&count).Error
+		default:
+			http.Error(w, "Scope must be \"group\" or \"user\"", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if count == 0 {
+			http.Error(w, "Subject not found", http.StatusNotFound)
+			return
+		}
 
-	var req struct {
-		Type       string `json:"type"`
-		Port       int    `json:"port"`
-		BindListen bool   `json:"bindListen"`
-		AutoStart  bool   `json:"autoStart"`
-	}
+		if err := acl.SetRule(wm.db, rule); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
-	}
+		json.NewEncoder(w).Encode(map[string]string{"status": "success"})
 
-	wm.mu.Lock()
-	defer wm.mu.Unlock()
+	case http.MethodDelete:
+		// Delete the rule of a group or user
+		var req struct {
+			Scope   string `json:"scope"`
+			Subject string `json:"subject"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 
-	var server *ProxyServer
-	if req.Type == "socks5" {
-		server = wm.socksServer
-	} else if req.Type == "http" {
-		server = wm.httpServer
-	} else {
-		http.Error(w, "Invalid proxy type", http.StatusBadRequest)
-		return
-	}
+		if err := acl.DeleteRule(wm.db, req.Scope, req.Subject); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
 
-	// Update configuration in memory
-	server.AutoStart = req.AutoStart
-	if !server.Running {
-		// Only update port and bindListen if proxy is not running
-		server.Port = req.Port
-		server.BindListen = req.BindListen
-	}
+		json.NewEncoder(w).Encode(map[string]string{"status": "success"})
 
-	// Save configuration to database
-	proxyConfig := &models.ProxyConfig{
-		Type:       server.Type,
-		Port:       server.Port,
-		BindListen: server.BindListen,
-		AutoStart:  server.AutoStart,
-	}
-	if err := config.SaveProxyConfig(wm.db, proxyConfig); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
 }
 
-// handleConfig handles unified configuration (GET, POST)
-// Includes: timeout, connection limiter, and system settings
-func (wm *Manager) handleConfig(w http.ResponseWriter, r *http.Request) {
+// handleSchedules handles access schedule definitions (GET, POST, DELETE)
+func (wm *Manager) handleSchedules(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
 	switch r.Method {
 	case http.MethodGet:
-		// Get current timeout configuration
-		timeout := config.GetTimeout()
-
-		// Get current limiter configuration
-		limiterConfig := config.GetLimiterConfig()
-
-		// Get autostart settings
-		autostartValue, _ := config.GetSystemConfig(wm.db, config.KeyAutoStart)
-		autostartEnabled := autostartValue == "true"
-
-		// Check actual registry status (Windows only)
-		registryEnabled, _ := autostart.IsEnabled()
-
-		response := map[string]interface{}{
-			"timeout": map[string]interface{}{
-				"connect":   int(timeout.Connect.Seconds()),
-				"idleRead":  int(timeout.IdleRead.Seconds()),
-				"idleWrite": int(timeout.IdleWrite.Seconds()),
-			},
-			"limiter": map[string]interface{}{
-				"maxConcurrentConnections":      limiterConfig.MaxConcurrentConnections,
-				"maxConcurrentConnectionsPerIP": limiterConfig.MaxConcurrentConnectionsPerIP,
-			},
-			"system": map[string]interface{}{
-				"autostartEnabled":   autostartEnabled,
-				"registryEnabled":    registryEnabled,
-				"autostartSupported": true,
-			},
-			"security": map[string]interface{}{
-				"allowPrivateIPAccess": config.GetAllowPrivateIPAccess(),
-			},
-		}
-
-		json.NewEncoder(w).Encode(response)
+		// List all schedules
+		schedules, err := schedule.ListSchedules(wm.db)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(schedules)
 
 	case http.MethodPost:
-		// Update configuration
-		var req struct {
-			Timeout *struct {
-				Connect   int `json:"connect"`
-				IdleRead  int `json:"idleRead"`
-				IdleWrite int `json:"idleWrite"`
-			} `json:"timeout"`
-			Limiter *struct {
-				MaxConcurrentConnections      int32 `json:"maxConcurrentConnections"`
-				MaxConcurrentConnectionsPerIP int32 `json:"maxConcurrentConnectionsPerIP"`
-			} `json:"limiter"`
-			System *struct {
-				AutostartEnabled bool `json:"autostartEnabled"`
-			} `json:"system"`
-			Security *struct {
-				AllowPrivateIPAccess bool `json:"allowPrivateIPAccess"`
-			} `json:"security"`
+		// Create or replace a schedule
+		var req schedule.Definition
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
 		}
 
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		if err := schedule.SaveSchedule(wm.db, req); err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
 
-		// Update timeout configuration if provided
-		if req.Timeout != nil {
-			// Validate timeout values
-			if req.Timeout.Connect <= 0 || req.Timeout.Connect > 300 {
+		json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+
+	case http.MethodDelete:
+		// Delete a schedule and its assignments
+		var req struct {
+			Name string `json:"name"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := schedule.DeleteSchedule(wm.db, req.Name); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleScheduleAssignments handles attaching schedules to users, groups and whitelist entries (GET, POST)
+func (wm *Manager) handleScheduleAssignments(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	switch r.Method {
+	case http.MethodGet:
+		// List all assignments
+		assignments, err := schedule.ListAssignments(wm.db)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(assignments)
+
+	case http.MethodPost:
+		// Attach a schedule (empty schedule detaches)
+		var req schedule.Assignment
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// The subject must exist
+		var count int64
+		var err error
+		switch req.Scope {
+		case schedule.ScopeUser:
+			err = wm.db.Model(&models.User{}).Where("username = ?", req.Subject).Count(&count).Error
+		case schedule.ScopeGroup:
+			err = wm.db.Model(&models.UserGroup{}).Where("name = ?", req.Subject).Count(&count).Error
+		case schedule.ScopeWhitelist:
+			err = wm.db.Model(&models.Whitelist{}).Where("ip = ?", req.Subject).Count(&count).Error
+		default:
+			http.Error(w, "Scope must be \"user\", \"group\" or \"whitelist\"", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if count == 0 {
+			http.Error(w, "Subject not found", http.StatusNotFound)
+			return
+		}
+
+		if err := schedule.Assign(wm.db, req.Scope, req.Subject, req.Schedule); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleWhitelist handles IP whitelist management
+func (wm *Manager) handleWhitelist(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	switch r.Method {
+	case http.MethodGet:
+		// List whitelist IPs
+		ips := auth.GetWhitelistIPs()
+		json.NewEncoder(w).Encode(ips)
+
+	case http.MethodPost:
+		// Add IP to whitelist
+		var req struct {
+			IP string `json:"ip"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := auth.AddIPToWhitelist(wm.db, req.IP); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+
+	case http.MethodDelete:
+		// Delete IP from whitelist
+		var req struct {
+			IP string `json:"ip"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := auth.DeleteIPFromWhitelist(wm.db, req.IP); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleQuotas handles traffic quota management (GET, POST)
+func (wm *Manager) handleQuotas(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	manager := quota.GetManager()
+	if manager == nil {
+		http.Error(w, "Quota manager not initialized", http.StatusInternalServerError)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		// Return a single user's usage if requested, otherwise all users
+		if username := r.URL.Query().Get("username"); username != "" {
+			usage, ok := manager.GetUsage(username)
+			if !ok {
+				http.Error(w, "No quota found for user", http.StatusNotFound)
+				return
+			}
+			json.NewEncoder(w).Encode(usage)
+			return
+		}
+		json.NewEncoder(w).Encode(manager.ListUsage())
+
+	case http.MethodPost:
+		// Set quota limits for a user
+		var req struct {
+			Username string `json:"username"`
+			quota.Limits
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var count int64
+		if err := wm.db.Model(&models.User{}).Where("username = ?", req.Username).Count(&count).Error; err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if count == 0 {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+
+		if err := manager.SetLimits(req.Username, req.Limits); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleQuotaReset resets a user's traffic usage counters
+func (wm *Manager) handleQuotaReset(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	manager := quota.GetManager()
+	if manager == nil {
+		http.Error(w, "Quota manager not initialized", http.StatusInternalServerError)
+		return
+	}
+
+	var req struct {
+		Username string `json:"username"`
+		Period   string `json:"period"` // "daily", "monthly", "total" or "all"
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := manager.Reset(req.Username, req.Period); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+}
+
+// handleProxyStart starts a proxy server
+func (wm *Manager) handleProxyStart(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		Type       string `json:"type"` // "socks5" or "http"
+		Port       int    `json:"port"`
+		BindListen bool   `json:"bindListen"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
+
+	server, ok := wm.legacyServer(req.Type)
+	if !ok {
+		http.Error(w, "Invalid proxy type", http.StatusBadRequest)
+		return
+	}
+
+	if server.Running {
+		http.Error(w, "Proxy already running", http.StatusBadRequest)
+		return
+	}
+
+	// Start the proxy server
+	server.Port = req.Port
+	server.BindListen = req.BindListen
+	if err := wm.startProxy(server); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	wm.servers[server.Name] = server
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+}
+
+// handleProxyStop stops a proxy server
+func (wm *Manager) handleProxyStop(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		Type string `json:"type"` // "socks5" or "http"
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
+
+	server, ok := wm.legacyServer(req.Type)
+	if !ok {
+		http.Error(w, "Invalid proxy type", http.StatusBadRequest)
+		return
+	}
+
+	if !server.Running {
+		http.Error(w, "Proxy not running", http.StatusBadRequest)
+		return
+	}
+
+	// Stop the proxy server
+	wm.stopProxy(server)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+}
+
+// handleProxyConfig handles proxy configuration updates
+func (wm *Manager) handleProxyConfig(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		Type       string `json:"type"`
+		Port       int    `json:"port"`
+		BindListen bool   `json:"bindListen"`
+		AutoStart  bool   `json:"autoStart"`
+		// Optional bandwidth limits (bytes/sec, 0 = unlimited); omitted keeps the current value
+		UploadRate   *int64 `json:"uploadRate"`
+		DownloadRate *int64 `json:"downloadRate"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
+
+	server, ok := wm.legacyServer(req.Type)
+	if !ok {
+		http.Error(w, "Invalid proxy type", http.StatusBadRequest)
+		return
+	}
+
+	// Validate bandwidth limits before changing anything
+	for _, rate := range []*int64{req.UploadRate, req.DownloadRate} {
+		if rate != nil && (*rate < 0 || *rate > config.MaxBandwidthRate) {
+			http.Error(w, "Bandwidth rate must be between 0 (unlimited) and 10737418240 bytes/sec", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Update configuration in memory
+	server.AutoStart = req.AutoStart
+	if req.UploadRate != nil {
+		server.UploadRate = *req.UploadRate
+	}
+	if req.DownloadRate != nil {
+		server.DownloadRate = *req.DownloadRate
+	}
+	// Bandwidth limits apply immediately, even to running proxies
+	applyListenerLimits(server)
+	if !server.Running {
+		// Only update port and bindListen if proxy is not running
+		server.Port = req.Port
+		server.BindListen = req.BindListen
+	}
+
+	// Save configuration to database
+	if err := config.SaveProxyConfig(wm.db, &server.ProxyConfig); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	wm.servers[server.Name] = server
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+}
+
+// handleConfig handles unified configuration (GET, POST)
+// Includes: timeout, connection limiter, and system settings
+func (wm *Manager) handleConfig(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	switch r.Method {
+	case http.MethodGet:
+		json.NewEncoder(w).Encode(wm.currentConfig())
+
+	case http.MethodPost:
+		// Update configuration
+		var req struct {
+			Timeout *struct {
+				Connect   int  `json:"connect"`
+				IdleRead  int  `json:"idleRead"`
+				IdleWrite int  `json:"idleWrite"`
+				Drain     *int `json:"drain"` // Optional; unchanged if omitted
+			} `json:"timeout"`
+			Limiter *struct {
+				MaxConcurrentConnections      int32 `json:"maxConcurrentConnections"`
+				MaxConcurrentConnectionsPerIP int32 `json:"maxConcurrentConnectionsPerIP"`
+			} `json:"limiter"`
+			System *struct {
+				AutostartEnabled bool `json:"autostartEnabled"`
+			} `json:"system"`
+			Security *struct {
+				AllowPrivateIPAccess bool `json:"allowPrivateIPAccess"`
+			} `json:"security"`
+			Bandwidth   *config.BandwidthConfig   `json:"bandwidth"`
+			UserLimiter *config.UserLimiterConfig `json:"userLimiter"`
+			Backup      *config.BackupConfig      `json:"backup"`
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// Update timeout configuration if provided
+		if req.Timeout != nil {
+			// Validate timeout values
+			if req.Timeout.Connect <= 0 || req.Timeout.Connect > 300 {
 				http.Error(w, "Connect timeout must be between 1 and 300 seconds", http.StatusBadRequest)
 				return
 			}
-			if req.Timeout.IdleRead <= 0 || req.Timeout.IdleRead > 3600 {
-				http.Error(w, "Idle read timeout must be between 1 and 3600 seconds", http.StatusBadRequest)
+			if req.Timeout.IdleRead <= 0 || req.Timeout.IdleRead > 3600 {
+				http.Error(w, "Idle read timeout must be between 1 and 3600 seconds", http.StatusBadRequest)
+				return
+			}
+			if req.Timeout.IdleWrite <= 0 || req.Timeout.IdleWrite > 3600 {
+				http.Error(w, "Idle write timeout must be between 1 and 3600 seconds", http.StatusBadRequest)
+				return
+			}
+			if req.Timeout.Drain != nil && (*req.Timeout.Drain <= 0 || *req.Timeout.Drain > 3600) {
+				http.Error(w, "Drain timeout must be between 1 and 3600 seconds", http.StatusBadRequest)
+				return
+			}
+
+			// Create new timeout configuration, keeping the settings the request does not cover
+			newTimeout := config.GetTimeout()
+			newTimeout.Connect = time.Duration(req.Timeout.Connect) * time.Second
+			newTimeout.IdleRead = time.Duration(req.Timeout.IdleRead) * time.Second
+			newTimeout.IdleWrite = time.Duration(req.Timeout.IdleWrite) * time.Second
+			if req.Timeout.Drain != nil {
+				newTimeout.Drain = time.Duration(*req.Timeout.Drain) * time.Second
+			}
+
+			// Save to database
+			if err := config.SaveTimeoutToDB(wm.db, newTimeout); err != nil {
+				http.Error(w, fmt.Sprintf("Failed to save timeout configuration: %v", err), http.StatusInternalServerError)
+				return
+			}
+		}
+
+		// Update limiter configuration if provided
+		if req.Limiter != nil {
+			// Validate limiter values
+			if req.Limiter.MaxConcurrentConnections <= 0 || req.Limiter.MaxConcurrentConnections > 1000000 {
+				http.Error(w, "Max concurrent connections must be between 1 and 1000000", http.StatusBadRequest)
+				return
+			}
+			if req.Limiter.MaxConcurrentConnectionsPerIP <= 0 || req.Limiter.MaxConcurrentConnectionsPerIP > 100000 {
+				http.Error(w, "Max concurrent connections per IP must be between 1 and 100000", http.StatusBadRequest)
 				return
 			}
-			if req.Timeout.IdleWrite <= 0 || req.Timeout.IdleWrite > 3600 {
-				http.Error(w, "Idle write timeout must be between 1 and 3600 seconds", http.StatusBadRequest)
+
+			// Update limiter configuration in database and memory
+			if err := config.UpdateLimiterConfig(wm.db, req.Limiter.MaxConcurrentConnections, req.Limiter.MaxConcurrentConnectionsPerIP); err != nil {
+				http.Error(w, fmt.Sprintf("Failed to update limiter configuration: %v", err), http.StatusInternalServerError)
+				return
+			}
+		}
+
+		// Update system settings if provided
+		if req.System != nil {
+			// Install or remove the autostart entry
+			if req.System.AutostartEnabled {
+				if err := autostart.Enable(); err != nil {
+					http.Error(w, fmt.Sprintf("Failed to enable autostart: %v", err), http.StatusInternalServerError)
+					return
+				}
+			} else {
+				if err := autostart.Disable(); err != nil {
+					http.Error(w, fmt.Sprintf("Failed to disable autostart: %v", err), http.StatusInternalServerError)
+					return
+				}
+			}
+
+			// Update database
+			value := "false"
+			if req.System.AutostartEnabled {
+				value = "true"
+			}
+			if err := config.SetSystemConfig(wm.db, config.KeyAutoStart, value); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+
+		// Update security settings if provided
+		if req.Security != nil {
+			if err := config.UpdateAllowPrivateIPAccess(wm.db, req.Security.AllowPrivateIPAccess); err != nil {
+				http.Error(w, fmt.Sprintf("Failed to update security configuration: %v", err), http.StatusInternalServerError)
+				return
+			}
+		}
+
+		// Update bandwidth settings if provided (applied live to existing connections)
+		if req.Bandwidth != nil {
+			if err := req.Bandwidth.Validate(); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err := config.UpdateBandwidthConfig(wm.db, *req.Bandwidth); err != nil {
+				http.Error(w, fmt.Sprintf("Failed to update bandwidth configuration: %v", err), http.StatusInternalServerError)
+				return
+			}
+			proxy.GetShaper().Reconfigure()
+		}
+
+		// Update per-user connection limit defaults if provided (applied to new connections)
+		if req.UserLimiter != nil {
+			if err := req.UserLimiter.Validate(); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err := config.UpdateUserLimiterConfig(wm.db, *req.UserLimiter); err != nil {
+				http.Error(w, fmt.Sprintf("Failed to update user limiter configuration: %v", err), http.StatusInternalServerError)
+				return
+			}
+		}
+
+		// Update scheduled backup settings if provided
+		if req.Backup != nil {
+			if err := req.Backup.Validate(); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err := config.UpdateBackupConfig(wm.db, *req.Backup); err != nil {
+				http.Error(w, fmt.Sprintf("Failed to update backup configuration: %v", err), http.StatusInternalServerError)
 				return
 			}
+		}
+
+		json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// currentConfig returns the unified configuration served by /api/config
+func (wm *Manager) currentConfig() map[string]interface{} {
+	// Get current timeout configuration
+	timeout := config.GetTimeout()
+
+	// Get current limiter configuration
+	limiterConfig := config.GetLimiterConfig()
+
+	// Get current bandwidth configuration
+	bandwidthConfig := config.GetBandwidthConfig()
+
+	// Get autostart settings
+	autostartValue, _ := config.GetSystemConfig(wm.db, config.KeyAutoStart)
+	autostartEnabled := autostartValue == "true"
+
+	// Check the actual autostart status (Windows shortcut, Linux user unit or autostart entry)
+	registryEnabled, _ := autostart.IsEnabled()
+
+	return map[string]interface{}{
+		"timeout": map[string]interface{}{
+			"connect":   int(timeout.Connect.Seconds()),
+			"idleRead":  int(timeout.IdleRead.Seconds()),
+			"idleWrite": int(timeout.IdleWrite.Seconds()),
+			"drain":     int(timeout.Drain.Seconds()),
+		},
+		"limiter": map[string]interface{}{
+			"maxConcurrentConnections":      limiterConfig.MaxConcurrentConnections,
+			"maxConcurrentConnectionsPerIP": limiterConfig.MaxConcurrentConnectionsPerIP,
+		},
+		"system": map[string]interface{}{
+			"autostartEnabled":   autostartEnabled,
+			"registryEnabled":    registryEnabled,
+			"autostartSupported": true,
+		},
+		"security": map[string]interface{}{
+			"allowPrivateIPAccess": config.GetAllowPrivateIPAccess(),
+		},
+		"bandwidth":   bandwidthConfig,
+		"userLimiter": config.GetUserLimiterConfig(),
+		"backup":      config.GetBackupConfig(),
+	}
+}
+
+// handleShutdown handles application shutdown request
+func (wm *Manager) handleShutdown(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	// Send success response first
+	json.NewEncoder(w).Encode(map[string]string{"status": "success", "message": "Application is shutting down..."})
+
+	// Flush the response to ensure client receives it
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+
+	// Shutdown the application in a goroutine to allow the response to be sent
+	go func() {
+		// Give the response time to be sent
+		time.Sleep(500 * time.Millisecond)
+
+		// Gracefully shutdown the application
+		if err := wm.ShutdownApplication(); err != nil {
+			fmt.Printf("Error during shutdown: %v\n", err)
+		}
+
+		// Exit the application
+		fmt.Println("Application shutdown complete")
+		time.Sleep(100 * time.Millisecond)
+		os.Exit(0)
+	}()
+}
+
+// handleUpgrade hands the listening sockets over to a newly started binary
+// This process stops accepting connections and exits once its open connections are drained
+func (wm *Manager) handleUpgrade(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// The new process loads the quota usage at startup
+	if manager := quota.GetManager(); manager != nil {
+		if err := manager.Flush(); err != nil {
+			logger.Warn("Failed to flush quota usage before upgrade: %v", err)
+		}
+	}
+
+	pid, err := upgrade.Upgrade()
+	if errors.Is(err, upgrade.ErrUnsupported) {
+		writeError(w, r, http.StatusNotImplemented, err.Error())
+		return
+	} else if err != nil {
+		logger.Error("Upgrade failed: %v", err)
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  "success",
+		"message": fmt.Sprintf("Process %d took over the listeners; this process exits once its connections are drained", pid),
+		"pid":     pid,
+	})
+}
+
+// handleMetricsRealtime returns real-time metrics snapshot
+func (wm *Manager) handleMetricsRealtime(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	collector := metrics.GetCollector()
+	if collector == nil {
+		http.Error(w, "Metrics collector not initialized", http.StatusInternalServerError)
+		return
+	}
+
+	snapshot := collector.GetSnapshot()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(snapshot)
+}
+
+// defaultLimiterTopIPs is the number of IPs reported by /api/limiter/stats unless ?top= is given
+const defaultLimiterTopIPs = 10
+
+// handleLimiterStats returns connection limiter statistics per proxy type
+func (wm *Manager) handleLimiterStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	topN := defaultLimiterTopIPs
+	if value := r.URL.Query().Get("top"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 || parsed > 1000 {
+			http.Error(w, "top must be between 0 and 1000", http.StatusBadRequest)
+			return
+		}
+		topN = parsed
+	}
+
+	limiterConfig := config.GetLimiterConfig()
+	response := map[string]interface{}{
+		"limits": map[string]interface{}{
+			"maxConcurrentConnections":      limiterConfig.MaxConcurrentConnections,
+			"maxConcurrentConnectionsPerIP": limiterConfig.MaxConcurrentConnectionsPerIP,
+			"maxNewConnectionsPerIPSecond":  config.GetUserLimiterConfig().MaxNewConnectionsPerIPSecond,
+		},
+		"listeners": proxy.ListenerLimiterStats(topN),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// handleMetricsHistory returns historical metrics data
+func (wm *Manager) handleMetricsHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	collector := metrics.GetCollector()
+	if collector == nil {
+		http.Error(w, "Metrics collector not initialized", http.StatusInternalServerError)
+		return
+	}
+
+	// Parse query parameters
+	query := r.URL.Query()
+	startTime := query.Get("startTime")
+	endTime := query.Get("endTime")
+	limit := query.Get("limit")
+	downsample := query.Get("downsample") // New parameter for downsampling
+
+	// Default values
+	var start, end int64
+	var limitInt int = 100
+
+	if startTime != "" {
+		fmt.Sscanf(startTime, "%d", &start)
+	} else {
+		// Default to last 24 hours
+		start = time.Now().Add(-24 * time.Hour).Unix()
+	}
+
+	if endTime != "" {
+		fmt.Sscanf(endTime, "%d", &end)
+	} else {
+		end = time.Now().Unix()
+	}
+
+	if limit != "" {
+		fmt.Sscanf(limit, "%d", &limitInt)
+	}
+
+	var snapshots []models.MetricsSnapshot
+	var err error
+
+	// Use downsampling if requested
+	if downsample == "true" || downsample == "1" {
+		// Use downsampled query with target points = limit
+		snapshots, err = collector.GetDownsampledSnapshots(start, end, limitInt)
+	} else {
+		// Use original query with limit
+		snapshots, err = collector.GetHistoricalSnapshots(start, end, limitInt)
+	}
+
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to retrieve metrics: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(snapshots)
+}
+
+// handleAuthConfig handles the authentication backend configuration (GET, POST)
+func (wm *Manager) handleAuthConfig(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	switch r.Method {
+	case http.MethodGet:
+		json.NewEncoder(w).Encode(redactedAuthConfig())
+
+	case http.MethodPost:
+		cfg := config.DefaultAuthConfig()
+		if err := json.NewDecoder(r.Body).Decode(&cfg); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		// An empty password or secret keeps the stored one
+		current := config.GetAuthConfig()
+		if cfg.LDAP.BindPassword == "" {
+			cfg.LDAP.BindPassword = current.LDAP.BindPassword
+		}
+		cfg.LDAP.BindPasswordSet = false
+		if cfg.RADIUS.Secret == "" {
+			cfg.RADIUS.Secret = current.RADIUS.Secret
+		}
+		cfg.RADIUS.SecretSet = false
+		if cfg.Webhook.Secret == "" {
+			cfg.Webhook.Secret = current.Webhook.Secret
+		}
+		cfg.Webhook.SecretSet = false
+
+		if err := config.UpdateAuthConfig(wm.db, cfg); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := auth.ConfigureBackends(config.GetAuthConfig()); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
 
-			// Create new timeout configuration
-			newTimeout := config.TimeoutConfig{
-				Connect:   time.Duration(req.Timeout.Connect) * time.Second,
-				IdleRead:  time.Duration(req.Timeout.IdleRead) * time.Second,
-				IdleWrite: time.Duration(req.Timeout.IdleWrite) * time.Second,
-			}
+// redactedAuthConfig returns the authentication backend configuration without passwords and secrets
+func redactedAuthConfig() config.AuthConfig {
+	cfg := config.GetAuthConfig()
+	if cfg.LDAP.BindPassword != "" {
+		cfg.LDAP.BindPassword = ""
+		cfg.LDAP.BindPasswordSet = true
+	}
+	if cfg.RADIUS.Secret != "" {
+		cfg.RADIUS.Secret = ""
+		cfg.RADIUS.SecretSet = true
+	}
+	if cfg.Webhook.Secret != "" {
+		cfg.Webhook.Secret = ""
+		cfg.Webhook.SecretSet = true
+	}
+	return cfg
+}
 
-			// Save to database
-			if err := config.SaveTimeoutToDB(wm.db, newTimeout); err != nil {
-				http.Error(w, fmt.Sprintf("Failed to save timeout configuration: %v", err), http.StatusInternalServerError)
-				return
-			}
+// handleAuthTest verifies credentials with the configured backends without opening a proxy session
+func (wm *Manager) handleAuthTest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		Username    string `json:"username"`
+		Password    string `json:"password"`
+		ClientIP    string `json:"clientIP"`    // Optional, passed to backends that use it
+		Listener    string `json:"listener"`    // Optional
+		Destination string `json:"destination"` // Optional
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	result, err := auth.Authenticate(&auth.Request{
+		Username:    req.Username,
+		Password:    []byte(req.Password),
+		ClientIP:    req.ClientIP,
+		Listener:    req.Listener,
+		Destination: req.Destination,
+	})
+	if err != nil {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"authenticated": false,
+			"error":         err.Error(),
+		})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"authenticated":  true,
+		"username":       result.Username,
+		"group":          result.Group,
+		"backend":        result.Backend,
+		"sessionTimeout": int64(result.SessionTimeout / time.Second),
+		"uploadRate":     result.UploadRate,
+		"downloadRate":   result.DownloadRate,
+		"egressIP":       result.EgressIP,
+	})
+}
+
+// handleSetup creates the first admin account (POST)
+// Only allowed from the local machine while no admin account exists
+func (wm *Manager) handleSetup(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !wm.isLocalRequest(r) {
+		http.Error(w, "Initial setup is only allowed from the local machine", http.StatusForbidden)
+		return
+	}
+
+	var req struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	wm.setupMu.Lock()
+	defer wm.setupMu.Unlock()
+	count, err := admin.Count(wm.db)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if count > 0 {
+		http.Error(w, "Setup already completed", http.StatusConflict)
+		return
+	}
+	if err := admin.Create(wm.db, req.Username, req.Password, admin.RoleAdmin); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	wm.startSession(w, r, req.Username)
+}
+
+// handleLogin logs an admin in with username and password (POST)
+func (wm *Manager) handleLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ip := clientIP(r)
+	if wm.loginBlocked(ip) {
+		http.Error(w, "Too many failed logins, try again later", http.StatusTooManyRequests)
+		return
+	}
+
+	var req struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := admin.Verify(wm.db, req.Username, req.Password); err != nil {
+		if errors.Is(err, admin.ErrInvalidCredentials) {
+			wm.recordLoginFailure(ip)
+			logger.Warn("Failed admin login for %s from %s", req.Username, ip)
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
 		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 
-		// Update limiter configuration if provided
-		if req.Limiter != nil {
-			// Validate limiter values
-			if req.Limiter.MaxConcurrentConnections <= 0 || req.Limiter.MaxConcurrentConnections > 1000000 {
-				http.Error(w, "Max concurrent connections must be between 1 and 1000000", http.StatusBadRequest)
-				return
+	totpEnabled, err := admin.TOTPEnabled(wm.db, req.Username)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if totpEnabled {
+		// Remembered browsers skip the code
+		if cookie, err := r.Cookie(deviceCookieName); err == nil && admin.DeviceTrusted(wm.db, req.Username, cookie.Value) {
+			wm.startSession(w, r, req.Username)
+			return
+		}
+		challenge, err := wm.beginPendingLogin(req.Username, ip)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"totpRequired": true,
+			"challenge":    challenge,
+		})
+		return
+	}
+	wm.startSession(w, r, req.Username)
+}
+
+// handleLoginVerify completes a login with a TOTP or recovery code (POST)
+func (wm *Manager) handleLoginVerify(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ip := clientIP(r)
+	if wm.loginBlocked(ip) {
+		http.Error(w, "Too many failed logins, try again later", http.StatusTooManyRequests)
+		return
+	}
+
+	var req struct {
+		Challenge      string `json:"challenge"`
+		Code           string `json:"code"`
+		RecoveryCode   string `json:"recoveryCode"`
+		RememberDevice bool   `json:"rememberDevice"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	username, ok := wm.pendingLoginUser(req.Challenge, ip)
+	if !ok {
+		http.Error(w, "Login expired, please log in again", http.StatusUnauthorized)
+		return
+	}
+
+	var err error
+	if req.RecoveryCode != "" {
+		err = admin.UseRecoveryCode(wm.db, username, req.RecoveryCode)
+	} else {
+		err = admin.VerifyTOTP(wm.db, username, req.Code)
+	}
+	if err != nil {
+		if errors.Is(err, admin.ErrInvalidCode) {
+			wm.recordLoginFailure(ip)
+			wm.failPendingLogin(req.Challenge)
+			logger.Warn("Failed two-factor verification for %s from %s", username, ip)
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	wm.finishPendingLogin(req.Challenge)
+	if req.RecoveryCode != "" {
+		logger.Warn("Admin %s logged in with a recovery code from %s", username, ip)
+	}
+
+	if req.RememberDevice {
+		token, err := admin.RememberDevice(wm.db, username, ip, r.UserAgent())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		setDeviceCookie(w, r, token)
+	}
+	wm.startSession(w, r, username)
+}
+
+// startSession creates a session for an admin and returns it with the session cookie
+func (wm *Manager) startSession(w http.ResponseWriter, r *http.Request, username string) {
+	token, session, err := admin.CreateSession(wm.db, username, clientIP(r))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	logger.Info("Admin %s logged in from %s", username, clientIP(r))
+	setSessionCookie(w, r, token)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(session)
+}
+
+// handleLogout ends the current session (POST)
+func (wm *Manager) handleLogout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if cookie, err := r.Cookie(sessionCookieName); err == nil {
+		if err := admin.DeleteSession(wm.db, cookie.Value); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	clearSessionCookie(w, r)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+}
+
+// handleSession reports the login state of the browser (GET)
+func (wm *Manager) handleSession(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	count, err := admin.Count(wm.db)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	response := map[string]interface{}{
+		"authenticated": false,
+		"setupRequired": count == 0,
+	}
+	if cookie, err := r.Cookie(sessionCookieName); err == nil {
+		if session, err := admin.LookupSession(wm.db, cookie.Value); err == nil {
+			response["authenticated"] = true
+			response["username"] = session.Username
+			response["csrfToken"] = session.CSRFToken
+			response["expiresAt"] = session.ExpiresAt
+			if role, err := admin.GetRole(wm.db, session.Username); err == nil {
+				response["role"] = role
 			}
-			if req.Limiter.MaxConcurrentConnectionsPerIP <= 0 || req.Limiter.MaxConcurrentConnectionsPerIP > 100000 {
-				http.Error(w, "Max concurrent connections per IP must be between 1 and 100000", http.StatusBadRequest)
-				return
+			if required, err := admin.EnrollmentRequired(wm.db, session.Username); err == nil {
+				response["totpEnrollmentRequired"] = required
 			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// handleAdmins handles admin accounts (GET, POST, DELETE)
+func (wm *Manager) handleAdmins(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	switch r.Method {
+	case http.MethodGet:
+		admins, err := admin.List(wm.db)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(admins)
+
+	case http.MethodPost:
+		var req struct {
+			Username string `json:"username"`
+			Password string `json:"password"`
+			Role     string `json:"role"` // Empty = admin
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		role, err := admin.ParseRole(req.Role)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := admin.Create(wm.db, req.Username, req.Password, role); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+
+	case http.MethodDelete:
+		var req struct {
+			Username string `json:"username"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := admin.Delete(wm.db, req.Username); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleAdminPassword changes an admin's password (POST)
+// Changing one's own password requires the current password, changing another admin's the admin role
+func (wm *Manager) handleAdminPassword(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		Username        string `json:"username"` // Empty = the logged-in admin
+		CurrentPassword string `json:"currentPassword"`
+		Password        string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	self := adminFromRequest(r)
+	if req.Username == "" || req.Username == self {
+		req.Username = self
+		if err := admin.Verify(wm.db, self, req.CurrentPassword); err != nil {
+			http.Error(w, "Current password is incorrect", http.StatusForbidden)
+			return
+		}
+	} else if !roleFromRequest(r).Allows(admin.RoleAdmin) {
+		http.Error(w, "Your role does not permit this action", http.StatusForbidden)
+		return
+	}
+	if err := admin.SetPassword(wm.db, req.Username, req.Password); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+}
+
+// handleAdminRole changes an admin's role (PUT)
+func (wm *Manager) handleAdminRole(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		Username string `json:"username"`
+		Role     string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	role, err := admin.ParseRole(req.Role)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := admin.SetRole(wm.db, req.Username, role); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	logger.Info("Admin %s changed the role of %s to %s", adminFromRequest(r), req.Username, role)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+}
+
+// handleTokens handles the API tokens of the logged-in admin (GET, POST, DELETE)
+func (wm *Manager) handleTokens(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	username := adminFromRequest(r)
 
-			// Update limiter configuration in database and memory
-			if err := config.UpdateLimiterConfig(wm.db, req.Limiter.MaxConcurrentConnections, req.Limiter.MaxConcurrentConnectionsPerIP); err != nil {
-				http.Error(w, fmt.Sprintf("Failed to update limiter configuration: %v", err), http.StatusInternalServerError)
-				return
-			}
+	switch r.Method {
+	case http.MethodGet:
+		tokens, err := admin.ListTokens(wm.db, username)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
 		}
+		json.NewEncoder(w).Encode(tokens)
 
-		// Update system settings if provided
-		if req.System != nil {
-			// Update registry
-			if req.System.AutostartEnabled {
-				if err := autostart.Enable(); err != nil {
-					http.Error(w, fmt.Sprintf("Failed to enable autostart: %v", err), http.StatusInternalServerError)
-					return
-				}
-			} else {
-				if err := autostart.Disable(); err != nil {
-					http.Error(w, fmt.Sprintf("Failed to disable autostart: %v", err), http.StatusInternalServerError)
-					return
-				}
-			}
+	case http.MethodPost:
+		var req struct {
+			Name    string `json:"name"`
+			TTLDays int    `json:"ttlDays"` // 0 = never expires
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		secret, token, err := admin.CreateToken(wm.db, username, req.Name, time.Duration(req.TTLDays)*24*time.Hour)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		// The secret is only shown once
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"token": secret,
+			"info":  token,
+		})
 
-			// Update database
-			value := "false"
-			if req.System.AutostartEnabled {
-				value = "true"
-			}
-			if err := config.SetSystemConfig(wm.db, config.KeyAutoStart, value); err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
+	case http.MethodDelete:
+		var req struct {
+			ID uint `json:"id"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := admin.DeleteToken(wm.db, username, req.ID); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
 		}
+		json.NewEncoder(w).Encode(map[string]string{"status": "success"})
 
-		// Update security settings if provided
-		if req.Security != nil {
-			if err := config.UpdateAllowPrivateIPAccess(wm.db, req.Security.AllowPrivateIPAccess); err != nil {
-				http.Error(w, fmt.Sprintf("Failed to update security configuration: %v", err), http.StatusInternalServerError)
-				return
-			}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleTOTP reports (GET) or turns off (DELETE) the logged-in admin's two-factor authentication
+// Turning it off requires the password and a current code
+func (wm *Manager) handleTOTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	username := adminFromRequest(r)
+
+	switch r.Method {
+	case http.MethodGet:
+		status, err := admin.GetTOTPStatus(wm.db, username)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
 		}
+		json.NewEncoder(w).Encode(status)
 
+	case http.MethodDelete:
+		var req struct {
+			Password string `json:"password"`
+			Code     string `json:"code"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		status, err := admin.GetTOTPStatus(wm.db, username)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if status.Required {
+			http.Error(w, "Two-factor authentication is required for this admin", http.StatusForbidden)
+			return
+		}
+		if err := admin.Verify(wm.db, username, req.Password); err != nil {
+			http.Error(w, "Current password is incorrect", http.StatusForbidden)
+			return
+		}
+		if err := admin.VerifyTOTP(wm.db, username, req.Code); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		if err := admin.DisableTOTP(wm.db, username); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		logger.Info("Admin %s disabled two-factor authentication", username)
 		json.NewEncoder(w).Encode(map[string]string{"status": "success"})
 
 	default:
@@ -525,117 +1922,205 @@ func (wm *Manager) handleConfig(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// handleShutdown handles application shutdown request
-func (wm *Manager) handleShutdown(w http.ResponseWriter, r *http.Request) {
+// handleTOTPEnroll starts TOTP enrolment and returns the secret and provisioning URI (POST)
+func (wm *Manager) handleTOTPEnroll(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-
-	// Send success response first
-	json.NewEncoder(w).Encode(map[string]string{"status": "success", "message": "Application is shutting down..."})
-
-	// Flush the response to ensure client receives it
-	if f, ok := w.(http.Flusher); ok {
-		f.Flush()
+	secret, uri, err := admin.BeginTOTPEnrollment(wm.db, adminFromRequest(r))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
-
-	// Shutdown the application in a goroutine to allow the response to be sent
-	go func() {
-		// Give the response time to be sent
-		time.Sleep(500 * time.Millisecond)
-
-		// Gracefully shutdown the application
-		if err := wm.ShutdownApplication(); err != nil {
-			fmt.Printf("Error during shutdown: %v\n", err)
-		}
-
-		// Exit the application
-		fmt.Println("Application shutdown complete")
-		time.Sleep(100 * time.Millisecond)
-		os.Exit(0)
-	}()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"secret": secret,
+		"uri":    uri,
+	})
 }
 
-// handleMetricsRealtime returns real-time metrics snapshot
-func (wm *Manager) handleMetricsRealtime(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
+// handleTOTPActivate confirms TOTP enrolment with a code and returns the recovery codes (POST)
+func (wm *Manager) handleTOTPActivate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	collector := metrics.GetCollector()
-	if collector == nil {
-		http.Error(w, "Metrics collector not initialized", http.StatusInternalServerError)
+	var req struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	username := adminFromRequest(r)
+	codes, err := admin.ActivateTOTP(wm.db, username, req.Code)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	logger.Info("Admin %s enabled two-factor authentication", username)
 
-	snapshot := collector.GetSnapshot()
-
+	// The recovery codes are only shown once
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(snapshot)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"recoveryCodes": codes,
+	})
 }
 
-// handleMetricsHistory returns historical metrics data
-func (wm *Manager) handleMetricsHistory(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
+// handleTOTPRecoveryCodes replaces the logged-in admin's recovery codes (POST)
+// Requires a current TOTP code
+func (wm *Manager) handleTOTPRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	collector := metrics.GetCollector()
-	if collector == nil {
-		http.Error(w, "Metrics collector not initialized", http.StatusInternalServerError)
+	var req struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	username := adminFromRequest(r)
+	if err := admin.VerifyTOTP(wm.db, username, req.Code); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	codes, err := admin.RegenerateRecoveryCodes(wm.db, username)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	// Parse query parameters
-	query := r.URL.Query()
-	startTime := query.Get("startTime")
-	endTime := query.Get("endTime")
-	limit := query.Get("limit")
-	downsample := query.Get("downsample") // New parameter for downsampling
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"recoveryCodes": codes,
+	})
+}
 
-	// Default values
-	var start, end int64
-	var limitInt int = 100
+// handleTOTPDevices handles the logged-in admin's remembered browsers (GET, DELETE)
+func (wm *Manager) handleTOTPDevices(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	username := adminFromRequest(r)
 
-	if startTime != "" {
-		fmt.Sscanf(startTime, "%d", &start)
-	} else {
-		// Default to last 24 hours
-		start = time.Now().Add(-24 * time.Hour).Unix()
-	}
+	switch r.Method {
+	case http.MethodGet:
+		devices, err := admin.ListTrustedDevices(wm.db, username)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(devices)
 
-	if endTime != "" {
-		fmt.Sscanf(endTime, "%d", &end)
-	} else {
-		end = time.Now().Unix()
+	case http.MethodDelete:
+		var req struct {
+			ID uint `json:"id"` // 0 = all remembered browsers
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := admin.ForgetDevice(wm.db, username, req.ID); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 	}
+}
 
-	if limit != "" {
-		fmt.Sscanf(limit, "%d", &limitInt)
+// handleAdminTOTP sets an admin's 2FA requirement (PUT) or resets another admin's
+// two-factor authentication after a lost authenticator (DELETE)
+func (wm *Manager) handleAdminTOTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	switch r.Method {
+	case http.MethodPut:
+		var req struct {
+			Username string `json:"username"`
+			Required bool   `json:"required"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := admin.SetTOTPRequired(wm.db, req.Username, req.Required); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+
+	case http.MethodDelete:
+		var req struct {
+			Username string `json:"username"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		self := adminFromRequest(r)
+		if req.Username == self {
+			http.Error(w, "Use /api/totp to turn off your own two-factor authentication", http.StatusBadRequest)
+			return
+		}
+		if err := admin.DisableTOTP(wm.db, req.Username); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		logger.Warn("Admin %s reset the two-factor authentication of %s", self, req.Username)
+		json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 	}
+}
 
-	var snapshots []models.MetricsSnapshot
-	var err error
+// handleAudit returns a page of the audit trail (GET)
+// Filters: actor, ip, endpoint, since and until (unix seconds), page and pageSize
+func (wm *Manager) handleAudit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
 
-	// Use downsampling if requested
-	if downsample == "true" || downsample == "1" {
-		// Use downsampled query with target points = limit
-		snapshots, err = collector.GetDownsampledSnapshots(start, end, limitInt)
-	} else {
-		// Use original query with limit
-		snapshots, err = collector.GetHistoricalSnapshots(start, end, limitInt)
+	query := r.URL.Query()
+	filter := audit.Filter{
+		Actor:    query.Get("actor"),
+		SourceIP: query.Get("ip"),
+		Endpoint: query.Get("endpoint"),
+	}
+	for name, target := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+		if value := query.Get(name); value != "" {
+			seconds, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				http.Error(w, name+" must be a unix timestamp", http.StatusBadRequest)
+				return
+			}
+			*target = time.Unix(seconds, 0)
+		}
+	}
+	for name, target := range map[string]*int{"page": &filter.Page, "pageSize": &filter.PageSize} {
+		if value := query.Get(name); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed < 1 {
+				http.Error(w, name+" must be a positive number", http.StatusBadRequest)
+				return
+			}
+			*target = parsed
+		}
 	}
 
+	result, err := audit.Query(wm.db, filter)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to retrieve metrics: %v", err), http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(snapshots)
+	json.NewEncoder(w).Encode(result)
 }
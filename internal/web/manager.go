@@ -2,42 +2,91 @@ package web
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"net"
 	"net/http"
+	"sort"
+	"strconv"
 	"sync"
 	"time"
 
 	"gorm.io/gorm"
 
-	"go-proxy-server/internal/auth"
 	"go-proxy-server/internal/config"
+	"go-proxy-server/internal/logger"
 	"go-proxy-server/internal/models"
 	"go-proxy-server/internal/proxy"
+	"go-proxy-server/internal/quota"
+	"go-proxy-server/internal/ratelimit"
+	"go-proxy-server/internal/reload"
+	"go-proxy-server/internal/systemd"
 )
 
-// ProxyServer represents a running proxy server
+// errListenerExists is returned when a listener is created under a name already in use
+var errListenerExists = errors.New("listener already exists")
+
+// ProxyServer is a configured proxy listener and its runtime state
 type ProxyServer struct {
-	Type       string // "socks5" or "http"
-	Port       int
-	BindListen bool
-	AutoStart  bool // Whether to auto-start on application launch
-	Listener   net.Listener
-	Running    bool
-	mu         sync.Mutex
+	models.ProxyConfig
+	Listeners *proxy.ListenerGroup
+	Running   bool
+}
+
+// proxyListener returns the settings the proxy handlers serve the listener's connections with
+func (server *ProxyServer) proxyListener() proxy.Listener {
+	return proxy.Listener{
+		Name:       server.Name,
+		Type:       server.Type,
+		BindListen: server.BindListen,
+		AuthMode:   server.AuthMode,
+	}
+}
+
+// listenSpec returns the local addresses the listener binds to
+func (server *ProxyServer) listenSpec() proxy.ListenSpec {
+	return proxy.ListenSpec{
+		Address:  server.ListenAddress,
+		IPFamily: server.IPFamily,
+		Each:     server.ListenEach,
+		Port:     server.Port,
+	}
+}
+
+// addresses returns the addresses a running listener is bound to
+func (server *ProxyServer) addresses() []string {
+	if !server.Running || server.Listeners == nil {
+		return []string{}
+	}
+	return server.Listeners.Addresses()
 }
 
 // Manager manages the web interface and proxy servers
 type Manager struct {
 	db             *gorm.DB
-	socksServer    *ProxyServer
-	httpServer     *ProxyServer
+	servers        map[string]*ProxyServer // Proxy listeners by name
 	mu             sync.RWMutex
 	webPort        int
 	actualPort     int // Actual port being used (after binding)
 	webHttpServer  *http.Server
 	shutdownCtx    context.Context
 	shutdownCancel context.CancelFunc
+
+	// Configuration the web server was started with and its parsed IP allowlist
+	webConfig       config.WebConfig
+	allowedNetworks []*net.IPNet
+
+	// Failed admin logins per client IP
+	loginMu       sync.Mutex
+	loginFailures map[string]*ratelimit.WindowCounter
+	// Serializes the creation of the first admin account
+	setupMu sync.Mutex
+	// Serializes the user writes of the v1 API, so If-Match is checked against the row the write replaces
+	userMu sync.Mutex
+	// Logins waiting for their TOTP code, by challenge
+	pendingMu     sync.Mutex
+	pendingLogins map[string]*pendingLogin
 }
 
 // NewManager creates a new web manager
@@ -46,126 +95,218 @@ func NewManager(db *gorm.DB, webPort int) *Manager {
 
 	manager := &Manager{
 		db:             db,
+		servers:        make(map[string]*ProxyServer),
 		webPort:        webPort,
 		shutdownCtx:    ctx,
 		shutdownCancel: cancel,
-		socksServer: &ProxyServer{
-			Type: "socks5",
-		},
-		httpServer: &ProxyServer{
-			Type: "http",
-		},
+		loginFailures:  make(map[string]*ratelimit.WindowCounter),
+		pendingLogins:  make(map[string]*pendingLogin),
 	}
 
-	// Load saved configurations from database
-	if socksConfig, err := config.LoadProxyConfig(db, "socks5"); err == nil && socksConfig != nil {
-		manager.socksServer.Port = socksConfig.Port
-		manager.socksServer.BindListen = socksConfig.BindListen
-		manager.socksServer.AutoStart = socksConfig.AutoStart
+	// Load saved listener configurations from database
+	configs, err := config.ListProxyConfigs(db)
+	if err != nil {
+		logger.Error("Failed to load listener configurations: %v", err)
 	}
-
-	if httpConfig, err := config.LoadProxyConfig(db, "http"); err == nil && httpConfig != nil {
-		manager.httpServer.Port = httpConfig.Port
-		manager.httpServer.BindListen = httpConfig.BindListen
-		manager.httpServer.AutoStart = httpConfig.AutoStart
+	for _, cfg := range configs {
+		server := &ProxyServer{ProxyConfig: cfg}
+		manager.servers[cfg.Name] = server
+		// Apply saved per-listener bandwidth and connection limits
+		applyListenerLimits(server)
 	}
 
+	// Listener changes made outside the web interface start, stop and restart the listeners
+	reload.Register(reload.Listeners, "listeners", manager.reloadListeners)
+
 	return manager
 }
 
-// startProxy starts a proxy server
-func (wm *Manager) startProxy(server *ProxyServer, port int, bindListen bool) error {
-	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
-	if err != nil {
+// applyListenerLimits applies a listener's bandwidth and connection limits, also to running connections
+func applyListenerLimits(server *ProxyServer) {
+	proxy.GetShaper().SetListenerRate(server.Name, server.UploadRate, server.DownloadRate)
+	proxy.GetListenerLimiter(server.Name).SetLimits(server.MaxConnections, server.MaxConnectionsPerIP)
+}
+
+// sortedServers returns the proxy listeners ordered by name (caller holds wm.mu)
+func (wm *Manager) sortedServers() []*ProxyServer {
+	servers := make([]*ProxyServer, 0, len(wm.servers))
+	for _, server := range wm.servers {
+		servers = append(servers, server)
+	}
+	sort.Slice(servers, func(i, j int) bool { return servers[i].Name < servers[j].Name })
+	return servers
+}
+
+// addListener validates, saves and registers a new listener (caller holds wm.mu)
+func (wm *Manager) addListener(cfg models.ProxyConfig) (*ProxyServer, error) {
+	if err := config.ValidateProxyConfig(&cfg); err != nil {
+		return nil, err
+	}
+	if _, exists := wm.servers[cfg.Name]; exists {
+		return nil, fmt.Errorf("%w: %s", errListenerExists, cfg.Name)
+	}
+	if err := config.SaveProxyConfig(wm.db, &cfg); err != nil {
+		return nil, err
+	}
+	server := &ProxyServer{ProxyConfig: cfg}
+	wm.servers[cfg.Name] = server
+	applyListenerLimits(server)
+	return server, nil
+}
+
+// removeListener stops and deletes a listener (caller holds wm.mu)
+func (wm *Manager) removeListener(server *ProxyServer) error {
+	if server.Running {
+		wm.stopProxy(server)
+	}
+	if err := config.DeleteProxyConfig(wm.db, server.Name); err != nil {
 		return err
 	}
+	delete(wm.servers, server.Name)
+	proxy.GetShaper().SetListenerRate(server.Name, 0, 0)
+	proxy.RemoveListenerLimiter(server.Name)
+	return nil
+}
 
-	server.Port = port
-	server.BindListen = bindListen
-	server.Listener = listener
-	server.Running = true
+// reloadListeners brings the listeners in line with the stored configurations
+// Deleted listeners stop, new ones start if they are set to autostart,
+// and running ones whose binding changed restart with the new settings
+func (wm *Manager) reloadListeners() error {
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
 
-	// Save configuration to database
-	proxyConfig := &models.ProxyConfig{
-		Type:       server.Type,
-		Port:       port,
-		BindListen: bindListen,
-		AutoStart:  server.AutoStart, // Preserve existing AutoStart setting
+	configs, err := config.ListProxyConfigs(wm.db)
+	if err != nil {
+		return fmt.Errorf("failed to load listener configurations: %w", err)
 	}
-	if err := config.SaveProxyConfig(wm.db, proxyConfig); err != nil {
-		fmt.Printf("Warning: Failed to save proxy config to database: %v\n", err)
+	stored := make(map[string]models.ProxyConfig, len(configs))
+	for _, cfg := range configs {
+		stored[cfg.Name] = cfg
 	}
 
-	// Start config reload goroutine with shutdown context
-	go func() {
-		ticker := time.NewTicker(10 * time.Second)
-		defer ticker.Stop()
+	for _, server := range wm.sortedServers() {
+		if _, ok := stored[server.Name]; ok {
+			continue
+		}
+		if server.Running {
+			wm.stopProxy(server)
+		}
+		delete(wm.servers, server.Name)
+		proxy.GetShaper().SetListenerRate(server.Name, 0, 0)
+		proxy.RemoveListenerLimiter(server.Name)
+	}
 
-		for {
-			select {
-			case <-wm.shutdownCtx.Done():
-				return
-			case <-ticker.C:
-				if !server.Running {
-					return
+	for _, cfg := range configs {
+		server, exists := wm.servers[cfg.Name]
+		if !exists {
+			server = &ProxyServer{ProxyConfig: cfg}
+			wm.servers[cfg.Name] = server
+			applyListenerLimits(server)
+			if cfg.AutoStart {
+				if err := wm.startProxy(server); err != nil {
+					logger.Error("Failed to start %s proxy %s: %v", server.Type, server.Name, err)
 				}
-				auth.LoadCredentialsFromDB(wm.db)
-				auth.LoadWhitelistFromDB(wm.db)
 			}
+			continue
 		}
-	}()
-
-	// Start accepting connections
-	go func() {
-		for server.Running {
-			conn, err := listener.Accept()
-			if err != nil {
-				if server.Running {
-					fmt.Printf("%s proxy accept error: %v\n", server.Type, err)
-				}
-				continue
-			}
 
-			if server.Type == "socks5" {
-				go proxy.HandleSocks5Connection(conn, bindListen)
-			} else if server.Type == "http" {
-				go proxy.HandleHTTPConnection(conn, bindListen)
+		// Connections accepted by the old sockets keep running
+		restart := server.Running && !sameListenerBinding(server.ProxyConfig, cfg)
+		if restart {
+			wm.closeProxy(server)
+		}
+		server.ProxyConfig = cfg
+		applyListenerLimits(server)
+		if restart {
+			if err := wm.startProxy(server); err != nil {
+				logger.Error("Failed to restart %s proxy %s: %v", server.Type, server.Name, err)
 			}
 		}
-	}()
+	}
+	return nil
+}
+
+// startProxy starts a proxy listener with its configured address, port and TLS settings (caller holds wm.mu)
+func (wm *Manager) startProxy(server *ProxyServer) error {
+	if server.Port == 0 {
+		return fmt.Errorf("listener '%s' has no port configured", server.Name)
+	}
+	var tlsConfig *tls.Config
+	if server.TLS {
+		certificate, err := tls.LoadX509KeyPair(server.TLSCert, server.TLSKey)
+		if err != nil {
+			return fmt.Errorf("failed to load TLS certificate of listener '%s': %w", server.Name, err)
+		}
+		tlsConfig = &tls.Config{
+			Certificates: []tls.Certificate{certificate},
+			MinVersion:   tls.VersionTLS12,
+		}
+	}
+
+	listeners := proxy.NewListenerGroup(server.listenSpec(), server.proxyListener(), tlsConfig)
+	if err := listeners.Open(); err != nil {
+		return err
+	}
+
+	server.Listeners = listeners
+	server.Running = true
+
+	// Save configuration to database
+	if err := config.SaveProxyConfig(wm.db, &server.ProxyConfig); err != nil {
+		fmt.Printf("Warning: Failed to save proxy config to database: %v\n", err)
+	}
 
-	fmt.Printf("%s proxy started on port %d\n", server.Type, port)
+	fmt.Printf("%s proxy %s started on %s\n", server.Type, server.Name, listeners)
 	return nil
 }
 
-// stopProxy stops a running proxy server
+// stopProxy stops a running proxy listener and drains its connections in the background (caller holds wm.mu)
 func (wm *Manager) stopProxy(server *ProxyServer) {
+	wm.closeProxy(server)
+	go proxy.DrainConnections(server.Name, config.GetTimeout().Drain)
+}
+
+// closeProxy stops accepting connections on a running proxy listener (caller holds wm.mu)
+func (wm *Manager) closeProxy(server *ProxyServer) {
 	server.Running = false
-	if server.Listener != nil {
-		server.Listener.Close()
+	if server.Listeners != nil {
+		server.Listeners.Close()
 	}
-	fmt.Printf("%s proxy stopped\n", server.Type)
+	fmt.Printf("%s proxy %s stopped\n", server.Type, server.Name)
 }
 
-// AutoStartProxy starts a proxy server automatically on application launch
-func (wm *Manager) AutoStartProxy(proxyType string, port int, bindListen bool) error {
+// AutoStartProxies starts every listener configured to start on application launch,
+// and after a hot upgrade every listener whose sockets were handed over
+func (wm *Manager) AutoStartProxies() {
 	wm.mu.Lock()
 	defer wm.mu.Unlock()
 
-	var server *ProxyServer
-	if proxyType == "socks5" {
-		server = wm.socksServer
-	} else if proxyType == "http" {
-		server = wm.httpServer
-	} else {
-		return fmt.Errorf("invalid proxy type: %s", proxyType)
+	for _, server := range wm.sortedServers() {
+		// Listeners running in the process this one upgraded keep running
+		if server.Running || !(server.AutoStart || server.listenSpec().Inherited()) {
+			continue
+		}
+		logger.Info("Auto-starting %s proxy %s on %s", server.Type, server.Name, server.listenSpec())
+		if err := wm.startProxy(server); err != nil {
+			logger.Error("Failed to auto-start %s proxy %s: %v", server.Type, server.Name, err)
+		}
 	}
+}
 
-	if server.Running {
-		return fmt.Errorf("%s proxy is already running", proxyType)
-	}
+// StartAllProxies starts every configured listener regardless of its autostart setting
+func (wm *Manager) StartAllProxies() {
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
 
-	return wm.startProxy(server, port, bindListen)
+	for _, server := range wm.sortedServers() {
+		if server.Running {
+			continue
+		}
+		logger.Info("Starting %s proxy %s on %s", server.Type, server.Name, server.listenSpec())
+		if err := wm.startProxy(server); err != nil {
+			logger.Error("Failed to start %s proxy %s: %v", server.Type, server.Name, err)
+		}
+	}
 }
 
 // GetActualPort returns the actual port being used by the web server
@@ -182,18 +323,37 @@ func (wm *Manager) SetActualPort(port int) {
 	wm.actualPort = port
 }
 
-// StopAllProxies stops all running proxy servers
-func (wm *Manager) StopAllProxies() {
-	wm.mu.Lock()
-	defer wm.mu.Unlock()
+// URL returns the address the web management interface is reachable at
+func (wm *Manager) URL() string {
+	wm.mu.RLock()
+	defer wm.mu.RUnlock()
 
-	if wm.socksServer.Running {
-		wm.stopProxy(wm.socksServer)
+	if wm.webConfig.IsUnixSocket() {
+		return wm.webConfig.Listen
 	}
+	scheme := "http"
+	if wm.webConfig.TLS {
+		scheme = "https"
+	}
+	host := wm.webConfig.Listen
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = "localhost"
+	}
+	return fmt.Sprintf("%s://%s", scheme, net.JoinHostPort(host, strconv.Itoa(wm.actualPort)))
+}
 
-	if wm.httpServer.Running {
-		wm.stopProxy(wm.httpServer)
+// StopAllProxies stops all running proxy servers and waits for their connections to drain
+func (wm *Manager) StopAllProxies() {
+	wm.mu.Lock()
+	for _, server := range wm.servers {
+		if server.Running {
+			wm.closeProxy(server)
+		}
 	}
+	wm.mu.Unlock()
+
+	// Drain without holding the lock so the status stays readable meanwhile
+	proxy.DrainConnections("", config.GetTimeout().Drain)
 }
 
 // Shutdown gracefully shuts down the web server
@@ -215,12 +375,21 @@ func (wm *Manager) Shutdown() error {
 
 // ShutdownApplication gracefully shuts down the entire application
 func (wm *Manager) ShutdownApplication() error {
+	systemd.Notify(systemd.StateStopping, systemd.Status("Draining connections"))
+
 	// Stop all proxy servers first
 	wm.StopAllProxies()
 
 	// Close all HTTP transport connections
 	proxy.CloseAllTransports()
 
+	// Persist pending traffic quota usage
+	if manager := quota.GetManager(); manager != nil {
+		if err := manager.Stop(); err != nil {
+			fmt.Printf("Warning: Failed to flush quota usage: %v\n", err)
+		}
+	}
+
 	// Shutdown the web server
 	if err := wm.Shutdown(); err != nil {
 		return err
@@ -0,0 +1,208 @@
+package web
+
+import (
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// pathParamPattern matches the path parameters of a route
+var pathParamPattern = regexp.MustCompile(`\{([^}]+)\}`)
+
+// timeType is documented as a date-time string
+var timeType = reflect.TypeOf(time.Time{})
+
+// openAPIDocument generates the OpenAPI 3 description of the v1 routes
+func openAPIDocument(routes []apiRoute) map[string]interface{} {
+	schemas := map[string]interface{}{
+		"Error": schemaFor(reflect.TypeOf(apiErrorEnvelope{}), nil),
+	}
+	paths := make(map[string]interface{})
+
+	for _, route := range routes {
+		operation := map[string]interface{}{
+			"tags":        []string{route.Tag},
+			"summary":     route.Summary,
+			"operationId": operationID(route),
+		}
+
+		var parameters []interface{}
+		for _, match := range pathParamPattern.FindAllStringSubmatch(route.Path, -1) {
+			parameters = append(parameters, map[string]interface{}{
+				"name": match[1], "in": "path", "required": true,
+				"schema": map[string]interface{}{"type": "string"},
+			})
+		}
+		for _, param := range route.Query {
+			parameters = append(parameters, map[string]interface{}{
+				"name": param.Name, "in": "query", "description": param.Description,
+				"schema": map[string]interface{}{"type": param.Type},
+			})
+		}
+		if route.Conditional {
+			parameters = append(parameters, map[string]interface{}{
+				"name": "If-Match", "in": "header",
+				"description": "ETag of the resource as last read; the request fails with 412 if it changed meanwhile",
+				"schema":      map[string]interface{}{"type": "string"},
+			})
+		}
+		if len(parameters) > 0 {
+			operation["parameters"] = parameters
+		}
+
+		if route.Request != nil {
+			operation["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content": map[string]interface{}{
+					"application/json": map[string]interface{}{
+						"schema": schemaFor(reflect.TypeOf(route.Request), schemas),
+					},
+				},
+			}
+		}
+
+		status := route.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		success := map[string]interface{}{"description": http.StatusText(status)}
+		if route.Response != nil {
+			responseType := reflect.TypeOf(route.Response)
+			var schema interface{}
+			if responseType.Kind() == reflect.Slice {
+				schema = listSchema(responseType.Elem(), schemas)
+			} else {
+				schema = schemaFor(responseType, schemas)
+				success["headers"] = map[string]interface{}{
+					"ETag": map[string]interface{}{
+						"description": "Entity tag for If-Match",
+						"schema":      map[string]interface{}{"type": "string"},
+					},
+				}
+			}
+			success["content"] = map[string]interface{}{
+				"application/json": map[string]interface{}{"schema": schema},
+			}
+		}
+		errorResponse := map[string]interface{}{
+			"description": "Error",
+			"content": map[string]interface{}{
+				"application/json": map[string]interface{}{
+					"schema": map[string]interface{}{"$ref": "#/components/schemas/Error"},
+				},
+			},
+		}
+		operation["responses"] = map[string]interface{}{
+			strconv.Itoa(status): success,
+			"default":            errorResponse,
+		}
+
+		path := "/api/v1" + route.Path
+		item, ok := paths[path].(map[string]interface{})
+		if !ok {
+			item = make(map[string]interface{})
+			paths[path] = item
+		}
+		item[strings.ToLower(route.Method)] = operation
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   "Go Proxy Server Management API",
+			"version": "1.0.0",
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": schemas,
+			"securitySchemes": map[string]interface{}{
+				"bearerAuth": map[string]interface{}{"type": "http", "scheme": "bearer"},
+				"cookieAuth": map[string]interface{}{"type": "apiKey", "in": "cookie", "name": sessionCookieName},
+			},
+		},
+		"security": []interface{}{
+			map[string]interface{}{"bearerAuth": []string{}},
+			map[string]interface{}{"cookieAuth": []string{}},
+		},
+	}
+}
+
+// operationID derives a unique operation name from the method and path, e.g. "post_listeners_id_start"
+func operationID(route apiRoute) string {
+	path := pathParamPattern.ReplaceAllString(route.Path, "$1")
+	return strings.ToLower(route.Method) + strings.ReplaceAll(path, "/", "_")
+}
+
+// listSchema returns the schema of a paginated list of elem
+func listSchema(elem reflect.Type, schemas map[string]interface{}) interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"items":    map[string]interface{}{"type": "array", "items": schemaFor(elem, schemas)},
+			"total":    map[string]interface{}{"type": "integer"},
+			"page":     map[string]interface{}{"type": "integer"},
+			"pageSize": map[string]interface{}{"type": "integer"},
+		},
+	}
+}
+
+// schemaFor returns the JSON schema of a Go type
+// Named structs are added to schemas as components and referenced (schemas nil = inline)
+func schemaFor(t reflect.Type, schemas map[string]interface{}) interface{} {
+	if t.Kind() == reflect.Ptr {
+		return schemaFor(t.Elem(), schemas)
+	}
+	if t == timeType {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": schemaFor(t.Elem(), schemas)}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": schemaFor(t.Elem(), schemas)}
+	case reflect.Struct:
+		name := strings.TrimPrefix(t.Name(), "api")
+		if schemas != nil && name != "" {
+			if _, ok := schemas[name]; !ok {
+				schemas[name] = nil // Placeholder against recursion
+				schemas[name] = structSchema(t, schemas)
+			}
+			return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+		}
+		return structSchema(t, schemas)
+	}
+	return map[string]interface{}{}
+}
+
+// structSchema returns the object schema of a struct from its JSON field names
+func structSchema(t reflect.Type, schemas map[string]interface{}) interface{} {
+	properties := make(map[string]interface{})
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name := field.Name
+		if tag := field.Tag.Get("json"); tag != "" {
+			if tag == "-" {
+				continue
+			}
+			name = strings.Split(tag, ",")[0]
+		}
+		properties[name] = schemaFor(field.Type, schemas)
+	}
+	return map[string]interface{}{"type": "object", "properties": properties}
+}
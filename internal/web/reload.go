@@ -0,0 +1,43 @@
+package web
+
+import (
+	"net/http"
+
+	"go-proxy-server/internal/reload"
+)
+
+// reloadTopics lists the configuration an API endpoint changes, including what depends on it
+// (e.g. deleting a user also drops its limits, access rules and schedule assignments)
+// Endpoints missing here apply their changes themselves
+var reloadTopics = map[string][]reload.Topic{
+	"/api/users":                 {reload.Users, reload.UserLimits, reload.AccessRules, reload.Schedules},
+	"/api/users/group":           {reload.Users},
+	"/api/users/limits":          {reload.UserLimits},
+	"/api/whitelist":             {reload.Whitelist, reload.Schedules},
+	"/api/groups":                {reload.Users, reload.AccessRules, reload.Schedules},
+	"/api/acl":                   {reload.AccessRules},
+	"/api/schedules":             {reload.Schedules},
+	"/api/schedules/assignments": {reload.Schedules},
+	"/api/config":                {reload.Timeouts, reload.Limiter, reload.Security, reload.Bandwidth, reload.Backups},
+	"/api/v1/users":              {reload.Users, reload.UserLimits, reload.AccessRules, reload.Schedules},
+	"/api/v1/whitelist":          {reload.Whitelist, reload.Schedules},
+}
+
+// announceChanges runs an API handler and announces the configuration a successful change affected,
+// so it applies to the running proxies immediately
+func announceChanges(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		topics := reloadTopics[endpointKey(r.URL.Path)]
+		if !isStateChanging(r.Method) || topics == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		if rec.status == 0 || rec.status < http.StatusBadRequest {
+			// Failures are logged and counted by the bus; the change itself is already saved
+			reload.Notify(topics...)
+		}
+	})
+}
@@ -0,0 +1,439 @@
+package web
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"go-proxy-server/internal/admin"
+	"go-proxy-server/internal/ratelimit"
+)
+
+const (
+	// sessionCookieName is the cookie carrying the admin session
+	sessionCookieName = "gps_session"
+	// csrfHeaderName carries the session's CSRF token on state-changing requests
+	csrfHeaderName = "X-CSRF-Token"
+	// deviceCookieName is the remember-device cookie letting a browser skip the TOTP code
+	deviceCookieName = "gps_device"
+
+	// Lifetime of a login waiting for its TOTP code and the codes that may be tried
+	pendingLoginTTL         = 5 * time.Minute
+	maxSecondFactorAttempts = 5
+
+	// Failed logins allowed per client IP and window before logins are refused
+	maxLoginFailures   = 10
+	loginFailureWindow = 5 * time.Minute
+)
+
+// publicAPIPaths can be used without being logged in
+var publicAPIPaths = map[string]bool{
+	"/api/login":   true,
+	"/api/session": true,
+	"/api/setup":   true,
+
+	"/api/login/verify": true,
+
+	"/api/v1/openapi.json": true,
+}
+
+// enrollmentPaths remain usable by admins who must set up TOTP before anything else
+var enrollmentPaths = map[string]bool{
+	"/api/logout":        true,
+	"/api/totp":          true,
+	"/api/totp/enroll":   true,
+	"/api/totp/activate": true,
+}
+
+// endpointRoles are the roles required to read (GET) and to change an API endpoint
+type endpointRoles struct {
+	read  admin.Role
+	write admin.Role
+}
+
+// defaultEndpointRoles applies to API endpoints missing from endpointPermissions
+var defaultEndpointRoles = endpointRoles{read: admin.RoleViewer, write: admin.RoleAdmin}
+
+// endpointPermissions lists the roles required per API endpoint
+var endpointPermissions = map[string]endpointRoles{
+	// The admin's own account; changing other admins' passwords is checked by the handler
+	"/api/logout":              {admin.RoleViewer, admin.RoleViewer},
+	"/api/admins/password":     {admin.RoleViewer, admin.RoleViewer},
+	"/api/tokens":              {admin.RoleViewer, admin.RoleViewer},
+	"/api/totp":                {admin.RoleViewer, admin.RoleViewer},
+	"/api/totp/enroll":         {admin.RoleViewer, admin.RoleViewer},
+	"/api/totp/activate":       {admin.RoleViewer, admin.RoleViewer},
+	"/api/totp/recovery-codes": {admin.RoleViewer, admin.RoleViewer},
+	"/api/totp/devices":        {admin.RoleViewer, admin.RoleViewer},
+
+	// Proxy users, access rules and listeners
+	"/api/users":                 {admin.RoleViewer, admin.RoleOperator},
+	"/api/users/limits":          {admin.RoleViewer, admin.RoleOperator},
+	"/api/users/group":           {admin.RoleViewer, admin.RoleOperator},
+	"/api/whitelist":             {admin.RoleViewer, admin.RoleOperator},
+	"/api/quotas":                {admin.RoleViewer, admin.RoleOperator},
+	"/api/quotas/reset":          {admin.RoleViewer, admin.RoleOperator},
+	"/api/groups":                {admin.RoleViewer, admin.RoleOperator},
+	"/api/acl":                   {admin.RoleViewer, admin.RoleOperator},
+	"/api/schedules":             {admin.RoleViewer, admin.RoleOperator},
+	"/api/schedules/assignments": {admin.RoleViewer, admin.RoleOperator},
+	"/api/proxy/start":           {admin.RoleViewer, admin.RoleOperator},
+	"/api/proxy/stop":            {admin.RoleViewer, admin.RoleOperator},
+	"/api/proxy/config":          {admin.RoleViewer, admin.RoleOperator},
+	"/api/auth/test":             {admin.RoleOperator, admin.RoleOperator},
+	"/api/v1/users":              {admin.RoleViewer, admin.RoleOperator},
+	"/api/v1/whitelist":          {admin.RoleViewer, admin.RoleOperator},
+	"/api/v1/listeners":          {admin.RoleViewer, admin.RoleOperator},
+
+	// Admin accounts and the audit trail
+	"/api/admins":      {admin.RoleAdmin, admin.RoleAdmin},
+	"/api/admins/role": {admin.RoleAdmin, admin.RoleAdmin},
+	"/api/admins/totp": {admin.RoleAdmin, admin.RoleAdmin},
+	"/api/audit":       {admin.RoleAdmin, admin.RoleAdmin},
+
+	// The configuration file holds password hashes and replaces the whole configuration
+	"/api/config/export": {admin.RoleAdmin, admin.RoleAdmin},
+	"/api/config/import": {admin.RoleAdmin, admin.RoleAdmin},
+
+	// A database backup holds every secret, including admin credentials
+	"/api/backup": {admin.RoleAdmin, admin.RoleAdmin},
+}
+
+// requiredRole returns the role needed for a request to an API endpoint
+func requiredRole(path, method string) admin.Role {
+	roles, ok := endpointPermissions[endpointKey(path)]
+	if !ok {
+		roles = defaultEndpointRoles
+	}
+	if isStateChanging(method) {
+		return roles.write
+	}
+	return roles.read
+}
+
+// pendingLogin is a login whose password was verified and that awaits the TOTP code
+type pendingLogin struct {
+	username  string
+	clientIP  string
+	expiresAt time.Time
+	attempts  int
+}
+
+// adminContextKey is the context key carrying the authenticated admin
+type adminContextKey struct{}
+
+// roleContextKey is the context key carrying the role of the authenticated admin
+type roleContextKey struct{}
+
+// adminFromRequest returns the admin authenticated for the request (empty for public endpoints)
+func adminFromRequest(r *http.Request) string {
+	username, _ := r.Context().Value(adminContextKey{}).(string)
+	return username
+}
+
+// roleFromRequest returns the role of the admin authenticated for the request
+func roleFromRequest(r *http.Request) admin.Role {
+	role, _ := r.Context().Value(roleContextKey{}).(admin.Role)
+	return role
+}
+
+// clientIP returns the address of the client of a management request
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// isStateChanging reports whether a method may modify state and therefore needs CSRF protection
+func isStateChanging(method string) bool {
+	return method != http.MethodGet && method != http.MethodHead && method != http.MethodOptions
+}
+
+// validHost reports whether the Host header names this server
+// Only localhost, IP addresses and the configured host names are accepted, which
+// defeats DNS rebinding, where a hostile domain resolves to this server
+func (wm *Manager) validHost(hostHeader string) bool {
+	host, _, err := net.SplitHostPort(hostHeader)
+	if err != nil {
+		host = hostHeader
+	}
+	host = strings.ToLower(strings.Trim(host, "[]"))
+	if host == "localhost" || net.ParseIP(host) != nil {
+		return true
+	}
+	wm.mu.RLock()
+	defer wm.mu.RUnlock()
+	for _, name := range wm.webConfig.Hosts {
+		if strings.EqualFold(name, host) {
+			return true
+		}
+	}
+	return false
+}
+
+// isLocalRequest reports whether a request comes from the local machine
+// (a loopback address or the unix socket)
+func (wm *Manager) isLocalRequest(r *http.Request) bool {
+	wm.mu.RLock()
+	unixSocket := wm.webConfig.IsUnixSocket()
+	wm.mu.RUnlock()
+	if unixSocket {
+		return true
+	}
+	ip := net.ParseIP(clientIP(r))
+	return ip != nil && ip.IsLoopback()
+}
+
+// clientAllowed reports whether the management IP allowlist admits a request
+// Local requests are always admitted so the allowlist cannot lock out the machine itself
+func (wm *Manager) clientAllowed(r *http.Request) bool {
+	wm.mu.RLock()
+	allowed := wm.allowedNetworks
+	wm.mu.RUnlock()
+	if len(allowed) == 0 || wm.isLocalRequest(r) {
+		return true
+	}
+	ip := net.ParseIP(clientIP(r))
+	if ip == nil {
+		return false
+	}
+	for _, network := range allowed {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// sameOrigin reports whether a browser request comes from the management UI itself
+// Requests without Origin (non-browser clients, same-origin navigation) are accepted
+func sameOrigin(r *http.Request) bool {
+	if r.Header.Get("Sec-Fetch-Site") == "cross-site" {
+		return false
+	}
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	return strings.EqualFold(u.Host, r.Host)
+}
+
+// authenticateRequest identifies the admin of an API request by bearer token or session cookie
+// Returns the admin and, for cookie sessions, the CSRF token the request must carry
+func (wm *Manager) authenticateRequest(r *http.Request) (username, csrfToken string, err error) {
+	if header := r.Header.Get("Authorization"); strings.HasPrefix(header, "Bearer ") {
+		username, err = admin.LookupToken(wm.db, strings.TrimPrefix(header, "Bearer "))
+		return username, "", err
+	}
+	cookie, err := r.Cookie(sessionCookieName)
+	if err != nil {
+		return "", "", admin.ErrSessionExpired
+	}
+	session, err := admin.LookupSession(wm.db, cookie.Value)
+	if err != nil {
+		return "", "", err
+	}
+	return session.Username, session.CSRFToken, nil
+}
+
+// protect wraps the management handlers with the IP allowlist, Host/Origin validation,
+// admin authentication, role checks, the audit trail and change announcements
+func (wm *Manager) protect(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Frame-Options", "DENY")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Header().Set("Referrer-Policy", "same-origin")
+
+		if !wm.clientAllowed(r) {
+			writeError(w, r, http.StatusForbidden, "Forbidden")
+			return
+		}
+		if !wm.validHost(r.Host) {
+			writeError(w, r, http.StatusMisdirectedRequest, "Invalid Host header")
+			return
+		}
+		if !sameOrigin(r) {
+			writeError(w, r, http.StatusForbidden, "Cross-origin request rejected")
+			return
+		}
+		if !strings.HasPrefix(r.URL.Path, "/api/") {
+			// Static UI files; the UI shows the login page when the API answers 401
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Cache-Control", "no-store")
+		if publicAPIPaths[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		username, csrfToken, err := wm.authenticateRequest(r)
+		if err != nil {
+			writeError(w, r, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+		// Bearer tokens are never sent automatically by browsers, so only cookie sessions need CSRF tokens
+		if csrfToken != "" && isStateChanging(r.Method) &&
+			subtle.ConstantTimeCompare([]byte(r.Header.Get(csrfHeaderName)), []byte(csrfToken)) != 1 {
+			writeError(w, r, http.StatusForbidden, "Invalid CSRF token")
+			return
+		}
+
+		if !enrollmentPaths[r.URL.Path] {
+			required, err := admin.EnrollmentRequired(wm.db, username)
+			if err != nil {
+				writeError(w, r, http.StatusUnauthorized, "Unauthorized")
+				return
+			}
+			if required {
+				writeError(w, r, http.StatusForbidden, "Two-factor authentication must be set up first")
+				return
+			}
+		}
+
+		role, err := admin.GetRole(wm.db, username)
+		if err != nil {
+			writeError(w, r, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+		if !role.Allows(requiredRole(r.URL.Path, r.Method)) {
+			writeError(w, r, http.StatusForbidden, "Your role does not permit this action")
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), adminContextKey{}, username)
+		ctx = context.WithValue(ctx, roleContextKey{}, role)
+		wm.serveAudited(w, r.WithContext(ctx), announceChanges(next))
+	})
+}
+
+// setSessionCookie stores the session cookie in the browser
+func setSessionCookie(w http.ResponseWriter, r *http.Request, token string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    token,
+		Path:     "/",
+		MaxAge:   int(admin.SessionMaxAge / time.Second),
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+// clearSessionCookie removes the session cookie from the browser
+func clearSessionCookie(w http.ResponseWriter, r *http.Request) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+// setDeviceCookie stores the remember-device cookie; it is only sent to the login endpoints
+func setDeviceCookie(w http.ResponseWriter, r *http.Request, token string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     deviceCookieName,
+		Value:    token,
+		Path:     "/api/login",
+		MaxAge:   int(admin.DeviceTrustDuration / time.Second),
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+// beginPendingLogin records a login awaiting its TOTP code and returns the challenge identifying it
+func (wm *Manager) beginPendingLogin(username, ip string) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	challenge := base64.RawURLEncoding.EncodeToString(b)
+
+	wm.pendingMu.Lock()
+	defer wm.pendingMu.Unlock()
+	now := time.Now()
+	for key, pending := range wm.pendingLogins {
+		if now.After(pending.expiresAt) {
+			delete(wm.pendingLogins, key)
+		}
+	}
+	wm.pendingLogins[challenge] = &pendingLogin{
+		username:  username,
+		clientIP:  ip,
+		expiresAt: now.Add(pendingLoginTTL),
+	}
+	return challenge, nil
+}
+
+// pendingLoginUser returns the admin of a pending login started from the same client IP
+func (wm *Manager) pendingLoginUser(challenge, ip string) (string, bool) {
+	wm.pendingMu.Lock()
+	defer wm.pendingMu.Unlock()
+	pending, ok := wm.pendingLogins[challenge]
+	if !ok || pending.clientIP != ip || time.Now().After(pending.expiresAt) {
+		return "", false
+	}
+	return pending.username, true
+}
+
+// failPendingLogin counts a wrong code and drops the pending login after too many
+func (wm *Manager) failPendingLogin(challenge string) {
+	wm.pendingMu.Lock()
+	defer wm.pendingMu.Unlock()
+	if pending, ok := wm.pendingLogins[challenge]; ok {
+		pending.attempts++
+		if pending.attempts >= maxSecondFactorAttempts {
+			delete(wm.pendingLogins, challenge)
+		}
+	}
+}
+
+// finishPendingLogin removes a completed pending login
+func (wm *Manager) finishPendingLogin(challenge string) {
+	wm.pendingMu.Lock()
+	defer wm.pendingMu.Unlock()
+	delete(wm.pendingLogins, challenge)
+}
+
+// loginBlocked reports whether a client IP has failed to log in too often
+func (wm *Manager) loginBlocked(ip string) bool {
+	wm.loginMu.Lock()
+	defer wm.loginMu.Unlock()
+	counter, ok := wm.loginFailures[ip]
+	return ok && counter.Count() >= maxLoginFailures
+}
+
+// recordLoginFailure counts a failed login of a client IP
+func (wm *Manager) recordLoginFailure(ip string) {
+	wm.loginMu.Lock()
+	defer wm.loginMu.Unlock()
+	for key, counter := range wm.loginFailures {
+		if counter.Expired() {
+			delete(wm.loginFailures, key)
+		}
+	}
+	counter, ok := wm.loginFailures[ip]
+	if !ok {
+		counter = ratelimit.NewWindowCounter(loginFailureWindow)
+		wm.loginFailures[ip] = counter
+	}
+	counter.Allow(0)
+}
@@ -0,0 +1,162 @@
+package web
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"go-proxy-server/internal/config"
+	"go-proxy-server/internal/logger"
+)
+
+const (
+	// File names of the generated certificate in the data directory
+	selfSignedCertFile = "web-cert.pem"
+	selfSignedKeyFile  = "web-key.pem"
+
+	// Lifetime of generated certificates; they are replaced shortly before expiring
+	selfSignedValidity = 365 * 24 * time.Hour
+	selfSignedRenewal  = 30 * 24 * time.Hour
+)
+
+// tlsConfig returns the TLS configuration of the web server with the configured
+// certificate, or a self-signed certificate kept in the data directory
+func tlsConfig(cfg config.WebConfig) (*tls.Config, error) {
+	certFile, keyFile := cfg.CertFile, cfg.KeyFile
+	if certFile == "" {
+		dataDir, err := config.GetDataDir()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get data directory: %w", err)
+		}
+		certFile = filepath.Join(dataDir, selfSignedCertFile)
+		keyFile = filepath.Join(dataDir, selfSignedKeyFile)
+		if err := ensureSelfSignedCertificate(certFile, keyFile, cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+	if cfg.CertFile == "" {
+		sum := sha256.Sum256(cert.Certificate[0])
+		logger.Info("Using self-signed certificate %s (SHA-256 fingerprint %s)", certFile, hex.EncodeToString(sum[:]))
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// ensureSelfSignedCertificate generates a certificate unless a usable one exists
+// A certificate is reused while it is valid for another renewal period and covers
+// the configured host names, so browsers keep their exception
+func ensureSelfSignedCertificate(certFile, keyFile string, cfg config.WebConfig) error {
+	dnsNames, ips := certificateNames(cfg)
+	if existing, err := readCertificate(certFile); err == nil && time.Until(existing.NotAfter) > selfSignedRenewal {
+		covered := true
+		for _, name := range dnsNames {
+			if existing.VerifyHostname(name) != nil {
+				covered = false
+			}
+		}
+		for _, ip := range ips {
+			if existing.VerifyHostname(ip.String()) != nil {
+				covered = false
+			}
+		}
+		if covered {
+			return nil
+		}
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return fmt.Errorf("failed to generate TLS key: %w", err)
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return fmt.Errorf("failed to generate certificate serial: %w", err)
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "go-proxy-server", Organization: []string{"go-proxy-server"}},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(selfSignedValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		DNSNames:              dnsNames,
+		IPAddresses:           ips,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return fmt.Errorf("failed to create certificate: %w", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return fmt.Errorf("failed to encode TLS key: %w", err)
+	}
+
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		return fmt.Errorf("failed to write TLS key: %w", err)
+	}
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		return fmt.Errorf("failed to write certificate: %w", err)
+	}
+	logger.Info("Generated self-signed certificate %s valid until %s", certFile, template.NotAfter.Format("2006-01-02"))
+	return nil
+}
+
+// certificateNames returns the names a generated certificate must cover
+func certificateNames(cfg config.WebConfig) ([]string, []net.IP) {
+	dnsNames := []string{"localhost"}
+	if hostname, err := os.Hostname(); err == nil && hostname != "" && hostname != "localhost" {
+		dnsNames = append(dnsNames, hostname)
+	}
+	dnsNames = append(dnsNames, cfg.Hosts...)
+
+	ips := []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback}
+	listenIP := net.ParseIP(cfg.Listen)
+	switch {
+	case listenIP == nil || listenIP.IsLoopback():
+	case listenIP.IsUnspecified():
+		// All interfaces: cover every address the machine can be reached by
+		addrs, _ := net.InterfaceAddrs()
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && !ipNet.IP.IsLoopback() && !ipNet.IP.IsLinkLocalUnicast() {
+				ips = append(ips, ipNet.IP)
+			}
+		}
+	default:
+		ips = append(ips, listenIP)
+	}
+	return dnsNames, ips
+}
+
+// readCertificate parses the first certificate of a PEM file
+func readCertificate(path string) (*x509.Certificate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("no certificate in %s", path)
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
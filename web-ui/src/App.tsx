@@ -1,5 +1,5 @@
-import React, { useState } from 'react';
-import { Layout, Menu, theme, Button, Modal, Space } from 'antd';
+import React, { useCallback, useEffect, useState } from 'react';
+import { Layout, Menu, theme, Button, Modal, Space, Spin, Typography } from 'antd';
 import {
   DashboardOutlined,
   ControlOutlined,
@@ -10,13 +10,20 @@ import {
   MenuUnfoldOutlined,
   ApiOutlined,
   PoweroffOutlined,
+  LogoutOutlined,
+  LockOutlined,
 } from '@ant-design/icons';
 import Dashboard from './components/Dashboard';
 import ProxyControl from './components/ProxyControl';
 import UserManagement from './components/UserManagement';
 import WhitelistManagement from './components/WhitelistManagement';
 import ConfigManagement from './components/ConfigManagement';
+import Login from './components/Login';
+import AccountSecurity from './components/AccountSecurity';
 import { shutdownApplication } from './api/system';
+import { getSession, logout } from './api/session';
+import { setCsrfToken, UNAUTHORIZED_EVENT } from './api/index';
+import type { SessionState, LoginResponse } from './types/session';
 import './App.css';
 
 const { Header, Sider, Content } = Layout;
@@ -27,10 +34,46 @@ const App: React.FC = () => {
     // Load saved page from localStorage, default to 'dashboard'
     return localStorage.getItem('selectedPage') || 'dashboard';
   });
+  const [session, setSession] = useState<SessionState | null>(null);
   const {
     token: { colorBgContainer },
   } = theme.useToken();
 
+  const loadSession = useCallback(async () => {
+    try {
+      const response = await getSession();
+      setCsrfToken(response.data.csrfToken || '');
+      setSession(response.data);
+    } catch {
+      setSession({ authenticated: false, setupRequired: false });
+    }
+  }, []);
+
+  useEffect(() => {
+    loadSession();
+    // Return to the login page when the session expires
+    const handleUnauthorized = () => {
+      setCsrfToken('');
+      setSession((current) => ({ authenticated: false, setupRequired: current?.setupRequired ?? false }));
+    };
+    window.addEventListener(UNAUTHORIZED_EVENT, handleUnauthorized);
+    return () => window.removeEventListener(UNAUTHORIZED_EVENT, handleUnauthorized);
+  }, [loadSession]);
+
+  const handleLoggedIn = (loggedIn: LoginResponse) => {
+    setCsrfToken(loggedIn.csrfToken);
+    setSession({ authenticated: true, setupRequired: false, ...loggedIn });
+  };
+
+  const handleLogout = async () => {
+    try {
+      await logout();
+    } finally {
+      setCsrfToken('');
+      setSession({ authenticated: false, setupRequired: false });
+    }
+  };
+
   const menuItems = [
     {
       key: 'dashboard',
@@ -57,9 +100,18 @@ const App: React.FC = () => {
       icon: <SettingOutlined />,
       label: '系统配置',
     },
+    {
+      key: 'security',
+      icon: <LockOutlined />,
+      label: '账户安全',
+    },
   ];
 
   const renderContent = () => {
+    // Admins who must set up two-factor authentication can only reach the security page
+    if (session?.totpEnrollmentRequired) {
+      return <AccountSecurity onChanged={loadSession} />;
+    }
     switch (selectedKey) {
       case 'dashboard':
         return <Dashboard />;
@@ -71,6 +123,8 @@ const App: React.FC = () => {
         return <WhitelistManagement />;
       case 'config':
         return <ConfigManagement />;
+      case 'security':
+        return <AccountSecurity onChanged={loadSession} />;
       default:
         return <Dashboard />;
     }
@@ -117,6 +171,18 @@ const App: React.FC = () => {
     });
   };
 
+  if (session === null) {
+    return (
+      <div style={{ minHeight: '100vh', display: 'flex', alignItems: 'center', justifyContent: 'center' }}>
+        <Spin size="large" />
+      </div>
+    );
+  }
+
+  if (!session.authenticated) {
+    return <Login setupRequired={session.setupRequired} onLoggedIn={handleLoggedIn} />;
+  }
+
   return (
     <Layout style={{ minHeight: '100vh' }}>
       <Sider
@@ -149,7 +215,7 @@ const App: React.FC = () => {
         <Menu
           theme="dark"
           mode="inline"
-          selectedKeys={[selectedKey]}
+          selectedKeys={[session.totpEnrollmentRequired ? 'security' : selectedKey]}
           items={menuItems}
           onClick={({ key }) => {
             setSelectedKey(key);
@@ -183,13 +249,19 @@ const App: React.FC = () => {
               Go Proxy Server 管理后台
             </h1>
           </Space>
-          <Button
-            danger
-            icon={<PoweroffOutlined />}
-            onClick={handleShutdown}
-          >
-            退出应用
-          </Button>
+          <Space>
+            <Typography.Text type="secondary">{session.username}</Typography.Text>
+            <Button icon={<LogoutOutlined />} onClick={handleLogout}>
+              退出登录
+            </Button>
+            <Button
+              danger
+              icon={<PoweroffOutlined />}
+              onClick={handleShutdown}
+            >
+              退出应用
+            </Button>
+          </Space>
         </Header>
         <Content
           style={{
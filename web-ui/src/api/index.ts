@@ -6,10 +6,39 @@ const api = axios.create({
   timeout: 10000,
 });
 
+// CSRF token of the current admin session, sent with state-changing requests
+let csrfToken = '';
+
+export const setCsrfToken = (token: string) => {
+  csrfToken = token;
+};
+
+// Event fired when the session has ended, so the app can show the login page
+export const UNAUTHORIZED_EVENT = 'auth:unauthorized';
+
+// 请求拦截器
+api.interceptors.request.use((config) => {
+  const method = (config.method || 'get').toLowerCase();
+  if (csrfToken && !['get', 'head', 'options'].includes(method)) {
+    config.headers.set('X-CSRF-Token', csrfToken);
+  }
+  return config;
+});
+
 // 响应拦截器
 api.interceptors.response.use(
   (response) => response,
   (error) => {
+    const url = error.config?.url;
+    if (url === '/login' || url === '/login/verify' || url === '/setup') {
+      // 登录页自行显示错误
+      return Promise.reject(error);
+    }
+    if (error.response?.status === 401) {
+      // 会话已过期,返回登录页
+      window.dispatchEvent(new Event(UNAUTHORIZED_EVENT));
+      return Promise.reject(error);
+    }
     const errorMessage = error.response?.data || error.message || '请求失败';
     message.error(errorMessage);
     return Promise.reject(error);
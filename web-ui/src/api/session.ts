@@ -0,0 +1,36 @@
+import api from './index';
+import type {
+  SessionState,
+  LoginRequest,
+  LoginResponse,
+  LoginResult,
+  LoginVerifyRequest,
+  TOTPStatus,
+  TOTPEnrollment,
+  RecoveryCodes,
+} from '../types/session';
+
+export const getSession = () => api.get<SessionState>('/session');
+
+export const login = (data: LoginRequest) => api.post<LoginResult>('/login', data);
+
+export const verifyLogin = (data: LoginVerifyRequest) => api.post<LoginResponse>('/login/verify', data);
+
+export const setupAdmin = (data: LoginRequest) => api.post<LoginResponse>('/setup', data);
+
+export const logout = () => api.post('/logout');
+
+export const getTOTPStatus = () => api.get<TOTPStatus>('/totp');
+
+export const enrollTOTP = () => api.post<TOTPEnrollment>('/totp/enroll');
+
+export const activateTOTP = (code: string) => api.post<RecoveryCodes>('/totp/activate', { code });
+
+export const disableTOTP = (password: string, code: string) =>
+  api.delete('/totp', { data: { password, code } });
+
+export const regenerateRecoveryCodes = (code: string) =>
+  api.post<RecoveryCodes>('/totp/recovery-codes', { code });
+
+// id 0 forgets all remembered browsers
+export const forgetDevice = (id: number) => api.delete('/totp/devices', { data: { id } });
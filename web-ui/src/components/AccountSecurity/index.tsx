@@ -0,0 +1,314 @@
+import React, { useState, useEffect } from 'react';
+import {
+  Card,
+  Button,
+  Space,
+  message,
+  Typography,
+  Row,
+  Col,
+  Modal,
+  Input,
+  QRCode,
+  Tag,
+  Table,
+  Alert,
+  Form,
+  Popconfirm,
+} from 'antd';
+import { LockOutlined, SafetyCertificateOutlined, ReloadOutlined, DeleteOutlined } from '@ant-design/icons';
+import {
+  getTOTPStatus,
+  enrollTOTP,
+  activateTOTP,
+  disableTOTP,
+  regenerateRecoveryCodes,
+  forgetDevice,
+} from '../../api/session';
+import type { TOTPStatus, TOTPEnrollment, TrustedDevice } from '../../types/session';
+
+const { Title, Text, Paragraph } = Typography;
+
+interface AccountSecurityProps {
+  // Called after 2FA was enabled or disabled
+  onChanged?: () => void;
+}
+
+const errorMessage = (err: unknown, fallback: string) => {
+  const response = (err as { response?: { data?: string } }).response;
+  return typeof response?.data === 'string' ? response.data : fallback;
+};
+
+const AccountSecurity: React.FC<AccountSecurityProps> = ({ onChanged }) => {
+  const [status, setStatus] = useState<TOTPStatus | null>(null);
+  const [loading, setLoading] = useState(false);
+  const [enrollment, setEnrollment] = useState<TOTPEnrollment | null>(null);
+  const [activationCode, setActivationCode] = useState('');
+  const [recoveryCodes, setRecoveryCodes] = useState<string[]>([]);
+  const [disableVisible, setDisableVisible] = useState(false);
+  const [regenerateVisible, setRegenerateVisible] = useState(false);
+
+  const loadStatus = async () => {
+    try {
+      setLoading(true);
+      const response = await getTOTPStatus();
+      setStatus(response.data);
+    } catch (error) {
+      console.error('Failed to load two-factor status:', error);
+      message.error('加载两步验证状态失败');
+    } finally {
+      setLoading(false);
+    }
+  };
+
+  useEffect(() => {
+    loadStatus();
+  }, []);
+
+  const handleEnroll = async () => {
+    try {
+      const response = await enrollTOTP();
+      setEnrollment(response.data);
+      setActivationCode('');
+    } catch (error) {
+      message.error(errorMessage(error, '生成密钥失败'));
+    }
+  };
+
+  const handleActivate = async () => {
+    try {
+      const response = await activateTOTP(activationCode);
+      setEnrollment(null);
+      setRecoveryCodes(response.data.recoveryCodes);
+      message.success('两步验证已启用');
+      loadStatus();
+      onChanged?.();
+    } catch (error) {
+      message.error(errorMessage(error, '验证码错误'));
+    }
+  };
+
+  const handleDisable = async (values: { password: string; code: string }) => {
+    try {
+      await disableTOTP(values.password, values.code);
+      setDisableVisible(false);
+      message.success('两步验证已关闭');
+      loadStatus();
+      onChanged?.();
+    } catch (error) {
+      message.error(errorMessage(error, '关闭两步验证失败'));
+    }
+  };
+
+  const handleRegenerate = async (values: { code: string }) => {
+    try {
+      const response = await regenerateRecoveryCodes(values.code);
+      setRegenerateVisible(false);
+      setRecoveryCodes(response.data.recoveryCodes);
+      loadStatus();
+    } catch (error) {
+      message.error(errorMessage(error, '生成恢复码失败'));
+    }
+  };
+
+  const handleForgetDevice = async (id: number) => {
+    try {
+      await forgetDevice(id);
+      message.success('已移除');
+      loadStatus();
+    } catch (error) {
+      message.error(errorMessage(error, '移除失败'));
+    }
+  };
+
+  const deviceColumns = [
+    { title: 'IP 地址', dataIndex: 'clientIP', key: 'clientIP' },
+    { title: '浏览器', dataIndex: 'userAgent', key: 'userAgent', ellipsis: true },
+    {
+      title: '最近使用',
+      dataIndex: 'lastUsedAt',
+      key: 'lastUsedAt',
+      render: (value: string) => new Date(value).toLocaleString(),
+    },
+    {
+      title: '到期时间',
+      dataIndex: 'expiresAt',
+      key: 'expiresAt',
+      render: (value: string) => new Date(value).toLocaleString(),
+    },
+    {
+      title: '操作',
+      key: 'action',
+      render: (_: unknown, device: TrustedDevice) => (
+        <Popconfirm title="确定移除此浏览器?" onConfirm={() => handleForgetDevice(device.id)}>
+          <Button danger size="small" icon={<DeleteOutlined />}>移除</Button>
+        </Popconfirm>
+      ),
+    },
+  ];
+
+  return (
+    <div>
+      <Title level={3} style={{ marginBottom: 24 }}>
+        <LockOutlined style={{ marginRight: 8, color: '#1890ff' }} />
+        账户安全
+      </Title>
+
+      {status?.required && !status.enabled && (
+        <Alert
+          type="warning"
+          showIcon
+          style={{ marginBottom: 24 }}
+          message="此管理员账户必须启用两步验证"
+          description="完成设置前无法使用管理界面的其他功能。"
+        />
+      )}
+
+      <Row gutter={[24, 24]}>
+        <Col span={24}>
+          <Card
+            title={
+              <Space>
+                <SafetyCertificateOutlined style={{ fontSize: '18px', color: '#52c41a' }} />
+                <span style={{ fontSize: '16px', fontWeight: 600 }}>两步验证 (TOTP)</span>
+                {status && (status.enabled ? <Tag color="green">已启用</Tag> : <Tag>未启用</Tag>)}
+                {status?.required && <Tag color="orange">强制</Tag>}
+              </Space>
+            }
+            bordered={false}
+            style={{ boxShadow: '0 2px 8px rgba(0,0,0,0.1)' }}
+            extra={
+              <Button icon={<ReloadOutlined />} onClick={loadStatus} loading={loading}>
+                刷新
+              </Button>
+            }
+          >
+            {status && !status.enabled && !enrollment && (
+              <Space direction="vertical">
+                <Text>登录时除密码外还需输入身份验证器 (如 Google Authenticator、Microsoft Authenticator) 生成的验证码。</Text>
+                <Button type="primary" onClick={handleEnroll}>启用两步验证</Button>
+              </Space>
+            )}
+
+            {enrollment && (
+              <Space align="start" size={32} wrap>
+                <QRCode value={enrollment.uri} />
+                <Space direction="vertical">
+                  <Text>1. 使用身份验证器扫描二维码,或手动输入密钥:</Text>
+                  <Paragraph copyable code style={{ marginBottom: 0 }}>{enrollment.secret}</Paragraph>
+                  <Text>2. 输入身份验证器显示的 6 位验证码:</Text>
+                  <Space>
+                    <Input
+                      value={activationCode}
+                      onChange={(e) => setActivationCode(e.target.value)}
+                      placeholder="123456"
+                      maxLength={6}
+                      inputMode="numeric"
+                      autoComplete="one-time-code"
+                      style={{ width: 140 }}
+                    />
+                    <Button type="primary" onClick={handleActivate} disabled={activationCode.length !== 6}>
+                      确认启用
+                    </Button>
+                    <Button onClick={() => setEnrollment(null)}>取消</Button>
+                  </Space>
+                </Space>
+              </Space>
+            )}
+
+            {status?.enabled && (
+              <Space direction="vertical">
+                <Text>剩余恢复码: {status.recoveryCodesRemaining}</Text>
+                <Space>
+                  <Button onClick={() => setRegenerateVisible(true)}>重新生成恢复码</Button>
+                  {!status.required && (
+                    <Button danger onClick={() => setDisableVisible(true)}>关闭两步验证</Button>
+                  )}
+                </Space>
+              </Space>
+            )}
+          </Card>
+        </Col>
+
+        {status?.enabled && (
+          <Col span={24}>
+            <Card
+              title={<span style={{ fontSize: '16px', fontWeight: 600 }}>已记住的浏览器 ({status.trustedDevices.length})</span>}
+              bordered={false}
+              style={{ boxShadow: '0 2px 8px rgba(0,0,0,0.1)' }}
+              extra={
+                status.trustedDevices.length > 0 && (
+                  <Popconfirm title="确定移除所有已记住的浏览器?" onConfirm={() => handleForgetDevice(0)}>
+                    <Button danger>全部移除</Button>
+                  </Popconfirm>
+                )
+              }
+            >
+              <Table<TrustedDevice>
+                rowKey="id"
+                columns={deviceColumns}
+                dataSource={status.trustedDevices}
+                pagination={false}
+                size="small"
+              />
+            </Card>
+          </Col>
+        )}
+      </Row>
+
+      <Modal
+        title="恢复码"
+        open={recoveryCodes.length > 0}
+        onOk={() => setRecoveryCodes([])}
+        onCancel={() => setRecoveryCodes([])}
+        cancelButtonProps={{ style: { display: 'none' } }}
+        okText="我已保存"
+      >
+        <Alert
+          type="warning"
+          showIcon
+          style={{ marginBottom: 16 }}
+          message="恢复码只显示一次,请妥善保存。每个恢复码只能使用一次,可在无法使用身份验证器时登录。"
+        />
+        <Paragraph copyable={{ text: recoveryCodes.join('\n') }}>
+          <pre style={{ margin: 0 }}>{recoveryCodes.join('\n')}</pre>
+        </Paragraph>
+      </Modal>
+
+      <Modal
+        title="关闭两步验证"
+        open={disableVisible}
+        onCancel={() => setDisableVisible(false)}
+        footer={null}
+        destroyOnHidden
+      >
+        <Form layout="vertical" onFinish={handleDisable}>
+          <Form.Item name="password" label="当前密码" rules={[{ required: true, message: '请输入当前密码' }]}>
+            <Input.Password autoComplete="current-password" />
+          </Form.Item>
+          <Form.Item name="code" label="验证码" rules={[{ required: true, message: '请输入验证码' }]}>
+            <Input maxLength={6} inputMode="numeric" autoComplete="one-time-code" />
+          </Form.Item>
+          <Button danger type="primary" htmlType="submit" block>关闭两步验证</Button>
+        </Form>
+      </Modal>
+
+      <Modal
+        title="重新生成恢复码"
+        open={regenerateVisible}
+        onCancel={() => setRegenerateVisible(false)}
+        footer={null}
+        destroyOnHidden
+      >
+        <Form layout="vertical" onFinish={handleRegenerate}>
+          <Form.Item name="code" label="验证码" extra="原有恢复码将全部失效" rules={[{ required: true, message: '请输入验证码' }]}>
+            <Input maxLength={6} inputMode="numeric" autoComplete="one-time-code" />
+          </Form.Item>
+          <Button type="primary" htmlType="submit" block>生成</Button>
+        </Form>
+      </Modal>
+    </div>
+  );
+};
+
+export default AccountSecurity;
@@ -1,6 +1,6 @@
 import React, { useState, useEffect } from 'react';
 import { Card, Form, InputNumber, Button, Row, Col, message, Typography, Alert, Switch, Space } from 'antd';
-import { SettingOutlined, SaveOutlined, ClockCircleOutlined, ApiOutlined, WindowsOutlined, CheckCircleOutlined, WarningOutlined, SafetyOutlined } from '@ant-design/icons';
+import { SettingOutlined, SaveOutlined, ClockCircleOutlined, ApiOutlined, DesktopOutlined, CheckCircleOutlined, WarningOutlined, SafetyOutlined } from '@ant-design/icons';
 import { getConfig, saveConfig } from '../../api/config';
 import type { UnifiedConfig } from '../../types/api';
 
@@ -349,7 +349,7 @@ const ConfigManagement: React.FC = () => {
             <Card
               title={
                 <Space>
-                  <WindowsOutlined style={{ color: '#1890ff' }} />
+                  <DesktopOutlined style={{ color: '#1890ff' }} />
                   <Text strong>系统设置</Text>
                 </Space>
               }
@@ -360,10 +360,10 @@ const ConfigManagement: React.FC = () => {
               {!config?.system.autostartSupported && (
                 <Alert
                   message="平台限制"
-                  description="开机自启功能仅在 Windows 平台可用，当前平台不支持此功能。"
+                  description="开机自启功能仅在 Windows 和 Linux 平台可用，当前平台不支持此功能。"
                   type="info"
                   showIcon
-                  icon={<WindowsOutlined />}
+                  icon={<DesktopOutlined />}
                   style={{ marginBottom: 24 }}
                 />
               )}
@@ -371,11 +371,11 @@ const ConfigManagement: React.FC = () => {
               <div style={{ marginBottom: 24 }}>
                 <Space direction="vertical" size="small">
                   <Text strong style={{ fontSize: '16px' }}>
-                    <WindowsOutlined style={{ marginRight: 8, color: '#1890ff' }} />
-                    Windows 开机自启
+                    <DesktopOutlined style={{ marginRight: 8, color: '#1890ff' }} />
+                    开机自启
                   </Text>
                   <Paragraph type="secondary" style={{ marginBottom: 0 }}>
-                    启用后，应用程序将在 Windows 系统启动时自动运行。此功能会修改 Windows 注册表中的启动项。
+                    启用后，应用程序将在系统启动或用户登录时自动运行。Windows 下会在启动文件夹中创建快捷方式，Linux 下会安装 systemd 用户单元或 XDG 自启动项。
                   </Paragraph>
                 </Space>
               </div>
@@ -414,18 +414,18 @@ const ConfigManagement: React.FC = () => {
 
               {config?.system.registryEnabled !== undefined && (
                 <Alert
-                  message="注册表状态"
+                  message="自启动项状态"
                   description={
                     <Space>
                       {config.system.registryEnabled ? (
                         <>
                           <CheckCircleOutlined style={{ color: '#52c41a' }} />
-                          <Text>Windows 注册表启动项已配置</Text>
+                          <Text>自启动项已配置</Text>
                         </>
                       ) : (
                         <>
                           <WarningOutlined style={{ color: '#faad14' }} />
-                          <Text>Windows 注册表启动项未配置</Text>
+                          <Text>自启动项未配置</Text>
                         </>
                       )}
                     </Space>
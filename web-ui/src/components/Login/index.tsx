@@ -0,0 +1,183 @@
+import React, { useState } from 'react';
+import { Card, Form, Input, Button, Typography, Alert, Checkbox } from 'antd';
+import { UserOutlined, LockOutlined, ApiOutlined, SafetyCertificateOutlined } from '@ant-design/icons';
+import { login, setupAdmin, verifyLogin } from '../../api/session';
+import type { LoginRequest, LoginResponse } from '../../types/session';
+
+const { Title, Text } = Typography;
+
+interface LoginProps {
+  setupRequired: boolean;
+  onLoggedIn: (session: LoginResponse) => void;
+}
+
+interface LoginFormValues extends LoginRequest {
+  confirm?: string;
+}
+
+interface VerifyFormValues {
+  code: string;
+  rememberDevice: boolean;
+}
+
+const errorMessage = (err: unknown, fallback: string) => {
+  const response = (err as { response?: { data?: string } }).response;
+  return typeof response?.data === 'string' ? response.data : fallback;
+};
+
+const Login: React.FC<LoginProps> = ({ setupRequired, onLoggedIn }) => {
+  const [loading, setLoading] = useState(false);
+  const [error, setError] = useState('');
+  // Set while the login waits for the TOTP code
+  const [challenge, setChallenge] = useState('');
+  const [useRecoveryCode, setUseRecoveryCode] = useState(false);
+
+  const handleSubmit = async (values: LoginFormValues) => {
+    setLoading(true);
+    setError('');
+    try {
+      const request = { username: values.username, password: values.password };
+      if (setupRequired) {
+        const response = await setupAdmin(request);
+        onLoggedIn(response.data);
+        return;
+      }
+      const response = await login(request);
+      if ('totpRequired' in response.data) {
+        setChallenge(response.data.challenge);
+      } else {
+        onLoggedIn(response.data);
+      }
+    } catch (err: unknown) {
+      setError(errorMessage(err, '登录失败'));
+    } finally {
+      setLoading(false);
+    }
+  };
+
+  const handleVerify = async (values: VerifyFormValues) => {
+    setLoading(true);
+    setError('');
+    try {
+      const response = await verifyLogin({
+        challenge,
+        rememberDevice: values.rememberDevice,
+        ...(useRecoveryCode ? { recoveryCode: values.code } : { code: values.code }),
+      });
+      onLoggedIn(response.data);
+    } catch (err: unknown) {
+      const status = (err as { response?: { status?: number } }).response?.status;
+      setError(errorMessage(err, '验证失败'));
+      // Too many wrong codes or expired: start over with the password
+      if (status === 401 && errorMessage(err, '').startsWith('Login expired')) {
+        setChallenge('');
+      }
+    } finally {
+      setLoading(false);
+    }
+  };
+
+  return (
+    <div style={{
+      minHeight: '100vh',
+      display: 'flex',
+      alignItems: 'center',
+      justifyContent: 'center',
+      background: '#f0f2f5',
+    }}>
+      <Card style={{ width: 380 }}>
+        <div style={{ textAlign: 'center', marginBottom: 24 }}>
+          <ApiOutlined style={{ fontSize: 40, color: '#1890ff' }} />
+          <Title level={3} style={{ marginTop: 12, marginBottom: 4 }}>
+            Go Proxy Server
+          </Title>
+          <Text type="secondary">
+            {setupRequired ? '首次使用,请创建管理员账户' : challenge ? '请输入两步验证码' : '请登录管理后台'}
+          </Text>
+        </div>
+        {error && <Alert type="error" message={error} showIcon style={{ marginBottom: 16 }} />}
+        {challenge ? (
+          <Form<VerifyFormValues>
+            key={useRecoveryCode ? 'recovery' : 'totp'}
+            layout="vertical"
+            onFinish={handleVerify}
+            autoComplete="off"
+            initialValues={{ rememberDevice: false }}
+          >
+            <Form.Item
+              name="code"
+              rules={[{ required: true, message: useRecoveryCode ? '请输入恢复码' : '请输入验证码' }]}
+            >
+              <Input
+                prefix={<SafetyCertificateOutlined />}
+                placeholder={useRecoveryCode ? '恢复码 (xxxxx-xxxxx)' : '身份验证器中的 6 位验证码'}
+                autoComplete="one-time-code"
+                inputMode={useRecoveryCode ? 'text' : 'numeric'}
+                autoFocus
+              />
+            </Form.Item>
+            <Form.Item name="rememberDevice" valuePropName="checked">
+              <Checkbox>30 天内在此浏览器上无需验证码</Checkbox>
+            </Form.Item>
+            <Form.Item style={{ marginBottom: 8 }}>
+              <Button type="primary" htmlType="submit" loading={loading} block>
+                验证
+              </Button>
+            </Form.Item>
+            <Button type="link" block onClick={() => { setUseRecoveryCode(!useRecoveryCode); setError(''); }}>
+              {useRecoveryCode ? '使用身份验证器验证码' : '无法使用身份验证器? 使用恢复码'}
+            </Button>
+            <Button type="link" block onClick={() => { setChallenge(''); setUseRecoveryCode(false); setError(''); }}>
+              返回
+            </Button>
+          </Form>
+        ) : (
+          <Form<LoginFormValues> layout="vertical" onFinish={handleSubmit} autoComplete="off">
+            <Form.Item name="username" rules={[{ required: true, message: '请输入用户名' }]}>
+              <Input prefix={<UserOutlined />} placeholder="管理员用户名" autoComplete="username" />
+            </Form.Item>
+            <Form.Item
+              name="password"
+              rules={[
+                { required: true, message: '请输入密码' },
+                ...(setupRequired ? [{ min: 10, message: '密码至少 10 个字符,需包含字母和数字' }] : []),
+              ]}
+            >
+              <Input.Password
+                prefix={<LockOutlined />}
+                placeholder="密码"
+                autoComplete={setupRequired ? 'new-password' : 'current-password'}
+              />
+            </Form.Item>
+            {setupRequired && (
+              <Form.Item
+                name="confirm"
+                dependencies={['password']}
+                rules={[
+                  { required: true, message: '请再次输入密码' },
+                  ({ getFieldValue }) => ({
+                    validator(_, value) {
+                      if (!value || getFieldValue('password') === value) {
+                        return Promise.resolve();
+                      }
+                      return Promise.reject(new Error('两次输入的密码不一致'));
+                    },
+                  }),
+                ]}
+              >
+                <Input.Password prefix={<LockOutlined />} placeholder="确认密码" autoComplete="new-password" />
+              </Form.Item>
+            )}
+            <Form.Item style={{ marginBottom: 0 }}>
+              <Button type="primary" htmlType="submit" loading={loading} block>
+                {setupRequired ? '创建并登录' : '登录'}
+              </Button>
+            </Form.Item>
+          </Form>
+        )}
+      </Card>
+    </div>
+  );
+};
+
+export default Login;
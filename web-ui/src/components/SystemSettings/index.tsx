@@ -1,6 +1,6 @@
 import React, { useState, useEffect } from 'react';
 import { Card, Form, Switch, Button, Alert, message, Typography, Space, Row, Col } from 'antd';
-import { SettingOutlined, SaveOutlined, WindowsOutlined, CheckCircleOutlined, WarningOutlined } from '@ant-design/icons';
+import { SettingOutlined, SaveOutlined, DesktopOutlined, CheckCircleOutlined, WarningOutlined } from '@ant-design/icons';
 import { getSystemSettings, saveSystemSettings } from '../../api/system';
 import type { SystemSettings as SystemSettingsType } from '../../types/api';
 
@@ -62,10 +62,10 @@ const SystemSettings: React.FC = () => {
             {!settings?.autostartSupported && (
               <Alert
                 message="平台限制"
-                description="开机自启功能仅在 Windows 平台可用，当前平台不支持此功能。"
+                description="开机自启功能仅在 Windows 和 Linux 平台可用，当前平台不支持此功能。"
                 type="info"
                 showIcon
-                icon={<WindowsOutlined />}
+                icon={<DesktopOutlined />}
                 style={{ marginBottom: 24 }}
               />
             )}
@@ -73,11 +73,11 @@ const SystemSettings: React.FC = () => {
             <div style={{ marginBottom: 24 }}>
               <Space direction="vertical" size="small">
                 <Text strong style={{ fontSize: '16px' }}>
-                  <WindowsOutlined style={{ marginRight: 8, color: '#1890ff' }} />
-                  Windows 开机自启
+                  <DesktopOutlined style={{ marginRight: 8, color: '#1890ff' }} />
+                  开机自启
                 </Text>
                 <Paragraph type="secondary" style={{ marginBottom: 0 }}>
-                  启用后，应用程序将在 Windows 系统启动时自动运行。此功能会修改 Windows 注册表中的启动项。
+                  启用后，应用程序将在系统启动或用户登录时自动运行。Windows 下会在启动文件夹中创建快捷方式，Linux 下会安装 systemd 用户单元或 XDG 自启动项。
                 </Paragraph>
               </Space>
             </div>
@@ -122,18 +122,18 @@ const SystemSettings: React.FC = () => {
 
               {settings?.registryEnabled !== undefined && (
                 <Alert
-                  message="注册表状态"
+                  message="自启动项状态"
                   description={
                     <Space>
                       {settings.registryEnabled ? (
                         <>
                           <CheckCircleOutlined style={{ color: '#52c41a' }} />
-                          <Text>Windows 注册表启动项已配置</Text>
+                          <Text>自启动项已配置</Text>
                         </>
                       ) : (
                         <>
                           <WarningOutlined style={{ color: '#faad14' }} />
-                          <Text>Windows 注册表启动项未配置</Text>
+                          <Text>自启动项未配置</Text>
                         </>
                       )}
                     </Space>
@@ -0,0 +1,62 @@
+export interface SessionState {
+  authenticated: boolean;
+  setupRequired: boolean;
+  username?: string;
+  csrfToken?: string;
+  expiresAt?: string;
+  role?: AdminRole;
+  totpEnrollmentRequired?: boolean;
+}
+
+export type AdminRole = 'viewer' | 'operator' | 'admin';
+
+export interface LoginRequest {
+  username: string;
+  password: string;
+}
+
+export interface LoginResponse {
+  username: string;
+  csrfToken: string;
+  expiresAt: string;
+}
+
+// Returned by /login instead of a session when a TOTP code is needed
+export interface TOTPChallenge {
+  totpRequired: true;
+  challenge: string;
+}
+
+export type LoginResult = LoginResponse | TOTPChallenge;
+
+export interface LoginVerifyRequest {
+  challenge: string;
+  code?: string;
+  recoveryCode?: string;
+  rememberDevice?: boolean;
+}
+
+export interface TrustedDevice {
+  id: number;
+  clientIP: string;
+  userAgent: string;
+  createdAt: string;
+  expiresAt: string;
+  lastUsedAt: string;
+}
+
+export interface TOTPStatus {
+  enabled: boolean;
+  required: boolean;
+  recoveryCodesRemaining: number;
+  trustedDevices: TrustedDevice[];
+}
+
+export interface TOTPEnrollment {
+  secret: string;
+  uri: string;
+}
+
+export interface RecoveryCodes {
+  recoveryCodes: string[];
+}